@@ -12,6 +12,7 @@ import (
 	"github.com/gambruh/simplevault/internal/clientfunc"
 	"github.com/gambruh/simplevault/internal/compileinfo"
 	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/securebuf"
 )
 
 var (
@@ -29,6 +30,7 @@ func main() {
 
 	//Init new client
 	client := clientfunc.NewClient(cfg)
+	client.Version = compileinfo.Version(buildVersion, buildCommit)
 
 	// creating context for graceful shutdown
 	ctxShutdown, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
@@ -38,7 +40,7 @@ func main() {
 	quit := make(chan struct{})
 
 	var wgShutdown sync.WaitGroup
-	wgShutdown.Add(2)
+	wgShutdown.Add(3)
 
 	// Ticker for synchronization
 	syncTime := time.NewTicker(config.ClientCfg.CheckTime)
@@ -60,20 +62,60 @@ func main() {
 		"setbinary":      client.SetBinaryCommand,
 		"getbinary":      client.GetBinaryCommand,
 		"listbinaries":   client.ListBinariesCommand,
+		"share":          client.ShareCommand,
+		"unshare":        client.UnshareCommand,
+		"listshares":     client.ListSharesCommand,
+		"createorg":      client.CreateOrgCommand,
+		"listorgs":       client.ListOrgsCommand,
+		"addmember":      client.AddMemberCommand,
+		"removemember":   client.RemoveMemberCommand,
+		"listmembers":    client.ListMembersCommand,
+		"recoverykit":    client.RecoveryKitCommand,
+		"recovershares":  client.RecoverSharesCommand,
+		"recoverykey":    client.RecoveryKeyCommand,
+		"recover":        client.RecoverCommand,
+		"enable2fa":      client.Enable2FACommand,
+		"disable2fa":     client.Disable2FACommand,
+		"lock":           client.LockCommand,
+		"unlock":         client.UnlockCommand,
+		"setpin":         client.SetPINCommand,
+		"logout":         client.LogoutCommand,
+		"logoutall":      client.LogoutAllCommand,
+		"changeusername": client.ChangeUsernameCommand,
+		"deleteaccount":  client.DeleteAccountCommand,
+		"bindcert":       client.BindCertCommand,
+		"createapikey":   client.CreateAPIKeyCommand,
+		"listapikeys":    client.ListAPIKeysCommand,
+		"revokeapikey":   client.RevokeAPIKeyCommand,
+		"devices":        client.DevicesCommand,
+		"revokedevice":   client.RevokeDeviceCommand,
+		"addloginkey":    client.AddLoginKeyCommand,
+		"keylogin":       client.KeyLoginCommand,
+		"listloginkeys":  client.ListLoginKeysCommand,
+		"revokeloginkey": client.RevokeLoginKeyCommand,
+		"conflicts":      client.ConflictsCommand,
+		"tag":            client.TagCommand,
 	}
 
 	// goroutine for data synchronization between client and server
 	go client.DataChecker(ctxShutdown, &wgShutdown, syncTime, quit)
 
+	// goroutine locking the client after inactivity
+	go client.AutoLocker(ctxShutdown, &wgShutdown, config.ClientCfg.LockTime, quit)
+
 	// goroutine for command recognition and client responding with actions
 	fmt.Println("Write help to get commands list")
 	go client.ResponseToCommand(ctxShutdown, &wgShutdown, quit, commands)
 
 	wgShutdown.Wait()
-	err := client.CheckAll()
-	if err != nil {
-		log.Println("error in CheckAll function:", err)
+	if !client.IsLocked() {
+		err := client.CheckAll()
+		if err != nil {
+			log.Println("error in CheckAll function:", err)
+		}
 	}
+	client.WipeKeys()
+	securebuf.DestroyAll()
 
 	defer fmt.Println("Client exited!")
 }
@@ -1,29 +1,185 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gambruh/simplevault/internal/auth"
 	"github.com/gambruh/simplevault/internal/config"
 	"github.com/gambruh/simplevault/internal/handlers"
 	"github.com/gambruh/simplevault/internal/storage/database"
+	"github.com/gambruh/simplevault/internal/tlshelpers"
 )
 
 func main() {
 	config.InitFlags()
 	config.SetConfig()
+
+	// admin commands, run instead of the server
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+		return
+	}
+
+	keys, err := auth.LoadKeySet(config.Cfg.JWTAlg, config.Cfg.JWTKeys)
+	if err != nil {
+		log.Fatalln("can't load signing keys:", err)
+	}
+	auth.SetKeys(keys)
+	go keys.RotateEvery(context.Background(), config.Cfg.JWTRotate)
+	go keys.ReloadEvery(context.Background(), config.Cfg.JWTReload)
+
 	authstorage := auth.GetAuthDB()
 	defstorage := database.GetDB()
 
 	service := handlers.NewService(defstorage, authstorage)
 
+	tlsconfig := &tls.Config{}
+	if config.Cfg.ClientCA != "" {
+		if config.Cfg.CertAuth != auth.CertAuthLogin && config.Cfg.CertAuth != auth.CertAuthSecondFactor {
+			log.Fatalln("unknown client certificate authentication mode:", config.Cfg.CertAuth)
+		}
+		if config.Cfg.CertMapping != auth.CertMappingSubject && config.Cfg.CertMapping != auth.CertMappingFingerprint {
+			log.Fatalln("unknown client certificate mapping:", config.Cfg.CertMapping)
+		}
+		// certificates are optional when they can replace the password, so users may still login with it
+		tlsconfig, err = tlshelpers.ClientAuthConfig(config.Cfg.ClientCA, config.Cfg.CertAuth == auth.CertAuthSecondFactor)
+		if err != nil {
+			log.Fatalln("can't set client certificates verification:", err)
+		}
+	}
+
 	server := &http.Server{
 		Addr:      config.Cfg.Address,
 		Handler:   service.Service(),
-		TLSConfig: &tls.Config{},
+		TLSConfig: tlsconfig,
 	}
 
 	log.Println(server.ListenAndServeTLS("cert.pem", "privatekey.pem"))
 }
+
+// runCommand runs an admin command against the database
+func runCommand(args []string) {
+	switch args[0] {
+	case "unlock":
+		if len(args) != 2 {
+			log.Fatalln("usage: simplevault-server unlock <login>")
+		}
+		authstorage := auth.GetAuthDB()
+		if err := authstorage.ResetLoginFailures(context.Background(), args[1]); err != nil {
+			log.Fatalln("can't unlock account:", err)
+		}
+		fmt.Println("account", args[1], "is unlocked")
+	case "bindcert":
+		if len(args) != 3 {
+			log.Fatalln("usage: simplevault-server bindcert <login> <certificate.pem>")
+		}
+		id, err := certFileID(args[2], config.Cfg.CertMapping)
+		if err != nil {
+			log.Fatalln("can't read certificate:", err)
+		}
+		authstorage := auth.GetAuthDB()
+		if err := authstorage.BindCertificate(context.Background(), args[1], id); err != nil {
+			log.Fatalln("can't bind certificate:", err)
+		}
+		fmt.Println("certificate is bound to", args[1])
+	case "migrate":
+		runMigrate(args[1:])
+	default:
+		log.Fatalln("unknown command:", args[0])
+	}
+}
+
+// runMigrate applies, reverts or lists schema migrations. The server applies pending ones on start,
+// down is run before going back to an older version of the server
+func runMigrate(args []string) {
+	const usage = "usage: simplevault-server migrate up|down [steps]|status"
+	if len(args) == 0 {
+		log.Fatalln(usage)
+	}
+
+	db, dialect, err := database.Open(config.Cfg.Storage, config.Cfg.Database)
+	if err != nil {
+		log.Fatalln("can't open database:", err)
+	}
+	defer db.Close()
+	migrator, err := database.NewMigrator(db, dialect)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatalln("can't migrate up:", err)
+		}
+		for _, m := range applied {
+			fmt.Println("applied", m)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalln(usage)
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			log.Fatalln("can't migrate down:", err)
+		}
+		for _, m := range reverted {
+			fmt.Println("reverted", m)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+	case args[0] == "status" && len(args) == 1:
+		status, err := migrator.Status()
+		if err != nil {
+			log.Fatalln("can't get migrations status:", err)
+		}
+		for _, s := range status {
+			switch {
+			case s.Unknown:
+				fmt.Printf("%-24s applied %s by a newer version\n", s, s.AppliedAt.Format(time.RFC3339))
+			case s.AppliedAt.IsZero():
+				fmt.Printf("%-24s pending\n", s)
+			default:
+				fmt.Printf("%-24s applied %s\n", s, s.AppliedAt.Format(time.RFC3339))
+			}
+		}
+	default:
+		log.Fatalln(usage)
+	}
+}
+
+// certFileID returns the ID a PEM-encoded client certificate is bound to an account by
+func certFileID(file string, mapping string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", errors.New("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	return auth.CertID(cert, mapping)
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+// AccountData is a request to change the username or delete the account, confirmed by SRP proof of the password.
+// Login is the new username, VaultKey is the vault key wrapped by the key derived from the new username
+type AccountData struct {
+	Login     string `json:"login,omitempty"`
+	Handshake string `json:"handshake"`
+	Proof     string `json:"proof"`
+	VaultKey  string `json:"vaultkey,omitempty"`
+}
+
+// ChangeUsername renames the account and saves its vault key wrapped for the new username.
+// Sessions, items and keys are bound to the account ID, so they stay with the account
+func (s *AuthDB) ChangeUsername(ctx context.Context, login string, newLogin string, vaultKey string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in ChangeUsername:%w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, changeUsernameQuery, login, newLogin)
+	if err != nil {
+		if database.IsUniqueConstraintViolation(err) {
+			return ErrUsernameIsTaken
+		}
+		return fmt.Errorf("error in ChangeUsername:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := tx.ExecContext(ctx, setVaultKeyQuery, newLogin, VaultKeyPassword, vaultKey); err != nil {
+		return fmt.Errorf("error updating vault key in ChangeUsername:%w", err)
+	}
+	// failures are counted by login, the new one may have been tried before it was taken
+	for _, name := range []string{login, newLogin} {
+		if _, err := tx.ExecContext(ctx, resetLoginFailuresQuery, name); err != nil {
+			return fmt.Errorf("error in ChangeUsername:%w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteAccount deletes the user. Everything of the user is deleted along by the foreign keys
+func (s *AuthDB) DeleteAccount(ctx context.Context, login string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in DeleteAccount:%w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, deleteUserQuery, login)
+	if err != nil {
+		return fmt.Errorf("error in DeleteAccount:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	// failures are counted by login for unknown accounts too, so they aren't bound to the user
+	if _, err := tx.ExecContext(ctx, resetLoginFailuresQuery, login); err != nil {
+		return fmt.Errorf("error in DeleteAccount:%w", err)
+	}
+	return tx.Commit()
+}
+
+// ChangeUsername is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) ChangeUsername(ctx context.Context, login string, newLogin string, vaultKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	password, ok := s.Data[login]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if _, taken := s.Data[newLogin]; taken {
+		return ErrUsernameIsTaken
+	}
+	verifier, hasVerifier := s.Verifiers[login]
+	s.moveUserData(login, newLogin)
+	delete(s.Failures, newLogin)
+	s.Data[newLogin] = password
+	if hasVerifier {
+		s.Verifiers[newLogin] = verifier
+	}
+	s.VaultKeys[newLogin+"/"+VaultKeyPassword] = vaultKey
+	return nil
+}
+
+// DeleteAccount is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) DeleteAccount(ctx context.Context, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	s.moveUserData(login, "")
+	return nil
+}
+
+// moveUserData moves everything of the user to the new login, or deletes it if the new login is empty
+func (s *AuthMemStorage) moveUserData(login string, newLogin string) {
+	delete(s.Data, login)
+	delete(s.Verifiers, login)
+	delete(s.Failures, login)
+	moveKey := func(key string) (string, bool) {
+		rest, ok := strings.CutPrefix(key, login+"/")
+		if !ok {
+			return "", false
+		}
+		return newLogin + "/" + rest, true
+	}
+
+	if recovery, ok := s.Recovery[login]; ok {
+		delete(s.Recovery, login)
+		if newLogin != "" {
+			s.Recovery[newLogin] = recovery
+		}
+	}
+	if totp, ok := s.TOTP[login]; ok {
+		delete(s.TOTP, login)
+		if newLogin != "" {
+			s.TOTP[newLogin] = totp
+		}
+	}
+	for key, wrapped := range s.VaultKeys {
+		if moved, ok := moveKey(key); ok {
+			delete(s.VaultKeys, key)
+			if newLogin != "" {
+				s.VaultKeys[moved] = wrapped
+			}
+		}
+	}
+	for key, device := range s.Devices {
+		if moved, ok := moveKey(key); ok {
+			delete(s.Devices, key)
+			if newLogin != "" {
+				s.Devices[moved] = device
+			}
+		}
+	}
+	for id, session := range s.Sessions {
+		if session.Login == login {
+			session.Login = newLogin
+			s.Sessions[id] = session
+			if newLogin == "" {
+				delete(s.Sessions, id)
+			}
+		}
+	}
+	for id, owner := range s.Certs {
+		if owner == login {
+			s.Certs[id] = newLogin
+			if newLogin == "" {
+				delete(s.Certs, id)
+			}
+		}
+	}
+	for id, key := range s.APIKeys {
+		if key.Login == login {
+			key.Login = newLogin
+			s.APIKeys[id] = key
+			if newLogin == "" {
+				delete(s.APIKeys, id)
+			}
+		}
+	}
+	for id, key := range s.LoginKeys {
+		if key.Login == login {
+			key.Login = newLogin
+			s.LoginKeys[id] = key
+			if newLogin == "" {
+				delete(s.LoginKeys, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+)
+
+func TestChangeUsername(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	// legacy account with a password hash
+	hash, err := argon2id.CreateHash("password", argon2id.DefaultParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Data["user"] = hash
+	s.Data["taken"] = hash
+	s.SetVaultKey(ctx, "user", VaultKeyPassword, "old")
+	s.SetVaultKey(ctx, "user", VaultKeyRecovery, "recovery")
+
+	_, refresh, err := NewSession(ctx, s, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ChangeUsername(ctx, "user", "taken", "new"); err != ErrUsernameIsTaken {
+		t.Errorf("taken username: got %v", err)
+	}
+	if err := s.ChangeUsername(ctx, "user", "renamed", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.VerifyCredentials(ctx, "renamed", "password"); err != nil {
+		t.Errorf("credentials of renamed user: %v", err)
+	}
+	if err := s.VerifyCredentials(ctx, "user", "password"); err == nil {
+		t.Error("old username still logs in")
+	}
+	if key, _ := s.GetVaultKey(ctx, "renamed", VaultKeyPassword); key != "new" {
+		t.Errorf("password vault key = %q, want new", key)
+	}
+	if key, _ := s.GetVaultKey(ctx, "renamed", VaultKeyRecovery); key != "recovery" {
+		t.Errorf("recovery vault key = %q, want recovery", key)
+	}
+
+	// the session goes on under the new username
+	access, _, err := RefreshSession(ctx, s, refresh)
+	if err != nil {
+		t.Fatalf("refreshing session of renamed user: %v", err)
+	}
+	if access == "" {
+		t.Error("no access token")
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+	s.SetVaultKey(ctx, "user", VaultKeyPassword, "key")
+
+	_, refresh, err := NewSession(ctx, s, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewAPIKey(ctx, s, "user", "ci", APIKeyScope{}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteAccount(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAccount(ctx, "user"); err != ErrUserNotFound {
+		t.Errorf("deleting deleted user: got %v", err)
+	}
+	if _, err := s.GetVaultKey(ctx, "user", VaultKeyPassword); err != ErrVaultKeyNotFound {
+		t.Errorf("vault key of deleted user: got %v", err)
+	}
+	if keys, _ := s.ListAPIKeys(ctx, "user"); len(keys) != 0 {
+		t.Errorf("API keys of deleted user: %v", keys)
+	}
+	if _, _, err := RefreshSession(ctx, s, refresh); err == nil {
+		t.Error("session of deleted user is refreshed")
+	}
+
+	// the username is free again
+	if err := s.Register(ctx, "user", SRPVerifier{Salt: "salt", Verifier: "verifier"}); err != nil {
+		t.Errorf("registering deleted username: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+const (
+	// APIKeyPrefix starts every API key, so bearer tokens are told from JWT access tokens
+	APIKeyPrefix = "svk_"
+
+	// last use of a key is saved not more often than this
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyScope limits what an API key can do. Empty lists allow everything.
+// Orgs work as folders: a key limited to organizations can't touch the personal vault
+type APIKeyScope struct {
+	ReadOnly bool     `json:"readonly,omitempty"`
+	Kinds    []string `json:"kinds,omitempty"`
+	Orgs     []string `json:"orgs,omitempty"`
+}
+
+// APIKey is a long-lived token of a user for scripts. The secret part is stored as a hash
+type APIKey struct {
+	ID         string      `json:"id"`
+	Login      string      `json:"-"`
+	Name       string      `json:"name"`
+	Hash       string      `json:"-"`
+	Scope      APIKeyScope `json:"scope"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ExpiresAt  time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt time.Time   `json:"last_used_at,omitempty"`
+}
+
+// APIKeyData is a request to create or revoke an API key. Key is the token of a created key
+type APIKeyData struct {
+	ID    string      `json:"id,omitempty"`
+	Name  string      `json:"name,omitempty"`
+	Scope APIKeyScope `json:"scope"`
+	// TTL is the key lifetime in seconds, zero for a key which doesn't expire
+	TTL int64  `json:"ttl,omitempty"`
+	Key string `json:"key,omitempty"`
+}
+
+// Allows reports whether the scope allows access to items of the kind in the organization vault.
+// Empty org is the personal vault, empty kind means the route isn't bound to a kind
+func (sc APIKeyScope) Allows(kind string, org string, write bool) bool {
+	if write && sc.ReadOnly {
+		return false
+	}
+	if kind != "" && len(sc.Kinds) > 0 && !contains(sc.Kinds, kind) {
+		return false
+	}
+	if len(sc.Orgs) > 0 && !contains(sc.Orgs, org) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAPIKey creates an API key of the user and returns it with the token, which is shown only once.
+// Zero ttl means the key doesn't expire
+func NewAPIKey(ctx context.Context, s AuthStorage, login string, name string, scope APIKeyScope, ttl time.Duration) (APIKey, string, error) {
+	id, err := randomToken(12)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	key := APIKey{
+		ID:        id,
+		Login:     login,
+		Name:      name,
+		Hash:      hashRefreshSecret(secret),
+		Scope:     scope,
+		CreatedAt: time.Now().UTC(),
+	}
+	if ttl > 0 {
+		key.ExpiresAt = key.CreatedAt.Add(ttl)
+	}
+	if err := s.CreateAPIKey(ctx, key); err != nil {
+		return APIKey{}, "", err
+	}
+	return key, APIKeyPrefix + id + "." + secret, nil
+}
+
+// CheckAPIKey returns the API key of the token if it is valid, and saves its last use
+func CheckAPIKey(ctx context.Context, s AuthStorage, token string) (APIKey, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, APIKeyPrefix), ".")
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	key, err := s.GetAPIKey(ctx, id)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashRefreshSecret(secret))) != 1 {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	now := time.Now().UTC()
+	if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+		return APIKey{}, ErrAPIKeyExpired
+	}
+	if now.Sub(key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.TouchAPIKey(ctx, id, now); err != nil {
+			log.Println("error when saving API key last use:", err)
+		}
+	}
+	return key, nil
+}
+
+// ScopeFromContext returns the scope of the API key the request is authenticated with.
+// ok is false for requests authenticated with a session
+func ScopeFromContext(ctx context.Context) (scope APIKeyScope, ok bool) {
+	scope, ok = ctx.Value(config.UserID("apikey")).(APIKeyScope)
+	return scope, ok
+}
+
+// RequireScope lets API key requests through only if the key scope allows the kind in the personal vault
+func RequireScope(kind string, write bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scope, ok := ScopeFromContext(r.Context()); ok && !scope.Allows(kind, "", write) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnly refuses requests authenticated with API keys
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ScopeFromContext(r.Context()); ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateAPIKey saves a new API key
+func (s *AuthDB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	scope, err := json.Marshal(key.Scope)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, createAPIKeyQuery, key.ID, key.Login, key.Name, key.Hash, string(scope), key.CreatedAt, nullTime(key.ExpiresAt))
+	if err != nil {
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in CreateAPIKey:%w", err)
+	}
+	return nil
+}
+
+// GetAPIKey returns the API key by ID
+func (s *AuthDB) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, getAPIKeyQuery, id))
+	switch err {
+	case nil:
+		return key, nil
+	case sql.ErrNoRows:
+		return APIKey{}, ErrAPIKeyNotFound
+	default:
+		return APIKey{}, fmt.Errorf("error in GetAPIKey:%w", err)
+	}
+}
+
+// ListAPIKeys returns API keys of the user
+func (s *AuthDB) ListAPIKeys(ctx context.Context, login string) ([]APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, listAPIKeysQuery, login)
+	if err != nil {
+		return nil, fmt.Errorf("error in ListAPIKeys:%w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error in ListAPIKeys:%w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey deletes the API key of the user
+func (s *AuthDB) RevokeAPIKey(ctx context.Context, login string, id string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, revokeAPIKeyQuery, id, login)
+	if err != nil {
+		return fmt.Errorf("error in RevokeAPIKey:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey saves the time of the last use of the API key
+func (s *AuthDB) TouchAPIKey(ctx context.Context, id string, used time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, touchAPIKeyQuery, id, used); err != nil {
+		return fmt.Errorf("error in TouchAPIKey:%w", err)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scope string
+	var expires, used sql.NullTime
+	err := row.Scan(&key.ID, &key.Login, &key.Name, &key.Hash, &scope, &key.CreatedAt, &expires, &used)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(scope), &key.Scope); err != nil {
+		return APIKey{}, err
+	}
+	key.ExpiresAt, key.LastUsedAt = expires.Time, used.Time
+	return key, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (s *AuthMemStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[key.Login]; !ok {
+		return ErrUserNotFound
+	}
+	s.APIKeys[key.ID] = key
+	return nil
+}
+
+func (s *AuthMemStorage) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.APIKeys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *AuthMemStorage) ListAPIKeys(ctx context.Context, login string) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []APIKey
+	for _, key := range s.APIKeys {
+		if key.Login == login {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (s *AuthMemStorage) RevokeAPIKey(ctx context.Context, login string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.APIKeys[id]
+	if !ok || key.Login != login {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.APIKeys, id)
+	return nil
+}
+
+func (s *AuthMemStorage) TouchAPIKey(ctx context.Context, id string, used time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.APIKeys[id]; ok {
+		key.LastUsedAt = used
+		s.APIKeys[id] = key
+	}
+	return nil
+}
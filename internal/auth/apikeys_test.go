@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAPIKeyScopeAllows(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope APIKeyScope
+		kind  string
+		org   string
+		write bool
+		want  bool
+	}{
+		{"empty scope", APIKeyScope{}, "card", "", true, true},
+		{"readonly read", APIKeyScope{ReadOnly: true}, "card", "", false, true},
+		{"readonly write", APIKeyScope{ReadOnly: true}, "card", "", true, false},
+		{"allowed kind", APIKeyScope{Kinds: []string{"card", "note"}}, "note", "", true, true},
+		{"other kind", APIKeyScope{Kinds: []string{"card"}}, "note", "", false, false},
+		{"allowed org", APIKeyScope{Orgs: []string{"team"}}, "card", "team", false, true},
+		{"personal vault of org key", APIKeyScope{Orgs: []string{"team"}}, "card", "", false, false},
+		{"other org", APIKeyScope{Orgs: []string{"team"}}, "card", "other", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Allows(tt.kind, tt.org, tt.write); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAPIKey(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+
+	key, token, err := NewAPIKey(ctx, s, "user", "ci", APIKeyScope{ReadOnly: true}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked, err := CheckAPIKey(ctx, s, token)
+	if err != nil {
+		t.Fatalf("CheckAPIKey(ctx, ) error = %v", err)
+	}
+	if checked.Login != "user" || !checked.Scope.ReadOnly {
+		t.Errorf("CheckAPIKey(ctx, ) = %+v", checked)
+	}
+	if used, _ := s.GetAPIKey(ctx, key.ID); used.LastUsedAt.IsZero() {
+		t.Error("last use is not saved")
+	}
+
+	if _, err := CheckAPIKey(ctx, s, APIKeyPrefix+key.ID+".wrong"); err != ErrAPIKeyNotFound {
+		t.Errorf("wrong secret: got %v", err)
+	}
+
+	_, expired, err := NewAPIKey(ctx, s, "user", "old", APIKeyScope{}, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := CheckAPIKey(ctx, s, expired); err != ErrAPIKeyExpired {
+		t.Errorf("expired key: got %v", err)
+	}
+
+	if err := s.RevokeAPIKey(ctx, "other", key.ID); err != ErrAPIKeyNotFound {
+		t.Errorf("revoking key of other user: got %v", err)
+	}
+	if err := s.RevokeAPIKey(ctx, "user", key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckAPIKey(ctx, s, token); err != ErrAPIKeyNotFound {
+		t.Errorf("revoked key: got %v", err)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+
+	access, _, err := NewSession(ctx, s, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, readonly, err := NewAPIKey(ctx, s, "user", "ci", APIKeyScope{ReadOnly: true}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("OK")) }
+	r := chi.NewRouter()
+	r.Use(AuthMiddleware(s))
+	r.With(RequireScope("card", false)).Get("/read", ok)
+	r.With(RequireScope("card", true)).Get("/write", ok)
+	r.With(SessionOnly).Get("/session", ok)
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"access token", "/session", access, http.StatusOK},
+		{"API key read", "/read", readonly, http.StatusOK},
+		{"readonly API key write", "/write", readonly, http.StatusForbidden},
+		{"API key on session route", "/session", readonly, http.StatusForbidden},
+		{"unknown API key", "/read", APIKeyPrefix + "unknown.secret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+}
@@ -9,83 +9,197 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexedwards/argon2id"
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage/database"
 )
 
-const (
-	userstablename     = "gk_users"
-	passwordstablename = "gk_passwords"
-)
-
+// LoginData is a login or registration request. Password is sent only by legacy accounts without SRP verifier,
+// others prove it with Handshake and Proof. Verifier is sent on registration
 type LoginData struct {
 	Login    string `json:"login"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
+	// SRP handshake ID and the proof of the password
+	Handshake string       `json:"handshake,omitempty"`
+	Proof     string       `json:"proof,omitempty"`
+	Verifier  *SRPVerifier `json:"verifier,omitempty"`
+	// OTP is TOTP or backup code for users with two-factor authentication enabled
+	OTP string `json:"otp,omitempty"`
+	// Device is the client install the user logs in from
+	Device *Device `json:"device,omitempty"`
 }
 
 type AuthStorage interface {
-	Register(login string, password string) error
-	VerifyCredentials(login string, password string) error
+	Register(ctx context.Context, login string, verifier SRPVerifier) error
+	VerifyCredentials(ctx context.Context, login string, password string) error
+	GetVerifier(ctx context.Context, login string) (SRPVerifier, error)
+	SetVerifier(ctx context.Context, login string, verifier SRPVerifier) error
+	SetVaultKey(ctx context.Context, login string, kind string, wrapped string) error
+	GetVaultKey(ctx context.Context, login string, kind string) (string, error)
+	SetRecoveryVerifier(ctx context.Context, login string, token string) error
+	ResetPassword(ctx context.Context, data ResetData) error
+	SetTOTP(ctx context.Context, login string, secret string) error
+	EnableTOTP(ctx context.Context, login string, backupcodes []string) error
+	DisableTOTP(ctx context.Context, login string) error
+	GetTOTP(ctx context.Context, login string) (secret string, enabled bool, err error)
+	UseBackupCode(ctx context.Context, login string, code string) error
+	CreateSession(ctx context.Context, session Session) error
+	GetSession(ctx context.Context, id string) (Session, error)
+	RotateRefreshToken(ctx context.Context, id string, oldHash string, newHash string, expires time.Time) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeAllSessions(ctx context.Context, login string) error
+	GetLoginFailures(ctx context.Context, login string) (LoginFailures, error)
+	AddLoginFailure(ctx context.Context, login string, now time.Time) (LoginFailures, error)
+	ResetLoginFailures(ctx context.Context, login string) error
+	BindCertificate(ctx context.Context, login string, certID string) error
+	GetCertificateLogin(ctx context.Context, certID string) (string, error)
+	ListCertificates(ctx context.Context, login string) ([]string, error)
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+	ListAPIKeys(ctx context.Context, login string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, login string, id string) error
+	TouchAPIKey(ctx context.Context, id string, used time.Time) error
+	SaveDevice(ctx context.Context, login string, device Device) error
+	TouchDevice(ctx context.Context, login string, id string, ip string, seen time.Time) error
+	ListDevices(ctx context.Context, login string) ([]Device, error)
+	RevokeDevice(ctx context.Context, login string, id string) error
+	ChangeUsername(ctx context.Context, login string, newLogin string, vaultKey string) error
+	DeleteAccount(ctx context.Context, login string) error
+	AddLoginKey(ctx context.Context, login string, key LoginKey) error
+	GetLoginKey(ctx context.Context, login string, id string) (LoginKey, error)
+	ListLoginKeys(ctx context.Context, login string) ([]LoginKey, error)
+	DeleteLoginKey(ctx context.Context, login string, id string) error
+	TouchLoginKey(ctx context.Context, id string, used time.Time) error
 }
 
+// AuthMemStorage is the inmemory implementation of AuthStorage, which behaves the same way as AuthDB.
+// Secrets are hashed as in the database
 type AuthMemStorage struct {
-	Data map[string]string
+	// legacy password hashes, empty for accounts with SRP verifier
+	Data      map[string]string
+	Verifiers map[string]SRPVerifier
+	// wrapped vault keys by "login/kind"
+	VaultKeys map[string]string
+	// recovery token hashes
+	Recovery map[string]string
+	TOTP     map[string]memTOTP
+	Sessions map[string]Session
+	Failures map[string]LoginFailures
+	Certs    map[string]string
+	APIKeys  map[string]APIKey
+	// devices by "login/device id"
+	Devices   map[string]Device
+	LoginKeys map[string]LoginKey
+
+	mu sync.Mutex
+}
+
+type memTOTP struct {
+	secret      string
+	enabled     bool
+	backupcodes []string
 }
 
 type AuthDB struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect database.Dialect
+	// queryTimeout is the deadline of each method on top of the caller's context, 0 for none
+	queryTimeout time.Duration
+}
+
+func (s *AuthDB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return database.WithTimeout(ctx, s.queryTimeout)
+}
+
+// SetQueryTimeout sets the deadline of each method on top of the caller's context, 0 for none
+func (s *AuthDB) SetQueryTimeout(d time.Duration) {
+	s.queryTimeout = d
 }
 
 // Authentication errors
 var (
-	ErrUserNotFound     = errors.New("user not found in database")
-	ErrTableDoesntExist = errors.New("table doesn't exist")
-	ErrUsernameIsTaken  = errors.New("username is taken")
-	ErrWrongCredentials = errors.New("wrong login credentials")
-	ErrWrongPassword    = errors.New("wrong password")
+	ErrUserNotFound         = errors.New("user not found in database")
+	ErrUsernameIsTaken      = errors.New("username is taken")
+	ErrWrongCredentials     = errors.New("wrong login credentials")
+	ErrWrongPassword        = errors.New("wrong password")
+	ErrVaultKeyNotFound     = errors.New("vault key not found")
+	ErrWrongRecoveryToken   = errors.New("wrong recovery token")
+	ErrTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrSecondFactorRequired = errors.New("second factor is required")
+	ErrWrongSecondFactor    = errors.New("wrong second factor code")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrSessionRevoked       = errors.New("session is revoked or expired")
+	ErrWrongRefreshToken    = errors.New("wrong refresh token")
+	ErrAPIKeyNotFound       = errors.New("API key not found")
+	ErrAPIKeyExpired        = errors.New("API key is expired")
+	ErrDeviceNotFound       = errors.New("device not found")
+	ErrDeviceRevoked        = errors.New("device is revoked")
 )
 
-// GenerateToken returns a jwt token string. That string will be added to cookies.
-func GenerateToken(login string) (string, error) {
-	// Create a new token object, specifying the signing method and the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": login,
-		"exp":    time.Now().Add(time.Hour * 8).Unix(),
-	})
-
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(config.Cfg.Key))
+// GenerateToken returns a short-lived jwt access token string of the session. That string will be added to cookies.
+// The token is signed with the current key of Keys, its ID is in the kid header
+func GenerateToken(login string, sessionID string) (string, error) {
+	ks, err := Keys()
 	if err != nil {
 		return "", err
 	}
-
-	return tokenString, nil
+	return ks.sign(jwt.MapClaims{
+		"userID": login,
+		"sid":    sessionID,
+		"exp":    time.Now().Add(AccessTokenTTL).Unix(),
+	})
 }
 
 // AuthMiddleware checks cookies attached to http request
-// If not valid then http.StatusUnauthorized will return
+// If not valid, or the session is revoked, then http.StatusUnauthorized will return
 // If valid it will pass the request to the handler
-func AuthMiddleware(next http.Handler) http.Handler {
+func AuthMiddleware(s AuthStorage) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return authMiddleware(s, next)
+	}
+}
+
+func authMiddleware(s AuthStorage, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		type MyCustomClaims struct {
-			UserID string `json:"userID"`
+			UserID    string `json:"userID"`
+			SessionID string `json:"sid"`
 			jwt.RegisteredClaims
 		}
 
-		cookie, err := r.Cookie("simplevault-auth")
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		authorization := r.Header.Get("Authorization")
+		isBearer := strings.HasPrefix(authorization, "Bearer ")
+		bearer := strings.TrimPrefix(authorization, "Bearer ")
+		if isBearer && strings.HasPrefix(bearer, APIKeyPrefix) {
+			apiKeyMiddleware(s, next, w, r, bearer)
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(cookie.Value, &MyCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.Cfg.Key), nil
-		})
+		tokenString := bearer
+		if !isBearer {
+			cookie, err := r.Cookie(AccessCookie)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			tokenString = cookie.Value
+		}
+
+		ks, err := Keys()
+		if err != nil {
+			log.Println("error when getting signing keys:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		token, err := jwt.ParseWithClaims(tokenString, &MyCustomClaims{}, ks.keyfunc,
+			jwt.WithValidMethods([]string{AlgEdDSA, AlgRS256}))
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -98,96 +212,116 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		err = checkSession(r.Context(), s, claims.UserID, claims.SessionID)
+		switch err {
+		case nil:
+		case ErrSessionNotFound, ErrSessionRevoked:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		default:
+			log.Println("error when checking session:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), config.UserID("userID"), claims.UserID)
+		ctx = context.WithValue(ctx, config.UserID("sessionID"), claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// apiKeyMiddleware authenticates the request with the API key and puts its scope into the context
+func apiKeyMiddleware(s AuthStorage, next http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	key, err := CheckAPIKey(r.Context(), s, token)
+	switch err {
+	case nil:
+	case ErrAPIKeyNotFound, ErrAPIKeyExpired:
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	default:
+		log.Println("error when checking API key:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), config.UserID("userID"), key.Login)
+	ctx = context.WithValue(ctx, config.UserID("apikey"), key.Scope)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // NewAuthDB returns connection to authDB
 func NewAuthDB(postgresStr string) *AuthDB {
-	db, _ := sql.Open("postgres", postgresStr)
+	db, _ := sql.Open("pgx", postgresStr)
 	return &AuthDB{
-		db: db,
+		db:      db,
+		dialect: database.Postgres,
+	}
+}
+
+// OpenAuthDB opens the auth database and creates its tables, see database.Open for the arguments
+func OpenAuthDB(storage string, postgresStr string) (*AuthDB, error) {
+	conn, dialect, err := database.Open(storage, postgresStr)
+	if err != nil {
+		return nil, err
+	}
+	db := &AuthDB{db: conn, dialect: dialect}
+	if err := db.InitAuthDB(); err != nil {
+		return nil, err
 	}
+	return db, nil
 }
 
 // GetAuthDB returns new auth storage
 func GetAuthDB() (authstorage AuthStorage) {
 
-	db := NewAuthDB(config.Cfg.Database)
-	db.InitAuthDB()
+	db, err := OpenAuthDB(config.Cfg.Storage, config.Cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db.SetQueryTimeout(config.Cfg.QueryTimeout)
 	authstorage = db
 
 	return authstorage
 }
 
-// CheckTableExists is a helper function to check if there is already a table with specifed name in a database
-func (s *AuthDB) CheckTableExists(tablename string) error {
-	var check bool
-
-	err := s.db.QueryRow(checkTableExistsQuery, tablename).Scan(&check)
-	if err != nil {
-		log.Printf("error checking if table exists: %v", err)
-		return err
-	}
-	if !check {
-		return ErrTableDoesntExist
-	}
-	return nil
-}
-
-// InitAuthDB creates tables in a fresh database.
+// InitAuthDB applies pending migrations, so a fresh database gets all the tables
 func (s *AuthDB) InitAuthDB() error {
-	err := s.CreateUsersTable()
+	migrator, err := database.NewMigrator(s.db, s.dialect)
 	if err != nil {
 		return err
 	}
-	err = s.CreatePasswordsTable()
-	if err != nil {
-		return err
+	if _, err := migrator.Up(); err != nil {
+		return fmt.Errorf("error migrating auth database:%w", err)
 	}
 	return nil
 }
 
-// CreateUsersTable creates table "users"
-func (s *AuthDB) CreateUsersTable() error {
-	err := s.CheckTableExists(userstablename)
-	if err == ErrTableDoesntExist {
-		_, err := s.db.Exec(createUsersTableQuery)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
+// Register attempts to save login and SRP verifier of the password in a database
+// returns error in case if the login is already exists in the database
+func (s *AuthDB) Register(ctx context.Context, login string, verifier SRPVerifier) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-// CreatePasswordsTable creates table "passwords"
-func (s *AuthDB) CreatePasswordsTable() error {
-	err := s.CheckTableExists(passwordstablename)
-	if err == ErrTableDoesntExist {
-		_, err = s.db.Exec(createPasswordsTableQuery)
+	var username string
+	e := s.db.QueryRowContext(ctx, CheckUsernameQuery, login).Scan(&username)
+	switch e {
+	case sql.ErrNoRows:
+		tx, err := s.db.BeginTx(ctx, nil)
 		if err != nil {
-			log.Println("error when creating passwords table:", err)
 			return err
 		}
-	}
-	return nil
-}
+		defer tx.Rollback()
 
-// Register attempts to save login and password hash in a database
-// returns error in case if the login is already exists in the database
-func (s *AuthDB) Register(login string, password string) error {
-	var username string
-	hashedpassword, err := argon2id.CreateHash(password, argon2id.DefaultParams)
-	if err != nil {
-		log.Println("error when trying to hash password:", err)
-		return err
-	}
-	e := s.db.QueryRow(CheckUsernameQuery, login).Scan(&username)
-	switch e {
-	case sql.ErrNoRows:
-		_, err := s.db.Exec(AddNewUserQuery, login, hashedpassword)
-		return err
+		if _, err := tx.ExecContext(ctx, AddNewUserQuery, login); err != nil {
+			if database.IsUniqueConstraintViolation(err) {
+				return ErrUsernameIsTaken
+			}
+			return fmt.Errorf("error in Register:%w", err)
+		}
+		if _, err := tx.ExecContext(ctx, setVerifierQuery, login, verifier.Salt, verifier.Verifier); err != nil {
+			return fmt.Errorf("error in Register:%w", err)
+		}
+		return tx.Commit()
 	case nil:
 		return ErrUsernameIsTaken
 	default:
@@ -197,19 +331,23 @@ func (s *AuthDB) Register(login string, password string) error {
 }
 
 // VerifyCredentials compares login and password with existing in the database login and password hash
-// returns error if no coincidence found, or if password hashes didn't match
-func (s *AuthDB) VerifyCredentials(login string, password string) error {
+// returns error if no coincidence found, or if password hashes didn't match.
+// Only legacy accounts have password hashes, others log in with SRP
+func (s *AuthDB) VerifyCredentials(ctx context.Context, login string, password string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	var (
 		id   int
 		pass string
 	)
 
-	err := s.db.QueryRow(CheckUsernameQuery, login).Scan(&id)
+	err := s.db.QueryRowContext(ctx, CheckUsernameQuery, login).Scan(&id)
 	if err != nil {
 		return ErrUserNotFound
 	}
 
-	err = s.db.QueryRow(CheckPasswordQuery, id).Scan(&pass)
+	err = s.db.QueryRowContext(ctx, CheckPasswordQuery, id).Scan(&pass)
 	if err != nil {
 		return ErrWrongPassword
 	}
@@ -227,27 +365,55 @@ func (s *AuthDB) VerifyCredentials(login string, password string) error {
 }
 
 // Register is a method for inmemory implementation of AuthStorage interface
-func (s *AuthMemStorage) Register(login string, password string) error {
+func (s *AuthMemStorage) Register(ctx context.Context, login string, verifier SRPVerifier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	_, contains := s.Data[login]
 	if contains {
 		return ErrUsernameIsTaken
 	}
-	s.Data[login] = password
+	s.Data[login] = ""
+	s.Verifiers[login] = verifier
 	return nil
 }
 
 // VerifyCredentials is a method for inmemory implementation of AuthStorage interface
-func (s AuthMemStorage) VerifyCredentials(login string, password string) error {
-	check, contains := s.Data[login]
-	if contains && check == password {
-		return nil
+func (s *AuthMemStorage) VerifyCredentials(ctx context.Context, login string, password string) error {
+	s.mu.Lock()
+	hash, ok := s.Data[login]
+	s.mu.Unlock()
+	if !ok {
+		return ErrUserNotFound
 	}
-	return ErrWrongPassword
+	if hash == "" {
+		return ErrWrongPassword
+	}
+
+	check, err := argon2id.ComparePasswordAndHash(password, hash)
+	if err != nil {
+		log.Println("error when trying to compare password and hash:", err)
+		return err
+	}
+	if !check {
+		return ErrWrongPassword
+	}
+	return nil
 }
 
 // NewMemStorage returns inmemory implementation of AuthStorage interface
 func NewMemStorage() *AuthMemStorage {
 	return &AuthMemStorage{
-		Data: make(map[string]string),
+		Data:      make(map[string]string),
+		Verifiers: make(map[string]SRPVerifier),
+		VaultKeys: make(map[string]string),
+		Recovery:  make(map[string]string),
+		TOTP:      make(map[string]memTOTP),
+		Sessions:  make(map[string]Session),
+		Failures:  make(map[string]LoginFailures),
+		Certs:     make(map[string]string),
+		APIKeys:   make(map[string]APIKey),
+		Devices:   make(map[string]Device),
+		LoginKeys: make(map[string]LoginKey),
 	}
 }
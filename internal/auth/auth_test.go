@@ -1,11 +1,12 @@
 package auth
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
-	"github.com/gambruh/simplevault/internal/config"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -19,21 +20,30 @@ func (ts *TestService) Service() http.Handler {
 	}
 	// Create a new router, add the AuthMiddleware and the mock handler.
 	r := chi.NewRouter()
-	r.Use(AuthMiddleware)
+	r.Use(AuthMiddleware(ts.Storage))
 	r.Get("/test", handler)
 
 	return r
 }
 func TestAuthMiddleware(t *testing.T) {
-	key := "abcd"
-	config.Cfg.Key = key
+	ctx := context.Background()
 	mockstorage := AuthMemStorage{
 		Data: make(map[string]string),
 	}
 	mockstorage.Data["user123"] = "secretpassword"
 	var mockservice = &(TestService{Storage: &mockstorage})
 
-	token123, err := GenerateToken("user123")
+	token123, _, err := NewSession(ctx, &mockstorage, "user123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, refresh, err := NewSession(ctx, &mockstorage, "user123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedID, _, _ := strings.Cut(refresh, ".")
+	mockstorage.RevokeSession(ctx, revokedID)
+	unknownSession, err := GenerateToken("user123", "unknown")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -59,6 +69,20 @@ func TestAuthMiddleware(t *testing.T) {
 			token:    "mybrainiswashedup",
 			want:     http.StatusUnauthorized,
 		},
+		{
+			name:     "Revoked session",
+			login:    "user123",
+			password: "usualpass",
+			token:    revoked,
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:     "Unknown session",
+			login:    "user123",
+			password: "usualpass",
+			token:    unknownSession,
+			want:     http.StatusUnauthorized,
+		},
 		{
 			name:     "No token",
 			login:    "unknownuser",
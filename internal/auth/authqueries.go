@@ -14,38 +14,294 @@ const CheckPasswordQuery = `
 `
 
 const AddNewUserQuery = `
-	WITH new_user AS (
-		INSERT INTO gk_users (username)
-		VALUES ($1)
-		RETURNING id
-	)
-	INSERT INTO gk_passwords (id, password)
-	VALUES ((SELECT id FROM new_user), $2);
-`
-
-const checkTableExistsQuery = `
-	SELECT EXISTS (
-		SELECT 	1 
-		FROM 	information_schema.tables
-		WHERE 	table_name = $1
-	);
-`
-
-const createUsersTableQuery = `
-	CREATE TABLE gk_users (
-		id SERIAL,
-		username text NOT NULL UNIQUE,
-		PRIMARY KEY (id)
-	);
-`
-
-const createPasswordsTableQuery = `
-	CREATE TABLE gk_passwords (
-		id integer PRIMARY KEY,
-		password TEXT NOT NULL,
-		CONSTRAINT fk_gk_users
-			FOREIGN KEY (id) 
-				REFERENCES gk_users(id)
-				ON DELETE CASCADE
-	);
+	INSERT INTO gk_users (username)
+	VALUES ($1);
+`
+
+const setVaultKeyQuery = `
+	INSERT INTO gk_vaultkeys (user_id, kind, wrapped_key)
+	VALUES ((SELECT id FROM gk_users WHERE username = $1), $2, $3)
+	ON CONFLICT (user_id, kind)
+	DO UPDATE SET wrapped_key = EXCLUDED.wrapped_key;
+`
+
+const getVaultKeyQuery = `
+	SELECT gk_vaultkeys.wrapped_key
+	FROM gk_vaultkeys
+	JOIN gk_users ON gk_vaultkeys.user_id = gk_users.id
+	WHERE gk_users.username = $1 AND gk_vaultkeys.kind = $2;
+`
+
+const setRecoveryVerifierQuery = `
+	INSERT INTO gk_recovery (id, verifier)
+	VALUES ((SELECT id FROM gk_users WHERE username = $1), $2)
+	ON CONFLICT (id)
+	DO UPDATE SET verifier = EXCLUDED.verifier;
+`
+
+const getRecoveryVerifierQuery = `
+	SELECT verifier
+	FROM gk_recovery
+	WHERE id = $1;
+`
+
+const setTOTPQuery = `
+	INSERT INTO gk_totp (id, secret, enabled)
+	VALUES ((SELECT id FROM gk_users WHERE username = $1), $2, FALSE)
+	ON CONFLICT (id)
+	DO UPDATE SET secret = EXCLUDED.secret, enabled = FALSE;
+`
+
+const enableTOTPQuery = `
+	UPDATE gk_totp
+	SET enabled = TRUE
+	WHERE id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const deleteTOTPQuery = `
+	DELETE FROM gk_totp
+	WHERE id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const getTOTPQuery = `
+	SELECT gk_totp.secret, gk_totp.enabled
+	FROM gk_totp
+	JOIN gk_users ON gk_totp.id = gk_users.id
+	WHERE gk_users.username = $1;
+`
+
+const addBackupCodeQuery = `
+	INSERT INTO gk_backup_codes (user_id, code)
+	VALUES ((SELECT id FROM gk_users WHERE username = $1), $2);
+`
+
+const listBackupCodesQuery = `
+	SELECT gk_backup_codes.id, gk_backup_codes.code
+	FROM gk_backup_codes
+	JOIN gk_users ON gk_backup_codes.user_id = gk_users.id
+	WHERE gk_users.username = $1;
+`
+
+const deleteBackupCodeQuery = `
+	DELETE FROM gk_backup_codes
+	WHERE id = $1;
+`
+
+const deleteBackupCodesQuery = `
+	DELETE FROM gk_backup_codes
+	WHERE user_id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const createSessionQuery = `
+	INSERT INTO gk_sessions (id, user_id, refresh_hash, expires_at, device_id)
+	VALUES ($1, (SELECT id FROM gk_users WHERE username = $2), $3, $4, NULLIF($5, ''));
+`
+
+const getSessionQuery = `
+	SELECT gk_users.username, gk_sessions.refresh_hash, gk_sessions.expires_at, gk_sessions.revoked,
+		COALESCE(gk_sessions.device_id, '')
+	FROM gk_sessions
+	JOIN gk_users ON gk_sessions.user_id = gk_users.id
+	WHERE gk_sessions.id = $1;
+`
+
+const rotateRefreshTokenQuery = `
+	UPDATE gk_sessions
+	SET refresh_hash = $3, expires_at = $4
+	WHERE id = $1 AND refresh_hash = $2 AND NOT revoked;
+`
+
+const revokeSessionQuery = `
+	UPDATE gk_sessions
+	SET revoked = TRUE
+	WHERE id = $1;
+`
+
+const revokeAllSessionsQuery = `
+	UPDATE gk_sessions
+	SET revoked = TRUE
+	WHERE user_id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const getLoginFailuresQuery = `
+	SELECT failures, last_failure, locked_until
+	FROM gk_login_failures
+	WHERE login = $1;
+`
+
+const getLoginFailuresForUpdateQuery = `
+	SELECT failures, last_failure, locked_until
+	FROM gk_login_failures
+	WHERE login = $1
+	FOR UPDATE;
+`
+
+const setLoginFailuresQuery = `
+	INSERT INTO gk_login_failures (login, failures, last_failure, locked_until)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (login) DO UPDATE
+	SET failures = EXCLUDED.failures, last_failure = EXCLUDED.last_failure, locked_until = EXCLUDED.locked_until;
+`
+
+const resetLoginFailuresQuery = `
+	DELETE FROM gk_login_failures
+	WHERE login = $1;
+`
+
+const bindCertificateQuery = `
+	INSERT INTO gk_user_certs (cert_id, user_id)
+	VALUES ($1, (SELECT id FROM gk_users WHERE username = $2))
+	ON CONFLICT (cert_id) DO NOTHING;
+`
+
+const getCertificateLoginQuery = `
+	SELECT gk_users.username
+	FROM gk_user_certs
+	JOIN gk_users ON gk_user_certs.user_id = gk_users.id
+	WHERE gk_user_certs.cert_id = $1;
+`
+
+const listCertificatesQuery = `
+	SELECT gk_user_certs.cert_id
+	FROM gk_user_certs
+	JOIN gk_users ON gk_user_certs.user_id = gk_users.id
+	WHERE gk_users.username = $1
+	ORDER BY gk_user_certs.created_at;
+`
+
+const createAPIKeyQuery = `
+	INSERT INTO gk_api_keys (id, user_id, name, key_hash, scope, created_at, expires_at)
+	VALUES ($1, (SELECT id FROM gk_users WHERE username = $2), $3, $4, $5, $6, $7);
+`
+
+const getAPIKeyQuery = `
+	SELECT gk_api_keys.id, gk_users.username, gk_api_keys.name, gk_api_keys.key_hash, gk_api_keys.scope,
+		gk_api_keys.created_at, gk_api_keys.expires_at, gk_api_keys.last_used_at
+	FROM gk_api_keys
+	JOIN gk_users ON gk_api_keys.user_id = gk_users.id
+	WHERE gk_api_keys.id = $1;
+`
+
+const listAPIKeysQuery = `
+	SELECT gk_api_keys.id, gk_users.username, gk_api_keys.name, gk_api_keys.key_hash, gk_api_keys.scope,
+		gk_api_keys.created_at, gk_api_keys.expires_at, gk_api_keys.last_used_at
+	FROM gk_api_keys
+	JOIN gk_users ON gk_api_keys.user_id = gk_users.id
+	WHERE gk_users.username = $1
+	ORDER BY gk_api_keys.created_at;
+`
+
+const revokeAPIKeyQuery = `
+	DELETE FROM gk_api_keys
+	WHERE id = $1 AND user_id = (SELECT id FROM gk_users WHERE username = $2);
+`
+
+const touchAPIKeyQuery = `
+	UPDATE gk_api_keys
+	SET last_used_at = $2
+	WHERE id = $1;
+`
+
+const saveDeviceQuery = `
+	INSERT INTO gk_devices (id, user_id, name, version, ip, first_seen, last_seen)
+	VALUES ($1, (SELECT id FROM gk_users WHERE username = $2), $3, $4, $5, $6, $6)
+	ON CONFLICT (user_id, id)
+	DO UPDATE SET name = EXCLUDED.name, version = EXCLUDED.version, ip = EXCLUDED.ip,
+		last_seen = EXCLUDED.last_seen
+	WHERE gk_devices.revoked = FALSE;
+`
+
+const touchDeviceQuery = `
+	UPDATE gk_devices
+	SET ip = $3, last_seen = $4
+	WHERE id = $2 AND user_id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const listDevicesQuery = `
+	SELECT gk_devices.id, gk_devices.name, gk_devices.version, gk_devices.ip,
+		gk_devices.first_seen, gk_devices.last_seen, gk_devices.revoked
+	FROM gk_devices
+	JOIN gk_users ON gk_devices.user_id = gk_users.id
+	WHERE gk_users.username = $1
+	ORDER BY gk_devices.last_seen DESC;
+`
+
+const revokeDeviceQuery = `
+	UPDATE gk_devices
+	SET revoked = TRUE
+	WHERE id = $2 AND user_id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const revokeDeviceSessionsQuery = `
+	UPDATE gk_sessions
+	SET revoked = TRUE
+	WHERE device_id = $2 AND user_id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const deleteDeviceLoginKeysQuery = `
+	DELETE FROM gk_login_keys
+	WHERE device_id = $2 AND user_id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const changeUsernameQuery = `
+	UPDATE gk_users
+	SET username = $2
+	WHERE username = $1;
+`
+
+const deleteUserQuery = `
+	DELETE FROM gk_users
+	WHERE username = $1;
+`
+
+const getVerifierQuery = `
+	SELECT gk_srp_verifiers.salt, gk_srp_verifiers.verifier
+	FROM gk_users
+	LEFT JOIN gk_srp_verifiers ON gk_srp_verifiers.id = gk_users.id
+	WHERE gk_users.username = $1;
+`
+
+const setVerifierQuery = `
+	INSERT INTO gk_srp_verifiers (id, salt, verifier)
+	SELECT id, $2, $3 FROM gk_users WHERE username = $1
+	ON CONFLICT (id)
+	DO UPDATE SET salt = EXCLUDED.salt, verifier = EXCLUDED.verifier;
+`
+
+const deletePasswordQuery = `
+	DELETE FROM gk_passwords
+	WHERE id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const addLoginKeyQuery = `
+	INSERT INTO gk_login_keys (id, user_id, name, public_key, created_at, device_id)
+	VALUES ($1, (SELECT id FROM gk_users WHERE username = $2), $3, $4, $5, $6);
+`
+
+const getLoginKeyQuery = `
+	SELECT gk_login_keys.id, gk_login_keys.name, gk_login_keys.public_key,
+		gk_login_keys.created_at, gk_login_keys.last_used_at, gk_login_keys.device_id
+	FROM gk_login_keys
+	JOIN gk_users ON gk_login_keys.user_id = gk_users.id
+	WHERE gk_users.username = $1 AND gk_login_keys.id = $2;
+`
+
+const listLoginKeysQuery = `
+	SELECT gk_login_keys.id, gk_login_keys.name, gk_login_keys.public_key,
+		gk_login_keys.created_at, gk_login_keys.last_used_at, gk_login_keys.device_id
+	FROM gk_login_keys
+	JOIN gk_users ON gk_login_keys.user_id = gk_users.id
+	WHERE gk_users.username = $1
+	ORDER BY gk_login_keys.created_at;
+`
+
+const deleteLoginKeyQuery = `
+	DELETE FROM gk_login_keys
+	WHERE id = $2 AND user_id = (SELECT id FROM gk_users WHERE username = $1);
+`
+
+const touchLoginKeyQuery = `
+	UPDATE gk_login_keys
+	SET last_used_at = $2
+	WHERE id = $1;
 `
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+// Client certificate authentication modes
+const (
+	// CertAuthLogin accepts a bound client certificate instead of the password
+	CertAuthLogin = "login"
+	// CertAuthSecondFactor requires a bound client certificate along with the password
+	CertAuthSecondFactor = "2fa"
+)
+
+// Ways to map a client certificate to an account.
+// Subject mapping survives certificate renewal, fingerprint mapping binds one exact certificate
+const (
+	CertMappingSubject     = "subject"
+	CertMappingFingerprint = "fingerprint"
+)
+
+// Client certificate errors
+var (
+	ErrNoClientCert        = errors.New("no verified client certificate")
+	ErrCertificateNotFound = errors.New("client certificate is not bound to any account")
+	ErrCertificateIsTaken  = errors.New("client certificate is bound to another account")
+	ErrWrongCertificate    = errors.New("client certificate doesn't belong to the account")
+	ErrUnknownCertMapping  = errors.New("unknown client certificate mapping")
+)
+
+// VerifiedCert returns the client certificate of the request, verified against the client CA
+func VerifiedCert(r *http.Request) (*x509.Certificate, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoClientCert
+	}
+	return r.TLS.VerifiedChains[0][0], nil
+}
+
+// CertID returns the ID the certificate is bound to an account by
+func CertID(cert *x509.Certificate, mapping string) (string, error) {
+	switch mapping {
+	case CertMappingSubject:
+		return "subject:" + cert.Subject.String(), nil
+	case CertMappingFingerprint:
+		sum := sha256.Sum256(cert.Raw)
+		return "sha256:" + hex.EncodeToString(sum[:]), nil
+	default:
+		return "", ErrUnknownCertMapping
+	}
+}
+
+// CertLogin returns the login of the account the verified client certificate is bound to
+func CertLogin(s AuthStorage, r *http.Request, mapping string) (string, error) {
+	cert, err := VerifiedCert(r)
+	if err != nil {
+		return "", err
+	}
+	id, err := CertID(cert, mapping)
+	if err != nil {
+		return "", err
+	}
+	return s.GetCertificateLogin(r.Context(), id)
+}
+
+// CheckClientCert checks that the verified client certificate is bound to the account.
+// With autoBind an account without any certificate gets bound the first one issued to its login as common name,
+// otherwise certificates are bound explicitly
+func CheckClientCert(s AuthStorage, r *http.Request, login string, mapping string, autoBind bool) error {
+	cert, err := VerifiedCert(r)
+	if err != nil {
+		return err
+	}
+	id, err := CertID(cert, mapping)
+	if err != nil {
+		return err
+	}
+
+	owner, err := s.GetCertificateLogin(r.Context(), id)
+	switch err {
+	case nil:
+		if owner != login {
+			return ErrWrongCertificate
+		}
+		return nil
+	case ErrCertificateNotFound:
+		if !autoBind {
+			return ErrWrongCertificate
+		}
+	default:
+		return err
+	}
+
+	bound, err := s.ListCertificates(r.Context(), login)
+	if err != nil {
+		return err
+	}
+	if len(bound) > 0 || cert.Subject.CommonName != login {
+		return ErrWrongCertificate
+	}
+	return s.BindCertificate(r.Context(), login, id)
+}
+
+// BindClientCert binds the verified client certificate of the request to the account
+func BindClientCert(s AuthStorage, r *http.Request, login string, mapping string) error {
+	cert, err := VerifiedCert(r)
+	if err != nil {
+		return err
+	}
+	id, err := CertID(cert, mapping)
+	if err != nil {
+		return err
+	}
+	return s.BindCertificate(r.Context(), login, id)
+}
+
+// BindCertificate binds the certificate ID to the account.
+// Returns ErrCertificateIsTaken if it is bound to another one
+func (s *AuthDB) BindCertificate(ctx context.Context, login string, certID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, bindCertificateQuery, certID, login); err != nil {
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in BindCertificate:%w", err)
+	}
+	owner, err := s.GetCertificateLogin(ctx, certID)
+	if err != nil {
+		return err
+	}
+	if owner != login {
+		return ErrCertificateIsTaken
+	}
+	return nil
+}
+
+// GetCertificateLogin returns the login of the account the certificate ID is bound to
+func (s *AuthDB) GetCertificateLogin(ctx context.Context, certID string) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var login string
+	err := s.db.QueryRowContext(ctx, getCertificateLoginQuery, certID).Scan(&login)
+	switch err {
+	case nil:
+		return login, nil
+	case sql.ErrNoRows:
+		return "", ErrCertificateNotFound
+	default:
+		return "", fmt.Errorf("error in GetCertificateLogin:%w", err)
+	}
+}
+
+// ListCertificates returns certificate IDs bound to the account
+func (s *AuthDB) ListCertificates(ctx context.Context, login string) ([]string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, listCertificatesQuery, login)
+	if err != nil {
+		return nil, fmt.Errorf("error in ListCertificates:%w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error in ListCertificates:%w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *AuthMemStorage) BindCertificate(ctx context.Context, login string, certID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	if owner, ok := s.Certs[certID]; ok && owner != login {
+		return ErrCertificateIsTaken
+	}
+	s.Certs[certID] = login
+	return nil
+}
+
+func (s *AuthMemStorage) GetCertificateLogin(ctx context.Context, certID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.Certs[certID]
+	if !ok {
+		return "", ErrCertificateNotFound
+	}
+	return login, nil
+}
+
+func (s *AuthMemStorage) ListCertificates(ctx context.Context, login string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, owner := range s.Certs {
+		if owner == login {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// certRequest returns a request with a verified client certificate issued to the common name
+func certRequest(t *testing.T, commonName string) *http.Request {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, public, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest(http.MethodPost, "/api/user/login", nil)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return r
+}
+
+func TestCheckClientCert(t *testing.T) {
+	for _, mapping := range []string{CertMappingSubject, CertMappingFingerprint} {
+		t.Run(mapping, func(t *testing.T) {
+			s := NewMemStorage()
+			s.Data["user"] = "password"
+			s.Data["other"] = "password"
+
+			// a certificate issued to another login is not bound on first use
+			if err := CheckClientCert(s, certRequest(t, "other"), "user", mapping, true); err != ErrWrongCertificate {
+				t.Errorf("certificate of other login: got %v", err)
+			}
+
+			own := certRequest(t, "user")
+			if err := CheckClientCert(s, own, "user", mapping, true); err != nil {
+				t.Fatalf("first certificate: %v", err)
+			}
+			if err := CheckClientCert(s, own, "user", mapping, true); err != nil {
+				t.Errorf("bound certificate: %v", err)
+			}
+			if login, err := CertLogin(s, own, mapping); err != nil || login != "user" {
+				t.Errorf("CertLogin() = %q, %v", login, err)
+			}
+
+			// the account has a certificate already, other ones are refused
+			if err := CheckClientCert(s, certRequest(t, "user"), "user", mapping, true); mapping == CertMappingFingerprint && err != ErrWrongCertificate {
+				t.Errorf("second certificate: got %v", err)
+			}
+			if err := CheckClientCert(s, own, "other", mapping, true); err != ErrWrongCertificate {
+				t.Errorf("certificate of other account: got %v", err)
+			}
+			if err := BindClientCert(s, own, "other", mapping); err != ErrCertificateIsTaken {
+				t.Errorf("binding taken certificate: got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckClientCertWithoutAutoBind(t *testing.T) {
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+
+	own := certRequest(t, "user")
+	if err := CheckClientCert(s, own, "user", CertMappingFingerprint, false); err != ErrWrongCertificate {
+		t.Errorf("unbound certificate: got %v", err)
+	}
+	if _, err := CertLogin(s, own, CertMappingFingerprint); err != ErrCertificateNotFound {
+		t.Errorf("certificate is bound on first use: %v", err)
+	}
+
+	if err := BindClientCert(s, own, "user", CertMappingFingerprint); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckClientCert(s, own, "user", CertMappingFingerprint, false); err != nil {
+		t.Errorf("explicitly bound certificate: %v", err)
+	}
+}
+
+func TestVerifiedCertRequired(t *testing.T) {
+	s := NewMemStorage()
+	r, _ := http.NewRequest(http.MethodPost, "/api/user/login", nil)
+	if err := CheckClientCert(s, r, "user", CertMappingSubject, true); err != ErrNoClientCert {
+		t.Errorf("plain request: got %v", err)
+	}
+
+	// presented but not verified against the client CA
+	r = certRequest(t, "user")
+	r.TLS.VerifiedChains = nil
+	if _, err := CertLogin(s, r, CertMappingSubject); err != ErrNoClientCert {
+		t.Errorf("unverified certificate: got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+const (
+	// maxDeviceField limits length of device fields sent by clients
+	maxDeviceField = 128
+)
+
+// Device is a client install of a user. The client sends ID, Name and Version on login,
+// the rest is filled by the server
+type Device struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	FirstSeen time.Time `json:"first_seen,omitempty"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
+	Revoked   bool      `json:"revoked,omitempty"`
+	// Current marks the device of the session listing the devices
+	Current bool `json:"current,omitempty"`
+}
+
+// Valid checks the fields sent by the client
+func (d Device) Valid() bool {
+	return d.ID != "" && len(d.ID) <= maxDeviceField && len(d.Name) <= maxDeviceField && len(d.Version) <= maxDeviceField
+}
+
+// SaveDevice registers the device of the user or updates it on a new login.
+// Returns ErrDeviceRevoked if the device was revoked, it stays revoked
+func (s *AuthDB) SaveDevice(ctx context.Context, login string, device Device) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, saveDeviceQuery, device.ID, login, device.Name, device.Version, device.IP, device.LastSeen)
+	if err != nil {
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in SaveDevice:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrDeviceRevoked
+	}
+	return nil
+}
+
+// TouchDevice saves the address and time the device was seen last
+func (s *AuthDB) TouchDevice(ctx context.Context, login string, id string, ip string, seen time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, touchDeviceQuery, login, id, ip, seen); err != nil {
+		return fmt.Errorf("error in TouchDevice:%w", err)
+	}
+	return nil
+}
+
+// ListDevices returns devices of the user, recently seen first
+func (s *AuthDB) ListDevices(ctx context.Context, login string) ([]Device, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, listDevicesQuery, login)
+	if err != nil {
+		return nil, fmt.Errorf("error in ListDevices:%w", err)
+	}
+	defer rows.Close()
+
+	var devices []Device
+	for rows.Next() {
+		var d Device
+		if err := rows.Scan(&d.ID, &d.Name, &d.Version, &d.IP, &d.FirstSeen, &d.LastSeen, &d.Revoked); err != nil {
+			return nil, fmt.Errorf("error in ListDevices:%w", err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// RevokeDevice marks the device revoked, revokes all its sessions and deletes its login keys
+func (s *AuthDB) RevokeDevice(ctx context.Context, login string, id string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in RevokeDevice:%w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, revokeDeviceQuery, login, id)
+	if err != nil {
+		return fmt.Errorf("error in RevokeDevice:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrDeviceNotFound
+	}
+	if _, err := tx.ExecContext(ctx, revokeDeviceSessionsQuery, login, id); err != nil {
+		return fmt.Errorf("error in RevokeDevice:%w", err)
+	}
+	if _, err := tx.ExecContext(ctx, deleteDeviceLoginKeysQuery, login, id); err != nil {
+		return fmt.Errorf("error in RevokeDevice:%w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *AuthMemStorage) SaveDevice(ctx context.Context, login string, device Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	key := login + "/" + device.ID
+	if old, ok := s.Devices[key]; ok {
+		if old.Revoked {
+			return ErrDeviceRevoked
+		}
+		device.FirstSeen = old.FirstSeen
+	} else {
+		device.FirstSeen = device.LastSeen
+	}
+	device.Revoked = false
+	s.Devices[key] = device
+	return nil
+}
+
+func (s *AuthMemStorage) TouchDevice(ctx context.Context, login string, id string, ip string, seen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := login + "/" + id
+	if device, ok := s.Devices[key]; ok {
+		device.IP, device.LastSeen = ip, seen
+		s.Devices[key] = device
+	}
+	return nil
+}
+
+func (s *AuthMemStorage) ListDevices(ctx context.Context, login string) ([]Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var devices []Device
+	for key, device := range s.Devices {
+		if key == login+"/"+device.ID {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].LastSeen.After(devices[j].LastSeen) })
+	return devices, nil
+}
+
+func (s *AuthMemStorage) RevokeDevice(ctx context.Context, login string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := login + "/" + id
+	device, ok := s.Devices[key]
+	if !ok {
+		return ErrDeviceNotFound
+	}
+	device.Revoked = true
+	s.Devices[key] = device
+
+	for sid, session := range s.Sessions {
+		if session.Login == login && session.DeviceID == id {
+			session.Revoked = true
+			s.Sessions[sid] = session
+		}
+	}
+	for kid, key := range s.LoginKeys {
+		if key.Login == login && key.DeviceID == id {
+			delete(s.LoginKeys, kid)
+		}
+	}
+	return nil
+}
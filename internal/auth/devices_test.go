@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRevokeDevice(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+
+	now := time.Now().UTC()
+	if err := s.SaveDevice(ctx, "user", Device{ID: "laptop", Name: "laptop", LastSeen: now}); err != nil {
+		t.Fatal(err)
+	}
+	_, refresh, err := NewSession(ctx, s, "user", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := NewSession(ctx, s, "user", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RevokeDevice(ctx, "other", "laptop"); err != ErrDeviceNotFound {
+		t.Errorf("revoking device of other user: got %v", err)
+	}
+	if err := s.RevokeDevice(ctx, "user", "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RefreshSession(ctx, s, refresh); err != ErrSessionRevoked {
+		t.Errorf("session of revoked device: got %v", err)
+	}
+	if _, _, err := RefreshSession(ctx, s, other); err != nil {
+		t.Errorf("session of other device: %v", err)
+	}
+
+	// logging in again from the device doesn't bring it back
+	if err := s.SaveDevice(ctx, "user", Device{ID: "laptop", Name: "laptop", LastSeen: now.Add(time.Hour)}); err != ErrDeviceRevoked {
+		t.Errorf("saving revoked device: got %v", err)
+	}
+	devices, _ := s.ListDevices(ctx, "user")
+	if len(devices) != 1 || !devices[0].Revoked || !devices[0].FirstSeen.Equal(now) {
+		t.Errorf("ListDevices() = %+v", devices)
+	}
+}
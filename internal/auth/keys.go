@@ -0,0 +1,485 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms of the access tokens
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+const rsaKeyBits = 2048
+
+// Key set errors
+var (
+	ErrUnknownAlg = errors.New("unknown signing algorithm")
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// reloadBackoff is the least time between reloads of the keys folder on tokens of unknown keys,
+// so forged key IDs don't make every request read the folder
+const reloadBackoff = 10 * time.Second
+
+var (
+	keysMu sync.Mutex
+	keys   *KeySet
+)
+
+// SetKeys sets the key set used to sign and verify access tokens.
+// The server sets the key set loaded from the keys folder at startup
+func SetKeys(ks *KeySet) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = ks
+}
+
+// Keys returns the key set used to sign and verify access tokens.
+// If none is set, a key set in memory is made on first use
+func Keys() (*KeySet, error) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if keys == nil {
+		ks, err := NewKeySet(AlgEdDSA)
+		if err != nil {
+			return nil, err
+		}
+		keys = ks
+	}
+	return keys, nil
+}
+
+// SigningKey is a private key signing access tokens. ID is the JWK thumbprint of its public key
+type SigningKey struct {
+	ID      string
+	Alg     string
+	Private crypto.Signer
+	Created time.Time
+}
+
+// KeySet keeps the current signing key and the retired ones.
+// Retired keys only verify tokens until the tokens signed with them expire
+type KeySet struct {
+	mu  sync.RWMutex
+	alg string
+	// folder the keys are saved to, in memory only if empty
+	dir string
+	// sorted by creation time, the last one is current
+	keys []*SigningKey
+	// last time the folder was read again on a token of an unknown key
+	reloaded time.Time
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set published on /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeySet returns a key set kept in memory with one fresh key
+func NewKeySet(alg string) (*KeySet, error) {
+	ks := &KeySet{alg: alg}
+	if err := ks.Rotate(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// LoadKeySet reads PEM-encoded private keys from the folder.
+// The newest key of the algorithm signs, a new one is generated if there is none
+func LoadKeySet(alg string, dir string) (*KeySet, error) {
+	if dir == "" {
+		return NewKeySet(alg)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{alg: alg, dir: dir}
+	loaded, err := readKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+	ks.keys = loaded
+
+	if current := ks.Current(); current == nil || current.Alg != alg {
+		if err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	ks.prune()
+	return ks, nil
+}
+
+// Reload reads the keys folder again, so keys rotated by other servers sharing it
+// sign and verify tokens here too. Keys pruned from the folder are kept until they are pruned here
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+	loaded, err := readKeys(ks.dir)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	known := make(map[string]bool, len(ks.keys))
+	for _, key := range ks.keys {
+		known[key.ID] = true
+	}
+	for _, key := range loaded {
+		if !known[key.ID] {
+			ks.keys = append(ks.keys, key)
+		}
+	}
+	sortKeys(ks.keys)
+	ks.mu.Unlock()
+	ks.prune()
+	return nil
+}
+
+// ReloadEvery reloads the keys folder with the interval until the context is done. Zero interval turns it off
+func (ks *KeySet) ReloadEvery(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || ks.dir == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Reload(); err != nil {
+				log.Println("error when reloading signing keys:", err)
+			}
+		}
+	}
+}
+
+// Current returns the key new tokens are signed with
+func (ks *KeySet) Current() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if len(ks.keys) == 0 {
+		return nil
+	}
+	return ks.keys[len(ks.keys)-1]
+}
+
+// Lookup finds the key by its ID. An unknown key may be made by another server sharing the keys folder,
+// so the folder is read again, at most once in reloadBackoff
+func (ks *KeySet) Lookup(kid string) (*SigningKey, error) {
+	if key := ks.find(kid); key != nil {
+		return key, nil
+	}
+	if ks.dir == "" {
+		return nil, ErrUnknownKey
+	}
+
+	ks.mu.Lock()
+	due := time.Since(ks.reloaded) > reloadBackoff
+	if due {
+		ks.reloaded = time.Now()
+	}
+	ks.mu.Unlock()
+	if !due {
+		return nil, ErrUnknownKey
+	}
+	if err := ks.Reload(); err != nil {
+		log.Println("error when reloading signing keys:", err)
+	}
+	if key := ks.find(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (ks *KeySet) find(kid string) *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// Rotate generates a new signing key. The old keys still verify tokens until they expire
+func (ks *KeySet) Rotate() error {
+	private, err := generateKey(ks.alg)
+	if err != nil {
+		return err
+	}
+	key, err := newSigningKey(private, time.Now())
+	if err != nil {
+		return err
+	}
+	if ks.dir != "" {
+		if err := writeKeyFile(ks.keyFile(key.ID), private); err != nil {
+			return err
+		}
+	}
+
+	ks.mu.Lock()
+	ks.keys = append(ks.keys, key)
+	ks.mu.Unlock()
+	ks.prune()
+	return nil
+}
+
+// RotateEvery rotates the keys with the interval until the context is done. Zero interval turns rotation off
+func (ks *KeySet) RotateEvery(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Rotate(); err != nil {
+				log.Println("error when rotating signing keys:", err)
+			}
+		}
+	}
+}
+
+// prune forgets the keys retired longer than the access token lifetime ago.
+// A key file is only deleted when the file itself is older than the lifetime,
+// so keys just written by other servers sharing the folder are kept
+func (ks *KeySet) prune() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	var keep []*SigningKey
+	for i, key := range ks.keys {
+		if i < len(ks.keys)-1 && time.Since(ks.keys[i+1].Created) > AccessTokenTTL && ks.age(key) > AccessTokenTTL {
+			if ks.dir != "" {
+				os.Remove(ks.keyFile(key.ID))
+			}
+			continue
+		}
+		keep = append(keep, key)
+	}
+	ks.keys = keep
+}
+
+// age returns the age of the key file, or of the key itself if it is kept in memory only
+func (ks *KeySet) age(key *SigningKey) time.Duration {
+	if ks.dir == "" {
+		return time.Since(key.Created)
+	}
+	info, err := os.Stat(ks.keyFile(key.ID))
+	if err != nil {
+		// removed by another server already
+		return time.Since(key.Created)
+	}
+	return time.Since(info.ModTime())
+}
+
+func (ks *KeySet) keyFile(kid string) string {
+	return filepath.Join(ks.dir, kid+".pem")
+}
+
+// JWKS returns public keys of the set
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk := publicJWK(key.Private.Public())
+		jwk.Kid = key.ID
+		jwk.Alg = key.Alg
+		jwk.Use = "sig"
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// sign signs the claims with the current key, adding its ID to the header
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key := ks.Current()
+	if key == nil {
+		return "", ErrUnknownKey
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// keyfunc returns public key to verify the token, found by the kid header
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	key, err := ks.Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Alg {
+		return nil, ErrUnknownAlg
+	}
+	return key.Private.Public(), nil
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return nil, ErrUnknownAlg
+	}
+}
+
+func newSigningKey(private crypto.Signer, created time.Time) (*SigningKey, error) {
+	var alg string
+	switch private.(type) {
+	case ed25519.PrivateKey:
+		alg = AlgEdDSA
+	case *rsa.PrivateKey:
+		alg = AlgRS256
+	default:
+		return nil, ErrUnknownAlg
+	}
+	return &SigningKey{
+		ID:      thumbprint(publicJWK(private.Public())),
+		Alg:     alg,
+		Private: private,
+		Created: created,
+	}, nil
+}
+
+func publicJWK(public crypto.PublicKey) JWK {
+	enc := base64.RawURLEncoding
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: enc.EncodeToString(public)}
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   enc.EncodeToString(public.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+	}
+	return JWK{}
+}
+
+// thumbprint is the JWK thumbprint of the public key (RFC 7638)
+func thumbprint(jwk JWK) string {
+	var members string
+	switch jwk.Kty {
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.Kty, jwk.N)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func readKeyFile(file string) (*SigningKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return nil, errors.New("no PEM private key found")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnknownAlg
+	}
+	return newSigningKey(signer, info.ModTime())
+}
+
+// writeKeyFile writes the key to a temporary file and renames it,
+// so other servers reading the folder never see a partly written key
+func writeKeyFile(file string, private crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// readKeys reads the keys of the folder sorted by creation time
+func readKeys(dir string) ([]*SigningKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []*SigningKey
+	for _, file := range files {
+		key, err := readKeyFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// pruned by another server meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't read signing key %s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func sortKeys(keys []*SigningKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Created.Before(keys[j].Created)
+	})
+}
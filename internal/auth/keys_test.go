@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func parseToken(t *testing.T, ks *KeySet, token string) error {
+	t.Helper()
+	_, err := jwt.Parse(token, ks.keyfunc, jwt.WithValidMethods([]string{AlgEdDSA, AlgRS256}))
+	return err
+}
+
+func TestKeySetRotate(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			ks, err := NewKeySet(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old, err := ks.sign(jwt.MapClaims{"userID": "user"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldKey := ks.Current()
+
+			if err := ks.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			if ks.Current().ID == oldKey.ID {
+				t.Fatal("current key is not rotated")
+			}
+			// the retired key still verifies
+			if err := parseToken(t, ks, old); err != nil {
+				t.Errorf("token of retired key: %v", err)
+			}
+			if got := len(ks.JWKS().Keys); got != 2 {
+				t.Errorf("JWKS has %d keys, want 2", got)
+			}
+
+			// the retired key is dropped after the tokens signed with it expire
+			oldKey.Created = time.Now().Add(-2 * AccessTokenTTL)
+			ks.Current().Created = time.Now().Add(-AccessTokenTTL - time.Minute)
+			ks.prune()
+			if err := parseToken(t, ks, old); err == nil {
+				t.Error("token of pruned key is accepted")
+			}
+			if got := len(ks.JWKS().Keys); got != 1 {
+				t.Errorf("JWKS has %d keys, want 1", got)
+			}
+		})
+	}
+}
+
+func TestKeySetRejectsForeignTokens(t *testing.T) {
+	ks, err := NewKeySet(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewKeySet(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := other.sign(jwt.MapClaims{"userID": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseToken(t, ks, foreign); err == nil {
+		t.Error("token of unknown key is accepted")
+	}
+
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userID": "user"})
+	hs.Header["kid"] = ks.Current().ID
+	symmetric, err := hs.SignedString([]byte("abcd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseToken(t, ks, symmetric); err == nil {
+		t.Error("HS256 token is accepted")
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := LoadKeySet(AlgEdDSA, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ks.sign(jwt.MapClaims{"userID": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadKeySet(AlgEdDSA, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Current().ID != ks.Current().ID {
+		t.Error("saved key is not loaded")
+	}
+	if err := parseToken(t, loaded, token); err != nil {
+		t.Errorf("token of saved key: %v", err)
+	}
+
+	// switching the algorithm makes a new current key, the old one verifies
+	switched, err := LoadKeySet(AlgRS256, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if switched.Current().Alg != AlgRS256 {
+		t.Errorf("current key algorithm is %s", switched.Current().Alg)
+	}
+	if err := parseToken(t, switched, token); err != nil {
+		t.Errorf("token of old key: %v", err)
+	}
+}
+
+// Servers sharing the keys folder pick up keys rotated by each other
+func TestKeySetReload(t *testing.T) {
+	dir := t.TempDir()
+	first, err := LoadKeySet(AlgEdDSA, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadKeySet(AlgEdDSA, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := first.sign(jwt.MapClaims{"userID": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unknown key is looked up in the folder
+	if err := parseToken(t, second, token); err != nil {
+		t.Errorf("token of the key rotated by another server: %v", err)
+	}
+	if second.Current().ID != first.Current().ID {
+		t.Error("the key rotated by another server doesn't sign")
+	}
+
+	// forged keys don't make every token read the folder
+	if err := first.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Lookup(first.Current().ID); err != ErrUnknownKey {
+		t.Errorf("folder is read again before the backoff: %v", err)
+	}
+	if err := second.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Lookup(first.Current().ID); err != nil {
+		t.Errorf("reloaded key: %v", err)
+	}
+}
+
+func TestKeySetPruneByFileAge(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := LoadKeySet(AlgEdDSA, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired := ks.Current()
+	if err := ks.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	retired.Created = time.Now().Add(-2 * AccessTokenTTL)
+	ks.Current().Created = time.Now().Add(-AccessTokenTTL - time.Minute)
+
+	// the file was just written, e.g. by another server
+	ks.prune()
+	if _, err := ks.Lookup(retired.ID); err != nil {
+		t.Errorf("key of a fresh file is pruned: %v", err)
+	}
+
+	old := time.Now().Add(-2 * AccessTokenTTL)
+	file := filepath.Join(dir, retired.ID+".pem")
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	ks.prune()
+	if ks.find(retired.ID) != nil {
+		t.Error("retired key is kept")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("file of retired key is kept: %v", err)
+	}
+}
+
+func TestKeysMadeOnFirstUse(t *testing.T) {
+	SetKeys(nil)
+	ks, err := Keys()
+	if err != nil || ks.Current() == nil {
+		t.Fatalf("Keys() = %v, %v", ks, err)
+	}
+	if again, _ := Keys(); again != ks {
+		t.Error("another key set is made on second use")
+	}
+}
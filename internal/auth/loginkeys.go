@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+const (
+	// KeyChallengeTTL is the time the client has to sign the nonce
+	KeyChallengeTTL = time.Minute
+	// maxKeyChallenges limits nonces waiting for signatures
+	maxKeyChallenges = 10000
+)
+
+// Login key errors
+var (
+	ErrLoginKeyNotFound  = errors.New("login key not found")
+	ErrLoginKeyIsTaken   = errors.New("login key is registered already")
+	ErrWrongLoginKey     = errors.New("malformed login key")
+	ErrChallengeNotFound = errors.New("login challenge not found or expired")
+	ErrTooManyChallenges = errors.New("too many login challenges in progress")
+	ErrWrongKeySignature = errors.New("wrong signature of login challenge")
+	ErrWrongKeyDevice    = errors.New("login key is registered from another device")
+)
+
+// LoginKey is an Ed25519 public key a device logs in with instead of the password.
+// The key belongs to the device it was registered from and is deleted when the device is revoked
+type LoginKey struct {
+	ID         string    `json:"id"`
+	Login      string    `json:"-"`
+	Name       string    `json:"name"`
+	PublicKey  string    `json:"public_key"`
+	DeviceID   string    `json:"device_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+}
+
+// KeyLoginData is a request of login by key. The client asks for Nonce with Login and KeyID,
+// then sends the Signature of KeyLoginMessage
+type KeyLoginData struct {
+	Login     string  `json:"login"`
+	KeyID     string  `json:"key_id"`
+	Nonce     string  `json:"nonce,omitempty"`
+	Signature string  `json:"signature,omitempty"`
+	Device    *Device `json:"device,omitempty"`
+}
+
+// NewLoginKey checks the public key sent by the client and returns the login key with its ID
+func NewLoginKey(login string, name string, publicKey string, deviceID string) (LoginKey, error) {
+	public, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return LoginKey{}, ErrWrongLoginKey
+	}
+	return LoginKey{
+		ID:        LoginKeyID(public),
+		Login:     login,
+		Name:      name,
+		PublicKey: publicKey,
+		DeviceID:  deviceID,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// LoginKeyID returns the ID of the public key, the same on the client and the server
+func LoginKeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:16])
+}
+
+// KeyLoginMessage is what the client signs, the nonce is bound to the login it was issued for
+func KeyLoginMessage(login string, nonce string) []byte {
+	return []byte("simplevault key login\n" + login + "\n" + nonce)
+}
+
+type keyChallenge struct {
+	login   string
+	keyID   string
+	expires time.Time
+}
+
+// KeyChallenges keeps nonces issued for login by key
+type KeyChallenges struct {
+	mu      sync.Mutex
+	pending map[string]keyChallenge
+}
+
+// NewKeyChallenges returns an empty challenge store
+func NewKeyChallenges() *KeyChallenges {
+	return &KeyChallenges{pending: make(map[string]keyChallenge)}
+}
+
+// Issue returns a new nonce for the key. Nonces are issued for unknown keys too,
+// so registered keys can't be told from others
+func (c *KeyChallenges) Issue(login string, keyID string) (string, error) {
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) >= maxKeyChallenges {
+		now := time.Now()
+		for n, ch := range c.pending {
+			if now.After(ch.expires) {
+				delete(c.pending, n)
+			}
+		}
+		if len(c.pending) >= maxKeyChallenges {
+			return "", ErrTooManyChallenges
+		}
+	}
+	c.pending[nonce] = keyChallenge{login: login, keyID: keyID, expires: time.Now().Add(KeyChallengeTTL)}
+	return nonce, nil
+}
+
+// Verify checks the signature of the nonce by the registered key of the user and saves its use.
+// The key must be used from the device it was registered from, keys without a device are refused.
+// A nonce is used once, whatever the result
+func (c *KeyChallenges) Verify(ctx context.Context, s AuthStorage, data KeyLoginData) error {
+	c.mu.Lock()
+	ch, ok := c.pending[data.Nonce]
+	delete(c.pending, data.Nonce)
+	c.mu.Unlock()
+	if !ok || ch.login != data.Login || ch.keyID != data.KeyID || time.Now().After(ch.expires) {
+		return ErrChallengeNotFound
+	}
+
+	key, err := s.GetLoginKey(ctx, data.Login, data.KeyID)
+	if err != nil {
+		return err
+	}
+	if key.DeviceID == "" || data.Device == nil || data.Device.ID != key.DeviceID {
+		return ErrWrongKeyDevice
+	}
+	public, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return ErrWrongLoginKey
+	}
+	signature, err := base64.StdEncoding.DecodeString(data.Signature)
+	if err != nil || !ed25519.Verify(public, KeyLoginMessage(data.Login, data.Nonce), signature) {
+		return ErrWrongKeySignature
+	}
+
+	if err := s.TouchLoginKey(ctx, key.ID, time.Now().UTC()); err != nil {
+		log.Println("error when saving login key last use:", err)
+	}
+	return nil
+}
+
+// AddLoginKey registers the login key of the user.
+// Returns ErrLoginKeyIsTaken if the key is registered already
+func (s *AuthDB) AddLoginKey(ctx context.Context, login string, key LoginKey) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, addLoginKeyQuery, key.ID, login, key.Name, key.PublicKey, key.CreatedAt, key.DeviceID)
+	if err != nil {
+		if database.IsUniqueConstraintViolation(err) {
+			return ErrLoginKeyIsTaken
+		}
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in AddLoginKey:%w", err)
+	}
+	return nil
+}
+
+// GetLoginKey returns the login key of the user by ID
+func (s *AuthDB) GetLoginKey(ctx context.Context, login string, id string) (LoginKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	key, err := scanLoginKey(s.db.QueryRowContext(ctx, getLoginKeyQuery, login, id))
+	switch err {
+	case nil:
+		key.Login = login
+		return key, nil
+	case sql.ErrNoRows:
+		return LoginKey{}, ErrLoginKeyNotFound
+	default:
+		return LoginKey{}, fmt.Errorf("error in GetLoginKey:%w", err)
+	}
+}
+
+// ListLoginKeys returns login keys of the user
+func (s *AuthDB) ListLoginKeys(ctx context.Context, login string) ([]LoginKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, listLoginKeysQuery, login)
+	if err != nil {
+		return nil, fmt.Errorf("error in ListLoginKeys:%w", err)
+	}
+	defer rows.Close()
+
+	var keys []LoginKey
+	for rows.Next() {
+		key, err := scanLoginKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error in ListLoginKeys:%w", err)
+		}
+		key.Login = login
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteLoginKey deletes the login key of the user
+func (s *AuthDB) DeleteLoginKey(ctx context.Context, login string, id string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, deleteLoginKeyQuery, login, id)
+	if err != nil {
+		return fmt.Errorf("error in DeleteLoginKey:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrLoginKeyNotFound
+	}
+	return nil
+}
+
+// TouchLoginKey saves the time of the last login by the key
+func (s *AuthDB) TouchLoginKey(ctx context.Context, id string, used time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, touchLoginKeyQuery, id, used); err != nil {
+		return fmt.Errorf("error in TouchLoginKey:%w", err)
+	}
+	return nil
+}
+
+func scanLoginKey(row rowScanner) (LoginKey, error) {
+	var key LoginKey
+	var used sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &key.PublicKey, &key.CreatedAt, &used, &key.DeviceID); err != nil {
+		return LoginKey{}, err
+	}
+	key.LastUsedAt = used.Time
+	return key, nil
+}
+
+func (s *AuthMemStorage) AddLoginKey(ctx context.Context, login string, key LoginKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	if _, ok := s.LoginKeys[key.ID]; ok {
+		return ErrLoginKeyIsTaken
+	}
+	key.Login = login
+	s.LoginKeys[key.ID] = key
+	return nil
+}
+
+func (s *AuthMemStorage) GetLoginKey(ctx context.Context, login string, id string) (LoginKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.LoginKeys[id]
+	if !ok || key.Login != login {
+		return LoginKey{}, ErrLoginKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *AuthMemStorage) ListLoginKeys(ctx context.Context, login string) ([]LoginKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []LoginKey
+	for _, key := range s.LoginKeys {
+		if key.Login == login {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (s *AuthMemStorage) DeleteLoginKey(ctx context.Context, login string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.LoginKeys[id]
+	if !ok || key.Login != login {
+		return ErrLoginKeyNotFound
+	}
+	delete(s.LoginKeys, id)
+	return nil
+}
+
+func (s *AuthMemStorage) TouchLoginKey(ctx context.Context, id string, used time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.LoginKeys[id]; ok {
+		key.LastUsedAt = used
+		s.LoginKeys[id] = key
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestKeyChallenges(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = ""
+	c := NewKeyChallenges()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewLoginKey("user", "server", base64.StdEncoding.EncodeToString(public), "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddLoginKey(ctx, "user", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddLoginKey(ctx, "user", key); err != ErrLoginKeyIsTaken {
+		t.Errorf("adding key twice: got %v", err)
+	}
+
+	signed := func(login string) KeyLoginData {
+		nonce, err := c.Issue(login, key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature := ed25519.Sign(private, KeyLoginMessage(login, nonce))
+		return KeyLoginData{Login: login, KeyID: key.ID, Nonce: nonce, Signature: base64.StdEncoding.EncodeToString(signature), Device: &Device{ID: "server"}}
+	}
+
+	data := signed("user")
+	if err := c.Verify(ctx, s, data); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if used, _ := s.GetLoginKey(ctx, "user", key.ID); used.LastUsedAt.IsZero() {
+		t.Error("last use is not saved")
+	}
+	if err := c.Verify(ctx, s, data); err != ErrChallengeNotFound {
+		t.Errorf("used nonce: got %v", err)
+	}
+
+	data = signed("user")
+	data.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("other")))
+	if err := c.Verify(ctx, s, data); err != ErrWrongKeySignature {
+		t.Errorf("wrong signature: got %v", err)
+	}
+
+	data = signed("user")
+	data.Device = &Device{ID: "laptop"}
+	if err := c.Verify(ctx, s, data); err != ErrWrongKeyDevice {
+		t.Errorf("key used from another device: got %v", err)
+	}
+	data = signed("user")
+	data.Device = nil
+	if err := c.Verify(ctx, s, data); err != ErrWrongKeyDevice {
+		t.Errorf("key used without a device: got %v", err)
+	}
+
+	// the key is registered for another user
+	if err := c.Verify(ctx, s, signed("other")); err != ErrLoginKeyNotFound {
+		t.Errorf("key of other user: got %v", err)
+	}
+
+	if err := s.SaveDevice(ctx, "user", Device{ID: "server"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeDevice(ctx, "user", "server"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Verify(ctx, s, signed("user")); err != ErrLoginKeyNotFound {
+		t.Errorf("key of revoked device: got %v", err)
+	}
+
+	legacy, err := NewLoginKey("user", "legacy", base64.StdEncoding.EncodeToString(public), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddLoginKey(ctx, "user", legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Verify(ctx, s, signed("user")); err != ErrWrongKeyDevice {
+		t.Errorf("key without a device: got %v", err)
+	}
+	if err := s.DeleteLoginKey(ctx, "user", key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Verify(ctx, s, signed("user")); err != ErrLoginKeyNotFound {
+		t.Errorf("revoked key: got %v", err)
+	}
+}
+
+func TestNewLoginKeyChecksKey(t *testing.T) {
+	if _, err := NewLoginKey("user", "key", base64.StdEncoding.EncodeToString([]byte("short")), "laptop"); err != ErrWrongLoginKey {
+		t.Errorf("short key: got %v", err)
+	}
+}
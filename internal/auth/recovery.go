@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/alexedwards/argon2id"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+// kinds of wrapped vault keys
+const (
+	// VaultKeyPassword is the vault key wrapped by a key derived from user's password
+	VaultKeyPassword = "password"
+	// VaultKeyRecovery is the vault key wrapped by user's one-time recovery key
+	VaultKeyRecovery = "recovery"
+)
+
+// VaultKeyData is a wrapped vault key sent between client and server.
+// Saving a wrapped vault key is confirmed by SRP proof of the password
+type VaultKeyData struct {
+	Kind      string `json:"kind"`
+	Key       string `json:"key"`
+	Handshake string `json:"handshake,omitempty"`
+	Proof     string `json:"proof,omitempty"`
+}
+
+// ResetData is used to reset a forgotten password.
+// Token is derived from user's vault key on the client, Verifier is the SRP verifier of the new password
+// and VaultKey is the vault key wrapped by it. Saving the token is confirmed by SRP proof of the password
+type ResetData struct {
+	Login     string      `json:"login"`
+	Token     string      `json:"token"`
+	Verifier  SRPVerifier `json:"verifier"`
+	VaultKey  string      `json:"vaultkey"`
+	Device    *Device     `json:"device,omitempty"`
+	Handshake string      `json:"handshake,omitempty"`
+	Proof     string      `json:"proof,omitempty"`
+}
+
+// SetVaultKey saves user's vault key wrapped by the key of the kind
+func (s *AuthDB) SetVaultKey(ctx context.Context, login string, kind string, wrapped string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, setVaultKeyQuery, login, kind, wrapped)
+	if err != nil {
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in SetVaultKey:%w", err)
+	}
+	return nil
+}
+
+// GetVaultKey returns user's vault key wrapped by the key of the kind
+func (s *AuthDB) GetVaultKey(ctx context.Context, login string, kind string) (wrapped string, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err = s.db.QueryRowContext(ctx, getVaultKeyQuery, login, kind).Scan(&wrapped)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrVaultKeyNotFound
+		}
+		return "", fmt.Errorf("error in GetVaultKey:%w", err)
+	}
+	return wrapped, nil
+}
+
+// SetRecoveryVerifier saves hash of the recovery token, which is derived from user's vault key
+func (s *AuthDB) SetRecoveryVerifier(ctx context.Context, login string, token string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	verifier, err := argon2id.CreateHash(token, argon2id.DefaultParams)
+	if err != nil {
+		return fmt.Errorf("error when trying to hash recovery token:%w", err)
+	}
+	_, err = s.db.ExecContext(ctx, setRecoveryVerifierQuery, login, verifier)
+	if err != nil {
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in SetRecoveryVerifier:%w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets SRP verifier of the new password if the recovery token matches the saved verifier
+// and saves the vault key wrapped by the new password
+func (s *AuthDB) ResetPassword(ctx context.Context, data ResetData) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		id       int
+		verifier string
+	)
+
+	err := s.db.QueryRowContext(ctx, CheckUsernameQuery, data.Login).Scan(&id)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	err = s.db.QueryRowContext(ctx, getRecoveryVerifierQuery, id).Scan(&verifier)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrWrongRecoveryToken
+		}
+		return fmt.Errorf("error in ResetPassword:%w", err)
+	}
+
+	check, err := argon2id.ComparePasswordAndHash(data.Token, verifier)
+	if err != nil {
+		return fmt.Errorf("error when trying to compare token and hash:%w", err)
+	}
+	if !check {
+		return ErrWrongRecoveryToken
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in ResetPassword:%w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setVerifierTx(ctx, tx, data.Login, data.Verifier); err != nil {
+		return fmt.Errorf("error updating verifier in ResetPassword:%w", err)
+	}
+	if _, err := tx.ExecContext(ctx, setVaultKeyQuery, data.Login, VaultKeyPassword, data.VaultKey); err != nil {
+		return fmt.Errorf("error updating vault key in ResetPassword:%w", err)
+	}
+
+	return tx.Commit()
+}
+
+// SetVaultKey is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) SetVaultKey(ctx context.Context, login string, kind string, wrapped string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	if s.VaultKeys == nil {
+		s.VaultKeys = make(map[string]string)
+	}
+	s.VaultKeys[login+"/"+kind] = wrapped
+	return nil
+}
+
+// GetVaultKey is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) GetVaultKey(ctx context.Context, login string, kind string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wrapped, ok := s.VaultKeys[login+"/"+kind]
+	if !ok {
+		return "", ErrVaultKeyNotFound
+	}
+	return wrapped, nil
+}
+
+// SetRecoveryVerifier is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) SetRecoveryVerifier(ctx context.Context, login string, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	verifier, err := argon2id.CreateHash(token, argon2id.DefaultParams)
+	if err != nil {
+		return fmt.Errorf("error when trying to hash recovery token:%w", err)
+	}
+	if s.Recovery == nil {
+		s.Recovery = make(map[string]string)
+	}
+	s.Recovery[login] = verifier
+	return nil
+}
+
+// ResetPassword is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) ResetPassword(ctx context.Context, data ResetData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[data.Login]; !ok {
+		return ErrUserNotFound
+	}
+	verifier, ok := s.Recovery[data.Login]
+	if !ok {
+		return ErrWrongRecoveryToken
+	}
+	check, err := argon2id.ComparePasswordAndHash(data.Token, verifier)
+	if err != nil {
+		return fmt.Errorf("error when trying to compare token and hash:%w", err)
+	}
+	if !check {
+		return ErrWrongRecoveryToken
+	}
+	s.Verifiers[data.Login] = data.Verifier
+	s.Data[data.Login] = ""
+	if s.VaultKeys == nil {
+		s.VaultKeys = make(map[string]string)
+	}
+	s.VaultKeys[data.Login+"/"+VaultKeyPassword] = data.VaultKey
+	return nil
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+const (
+	// AccessTokenTTL is the lifetime of the JWT access token
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is the lifetime of a session without refreshing
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	// AccessCookie and RefreshCookie are names of cookies with the tokens
+	AccessCookie  = "simplevault-auth"
+	RefreshCookie = "simplevault-refresh"
+)
+
+// Session is a login of a user on a device. Refresh token is stored as a hash
+type Session struct {
+	ID          string
+	Login       string
+	RefreshHash string
+	ExpiresAt   time.Time
+	Revoked     bool
+	// DeviceID is the client install the session belongs to, empty for clients which don't tell it
+	DeviceID string
+}
+
+// NewSession creates a session of the user on the device and returns its access and refresh tokens
+func NewSession(ctx context.Context, s AuthStorage, login string, deviceID string) (access string, refresh string, err error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.CreateSession(ctx, Session{
+		ID:          id,
+		Login:       login,
+		RefreshHash: hashRefreshSecret(secret),
+		ExpiresAt:   time.Now().Add(RefreshTokenTTL),
+		DeviceID:    deviceID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	access, err = GenerateToken(login, id)
+	if err != nil {
+		return "", "", err
+	}
+	return access, id + "." + secret, nil
+}
+
+// RefreshSession checks the refresh token and rotates it, returning new access and refresh tokens.
+// A refresh token which has already been rotated means it has leaked, so the session is revoked
+func RefreshSession(ctx context.Context, s AuthStorage, refresh string) (access string, newRefresh string, err error) {
+	id, secret, ok := strings.Cut(refresh, ".")
+	if !ok {
+		return "", "", ErrWrongRefreshToken
+	}
+
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+	if session.Revoked || time.Now().After(session.ExpiresAt) {
+		return "", "", ErrSessionRevoked
+	}
+
+	hash := hashRefreshSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(session.RefreshHash)) != 1 {
+		return "", "", revokeReused(ctx, s, session)
+	}
+
+	newSecret, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	// the token is rotated only if it is still current, so of concurrent refreshes with it
+	// one wins and the others are reuse
+	err = s.RotateRefreshToken(ctx, id, hash, hashRefreshSecret(newSecret), time.Now().Add(RefreshTokenTTL))
+	switch err {
+	case nil:
+	case ErrWrongRefreshToken:
+		return "", "", revokeReused(ctx, s, session)
+	default:
+		return "", "", err
+	}
+
+	access, err = GenerateToken(session.Login, id)
+	if err != nil {
+		return "", "", err
+	}
+	return access, id + "." + newSecret, nil
+}
+
+// revokeReused revokes the session whose refresh token has been used twice
+func revokeReused(ctx context.Context, s AuthStorage, session Session) error {
+	log.Println("reused refresh token, revoking session of", session.Login)
+	if err := s.RevokeSession(ctx, session.ID); err != nil {
+		log.Println("can't revoke session:", err)
+	}
+	return ErrWrongRefreshToken
+}
+
+// checkSession returns nil if the session of the access token is still active
+func checkSession(ctx context.Context, s AuthStorage, login, id string) error {
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session.Revoked || session.Login != login || time.Now().After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't generate token:%w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshSecret hashes the secret part of refresh token. It is random, so no slow hash is needed
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession saves a new session
+func (s *AuthDB) CreateSession(ctx context.Context, session Session) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, createSessionQuery, session.ID, session.Login, session.RefreshHash, session.ExpiresAt, session.DeviceID)
+	if err != nil {
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in CreateSession:%w", err)
+	}
+	return nil
+}
+
+// GetSession returns the session by its id
+func (s *AuthDB) GetSession(ctx context.Context, id string) (Session, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	session := Session{ID: id}
+	err := s.db.QueryRowContext(ctx, getSessionQuery, id).Scan(&session.Login, &session.RefreshHash, &session.ExpiresAt, &session.Revoked, &session.DeviceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Session{}, ErrSessionNotFound
+		}
+		return Session{}, fmt.Errorf("error in GetSession:%w", err)
+	}
+	return session, nil
+}
+
+// RotateRefreshToken replaces refresh token hash of the session if the old one is still current
+func (s *AuthDB) RotateRefreshToken(ctx context.Context, id string, oldHash string, newHash string, expires time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, rotateRefreshTokenQuery, id, oldHash, newHash, expires)
+	if err != nil {
+		return fmt.Errorf("error in RotateRefreshToken:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrWrongRefreshToken
+	}
+	return nil
+}
+
+// RevokeSession revokes the session, its tokens are not accepted anymore
+func (s *AuthDB) RevokeSession(ctx context.Context, id string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, revokeSessionQuery, id)
+	if err != nil {
+		return fmt.Errorf("error in RevokeSession:%w", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions revokes all sessions of the user
+func (s *AuthDB) RevokeAllSessions(ctx context.Context, login string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, revokeAllSessionsQuery, login)
+	if err != nil {
+		return fmt.Errorf("error in RevokeAllSessions:%w", err)
+	}
+	return nil
+}
+
+// CreateSession is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) CreateSession(ctx context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[session.Login]; !ok {
+		return ErrUserNotFound
+	}
+	if s.Sessions == nil {
+		s.Sessions = make(map[string]Session)
+	}
+	s.Sessions[session.ID] = session
+	return nil
+}
+
+// GetSession is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) GetSession(ctx context.Context, id string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.Sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// RotateRefreshToken is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) RotateRefreshToken(ctx context.Context, id string, oldHash string, newHash string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.Sessions[id]
+	if !ok || session.Revoked || session.RefreshHash != oldHash {
+		return ErrWrongRefreshToken
+	}
+	session.RefreshHash, session.ExpiresAt = newHash, expires
+	s.Sessions[id] = session
+	return nil
+}
+
+// RevokeSession is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) RevokeSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.Sessions[id]; ok {
+		session.Revoked = true
+		s.Sessions[id] = session
+	}
+	return nil
+}
+
+// RevokeAllSessions is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) RevokeAllSessions(ctx context.Context, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.Sessions {
+		if session.Login == login {
+			session.Revoked = true
+			s.Sessions[id] = session
+		}
+	}
+	return nil
+}
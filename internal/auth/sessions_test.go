@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRefreshSession(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+
+	_, refresh, err := NewSession(ctx, s, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, rotated, err := RefreshSession(ctx, s, refresh)
+	if err != nil {
+		t.Fatalf("RefreshSession(ctx, ) error = %v", err)
+	}
+	if rotated == refresh {
+		t.Error("refresh token is not rotated")
+	}
+
+	// reuse of the rotated token revokes the session
+	if _, _, err := RefreshSession(ctx, s, refresh); err != ErrWrongRefreshToken {
+		t.Errorf("reused token: got %v", err)
+	}
+	if _, _, err := RefreshSession(ctx, s, rotated); err != ErrSessionRevoked {
+		t.Errorf("token of revoked session: got %v", err)
+	}
+
+	if _, _, err := RefreshSession(ctx, s, "malformed"); err != ErrWrongRefreshToken {
+		t.Errorf("malformed token: got %v", err)
+	}
+}
+
+// staleSessions returns sessions as they were before a concurrent refresh rotated the token
+type staleSessions struct {
+	*AuthMemStorage
+	stale Session
+}
+
+func (s staleSessions) GetSession(ctx context.Context, id string) (Session, error) {
+	return s.stale, nil
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+
+	_, refresh, err := NewSession(ctx, s, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, _ := strings.Cut(refresh, ".")
+	stale, err := s.GetSession(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rotated, err := RefreshSession(ctx, s, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the other refresh has read the session before the rotation and loses it
+	if _, _, err := RefreshSession(ctx, staleSessions{s, stale}, refresh); err != ErrWrongRefreshToken {
+		t.Errorf("refresh losing the rotation: got %v", err)
+	}
+	if _, _, err := RefreshSession(ctx, s, rotated); err != ErrSessionRevoked {
+		t.Errorf("session is not revoked after reuse: %v", err)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+	s.Data["other"] = "password"
+
+	_, first, _ := NewSession(ctx, s, "user", "")
+	_, second, _ := NewSession(ctx, s, "user", "")
+	_, other, _ := NewSession(ctx, s, "other", "")
+
+	s.RevokeAllSessions(ctx, "user")
+
+	for _, refresh := range []string{first, second} {
+		if _, _, err := RefreshSession(ctx, s, refresh); err != ErrSessionRevoked {
+			t.Errorf("session is not revoked: %v", err)
+		}
+	}
+	if _, _, err := RefreshSession(ctx, s, other); err != nil {
+		t.Errorf("session of other user is revoked: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+func newSQLite(t *testing.T) (*AuthDB, *database.SQLdb) {
+	t.Helper()
+	conn, dialect, err := database.Open("sqlite://"+filepath.Join(t.TempDir(), "vault.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	authdb := &AuthDB{db: conn, dialect: dialect}
+	db := &database.SQLdb{DB: conn, Dialect: dialect}
+	// creating tables twice must not fail, the server does it on every start
+	for i := 0; i < 2; i++ {
+		if err := authdb.InitAuthDB(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InitDatabase(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return authdb, db
+}
+
+func TestSQLiteUniqueConflicts(t *testing.T) {
+	ctx := context.Background()
+	authdb, db := newSQLite(t)
+	verifier := SRPVerifier{Salt: "salt", Verifier: "verifier"}
+
+	if err := authdb.Register(ctx, "user", verifier); err != nil {
+		t.Fatal(err)
+	}
+	if err := authdb.Register(ctx, "user", verifier); err != ErrUsernameIsTaken {
+		t.Errorf("registering twice: got %v", err)
+	}
+	if err := authdb.Register(ctx, "other", verifier); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := authdb.GetVerifier(ctx, "user"); err != nil || got != verifier {
+		t.Errorf("GetVerifier() = %v, %v", got, err)
+	}
+	if err := authdb.ChangeUsername(ctx, "user", "other", "key"); err != ErrUsernameIsTaken {
+		t.Errorf("renaming to taken username: got %v", err)
+	}
+
+	item := storage.EncryptedData{Name: "item", Data: "data"}
+	if err := db.SetLoginCred(ctx, "user", item); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetLoginCred(ctx, "user", item); err != storage.ErrMetanameIsTaken {
+		t.Errorf("saving login twice: got %v", err)
+	}
+	if err := db.SetLoginCred(ctx, "other", item); err != nil {
+		t.Errorf("same name of other user: got %v", err)
+	}
+	if err := db.SetCard(ctx, "user", item); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetCard(ctx, "user", item); err != storage.ErrMetanameIsTaken {
+		t.Errorf("saving card twice: got %v", err)
+	}
+	if err := db.CreateOrg(ctx, "user", storage.Org{Name: "org", VaultKey: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateOrg(ctx, "other", storage.Org{Name: "org", VaultKey: "key"}); err != storage.ErrMetanameIsTaken {
+		t.Errorf("creating org twice: got %v", err)
+	}
+
+	// shares are updated in place
+	share := storage.Share{Recipient: "other", Kind: "note", Name: "item", Data: "old"}
+	if err := db.SetShare(ctx, "user", share); err != nil {
+		t.Fatal(err)
+	}
+	share.Data = "new"
+	if err := db.SetShare(ctx, "user", share); err != nil {
+		t.Fatal(err)
+	}
+	if shares, err := db.ListSharesReceived(ctx, "other"); err != nil || len(shares) != 1 || shares[0].Data != "new" {
+		t.Errorf("ListSharesReceived() = %v, %v", shares, err)
+	}
+
+	// deleting the account deletes its data
+	if err := authdb.DeleteAccount(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetLoginCred(ctx, "user", "item"); err != storage.ErrDataNotFound {
+		t.Errorf("data of deleted account: got %v", err)
+	}
+	if _, err := db.GetLoginCred(ctx, "other", "item"); err != nil {
+		t.Errorf("data of other account: got %v", err)
+	}
+}
+
+func TestSQLiteTimes(t *testing.T) {
+	ctx := context.Background()
+	authdb, _ := newSQLite(t)
+	if err := authdb.Register(ctx, "user", SRPVerifier{Salt: "salt", Verifier: "verifier"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+	if err := authdb.CreateSession(ctx, Session{ID: "id", Login: "user", RefreshHash: "hash", ExpiresAt: expires}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := authdb.GetSession(ctx, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Login != "user" || !session.ExpiresAt.Equal(expires) || session.Revoked {
+		t.Errorf("GetSession() = %+v", session)
+	}
+
+	now := time.Now().UTC()
+	for i := 1; i <= 2; i++ {
+		f, err := authdb.AddLoginFailure(ctx, "user", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Count != i {
+			t.Errorf("failure %d counted as %d", i, f.Count)
+		}
+	}
+}
+
+func TestSQLiteContext(t *testing.T) {
+	authdb, db := newSQLite(t)
+	verifier := SRPVerifier{Salt: "salt", Verifier: "verifier"}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := authdb.Register(canceled, "user", verifier); !errors.Is(err, context.Canceled) {
+		t.Fatalf("register with canceled context: %v", err)
+	}
+	if _, err := db.ListNotes(canceled, "user"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("list with canceled context: %v", err)
+	}
+	if err := authdb.Register(context.Background(), "user", verifier); err != nil {
+		t.Fatal(err)
+	}
+
+	// the deadline of the storage applies on top of the caller's context
+	authdb.SetQueryTimeout(time.Nanosecond)
+	db.QueryTimeout = time.Nanosecond
+	if err := db.SetNote(context.Background(), "user", storage.EncryptedData{Name: "note", Data: "data"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("set note after deadline: %v", err)
+	}
+	if _, err := authdb.GetLoginFailures(context.Background(), "user"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("get failures after deadline: %v", err)
+	}
+
+	authdb.SetQueryTimeout(0)
+	db.QueryTimeout = 0
+	if err := db.SetNote(context.Background(), "user", storage.EncryptedData{Name: "note", Data: "data"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,420 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Users prove the password with SRP-6a (RFC 5054), so it never leaves the client.
+// The server keeps only a verifier derived from the password by argon2id and can't use it to log in.
+// Accounts registered before have a password hash instead. Their handshakes never verify, like those
+// of unknown accounts, the client sends the password once only if the user allows it and replaces the hash by a verifier
+
+const (
+	// SRPHandshakeTTL is the time the client has to send the proof after starting the handshake
+	SRPHandshakeTTL = time.Minute
+	// maxSRPHandshakes limits handshakes waiting for the proof
+	maxSRPHandshakes = 10000
+)
+
+// 2048-bit group of RFC 5054
+var (
+	srpN, _ = new(big.Int).SetString(""+
+		"AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050"+
+		"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50"+
+		"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8"+
+		"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B"+
+		"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748"+
+		"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6"+
+		"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6"+
+		"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73", 16)
+	srpG = big.NewInt(2)
+	srpK = new(big.Int).SetBytes(srpHash(srpPad(srpN), srpPad(srpG)))
+)
+
+// SRP errors
+var (
+	ErrVerifierNotFound  = errors.New("account has no SRP verifier")
+	ErrHandshakeNotFound = errors.New("SRP handshake not found or expired")
+	ErrTooManyHandshakes = errors.New("too many SRP handshakes in progress")
+	ErrWrongSRPData      = errors.New("malformed SRP data")
+	ErrWrongServerProof  = errors.New("server has failed to prove it knows the verifier")
+)
+
+// SRPVerifier is what the server stores instead of the password
+type SRPVerifier struct {
+	Salt     string `json:"salt"`
+	Verifier string `json:"verifier"`
+}
+
+// SRPStart starts the login handshake with the client public ephemeral value
+type SRPStart struct {
+	Login string `json:"login"`
+	A     string `json:"a"`
+}
+
+// SRPChallenge is the answer to SRPStart
+type SRPChallenge struct {
+	Handshake string `json:"handshake,omitempty"`
+	Salt      string `json:"salt,omitempty"`
+	B         string `json:"b,omitempty"`
+}
+
+// SRPProof is the proof of the client sent in the handshake, or the proof of the server in return
+type SRPProof struct {
+	Handshake string `json:"handshake,omitempty"`
+	Proof     string `json:"proof"`
+}
+
+// Valid checks that the verifier is well-formed
+func (v SRPVerifier) Valid() bool {
+	salt, err1 := base64.StdEncoding.DecodeString(v.Salt)
+	verifier, err2 := decodeSRPInt(v.Verifier)
+	return err1 == nil && err2 == nil && len(salt) >= 16 && verifier.Sign() > 0
+}
+
+// NewSRPVerifier derives a verifier of the password with a new random salt
+func NewSRPVerifier(password string) (SRPVerifier, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return SRPVerifier{}, fmt.Errorf("can't generate salt:%w", err)
+	}
+	v := new(big.Int).Exp(srpG, srpX(salt, password), srpN)
+	return SRPVerifier{
+		Salt:     base64.StdEncoding.EncodeToString(salt),
+		Verifier: encodeSRPInt(v),
+	}, nil
+}
+
+// SRPClient is the client side of the login handshake
+type SRPClient struct {
+	login string
+	a     *big.Int
+	A     *big.Int
+	// expected proof of the server
+	m2 []byte
+}
+
+// NewSRPClient generates the ephemeral values of the client
+func NewSRPClient(login string) (*SRPClient, error) {
+	a, err := srpRandom()
+	if err != nil {
+		return nil, err
+	}
+	return &SRPClient{login: login, a: a, A: new(big.Int).Exp(srpG, a, srpN)}, nil
+}
+
+// Start returns the first message of the handshake
+func (c *SRPClient) Start() SRPStart {
+	return SRPStart{Login: c.login, A: encodeSRPInt(c.A)}
+}
+
+// Proof returns the proof of the password for the challenge of the server
+func (c *SRPClient) Proof(password string, ch SRPChallenge) (SRPProof, error) {
+	salt, err := base64.StdEncoding.DecodeString(ch.Salt)
+	if err != nil {
+		return SRPProof{}, ErrWrongSRPData
+	}
+	B, err := decodeSRPInt(ch.B)
+	if err != nil || new(big.Int).Mod(B, srpN).Sign() == 0 {
+		return SRPProof{}, ErrWrongSRPData
+	}
+	u := srpU(c.A, B)
+	if u.Sign() == 0 {
+		return SRPProof{}, ErrWrongSRPData
+	}
+
+	// S = (B - k*g^x)^(a + u*x)
+	x := srpX(salt, password)
+	base := new(big.Int).Exp(srpG, x, srpN)
+	base.Mul(base, srpK)
+	base.Sub(B, base)
+	base.Mod(base, srpN)
+	exp := new(big.Int).Mul(u, x)
+	exp.Add(exp, c.a)
+	S := new(big.Int).Exp(base, exp, srpN)
+
+	m1, m2 := srpProofs(c.login, salt, c.A, B, S)
+	c.m2 = m2
+	return SRPProof{Handshake: ch.Handshake, Proof: base64.StdEncoding.EncodeToString(m1)}, nil
+}
+
+// VerifyServer checks the proof of the server, it shows the server holds the verifier
+func (c *SRPClient) VerifyServer(proof SRPProof) error {
+	m2, err := base64.StdEncoding.DecodeString(proof.Proof)
+	if err != nil || c.m2 == nil || !hmac.Equal(m2, c.m2) {
+		return ErrWrongServerProof
+	}
+	return nil
+}
+
+type srpHandshake struct {
+	login   string
+	salt    []byte
+	v       *big.Int
+	A, B, b *big.Int
+	expires time.Time
+}
+
+// SRPHandshakes keeps handshakes of the server waiting for the proof of the client
+type SRPHandshakes struct {
+	mu      sync.Mutex
+	pending map[string]srpHandshake
+	// salts of unknown accounts are derived from it, so they look the same on every attempt
+	secret []byte
+}
+
+// NewSRPHandshakes returns an empty handshake store
+func NewSRPHandshakes() *SRPHandshakes {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return &SRPHandshakes{pending: make(map[string]srpHandshake), secret: secret}
+}
+
+// Start begins the handshake for the login. Unknown accounts and legacy ones without verifier
+// get a challenge which never verifies, so they can't be told from accounts with verifier
+func (h *SRPHandshakes) Start(ctx context.Context, s AuthStorage, start SRPStart) (SRPChallenge, error) {
+	A, err := decodeSRPInt(start.A)
+	if err != nil || new(big.Int).Mod(A, srpN).Sign() == 0 {
+		return SRPChallenge{}, ErrWrongSRPData
+	}
+
+	hs := srpHandshake{login: start.Login, A: A, expires: time.Now().Add(SRPHandshakeTTL)}
+	verifier, err := s.GetVerifier(ctx, start.Login)
+	switch err {
+	case nil:
+		hs.salt, err = base64.StdEncoding.DecodeString(verifier.Salt)
+		if err != nil {
+			return SRPChallenge{}, fmt.Errorf("error decoding salt:%w", err)
+		}
+		if hs.v, err = decodeSRPInt(verifier.Verifier); err != nil {
+			return SRPChallenge{}, fmt.Errorf("error decoding verifier:%w", err)
+		}
+	case ErrVerifierNotFound, ErrUserNotFound:
+		mac := hmac.New(sha256.New, h.secret)
+		mac.Write([]byte(start.Login))
+		hs.salt = mac.Sum(nil)[:16]
+		hs.v = big.NewInt(0)
+	default:
+		return SRPChallenge{}, err
+	}
+
+	// B = k*v + g^b
+	if hs.b, err = srpRandom(); err != nil {
+		return SRPChallenge{}, err
+	}
+	hs.B = new(big.Int).Mul(srpK, hs.v)
+	hs.B.Add(hs.B, new(big.Int).Exp(srpG, hs.b, srpN))
+	hs.B.Mod(hs.B, srpN)
+
+	id, err := randomToken(16)
+	if err != nil {
+		return SRPChallenge{}, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.pending) >= maxSRPHandshakes {
+		h.prune(time.Now())
+		if len(h.pending) >= maxSRPHandshakes {
+			return SRPChallenge{}, ErrTooManyHandshakes
+		}
+	}
+	h.pending[id] = hs
+
+	return SRPChallenge{
+		Handshake: id,
+		Salt:      base64.StdEncoding.EncodeToString(hs.salt),
+		B:         encodeSRPInt(hs.B),
+	}, nil
+}
+
+// Finish checks the proof of the client and returns the proof of the server.
+// A handshake is used once, whatever the result
+func (h *SRPHandshakes) Finish(login string, proof SRPProof) (SRPProof, error) {
+	h.mu.Lock()
+	hs, ok := h.pending[proof.Handshake]
+	delete(h.pending, proof.Handshake)
+	h.mu.Unlock()
+	if !ok || hs.login != login || time.Now().After(hs.expires) {
+		return SRPProof{}, ErrHandshakeNotFound
+	}
+	if hs.v.Sign() == 0 {
+		return SRPProof{}, ErrWrongPassword
+	}
+
+	m1, err := base64.StdEncoding.DecodeString(proof.Proof)
+	if err != nil {
+		return SRPProof{}, ErrWrongSRPData
+	}
+
+	// S = (A * v^u)^b
+	u := srpU(hs.A, hs.B)
+	S := new(big.Int).Exp(hs.v, u, srpN)
+	S.Mul(S, hs.A)
+	S.Exp(S, hs.b, srpN)
+
+	want, m2 := srpProofs(hs.login, hs.salt, hs.A, hs.B, S)
+	if subtle.ConstantTimeCompare(m1, want) != 1 {
+		return SRPProof{}, ErrWrongPassword
+	}
+	return SRPProof{Proof: base64.StdEncoding.EncodeToString(m2)}, nil
+}
+
+func (h *SRPHandshakes) prune(now time.Time) {
+	for id, hs := range h.pending {
+		if now.After(hs.expires) {
+			delete(h.pending, id)
+		}
+	}
+}
+
+// srpX derives the private value out of the password, argon2id makes guessing it out of the verifier slow
+func srpX(salt []byte, password string) *big.Int {
+	key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 2, 32)
+	return new(big.Int).SetBytes(srpHash(salt, key))
+}
+
+func srpU(A, B *big.Int) *big.Int {
+	return new(big.Int).SetBytes(srpHash(srpPad(A), srpPad(B)))
+}
+
+// srpProofs returns M1 = H(H(N) xor H(g) | H(I) | s | A | B | K) and M2 = H(A | M1 | K)
+func srpProofs(login string, salt []byte, A, B, S *big.Int) (m1 []byte, m2 []byte) {
+	K := srpHash(srpPad(S))
+	hn, hg := srpHash(srpN.Bytes()), srpHash(srpG.Bytes())
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+	m1 = srpHash(hn, srpHash([]byte(login)), salt, srpPad(A), srpPad(B), K)
+	m2 = srpHash(srpPad(A), m1, K)
+	return m1, m2
+}
+
+func srpHash(parts ...[]byte) []byte {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// srpPad returns the number as bytes of the length of N
+func srpPad(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, (srpN.BitLen()+7)/8))
+}
+
+func srpRandom() (*big.Int, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("can't generate SRP value:%w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func encodeSRPInt(n *big.Int) string {
+	return base64.StdEncoding.EncodeToString(srpPad(n))
+}
+
+func decodeSRPInt(s string) (*big.Int, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 || len(b) > (srpN.BitLen()+7)/8 {
+		return nil, ErrWrongSRPData
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// GetVerifier returns the SRP verifier of the user.
+// Returns ErrVerifierNotFound for legacy accounts which have a password hash only
+func (s *AuthDB) GetVerifier(ctx context.Context, login string) (SRPVerifier, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var v SRPVerifier
+	var salt, verifier sql.NullString
+	err := s.db.QueryRowContext(ctx, getVerifierQuery, login).Scan(&salt, &verifier)
+	switch {
+	case err == sql.ErrNoRows:
+		return SRPVerifier{}, ErrUserNotFound
+	case err != nil:
+		return SRPVerifier{}, fmt.Errorf("error in GetVerifier:%w", err)
+	case !salt.Valid:
+		return SRPVerifier{}, ErrVerifierNotFound
+	}
+	v.Salt, v.Verifier = salt.String, verifier.String
+	return v, nil
+}
+
+// SetVerifier saves the SRP verifier of the user and deletes the legacy password hash
+func (s *AuthDB) SetVerifier(ctx context.Context, login string, v SRPVerifier) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in SetVerifier:%w", err)
+	}
+	defer tx.Rollback()
+
+	err = setVerifierTx(ctx, tx, login, v)
+	switch err {
+	case nil:
+	case ErrUserNotFound:
+		return err
+	default:
+		return fmt.Errorf("error in SetVerifier:%w", err)
+	}
+	return tx.Commit()
+}
+
+func setVerifierTx(ctx context.Context, tx *sql.Tx, login string, v SRPVerifier) error {
+	res, err := tx.ExecContext(ctx, setVerifierQuery, login, v.Salt, v.Verifier)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	_, err = tx.ExecContext(ctx, deletePasswordQuery, login)
+	return err
+}
+
+// GetVerifier is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) GetVerifier(ctx context.Context, login string) (SRPVerifier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return SRPVerifier{}, ErrUserNotFound
+	}
+	v, ok := s.Verifiers[login]
+	if !ok {
+		return SRPVerifier{}, ErrVerifierNotFound
+	}
+	return v, nil
+}
+
+// SetVerifier is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) SetVerifier(ctx context.Context, login string, v SRPVerifier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	s.Verifiers[login] = v
+	s.Data[login] = ""
+	return nil
+}
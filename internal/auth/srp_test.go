@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestSRPGroup(t *testing.T) {
+	q := new(big.Int).Rsh(srpN, 1)
+	if srpN.BitLen() != 2048 || !srpN.ProbablyPrime(20) || !q.ProbablyPrime(20) {
+		t.Error("N is not a 2048-bit safe prime")
+	}
+}
+
+// srpLogin runs the handshake and returns the error of the server and the client
+func srpLogin(t *testing.T, s AuthStorage, h *SRPHandshakes, login, password string) (error, error) {
+	t.Helper()
+	ctx := context.Background()
+	client, err := NewSRPClient(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := h.Start(ctx, s, client.Start())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := client.Proof(password, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverProof, err := h.Finish(login, proof)
+	if err != nil {
+		return err, nil
+	}
+	return nil, client.VerifyServer(serverProof)
+}
+
+func TestSRPHandshake(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	h := NewSRPHandshakes()
+
+	verifier, err := NewSRPVerifier("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifier.Valid() {
+		t.Fatal("new verifier is not valid")
+	}
+	if err := s.Register(ctx, "user", verifier); err != nil {
+		t.Fatal(err)
+	}
+
+	if serr, cerr := srpLogin(t, s, h, "user", "password"); serr != nil || cerr != nil {
+		t.Errorf("right password: server %v, client %v", serr, cerr)
+	}
+	if serr, _ := srpLogin(t, s, h, "user", "wrong"); serr != ErrWrongPassword {
+		t.Errorf("wrong password: got %v", serr)
+	}
+	if serr, _ := srpLogin(t, s, h, "nobody", "password"); serr != ErrWrongPassword {
+		t.Errorf("unknown user: got %v", serr)
+	}
+	if err := s.VerifyCredentials(ctx, "user", ""); err == nil {
+		t.Error("empty legacy password is accepted")
+	}
+}
+
+func TestSRPHandshakeOnce(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	h := NewSRPHandshakes()
+	verifier, _ := NewSRPVerifier("password")
+	s.Register(ctx, "user", verifier)
+
+	client, _ := NewSRPClient("user")
+	challenge, err := h.Start(ctx, s, client.Start())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, _ := client.Proof("password", challenge)
+	if _, err := h.Finish("other", proof); err != ErrHandshakeNotFound {
+		t.Errorf("handshake of other login: got %v", err)
+	}
+	if _, err := h.Finish("user", proof); err != ErrHandshakeNotFound {
+		t.Errorf("used handshake: got %v", err)
+	}
+}
+
+func TestSRPLegacyAccount(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+	h := NewSRPHandshakes()
+
+	// legacy accounts look like unknown ones and never verify
+	client, _ := NewSRPClient("user")
+	challenge, err := h.Start(ctx, s, client.Start())
+	if err != nil || challenge.Salt == "" || challenge.B == "" {
+		t.Fatalf("legacy account: %+v, %v", challenge, err)
+	}
+	if serr, _ := srpLogin(t, s, h, "user", "password"); serr != ErrWrongPassword {
+		t.Errorf("legacy account handshake: got %v", serr)
+	}
+
+	verifier, _ := NewSRPVerifier("password")
+	if err := s.SetVerifier(ctx, "user", verifier); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.VerifyCredentials(ctx, "user", "password"); err == nil {
+		t.Error("password hash is kept after upgrade")
+	}
+	if serr, cerr := srpLogin(t, s, h, "user", "password"); serr != nil || cerr != nil {
+		t.Errorf("upgraded account: server %v, client %v", serr, cerr)
+	}
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+const (
+	// MaxLoginFailures is the number of failed logins in a row after which the account is locked
+	MaxLoginFailures = 5
+	// LockoutTime is how long the account stays locked
+	LockoutTime = 15 * time.Minute
+	// BackoffBase is the wait after the first failure, it doubles with every next one up to MaxBackoff
+	BackoffBase = time.Second
+	MaxBackoff  = 5 * time.Minute
+	// FailuresTTL is the time after the last failure when the failures are forgotten
+	FailuresTTL = 24 * time.Hour
+)
+
+// LoginFailures is a counter of failed logins in a row of an account
+type LoginFailures struct {
+	Count       int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// RetryAfter returns how long to wait before the next login attempt, zero if it is allowed now
+func (f LoginFailures) RetryAfter(now time.Time) time.Duration {
+	wait := f.LockedUntil.Sub(now)
+	if backoffWait := f.LastFailure.Add(backoff(f.Count)).Sub(now); backoffWait > wait {
+		wait = backoffWait
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// next returns the counter after one more failure. The account is locked after MaxLoginFailures
+// and the counter starts over, so the next lockout takes MaxLoginFailures failures again
+func (f LoginFailures) next(now time.Time) LoginFailures {
+	if now.Sub(f.LastFailure) > FailuresTTL {
+		f.Count = 0
+	}
+	f.Count++
+	f.LastFailure = now
+	if f.Count >= MaxLoginFailures {
+		f.Count = 0
+		f.LockedUntil = now.Add(LockoutTime)
+	}
+	return f
+}
+
+// backoff is the exponential wait after n failures
+func backoff(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	wait := BackoffBase
+	for i := 1; i < n && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxBackoff {
+		return MaxBackoff
+	}
+	return wait
+}
+
+// Limiter throttles attempts by a key such as IP address in memory.
+// First free attempts go without waiting, then the wait grows exponentially
+type Limiter struct {
+	mu      sync.Mutex
+	free    int
+	entries map[string]LoginFailures
+}
+
+// NewLimiter returns a limiter allowing free attempts before backoff
+func NewLimiter(free int) *Limiter {
+	return &Limiter{
+		free:    free,
+		entries: make(map[string]LoginFailures),
+	}
+}
+
+// RetryAfter returns how long the key has to wait before the next attempt
+func (l *Limiter) RetryAfter(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f := l.entries[key]
+	f.Count -= l.free
+	return f.RetryAfter(now)
+}
+
+// Fail counts a failed attempt of the key
+func (l *Limiter) Fail(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f := l.entries[key]
+	if now.Sub(f.LastFailure) > FailuresTTL {
+		f.Count = 0
+	}
+	f.Count++
+	f.LastFailure = now
+	l.entries[key] = f
+
+	// forget stale keys, so the map doesn't grow forever
+	if len(l.entries)%1024 == 0 {
+		for k, e := range l.entries {
+			if now.Sub(e.LastFailure) > FailuresTTL {
+				delete(l.entries, k)
+			}
+		}
+	}
+}
+
+// Reset forgets failures of the key
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// GetLoginFailures returns failed logins counter of the login, zero if there are none
+func (s *AuthDB) GetLoginFailures(ctx context.Context, login string) (LoginFailures, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var f LoginFailures
+	var locked sql.NullTime
+	err := s.db.QueryRowContext(ctx, getLoginFailuresQuery, login).Scan(&f.Count, &f.LastFailure, &locked)
+	switch err {
+	case nil:
+		f.LockedUntil = locked.Time
+		return f, nil
+	case sql.ErrNoRows:
+		return LoginFailures{}, nil
+	default:
+		return LoginFailures{}, fmt.Errorf("error in GetLoginFailures:%w", err)
+	}
+}
+
+// AddLoginFailure counts a failed login and returns the new counter
+func (s *AuthDB) AddLoginFailure(ctx context.Context, login string, now time.Time) (LoginFailures, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return LoginFailures{}, err
+	}
+	defer tx.Rollback()
+
+	var f LoginFailures
+	var locked sql.NullTime
+	// SQLite has no row locks, its transactions take the write lock of the database at once
+	query := getLoginFailuresForUpdateQuery
+	if s.dialect == database.SQLite {
+		query = getLoginFailuresQuery
+	}
+	err = tx.QueryRowContext(ctx, query, login).Scan(&f.Count, &f.LastFailure, &locked)
+	if err != nil && err != sql.ErrNoRows {
+		return LoginFailures{}, fmt.Errorf("error in AddLoginFailure:%w", err)
+	}
+	f.LockedUntil = locked.Time
+
+	f = f.next(now)
+	locked = sql.NullTime{Time: f.LockedUntil, Valid: !f.LockedUntil.IsZero()}
+	if _, err := tx.ExecContext(ctx, setLoginFailuresQuery, login, f.Count, f.LastFailure, locked); err != nil {
+		return LoginFailures{}, fmt.Errorf("error in AddLoginFailure:%w", err)
+	}
+	return f, tx.Commit()
+}
+
+// ResetLoginFailures forgets failed logins and unlocks the account
+func (s *AuthDB) ResetLoginFailures(ctx context.Context, login string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, resetLoginFailuresQuery, login); err != nil {
+		return fmt.Errorf("error in ResetLoginFailures:%w", err)
+	}
+	return nil
+}
+
+func (s *AuthMemStorage) GetLoginFailures(ctx context.Context, login string) (LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Failures[login], nil
+}
+
+func (s *AuthMemStorage) AddLoginFailure(ctx context.Context, login string, now time.Time) (LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.Failures[login].next(now)
+	s.Failures[login] = f
+	return f, nil
+}
+
+func (s *AuthMemStorage) ResetLoginFailures(ctx context.Context, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Failures, login)
+	return nil
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{100, MaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginFailuresLockout(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	now := time.Now()
+
+	var f LoginFailures
+	var err error
+	for i := 1; i < MaxLoginFailures; i++ {
+		if f, err = s.AddLoginFailure(ctx, "user", now); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := f.RetryAfter(now), backoff(i); got != want {
+			t.Errorf("wait after %d failures = %v, want %v", i, got, want)
+		}
+	}
+
+	f, _ = s.AddLoginFailure(ctx, "user", now)
+	if got := f.RetryAfter(now); got != LockoutTime {
+		t.Errorf("wait after lockout = %v, want %v", got, LockoutTime)
+	}
+	if got := f.RetryAfter(now.Add(LockoutTime)); got != 0 {
+		t.Errorf("wait after lockout is over = %v", got)
+	}
+
+	// admin unlock
+	s.ResetLoginFailures(ctx, "user")
+	f, _ = s.GetLoginFailures(ctx, "user")
+	if got := f.RetryAfter(now); got != 0 {
+		t.Errorf("wait after unlock = %v", got)
+	}
+}
+
+func TestLoginFailuresForgotten(t *testing.T) {
+	now := time.Now()
+	f := LoginFailures{}.next(now).next(now).next(now)
+	f = f.next(now.Add(FailuresTTL + time.Second))
+	if f.Count != 1 {
+		t.Errorf("failures after TTL = %d, want 1", f.Count)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2)
+	now := time.Now()
+
+	l.Fail("ip", now)
+	l.Fail("ip", now)
+	if got := l.RetryAfter("ip", now); got != 0 {
+		t.Errorf("wait within free attempts = %v", got)
+	}
+	l.Fail("ip", now)
+	if got := l.RetryAfter("ip", now); got != BackoffBase {
+		t.Errorf("wait after free attempts = %v, want %v", got, BackoffBase)
+	}
+	if got := l.RetryAfter("other", now); got != 0 {
+		t.Errorf("wait of other key = %v", got)
+	}
+
+	l.Reset("ip")
+	if got := l.RetryAfter("ip", now); got != 0 {
+		t.Errorf("wait after reset = %v", got)
+	}
+}
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+
+	"github.com/gambruh/simplevault/internal/storage/database"
+)
+
+const (
+	totpIssuer = "simplevault"
+	totpPeriod = 30
+	totpDigits = 6
+	// number of periods before and after current one in which codes are still accepted
+	totpSkew = 1
+
+	backupCodesNumber = 10
+)
+
+// TOTPData is exchanged between client and server when enrolling into two-factor authentication
+type TOTPData struct {
+	Secret      string   `json:"secret,omitempty"`
+	URI         string   `json:"uri,omitempty"`
+	Code        string   `json:"code,omitempty"`
+	BackupCodes []string `json:"backupcodes,omitempty"`
+}
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random base32 encoded TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("can't generate TOTP secret:%w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns otpauth URI to be added to an authenticator app
+func TOTPURI(login, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+login) + "?" + v.Encode()
+}
+
+// TOTPCode returns TOTP code (RFC 6238) of the secret for the moment t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("can't decode TOTP secret:%w", err)
+	}
+	return hotp(key, uint64(t.Unix()/totpPeriod)), nil
+}
+
+// ValidateTOTP checks the code against the secret, allowing clock skew of one period
+func ValidateTOTP(secret, code string, t time.Time) bool {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return false
+	}
+	counter := t.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		expected := hotp(key, uint64(counter+int64(i)))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// hotp returns HOTP code (RFC 4226) of the key for the counter
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// GenerateBackupCodes returns one-time codes to be used instead of TOTP codes
+func GenerateBackupCodes() ([]string, error) {
+	codes := make([]string, backupCodesNumber)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("can't generate backup codes:%w", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// CheckSecondFactor checks TOTP code or a backup code of a user with enabled two-factor authentication.
+// Used backup codes are burned
+func CheckSecondFactor(ctx context.Context, s AuthStorage, login string, code string) error {
+	secret, enabled, err := s.GetTOTP(ctx, login)
+	if err != nil {
+		if err == ErrTOTPNotEnabled {
+			return nil
+		}
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	if code == "" {
+		return ErrSecondFactorRequired
+	}
+	if ValidateTOTP(secret, code, time.Now()) {
+		return nil
+	}
+	return s.UseBackupCode(ctx, login, code)
+}
+
+// SetTOTP saves a new TOTP secret of the user. It is not enabled until EnableTOTP is called
+func (s *AuthDB) SetTOTP(ctx context.Context, login string, secret string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, setTOTPQuery, login, secret)
+	if err != nil {
+		if database.IsNotNullViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("error in SetTOTP:%w", err)
+	}
+	return nil
+}
+
+// EnableTOTP enables two-factor authentication and replaces user's backup codes, which are stored hashed.
+// Returns ErrTOTPNotEnabled if there is no secret set by SetTOTP
+func (s *AuthDB) EnableTOTP(ctx context.Context, login string, backupcodes []string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in EnableTOTP:%w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, enableTOTPQuery, login)
+	if err != nil {
+		return fmt.Errorf("error in EnableTOTP:%w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrTOTPNotEnabled
+	}
+	if _, err := tx.ExecContext(ctx, deleteBackupCodesQuery, login); err != nil {
+		return fmt.Errorf("error deleting backup codes in EnableTOTP:%w", err)
+	}
+	for _, code := range backupcodes {
+		hash, err := argon2id.CreateHash(code, argon2id.DefaultParams)
+		if err != nil {
+			return fmt.Errorf("error when trying to hash backup code:%w", err)
+		}
+		if _, err := tx.ExecContext(ctx, addBackupCodeQuery, login, hash); err != nil {
+			return fmt.Errorf("error adding backup code in EnableTOTP:%w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP removes TOTP secret and backup codes of the user
+func (s *AuthDB) DisableTOTP(ctx context.Context, login string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, deleteTOTPQuery, login)
+	if err != nil {
+		return fmt.Errorf("error in DisableTOTP:%w", err)
+	}
+	_, err = s.db.ExecContext(ctx, deleteBackupCodesQuery, login)
+	if err != nil {
+		return fmt.Errorf("error deleting backup codes in DisableTOTP:%w", err)
+	}
+	return nil
+}
+
+// GetTOTP returns user's TOTP secret and whether two-factor authentication is enabled
+func (s *AuthDB) GetTOTP(ctx context.Context, login string) (secret string, enabled bool, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err = s.db.QueryRowContext(ctx, getTOTPQuery, login).Scan(&secret, &enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, ErrTOTPNotEnabled
+		}
+		return "", false, fmt.Errorf("error in GetTOTP:%w", err)
+	}
+	return secret, enabled, nil
+}
+
+// UseBackupCode checks the backup code and deletes it, so it can't be used again
+func (s *AuthDB) UseBackupCode(ctx context.Context, login string, code string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, listBackupCodesQuery, login)
+	if err != nil {
+		return fmt.Errorf("couldn't ask database in UseBackupCode:%w", err)
+	}
+	defer rows.Close()
+
+	var matched = -1
+	for rows.Next() {
+		var (
+			id   int
+			hash string
+		)
+		if err := rows.Scan(&id, &hash); err != nil {
+			return fmt.Errorf("error scanning in UseBackupCode:%w", err)
+		}
+		if check, err := argon2id.ComparePasswordAndHash(code, hash); err == nil && check {
+			matched = id
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error scanning with rows.Next() in UseBackupCode:%w", err)
+	}
+	if matched < 0 {
+		return ErrWrongSecondFactor
+	}
+
+	if _, err := s.db.ExecContext(ctx, deleteBackupCodeQuery, matched); err != nil {
+		return fmt.Errorf("error deleting backup code in UseBackupCode:%w", err)
+	}
+	return nil
+}
+
+// SetTOTP is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) SetTOTP(ctx context.Context, login string, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Data[login]; !ok {
+		return ErrUserNotFound
+	}
+	if s.TOTP == nil {
+		s.TOTP = make(map[string]memTOTP)
+	}
+	// backup codes stay until EnableTOTP replaces them, as in the database
+	totp := s.TOTP[login]
+	totp.secret, totp.enabled = secret, false
+	s.TOTP[login] = totp
+	return nil
+}
+
+// EnableTOTP is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) EnableTOTP(ctx context.Context, login string, backupcodes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.TOTP[login]
+	if !ok {
+		return ErrTOTPNotEnabled
+	}
+	totp.enabled = true
+	totp.backupcodes = nil
+	for _, code := range backupcodes {
+		hash, err := argon2id.CreateHash(code, argon2id.DefaultParams)
+		if err != nil {
+			return fmt.Errorf("error when trying to hash backup code:%w", err)
+		}
+		totp.backupcodes = append(totp.backupcodes, hash)
+	}
+	s.TOTP[login] = totp
+	return nil
+}
+
+// DisableTOTP is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) DisableTOTP(ctx context.Context, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.TOTP, login)
+	return nil
+}
+
+// GetTOTP is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) GetTOTP(ctx context.Context, login string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.TOTP[login]
+	if !ok {
+		return "", false, ErrTOTPNotEnabled
+	}
+	return totp.secret, totp.enabled, nil
+}
+
+// UseBackupCode is a method for inmemory implementation of AuthStorage interface
+func (s *AuthMemStorage) UseBackupCode(ctx context.Context, login string, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.TOTP[login]
+	if !ok {
+		return ErrWrongSecondFactor
+	}
+	for i, hash := range totp.backupcodes {
+		if check, err := argon2id.ComparePasswordAndHash(code, hash); err == nil && check {
+			totp.backupcodes = append(totp.backupcodes[:i], totp.backupcodes[i+1:]...)
+			s.TOTP[login] = totp
+			return nil
+		}
+	}
+	return ErrWrongSecondFactor
+}
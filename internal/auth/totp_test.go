@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 test secret "12345678901234567890", truncated to 6 digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, _ := TOTPCode(secret, now)
+	if !ValidateTOTP(secret, code, now) {
+		t.Error("current code is not valid")
+	}
+	if !ValidateTOTP(secret, code, now.Add(totpPeriod*time.Second)) {
+		t.Error("code of previous period is not valid")
+	}
+	if ValidateTOTP(secret, code, now.Add(3*totpPeriod*time.Second)) {
+		t.Error("stale code is valid")
+	}
+}
+
+func TestCheckSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	s.Data["user"] = "password"
+	if err := CheckSecondFactor(ctx, s, "user", ""); err != nil {
+		t.Errorf("user without 2FA: got %v", err)
+	}
+
+	secret, _ := GenerateTOTPSecret()
+	s.SetTOTP(ctx, "user", secret)
+	s.EnableTOTP(ctx, "user", []string{"aaaa-bbbb"})
+
+	if err := CheckSecondFactor(ctx, s, "user", ""); err != ErrSecondFactorRequired {
+		t.Errorf("missing code: got %v", err)
+	}
+	if err := CheckSecondFactor(ctx, s, "user", "000000x"); err != ErrWrongSecondFactor {
+		t.Errorf("wrong code: got %v", err)
+	}
+	code, _ := TOTPCode(secret, time.Now())
+	if err := CheckSecondFactor(ctx, s, "user", code); err != nil {
+		t.Errorf("valid code: got %v", err)
+	}
+	if err := CheckSecondFactor(ctx, s, "user", "aaaa-bbbb"); err != nil {
+		t.Errorf("backup code: got %v", err)
+	}
+	if err := CheckSecondFactor(ctx, s, "user", "aaaa-bbbb"); err != ErrWrongSecondFactor {
+		t.Errorf("reused backup code: got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/securebuf"
+)
+
+// confirmPassword proves the password of the current user with SRP handshake
+func (c *Client) confirmPassword(password string) (auth.AccountData, error) {
+	user, err := readUserFile()
+	if err != nil {
+		return auth.AccountData{}, ErrLoginRequired
+	}
+	return c.proveLogin(user.Login, password)
+}
+
+// proveLogin proves the password of the login with SRP handshake, the user data file may not be written yet
+func (c *Client) proveLogin(login, password string) (auth.AccountData, error) {
+	_, proof, err := c.srpProve(login, password)
+	if err != nil {
+		return auth.AccountData{}, err
+	}
+	return auth.AccountData{Handshake: proof.Handshake, Proof: proof.Proof}, nil
+}
+
+func (c *Client) sendAccountRequest(path string, data auth.AccountData) (*http.Response, error) {
+	res, err := c.sendJSON(http.MethodPost, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("error in sendAccountRequest: %w", err)
+	}
+
+	switch res.StatusCode {
+	case 200:
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 400:
+		return nil, ErrBadRequest
+	case 401:
+		return nil, ErrLoginRequired
+	case 403:
+		return nil, ErrWrongLoginData
+	case 409:
+		return nil, ErrUsernameIsTaken
+	case 429:
+		return nil, tooManyAttempts(res)
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+// ChangeUsernameCommand renames the account. The vault key is wrapped anew with a new salt
+func (c *Client) ChangeUsernameCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 3 {
+		printChangeUsernameSyntax()
+		return
+	}
+	if c.AuthCookie == nil || c.Key == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	newLogin, password := input[1], input[2]
+
+	encoded, err := wrapWithPassword(c.Key, password)
+	if err != nil {
+		fmt.Println("can't change username:", err)
+		return
+	}
+
+	data, err := c.confirmPassword(password)
+	if err != nil {
+		fmt.Println("can't change username:", err)
+		return
+	}
+	data.Login, data.VaultKey = newLogin, encoded
+	res, err := c.sendAccountRequest("/api/user/rename", data)
+	if err != nil {
+		fmt.Println("can't change username:", err)
+		return
+	}
+	defer res.Body.Close()
+
+	// the server issues an access token for the new username
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == auth.AccessCookie {
+			c.sessionMu.Lock()
+			c.AuthCookie = cookie
+			c.sessionMu.Unlock()
+		}
+	}
+	markVerifier(newLogin)
+	if err := c.createUserLoginFile(newLogin, password, encoded); err != nil {
+		fmt.Println("can't save user data file:", err)
+	}
+	// the login key of this device stays registered, it signs in under the new username
+	if key, err := readLoginKeyFile(); err == nil {
+		key.Login = newLogin
+		if data, err := json.Marshal(key); err == nil {
+			writeLoginKeyFile(data)
+		}
+	}
+	fmt.Println("Username is changed to", newLogin)
+}
+
+// DeleteAccountCommand deletes the account with all the data on the server,
+// then wipes the local storage and the user data file
+func (c *Client) DeleteAccountCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 2 {
+		printDeleteAccountSyntax()
+		return
+	}
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	// the command itself is running, anything else means synchronization is in progress
+	if c.lock.busy > 1 {
+		fmt.Println("synchronization is in progress, try again")
+		return
+	}
+
+	data, err := c.confirmPassword(input[1])
+	if err != nil {
+		fmt.Println("can't delete account:", err)
+		return
+	}
+	res, err := c.sendAccountRequest("/api/user/delete", data)
+	if err != nil {
+		fmt.Println("can't delete account:", err)
+		return
+	}
+	res.Body.Close()
+
+	c.WipeKeys()
+	securebuf.Wipe(c.lock.pinKey)
+	c.lock.pinKey, c.lock.pinSalt = nil, nil
+	c.DeleteLocalStorage()
+	if err := os.Remove(config.ClientCfg.UserDataFile); err != nil && !os.IsNotExist(err) {
+		fmt.Println("can't remove user data file:", err)
+	}
+	os.Remove(loginKeyPath())
+	fmt.Println("Account is deleted")
+}
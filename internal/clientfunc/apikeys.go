@@ -0,0 +1,135 @@
+package clientfunc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/helpers"
+)
+
+// parseAPIKeyOptions parses options of createapikey command: ttl=<duration>, readonly, kinds=<list>, orgs=<list>
+func parseAPIKeyOptions(options []string) (auth.APIKeyData, error) {
+	var data auth.APIKeyData
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		switch name {
+		case "readonly":
+			data.Scope.ReadOnly = true
+		case "ttl":
+			ttl, err := time.ParseDuration(value)
+			if err != nil || ttl < time.Second {
+				return data, fmt.Errorf("wrong ttl %q", value)
+			}
+			data.TTL = int64(ttl.Seconds())
+		case "kinds":
+			data.Scope.Kinds = strings.Split(value, ",")
+		case "orgs":
+			data.Scope.Orgs = strings.Split(value, ",")
+		default:
+			return data, fmt.Errorf("unknown option %q", option)
+		}
+	}
+	return data, nil
+}
+
+// CreateAPIKeyCommand creates an API key for scripts, the key is shown only once
+func (c *Client) CreateAPIKeyCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) < 2 {
+		printCreateAPIKeySyntax()
+		return
+	}
+
+	data, err := parseAPIKeyOptions(input[2:])
+	if err != nil {
+		fmt.Println(err)
+		printCreateAPIKeySyntax()
+		return
+	}
+	data.Name = input[1]
+
+	created, err := c.sendCreateAPIKeyRequest(data)
+	if err != nil {
+		fmt.Println("can't create API key:", err)
+		return
+	}
+	fmt.Println("API key is created, it is shown only once:")
+	fmt.Println("  ", created.Key)
+	fmt.Println("Send it in header: Authorization: Bearer <key>")
+}
+
+// ListAPIKeysCommand prints API keys of the user
+func (c *Client) ListAPIKeysCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 1 {
+		printListAPIKeysSyntax()
+		return
+	}
+
+	keys, err := c.sendListAPIKeysRequest()
+	if err != nil {
+		fmt.Println("can't list API keys:", err)
+		return
+	}
+	if len(keys) == 0 {
+		fmt.Println("There are no API keys")
+		return
+	}
+	fmt.Println("API keys:")
+	for _, key := range keys {
+		fmt.Printf("   %s %s (%s), expires: %s, last used: %s\n",
+			key.ID, key.Name, describeScope(key.Scope), formatTime(key.ExpiresAt, "never"), formatTime(key.LastUsedAt, "never"))
+	}
+}
+
+// RevokeAPIKeyCommand deletes the API key, it stops working right away
+func (c *Client) RevokeAPIKeyCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 2 {
+		printRevokeAPIKeySyntax()
+		return
+	}
+
+	if err := c.sendRevokeAPIKeyRequest(input[1]); err != nil {
+		fmt.Println("can't revoke API key:", err)
+		return
+	}
+	fmt.Println("API key is revoked")
+}
+
+func describeScope(scope auth.APIKeyScope) string {
+	var parts []string
+	if scope.ReadOnly {
+		parts = append(parts, "readonly")
+	} else {
+		parts = append(parts, "read-write")
+	}
+	if len(scope.Kinds) > 0 {
+		parts = append(parts, "kinds: "+strings.Join(scope.Kinds, ","))
+	}
+	if len(scope.Orgs) > 0 {
+		parts = append(parts, "orgs: "+strings.Join(scope.Orgs, ","))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func formatTime(t time.Time, zero string) string {
+	if t.IsZero() {
+		return zero
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
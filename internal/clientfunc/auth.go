@@ -3,14 +3,15 @@ package clientfunc
 import (
 	"bufio"
 	"bytes"
-	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alexedwards/argon2id"
 
@@ -60,11 +61,23 @@ func (c *Client) Register(input []string) {
 	switch err {
 	case nil:
 		c.AuthCookie = authcookie
-		key := sha256.Sum256([]byte(loginData.Password))
-		c.Key = key[:]
+		wrapped, err := c.createVault(loginData.Login, loginData.Password)
+		if err != nil {
+			fmt.Println("can't create vault key:", err)
+			return
+		}
 		fmt.Println("registered successfully")
-		c.createUserLoginFile(loginData.Login, loginData.Password)
+		c.createUserLoginFile(loginData.Login, loginData.Password, wrapped)
+		if recoveryKey, err := c.issueRecoveryKey(loginData.Login, loginData.Password); err != nil {
+			fmt.Println("can't issue recovery key, use recoverykey command:", err)
+		} else {
+			printRecoveryKey(recoveryKey)
+		}
 		c.Storage.InitStorage(c.Key)
+		c.setUnlocked()
+		if err := c.loadKeyPair(); err != nil {
+			fmt.Println("can't create key pair for sharing:", err)
+		}
 	case ErrUsernameIsTaken:
 		fmt.Println("Username is taken, please provide another")
 	default:
@@ -90,6 +103,17 @@ func (c *Client) Login(input []string) {
 	}
 
 	c.checkLoginFile(loginData)
+	err := c.openVault(loginData)
+	if err != nil {
+		log.Println("error when trying to login offline: ", err)
+		return
+	}
+	c.CheckAll()
+	fmt.Println("Successfully logged!")
+}
+
+// openVault logs in online if possible, then unlocks the vault offline and opens organizations vaults
+func (c *Client) openVault(loginData auth.LoginData) error {
 	// login online
 	err := c.loginOnline(loginData)
 	if err != nil {
@@ -98,28 +122,55 @@ func (c *Client) Login(input []string) {
 	// logging offline
 	err = c.loginOffline(loginData)
 	if err != nil {
-		log.Println("error when trying to login offline: ", err)
-		return
+		return err
 	}
 	c.Storage.InitStorage(c.Key)
-	c.CheckAll()
-	fmt.Println("Successfully logged!")
+	if c.AuthCookie != nil {
+		err = c.loadOrgs()
+	} else {
+		err = c.loadOrgsFromFile()
+	}
+	if err != nil {
+		fmt.Println("can't open organizations vaults:", err)
+	}
+	c.setUnlocked()
+	return nil
 }
 
 func (c *Client) loginOnline(loginData auth.LoginData) error {
 	// logging into server
 	authcookie, err := c.sendLoginRequest(loginData)
+	if err == ErrSecondFactorRequired {
+		loginData.OTP = promptSecondFactor()
+		if loginData.OTP == "" {
+			return ErrSecondFactorRequired
+		}
+		authcookie, err = c.sendLoginRequest(loginData)
+	}
 	switch err {
 	case nil:
 		c.AuthCookie = authcookie
-		key := sha256.Sum256([]byte(loginData.Login + loginData.Password))
-		c.Key = key[:]
-		c.createUserLoginFile(loginData.Login, loginData.Password)
+		wrapped, err := c.unlockVaultOnline(loginData.Login, loginData.Password)
+		if err != nil {
+			c.AuthCookie = nil
+			return fmt.Errorf("can't unlock vault key:%w", err)
+		}
+		c.createUserLoginFile(loginData.Login, loginData.Password, wrapped)
+		if err := c.loadKeyPair(); err != nil {
+			fmt.Println("can't load key pair for sharing:", err)
+		}
 		return nil
 	case ErrWrongLoginData:
 
 		fmt.Println("wrong login credentials, try again")
+		if !config.ClientCfg.LegacyLogin && !hasVerifier(loginData.Login) {
+			fmt.Println("accounts registered by old clients log in once with -legacylogin, it sends the password to the server")
+		}
 		return ErrWrongLoginData
+	case ErrDeviceRevoked:
+		forgetDevice()
+		fmt.Println("this device was revoked, login again to register it as a new device")
+		return ErrDeviceRevoked
 	case ErrServerIsDown:
 		log.Println("Server is down, try again later")
 		c.AuthCookie = nil
@@ -149,14 +200,25 @@ func (c *Client) loginOffline(logincreds auth.LoginData) error {
 		return ErrWrongLoginData
 	}
 
+	if err := c.unlockVaultOffline(logincreds.Login, logincreds.Password); err != nil {
+		return fmt.Errorf("can't unlock vault key:%w", err)
+	}
+
 	//sucessfuly logged in
 	c.LoggedOffline = true
-	key := sha256.Sum256([]byte(logincreds.Login + logincreds.Password))
-	c.Key = key[:]
 	return nil
 }
 
 func (c *Client) sendRegisterRequest(login auth.LoginData) (*http.Cookie, error) {
+	login.Device = c.device()
+
+	// the server gets the verifier of the password, never the password itself
+	verifier, err := auth.NewSRPVerifier(login.Password)
+	if err != nil {
+		return nil, err
+	}
+	login.Verifier, login.Password = &verifier, ""
+
 	//preparing url to send to
 	url := fmt.Sprintf("%s/api/user/register", c.Config.Address)
 	//checking if the prefix is ok
@@ -188,15 +250,14 @@ func (c *Client) sendRegisterRequest(login auth.LoginData) (*http.Cookie, error)
 	// checking the response code
 	switch res.StatusCode {
 	case 200:
-		cookies := res.Cookies()
-		for _, cookie := range cookies {
-			if cookie.Name == "simplevault-auth" {
-				return cookie, nil
-			}
-		}
-		return nil, ErrNoCookieReturned
+		markVerifier(login.Login)
+		return c.sessionCookies(res)
+	case 400:
+		return nil, ErrBadRequest
 	case 409:
 		return nil, ErrUsernameIsTaken
+	case 429:
+		return nil, tooManyAttempts(res)
 	case 500:
 		fmt.Println("Server error, please try again")
 		return nil, ErrServerIsDown
@@ -207,7 +268,31 @@ func (c *Client) sendRegisterRequest(login auth.LoginData) (*http.Cookie, error)
 }
 
 func (c *Client) sendLoginRequest(login auth.LoginData) (*http.Cookie, error) {
+	login.Device = c.device()
+
+	password := login.Password
+	srp, proof, err := c.srpProve(login.Login, password)
+	if err != nil {
+		return nil, fmt.Errorf("error in SRP handshake: %w", err)
+	}
+	login.Password, login.Handshake, login.Proof = "", proof.Handshake, proof.Proof
+	authcookie, err := c.postLogin(login, srp)
+
+	// accounts registered before SRP have no verifier, their handshakes fail like those with a wrong password.
+	// The password is sent once to get the verifier, only if the user allows it
+	if errors.Is(err, ErrWrongLoginData) && legacyLoginAllowed(login.Login) {
+		login.Password, login.Handshake, login.Proof = password, "", ""
+		authcookie, err = c.postLogin(login, nil)
+		if err == nil {
+			c.upgradeVerifier(authcookie, login.Login, password)
+		}
+	}
+	return authcookie, err
+}
 
+// postLogin sends the login request. With SRP client the proof of the server is checked
+// and the login is recorded to have verifier
+func (c *Client) postLogin(login auth.LoginData, srp *auth.SRPClient) (*http.Cookie, error) {
 	url := fmt.Sprintf("%s/api/user/login", c.Config.Address)
 
 	if !strings.HasPrefix(url, "http://") {
@@ -232,15 +317,31 @@ func (c *Client) sendLoginRequest(login auth.LoginData) (*http.Cookie, error) {
 
 	switch res.StatusCode {
 	case 200:
-		cookies := res.Cookies()
-		for _, cookie := range cookies {
-			if cookie.Name == "simplevault-auth" {
-				return cookie, nil
-			}
+		authcookie, err := c.sessionCookies(res)
+		if err != nil {
+			return nil, err
+		}
+		if srp == nil {
+			return authcookie, nil
+		}
+		var serverProof auth.SRPProof
+		json.NewDecoder(res.Body).Decode(&serverProof)
+		if err := srp.VerifyServer(serverProof); err != nil {
+			return nil, err
 		}
-		return nil, ErrNoCookieReturned
+		markVerifier(login.Login)
+		return authcookie, nil
 	case 401:
+		if login.OTP != "" {
+			return nil, ErrWrongSecondFactor
+		}
 		return nil, ErrWrongLoginData
+	case 403:
+		return nil, ErrSecondFactorRequired
+	case 410:
+		return nil, ErrDeviceRevoked
+	case 429:
+		return nil, tooManyAttempts(res)
 	case 500:
 		return nil, ErrServerIsDown
 	default:
@@ -248,7 +349,16 @@ func (c *Client) sendLoginRequest(login auth.LoginData) (*http.Cookie, error) {
 	}
 }
 
-func (c *Client) createUserLoginFile(username, password string) error {
+// tooManyAttempts returns ErrTooManyAttempts with the wait time from Retry-After header
+func tooManyAttempts(res *http.Response) error {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil {
+		return ErrTooManyAttempts
+	}
+	return fmt.Errorf("%w, try again in %s", ErrTooManyAttempts, time.Duration(seconds)*time.Second)
+}
+
+func (c *Client) createUserLoginFile(username, password, vaultkey string) error {
 
 	os.Mkdir(config.ClientCfg.UserDataFolder, 0600)
 	file, err := os.OpenFile(config.ClientCfg.UserDataFile, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
@@ -263,7 +373,7 @@ func (c *Client) createUserLoginFile(username, password string) error {
 	}
 
 	//writing to the file
-	_, err = fmt.Fprintf(file, `{"login":"%s","password":"%s"}`, username, hashedpassword)
+	err = json.NewEncoder(file).Encode(userFile{Login: username, Password: hashedpassword, VaultKey: vaultkey})
 	if err != nil {
 		return fmt.Errorf("error when trying to write into file:%w", err)
 	}
@@ -0,0 +1,284 @@
+package clientfunc
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"golang.org/x/crypto/argon2"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/securebuf"
+)
+
+// number of wrong PINs after which the full password is required to unlock
+const maxPINAttempts = 3
+
+// commands available while the client is locked
+var lockedCommands = map[string]bool{
+	"unlock":   true,
+	"login":    true,
+	"register": true,
+	"recover":  true,
+	"keylogin": true,
+}
+
+// autoLock keeps the state of the client lock.
+// PIN-wrapped copy of the vault key lives only in memory and is dropped after maxPINAttempts failures
+type autoLock struct {
+	mu     sync.Mutex
+	locked bool
+	// number of running commands and synchronizations, the keys are not wiped under them
+	busy         int
+	lastActivity time.Time
+
+	pinSalt     []byte
+	pinKey      []byte
+	pinAttempts int
+}
+
+// IsLocked reports whether the client is locked after inactivity or with lock command
+func (c *Client) IsLocked() bool {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	return c.lock.locked
+}
+
+// startCommand marks the client busy, so it isn't locked in the middle of a command.
+// Returns false if the command isn't available while the client is locked
+func (c *Client) startCommand(command string) bool {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	if c.lock.locked && !lockedCommands[command] {
+		return false
+	}
+	c.lock.busy++
+	c.lock.lastActivity = time.Now()
+	return true
+}
+
+// finishCommand resets the inactivity timer after a command
+func (c *Client) finishCommand() {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	c.lock.busy--
+	c.lock.lastActivity = time.Now()
+}
+
+// startSync marks the client busy for the background synchronization.
+// Returns false if the client is locked
+func (c *Client) startSync() bool {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	if c.lock.locked {
+		return false
+	}
+	c.lock.busy++
+	return true
+}
+
+// finishSync ends the background synchronization, it doesn't count as user's activity
+func (c *Client) finishSync() {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	c.lock.busy--
+}
+
+// AutoLocker locks the client after the timeout of inactivity. Zero timeout turns auto-lock off
+func (c *Client) AutoLocker(context context.Context, wgShutdown *sync.WaitGroup, timeout time.Duration, quit <-chan struct{}) {
+	defer wgShutdown.Done()
+	if timeout <= 0 {
+		return
+	}
+
+	c.finishCommand()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-context.Done():
+			return
+		case <-quit:
+			return
+		case <-ticker.C:
+			c.lock.mu.Lock()
+			idle := !c.lock.locked && c.lock.busy == 0 && c.Key != nil && time.Since(c.lock.lastActivity) > timeout
+			if idle {
+				c.lockLocked()
+			}
+			c.lock.mu.Unlock()
+			if idle {
+				fmt.Println()
+				fmt.Println("Client is locked after inactivity, use unlock command")
+			}
+		}
+	}
+}
+
+// LockCommand locks the client right away
+func (c *Client) LockCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 1 {
+		printLockSyntax()
+		return
+	}
+	if c.Key == nil {
+		fmt.Println("please login first")
+		return
+	}
+	c.lock.mu.Lock()
+	// the lock command itself is running, anything else means synchronization is in progress
+	if c.lock.busy > 1 {
+		c.lock.mu.Unlock()
+		fmt.Println("synchronization is in progress, try again")
+		return
+	}
+	c.lockLocked()
+	c.lock.mu.Unlock()
+	fmt.Println("Client is locked, use unlock command")
+}
+
+// lockLocked wipes the keys and the auth cookie. c.lock.mu must be held
+func (c *Client) lockLocked() {
+	c.WipeKeys()
+	c.lock.locked = true
+}
+
+// WipeKeys zeroes all the keys held by the client and forgets the session cookies
+func (c *Client) WipeKeys() {
+	securebuf.Wipe(c.Key)
+	c.keyBuf.Destroy()
+	c.keyBuf, c.Key = nil, nil
+	c.privateKeyBuf.Destroy()
+	c.privateKeyBuf = nil
+	c.PublicKey, c.PrivateKey = nil, nil
+	c.closeOrgVaults()
+	c.sessionMu.Lock()
+	c.AuthCookie, c.RefreshCookie = nil, nil
+	c.sessionMu.Unlock()
+	c.LoggedOffline = false
+}
+
+// SetPINCommand sets a short PIN to unlock the client without the full password
+func (c *Client) SetPINCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 2 {
+		printSetPINSyntax()
+		return
+	}
+	if c.Key == nil {
+		fmt.Println("please login first")
+		return
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		fmt.Println("can't set PIN:", err)
+		return
+	}
+	wrapped, err := encrypt.WrapKey(c.Key, pinKey(input[1], salt))
+	if err != nil {
+		fmt.Println("can't set PIN:", err)
+		return
+	}
+
+	c.lock.mu.Lock()
+	c.lock.pinSalt, c.lock.pinKey, c.lock.pinAttempts = salt, wrapped, 0
+	c.lock.mu.Unlock()
+	fmt.Println("PIN is set, it unlocks the client until exit or", maxPINAttempts, "wrong attempts")
+}
+
+func pinKey(pin string, salt []byte) []byte {
+	return argon2.IDKey([]byte(pin), salt, 3, 64*1024, 4, 32)
+}
+
+// UnlockCommand unlocks the client with the PIN or the full password.
+// Unlocking with PIN works offline only, as the password is needed to login to the server
+func (c *Client) UnlockCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 2 {
+		printUnlockSyntax()
+		return
+	}
+	if !c.IsLocked() {
+		fmt.Println("client is not locked")
+		return
+	}
+	secret := input[1]
+
+	userdata, err := readUserFile()
+	if err != nil {
+		fmt.Println("please login, using login command")
+		return
+	}
+
+	if c.unlockWithPIN(secret) {
+		if err := c.loadOrgsFromFile(); err != nil {
+			fmt.Println("can't open organizations vaults:", err)
+		}
+		fmt.Println("Unlocked with PIN, use login command to get online")
+		return
+	}
+
+	check, err := argon2id.ComparePasswordAndHash(secret, userdata.Password)
+	if err != nil || !check {
+		c.failPIN()
+		fmt.Println("wrong PIN or password")
+		return
+	}
+
+	if err := c.openVault(auth.LoginData{Login: userdata.Login, Password: secret}); err != nil {
+		fmt.Println("can't unlock:", err)
+		return
+	}
+	fmt.Println("Unlocked!")
+}
+
+// setUnlocked unlocks the client once the vault key is restored with the password
+func (c *Client) setUnlocked() {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	c.lock.locked = false
+	c.lock.pinAttempts = 0
+	c.lock.lastActivity = time.Now()
+}
+
+// unlockWithPIN restores the vault key from the PIN-wrapped copy
+func (c *Client) unlockWithPIN(pin string) bool {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	if c.lock.pinKey == nil {
+		return false
+	}
+	key, err := encrypt.UnwrapKey(c.lock.pinKey, pinKey(pin, c.lock.pinSalt))
+	if err != nil {
+		return false
+	}
+	if err := c.setKey(key); err != nil {
+		return false
+	}
+	c.LoggedOffline = true
+	c.lock.locked = false
+	c.lock.pinAttempts = 0
+	return true
+}
+
+// failPIN counts wrong attempt and drops PIN-wrapped key when attempts are over
+func (c *Client) failPIN() {
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	if c.lock.pinKey == nil {
+		return
+	}
+	c.lock.pinAttempts++
+	if c.lock.pinAttempts >= maxPINAttempts {
+		securebuf.Wipe(c.lock.pinKey)
+		c.lock.pinKey, c.lock.pinSalt = nil, nil
+		fmt.Println("too many wrong attempts, PIN is removed, unlock with the password")
+	}
+}
@@ -0,0 +1,45 @@
+package clientfunc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPINUnlock(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	c := &Client{Key: append([]byte(nil), key...), Orgs: make(map[string]*OrgVault)}
+
+	c.SetPINCommand([]string{"setpin", "1234"})
+	c.startCommand("lock")
+	c.LockCommand([]string{"lock"})
+	c.finishCommand()
+	if !c.IsLocked() || c.Key != nil {
+		t.Fatal("client is not locked")
+	}
+	if c.startCommand("listcards") {
+		t.Error("command is allowed while locked")
+	}
+
+	if c.unlockWithPIN("0000") {
+		t.Error("unlocked with wrong PIN")
+	}
+	if !c.unlockWithPIN("1234") {
+		t.Fatal("can't unlock with PIN")
+	}
+	if c.IsLocked() || !bytes.Equal(c.Key, key) {
+		t.Error("vault key is not restored")
+	}
+}
+
+func TestPINAttempts(t *testing.T) {
+	c := &Client{Key: bytes.Repeat([]byte{7}, 32), Orgs: make(map[string]*OrgVault)}
+
+	c.SetPINCommand([]string{"setpin", "1234"})
+	c.LockCommand([]string{"lock"})
+	for i := 0; i < maxPINAttempts; i++ {
+		c.failPIN()
+	}
+	if c.unlockWithPIN("1234") {
+		t.Error("PIN works after too many wrong attempts")
+	}
+}
@@ -0,0 +1,148 @@
+package clientfunc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// blind indexes are prefixed, so names uploaded before they were hidden can be told apart
+const blindIndexPrefix = "bi1-"
+
+// kind of binaries for blind indexes, other kinds are taken from the storage package
+const kindBinary = "binary"
+
+// kind of blind indexes of tags, a tag is the same for items of every kind
+const tagIndexKind = "tag"
+
+// kinds of blind indexes of shares are prefixed, so a share and the item it is made of have different indexes
+const shareIndexPrefix = "share/"
+
+// indexKey derives the key of blind indexes from the vault key
+func indexKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("simplevault-blind-index"))
+	return mac.Sum(nil)
+}
+
+// blindIndexWith returns a keyed hash of the item name, which the server uses instead of the name.
+// The kind is mixed in, so the same name of a card and a note gives different indexes
+func blindIndexWith(key []byte, kind, name string) string {
+	mac := hmac.New(sha256.New, indexKey(key))
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(name))
+	return blindIndexPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// blindIndex returns the blind index of the name of a personal item
+func (c *Client) blindIndex(kind, name string) string {
+	return blindIndexWith(c.Key, kind, name)
+}
+
+// contentHash returns a keyed hash of the item content, so devices compare contents
+// through the server without revealing them
+func (c *Client) contentHash(kind string, content any) (string, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("can't encode content:%w", err)
+	}
+	mac := c.contentMAC(kind)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// contentMAC returns the keyed hash of contents of the kind, the content is written into it
+func (c *Client) contentMAC(kind string) hash.Hash {
+	key := hmac.New(sha256.New, c.Key)
+	key.Write([]byte("simplevault-content-hash"))
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	return mac
+}
+
+func isBlindIndex(name string) bool {
+	return strings.HasPrefix(name, blindIndexPrefix)
+}
+
+// hideName returns the blind index and the encrypted item name to be sent to the server
+func (c *Client) hideName(kind, name string) (index, encname string, err error) {
+	encname, err = sealName(name, c.Key)
+	return c.blindIndex(kind, name), encname, err
+}
+
+// revealName decrypts the item name received from the server.
+// Items uploaded before names were hidden keep the name in clear
+func (c *Client) revealName(name, encname string) (string, error) {
+	return openName(name, encname, c.Key)
+}
+
+// sealName encrypts the item name with the key of the vault or share the item is in
+func sealName(name string, key []byte) (string, error) {
+	sealed, err := encrypt.WrapKey([]byte(name), key)
+	if err != nil {
+		return "", fmt.Errorf("can't encrypt name:%w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openName decrypts the item name sealed with the key, names without encrypted ones are in clear
+func openName(name, encname string, key []byte) (string, error) {
+	if encname == "" {
+		return name, nil
+	}
+	plain, err := unwrapEncodedKey(encname, key)
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt name:%w", err)
+	}
+	return string(plain), nil
+}
+
+// indexNames maps blind indexes of local item names to the names
+func (c *Client) indexNames(kind string, names []string) map[string]string {
+	return indexNamesWith(c.Key, kind, names)
+}
+
+// indexNamesWith maps blind indexes keyed by the vault key to the names
+func indexNamesWith(key []byte, kind string, names []string) map[string]string {
+	indexed := make(map[string]string, len(names))
+	for _, name := range names {
+		indexed[blindIndexWith(key, kind, name)] = name
+	}
+	return indexed
+}
+
+// shareIndex returns the blind index of a share of the user's item. Only the owner
+// can compute it, the recipient reads the name encrypted with the share key
+func (c *Client) shareIndex(kind, name string) string {
+	return c.blindIndex(shareIndexPrefix+kind, name)
+}
+
+// tagIndex returns the blind index of the tag, the server filters lists by it
+func (c *Client) tagIndex(tag string) string {
+	return c.blindIndex(tagIndexKind, tag)
+}
+
+// hideEncryptedData replaces the name of the item with its blind index and encrypted name
+func (c *Client) hideEncryptedData(kind string, data storage.EncryptedData) (storage.EncryptedData, error) {
+	var err error
+	data.Name, data.EncName, err = c.hideName(kind, data.Name)
+	return data, err
+}
+
+// revealEncryptedData restores the name of the item received from the server
+func (c *Client) revealEncryptedData(data storage.EncryptedData) (storage.EncryptedData, error) {
+	var err error
+	data.Name, err = c.revealName(data.Name, data.EncName)
+	data.EncName = ""
+	return data, err
+}
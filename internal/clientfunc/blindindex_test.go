@@ -0,0 +1,50 @@
+package clientfunc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+func TestHideRevealName(t *testing.T) {
+	c := &Client{Key: bytes.Repeat([]byte{1}, 32)}
+
+	index, encname, err := c.hideName(storage.KindCard, "chase-visa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isBlindIndex(index) || index != c.blindIndex(storage.KindCard, "chase-visa") {
+		t.Errorf("blind index is not deterministic: %s", index)
+	}
+	if index == c.blindIndex(storage.KindNote, "chase-visa") {
+		t.Error("blind indexes of different kinds are equal")
+	}
+	name, err := c.revealName(index, encname)
+	if err != nil || name != "chase-visa" {
+		t.Errorf("revealName() = %v, %v", name, err)
+	}
+	if name, _ := c.revealName("legacy", ""); name != "legacy" {
+		t.Errorf("legacy name is changed: %v", name)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	c := &Client{Key: bytes.Repeat([]byte{1}, 32)}
+	note := storage.Note{Name: "wifi", Text: "password"}
+
+	hash, err := c.contentHash(storage.KindNote, note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := c.contentHash(storage.KindNote, note); same != hash {
+		t.Errorf("content hash is not deterministic: %s, %s", hash, same)
+	}
+	if other, _ := c.contentHash(storage.KindNote, storage.Note{Name: "wifi", Text: "new password"}); other == hash {
+		t.Error("hashes of different contents are equal")
+	}
+	other := &Client{Key: bytes.Repeat([]byte{2}, 32)}
+	if keyed, _ := other.contentHash(storage.KindNote, note); keyed == hash {
+		t.Error("hashes with different keys are equal")
+	}
+}
@@ -0,0 +1,53 @@
+package clientfunc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/helpers"
+)
+
+func (c *Client) sendBindCertRequest() error {
+	res, err := c.sendJSON(http.MethodPost, "/api/user/cert/bind", nil)
+	if err != nil {
+		return fmt.Errorf("error in sendBindCertRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrNoClientCert
+	case 401:
+		return ErrLoginRequired
+	case 404:
+		return ErrCertAuthOff
+	case 409:
+		return ErrCertificateIsTaken
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+// BindCertCommand binds the client certificate to the account, so the server accepts it for authentication
+func (c *Client) BindCertCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 1 {
+		printBindCertSyntax()
+		return
+	}
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+
+	if err := c.sendBindCertRequest(); err != nil {
+		fmt.Println("can't bind client certificate:", err)
+		return
+	}
+	fmt.Println("Client certificate is bound to the account")
+}
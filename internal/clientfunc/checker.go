@@ -1,267 +1,529 @@
 package clientfunc
 
 import (
+	"errors"
 	"fmt"
+	"log"
 
+	"github.com/gambruh/simplevault/internal/encrypt"
 	"github.com/gambruh/simplevault/internal/helpers"
 	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/localstorage"
 )
 
-// CheckAll function checks for desynchronized data between client and server
+// CheckAll synchronizes items between client and server. The first time full lists of names are compared,
+// later only changes of the server after the persisted revision are applied
+// and local items the server hasn't got yet are uploaded
 func (c *Client) CheckAll() error {
-
-	if err := c.checkCards(); err != nil {
-		if err == ErrDataNotFound {
-			//do nothing
-		} else {
-			return fmt.Errorf("error in checkCards:%w", err)
+	if c.AuthCookie != nil {
+		c.syncMu.Lock()
+		err := c.syncChanges()
+		c.syncMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("error in syncChanges:%w", err)
 		}
 	}
 
-	if err := c.checkLoginCreds(); err != nil {
-		if err == ErrDataNotFound {
-			//do nothing
-		} else {
-			return fmt.Errorf("error in checkLoginCreds:%w", err)
-		}
+	if err := c.checkOrgs(); err != nil {
+		return fmt.Errorf("error in checkOrgs:%w", err)
 	}
 
-	if err := c.checkNotes(); err != nil {
-		if err == ErrDataNotFound {
-			//do nothing
-		} else {
-			return fmt.Errorf("error in checkNotes:%w", err)
-		}
-	}
+	return nil
+}
 
-	if err := c.checkBinaries(); err != nil {
-		if err == ErrDataNotFound {
-			//do nothing
-		} else {
-			return fmt.Errorf("error in checkBinaries:%w", err)
-		}
+// itemSync is how items of one kind are synchronized
+type itemSync struct {
+	kind string
+	// listDB lists names of the items on the server, list lists local names
+	listDB func() ([]string, error)
+	list   func() ([]string, error)
+	// load reads and encrypts a local item by its name with the hash of its content,
+	// save decrypts and saves a downloaded one
+	load func(name string) (storage.Item, error)
+	save func(item storage.Item) error
+	// remove deletes a local item by its name
+	remove func(name string) error
+}
 
+func (c *Client) itemSyncs() []itemSync {
+	return []itemSync{
+		{
+			kind:   storage.KindCard,
+			listDB: c.listCardsFromDB,
+			list:   c.listCardsFromStorage,
+			load: func(cardname string) (storage.Item, error) {
+				card, err := c.openCardFromStorage(cardname)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				defer card.Destroy()
+				data, err := card.Seal("", c.Key)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				hash := c.itemHash(storage.KindCard, cardname, card, cardFields)
+				return storage.Item{Name: cardname, Data: data, Hash: hash}, nil
+			},
+			save: func(item storage.Item) error {
+				card, err := helpers.OpenItem(item.Data, c.Key)
+				if err != nil {
+					return err
+				}
+				defer card.Destroy()
+				return c.saveOpenedCardInStorage(item.Name, card)
+			},
+			remove: func(cardname string) error {
+				return c.Storage.DeleteCard(cardname, c.Key)
+			},
+		},
+		{
+			kind:   storage.KindLoginCreds,
+			listDB: c.listLoginCredsFromDB,
+			list:   c.listLoginCredsFromStorage,
+			load: func(logincredname string) (storage.Item, error) {
+				logincred, err := c.openLoginCredsFromStorage(logincredname)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				defer logincred.Destroy()
+				data, err := logincred.Seal("", c.Key)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				hash := c.itemHash(storage.KindLoginCreds, logincredname, logincred, loginCredsFields)
+				return storage.Item{Name: logincredname, Data: data, Hash: hash}, nil
+			},
+			save: func(item storage.Item) error {
+				logincred, err := helpers.OpenItem(item.Data, c.Key)
+				if err != nil {
+					return err
+				}
+				defer logincred.Destroy()
+				return c.saveOpenedLoginCredsInStorage(item.Name, logincred)
+			},
+			remove: func(logincredname string) error {
+				return c.Storage.DeleteLoginCreds(logincredname, c.Key)
+			},
+		},
+		{
+			kind:   storage.KindNote,
+			listDB: c.listNotesFromDB,
+			list:   c.listNotesFromStorage,
+			load: func(notename string) (storage.Item, error) {
+				note, err := c.openNoteFromStorage(notename)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				defer note.Destroy()
+				data, err := note.Seal("", c.Key)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				hash := c.itemHash(storage.KindNote, notename, note, noteFields)
+				return storage.Item{Name: notename, Data: data, Hash: hash}, nil
+			},
+			save: func(item storage.Item) error {
+				note, err := helpers.OpenItem(item.Data, c.Key)
+				if err != nil {
+					return err
+				}
+				defer note.Destroy()
+				return c.saveOpenedNoteInStorage(item.Name, note)
+			},
+			remove: func(notename string) error {
+				return c.Storage.DeleteNote(notename, c.Key)
+			},
+		},
+		{
+			kind:   kindBinary,
+			listDB: c.listBinariesFromDB,
+			list:   c.listBinariesFromStorage,
+			load: func(binaryname string) (storage.Item, error) {
+				binary, err := c.openBinaryFromStorage(binaryname)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				defer binary.Destroy()
+				data, err := encrypt.EncryptData(binary.Bytes(), c.Key)
+				if err != nil {
+					return storage.Item{}, err
+				}
+				hash := c.binaryHash(binaryname, binary.Bytes())
+				return storage.Item{Name: binaryname, Binary: data, Hash: hash}, nil
+			},
+			save: func(item storage.Item) error {
+				return c.saveSealedBinaryInStorage(item.Name, item.Binary)
+			},
+			remove: c.Storage.DeleteBinary,
+		},
 	}
-
-	return nil
 }
 
-func (c *Client) checkCards() error {
-	if c.AuthCookie == nil {
-		return nil
-	}
-	cardsDB, err := c.listCardsFromDB()
+// syncChanges applies changes of the server after the revision of the sync state
+// and uploads local items changed after they were synchronized. Without the sync state, or if the server
+// has lost changes the client has seen, everything is synchronized from the start of the feed
+func (c *Client) syncChanges() error {
+	state, err := c.Storage.LoadSyncState(c.Key)
 	if err != nil {
-		return err
+		if !errors.Is(err, localstorage.ErrNoData) {
+			log.Println("can't load sync state, synchronizing everything:", err)
+		}
+		return c.syncAll()
 	}
 
-	cardsLocal, err := c.listCardsFromStorage()
+	changes, revision, err := c.readChanges(state.Revision)
 	if err != nil {
 		return err
 	}
+	if revision < state.Revision {
+		return c.syncAll()
+	}
+	state.Revision = revision
+	if state.Items == nil {
+		state.Items = make(map[string]map[string]localstorage.SyncedItem)
+	}
 
-	mapLocal := helpers.CreateMapFromList(cardsLocal)
-	mapServer := helpers.CreateMapFromList(cardsDB)
-
-	toUpload, toDownload := helpers.CompareTwoMaps(mapServer, mapLocal)
-
-	for cardname := range toUpload {
-		var eCard storage.EncryptedData
-		card, err := c.getCardFromStorage(cardname)
-		if err != nil {
-			return err
+	byKind := changesByKind(changes)
+	for _, sync := range c.itemSyncs() {
+		known := state.Items[sync.kind]
+		if known == nil {
+			known = make(map[string]localstorage.SyncedItem)
+			state.Items[sync.kind] = known
 		}
-		eCard.Data, err = helpers.EncryptCardData(card, c.Key)
-		if err != nil {
-			return err
+		if err := c.applyChanges(sync, byKind[sync.kind], known, &state); err != nil {
+			return fmt.Errorf("error applying changes of %s:%w", sync.kind, err)
 		}
-		eCard.Name = card.Cardname
-		err = c.sendCardToDB(eCard)
-		if err != nil {
-			return err
+		if err := c.uploadPending(sync, known, state.Conflicts); err != nil {
+			return fmt.Errorf("error uploading %s:%w", sync.kind, err)
 		}
 	}
+	return c.Storage.SaveSyncState(state, c.Key)
+}
 
-	for cardname := range toDownload {
-		eCard, err := c.getCardFromDB(cardname)
+// syncAll applies the whole change feed of the server to local items as if none of them was synchronized,
+// so items existing on both sides with different contents become conflicts, and saves the sync state.
+// Items saved on the server before the feed was kept are synchronized by names
+func (c *Client) syncAll() error {
+	changes, revision, err := c.readChanges(0)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return err
-		}
+	state := localstorage.SyncState{Revision: revision, Items: make(map[string]map[string]localstorage.SyncedItem)}
+	byKind := changesByKind(changes)
+	for _, sync := range c.itemSyncs() {
+		known := make(map[string]localstorage.SyncedItem)
+		state.Items[sync.kind] = known
 
-		card, err := helpers.DecryptCardData(eCard, c.Key)
+		if err := c.applyChanges(sync, byKind[sync.kind], known, &state); err != nil {
+			return fmt.Errorf("error applying changes of %s:%w", sync.kind, err)
+		}
+		legacy, err := c.syncUnversioned(sync, byKind[sync.kind], known)
 		if err != nil {
-			return err
+			return fmt.Errorf("error syncing %s:%w", sync.kind, err)
+		}
+		if err := c.uploadPending(sync, known, state.Conflicts); err != nil {
+			return fmt.Errorf("error uploading %s:%w", sync.kind, err)
 		}
+		if err := c.deleteLegacy(sync, legacy, known); err != nil {
+			return fmt.Errorf("error deleting legacy %s:%w", sync.kind, err)
+		}
+	}
+	return c.Storage.SaveSyncState(state, c.Key)
+}
 
-		err = c.saveCardInStorage(card)
+// readChanges reads the change feed after the revision since page by page.
+// Returns the changes and the revision of the user they are read up to
+func (c *Client) readChanges(since int64) (changes []storage.Change, revision int64, err error) {
+	for {
+		page, err := c.getChangesFromDB(since, storage.MaxPageSize)
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
+		changes = append(changes, page.Changes...)
+		if !page.More || len(page.Changes) == 0 {
+			return changes, page.Revision, nil
+		}
+		since = page.Changes[len(page.Changes)-1].Revision
 	}
-
-	return nil
 }
 
-func (c *Client) checkLoginCreds() error {
-	if c.AuthCookie == nil {
-		return nil
+func changesByKind(changes []storage.Change) map[string][]storage.Change {
+	byKind := make(map[string][]storage.Change)
+	for _, change := range changes {
+		byKind[change.Kind] = append(byKind[change.Kind], change)
 	}
+	return byKind
+}
 
-	loginCredsDB, err := c.listLoginCredsFromDB()
+// syncUnversioned downloads server items without changes in the feed missing locally
+// and marks local items with such names synchronized. Items with names in clear aren't marked,
+// local copies are uploaded again under blind indexes. Returns the names in clear of such items
+func (c *Client) syncUnversioned(sync itemSync, changes []storage.Change, known map[string]localstorage.SyncedItem) (legacy []string, err error) {
+	serverList, err := sync.listDB()
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	loginCredsLocal, err := c.listLoginCredsFromStorage()
+	localList, err := sync.list()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	versioned := make(map[string]struct{}, len(changes))
+	for _, change := range changes {
+		versioned[change.Name] = struct{}{}
+	}
+	local := c.indexNames(sync.kind, localList)
+	plainLocal := make(map[string]struct{}, len(localList))
+	for _, name := range localList {
+		plainLocal[name] = struct{}{}
 	}
 
-	mapLocal := helpers.CreateMapFromList(loginCredsLocal)
-	mapServer := helpers.CreateMapFromList(loginCredsDB)
-
-	toUpload, toDownload := helpers.CompareTwoMaps(mapServer, mapLocal)
-
-	for logincredname := range toUpload {
-		var eLoginCred storage.EncryptedData
-		logincred, err := c.getLoginCredsFromStorage(logincredname)
-		if err != nil {
-			return err
+	var download []storage.Item
+	for _, name := range serverList {
+		if _, ok := versioned[name]; ok {
+			continue
 		}
-		eLoginCred.Data, err = helpers.EncryptLoginCredsData(logincred, c.Key)
-		if err != nil {
-			return err
+		if !isBlindIndex(name) {
+			if _, ok := plainLocal[name]; ok {
+				legacy = append(legacy, name)
+			} else {
+				download = append(download, storage.Item{Kind: sync.kind, Name: name})
+			}
+			continue
 		}
-		eLoginCred.Name = logincred.Name
-		err = c.sendLoginCredsToDB(eLoginCred)
+		localName, ok := local[name]
+		if !ok {
+			download = append(download, storage.Item{Kind: sync.kind, Name: name})
+			continue
+		}
+		if _, ok := known[localName]; ok {
+			continue
+		}
+		item, err := sync.load(localName)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		known[localName] = localstorage.SyncedItem{Hash: item.Hash}
 	}
 
-	for logincredname := range toDownload {
-		eLoginCred, err := c.getLoginCredsFromDB(logincredname)
-
+	items, err := c.fetchItems(sync, download)
+	if err != nil {
+		return nil, err
+	}
+	for index, item := range items {
+		hash, err := c.replaceLocal(sync, item)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		logincred, err := helpers.DecryptLoginCredsData(eLoginCred, c.Key)
-		if err != nil {
-			return err
+		if isBlindIndex(index) {
+			known[item.Name] = localstorage.SyncedItem{Hash: hash}
 		}
+	}
+	return legacy, nil
+}
 
-		err = c.saveLoginCredsInStorage(logincred)
-		if err != nil {
-			return err
+// deleteLegacy deletes the server items with names in clear once their local copies are uploaded
+// under blind indexes. The deletions are the client's own changes, so the items are marked seen
+// up to them and the feed doesn't delete the local copies. Items failed are left for the next full sync
+func (c *Client) deleteLegacy(sync itemSync, legacy []string, known map[string]localstorage.SyncedItem) error {
+	var remove []storage.Item
+	for _, name := range legacy {
+		if _, ok := known[name]; ok {
+			remove = append(remove, storage.Item{Kind: sync.kind, Name: name})
+		}
+	}
+	deleted, err := c.deleteItemsInDB(remove)
+	if err != nil {
+		return err
+	}
+	for _, result := range deleted {
+		if result.Error != "" {
+			log.Printf("can't delete %s %s saved in clear: %s\n", sync.kind, result.Name, result.Error)
+			continue
+		}
+		if synced := known[result.Name]; synced.Revision < result.Revision {
+			synced.Revision = result.Revision
+			known[result.Name] = synced
 		}
 	}
-
 	return nil
 }
 
-func (c *Client) checkNotes() error {
-	if c.AuthCookie == nil {
+// applyChanges applies changes of the server to local items of the kind. Changes the client
+// has seen already, its own uploads among them, are skipped. Local items modified after
+// they were synchronized, or never synchronized, conflict with the changes of the server,
+// the conflicts are handled by the policy of the config
+func (c *Client) applyChanges(sync itemSync, changes []storage.Change, known map[string]localstorage.SyncedItem, state *localstorage.SyncState) error {
+	if len(changes) == 0 {
 		return nil
 	}
-
-	listDB, err := c.listNotesFromDB()
+	localList, err := sync.list()
 	if err != nil {
 		return err
 	}
-
-	listLocal, err := c.listNotesFromStorage()
-	if err != nil {
-		return err
+	local := c.indexNames(sync.kind, localList)
+	for _, name := range localList {
+		local[name] = name
 	}
 
-	mapLocal := helpers.CreateMapFromList(listLocal)
-	mapServer := helpers.CreateMapFromList(listDB)
-
-	toUpload, toDownload := helpers.CompareTwoMaps(mapServer, mapLocal)
-
-	for notename := range toUpload {
-		var eData storage.EncryptedData
-		note, err := c.getNoteFromStorage(notename)
-		if err != nil {
-			return err
+	var download []storage.Item
+	var conflicts []localstorage.Conflict
+	for _, change := range changes {
+		name, exists := local[change.Name]
+		if !exists {
+			if !change.Deleted {
+				download = append(download, storage.Item{Kind: sync.kind, Name: change.Name})
+			}
+			continue
 		}
-		eData.Data, err = helpers.EncryptNoteData(note, c.Key)
-		if err != nil {
-			return err
+		synced, ok := known[name]
+		if ok && synced.Revision >= change.Revision {
+			continue
 		}
-		eData.Name = note.Name
-		err = c.sendNoteToDB(eData)
+		item, err := sync.load(name)
 		if err != nil {
 			return err
 		}
+		switch {
+		case !change.Deleted && item.Hash == change.Hash:
+			known[name] = localstorage.SyncedItem{Revision: change.Revision, Hash: change.Hash}
+			state.Conflicts = withoutConflict(state.Conflicts, sync.kind, name)
+		case !ok && !change.Deleted && change.Hash == "":
+			// changes of clients not hashing contents are compared by names only
+			known[name] = localstorage.SyncedItem{Revision: change.Revision, Hash: item.Hash}
+		case ok && item.Hash == synced.Hash && change.Deleted:
+			if err := sync.remove(name); err != nil && !errors.Is(err, localstorage.ErrNoData) {
+				return err
+			}
+			delete(known, name)
+		case ok && item.Hash == synced.Hash:
+			download = append(download, storage.Item{Kind: sync.kind, Name: change.Name})
+		default:
+			conflicts = append(conflicts, localstorage.Conflict{Name: name, Change: change})
+		}
 	}
 
-	for notename := range toDownload {
-		eData, err := c.getNoteFromDB(notename)
-
+	items, err := c.fetchItems(sync, download)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		hash, err := c.replaceLocal(sync, item)
 		if err != nil {
 			return err
 		}
+		known[item.Name] = localstorage.SyncedItem{Revision: item.BaseRevision, Hash: hash}
+	}
 
-		note, err := helpers.DecryptNoteData(eData, c.Key)
-		if err != nil {
+	for _, conflict := range conflicts {
+		if err := c.handleConflict(sync, conflict, known, state); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		err = c.saveNoteInStorage(note)
+// fetchItems downloads the items of the kind and reveals their names. Items are returned by names
+// on the server, with revisions of their last changes in BaseRevision. Items failed on the server,
+// deleted meanwhile for one, are logged and left for the next check
+func (c *Client) fetchItems(sync itemSync, download []storage.Item) (map[string]storage.Item, error) {
+	results, err := c.getItemsFromDB(download)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]storage.Item, len(results))
+	for _, result := range results {
+		if result.Error != "" {
+			log.Printf("can't download %s %s: %s\n", sync.kind, result.Name, result.Error)
+			continue
+		}
+		item := result.Item
+		item.Name, err = c.revealName(item.Name, item.EncName)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		item.EncName = ""
+		item.BaseRevision = result.Revision
+		items[result.Name] = item
 	}
-
-	return nil
+	return items, nil
 }
 
-func (c *Client) checkBinaries() error {
-	if c.AuthCookie == nil {
-		return nil
+// replaceLocal saves the downloaded item in place of the local one and returns the hash of its content
+func (c *Client) replaceLocal(sync itemSync, item storage.Item) (string, error) {
+	if err := sync.remove(item.Name); err != nil && !errors.Is(err, localstorage.ErrNoData) {
+		return "", err
 	}
-
-	listDB, err := c.listBinariesFromDB()
-	if err != nil {
-		return err
+	if err := sync.save(item); err != nil {
+		return "", err
 	}
+	saved, err := sync.load(item.Name)
+	return saved.Hash, err
+}
 
-	listLocal, err := c.listBinariesFromStorage()
+// uploadPending uploads local items of the kind marked pending as updates based on the revisions seen,
+// and items the server hasn't got as new ones. Other synchronized items aren't read at all. Items with open
+// conflicts are skipped. Items changed on the server meanwhile, or with names taken, come with the next changes
+func (c *Client) uploadPending(sync itemSync, known map[string]localstorage.SyncedItem, conflicts []localstorage.Conflict) error {
+	localList, err := sync.list()
 	if err != nil {
 		return err
 	}
+	var device string
+	if d := c.device(); d != nil {
+		device = d.Name
+	}
 
-	mapLocal := helpers.CreateMapFromList(listLocal)
-	mapServer := helpers.CreateMapFromList(listDB)
-
-	toUpload, toDownload := helpers.CompareTwoMaps(mapServer, mapLocal)
-
-	for binaryname := range toUpload {
-		binary, err := c.getBinaryFromStorage(binaryname)
-		if err != nil {
-			return err
+	names := make(map[string]string)
+	hashes := make(map[string]string)
+	var add, update []storage.Item
+	for _, name := range localList {
+		if hasConflict(conflicts, sync.kind, name) {
+			continue
 		}
-
-		err = c.sendBinaryToDB(binary)
-		if err != nil {
-			return err
+		synced, ok := known[name]
+		if ok && !synced.Pending {
+			continue
 		}
-	}
-
-	for binaryname := range toDownload {
-		binary, err := c.getBinaryFromDB(binaryname)
+		item, err := sync.load(name)
 		if err != nil {
 			return err
 		}
-
-		err = c.saveBinaryInStorage(binary)
+		if ok && synced.Hash == item.Hash {
+			synced.Pending = false
+			known[name] = synced
+			continue
+		}
+		item.Kind = sync.kind
+		item.Device = device
+		item.Name, item.EncName, err = c.hideName(sync.kind, name)
 		if err != nil {
 			return err
 		}
+		names[item.Name] = name
+		hashes[item.Name] = item.Hash
+		if ok {
+			item.BaseRevision = synced.Revision
+			update = append(update, item)
+		} else {
+			add = append(add, item)
+		}
 	}
 
+	added, err := c.sendItemsToDB(add)
+	if err != nil {
+		return err
+	}
+	updated, err := c.updateItemsInDB(update)
+	if err != nil {
+		return err
+	}
+	for _, result := range append(added, updated...) {
+		if result.Error != "" {
+			log.Printf("can't upload %s %s: %s\n", sync.kind, names[result.Name], result.Error)
+			continue
+		}
+		known[names[result.Name]] = localstorage.SyncedItem{Revision: result.Revision, Hash: hashes[result.Name]}
+	}
 	return nil
 }
@@ -0,0 +1,221 @@
+package clientfunc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/handlers"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/localstorage"
+	"github.com/gambruh/simplevault/internal/storage/memstorage"
+)
+
+// newTestClient returns a client with the personal vault in a temporary folder
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	ls := localstorage.NewStorage()
+	ls.Folder = t.TempDir()
+	c := &Client{Key: bytes.Repeat([]byte{1}, 32), Storage: ls, Orgs: make(map[string]*OrgVault)}
+	if err := c.Storage.InitStorage(c.Key); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func syncOf(c *Client, kind string) itemSync {
+	for _, sync := range c.itemSyncs() {
+		if sync.kind == kind {
+			return sync
+		}
+	}
+	return itemSync{}
+}
+
+// Items are encrypted anew every time they are uploaded in batches,
+// so two updates of the same item never share a nonce while the content hash stays the same
+func TestItemSyncLoadReencrypts(t *testing.T) {
+	c := newTestClient(t)
+	card := storage.Card{Cardname: "visa", Number: "4111111111111111", Name: "John", Surname: "Doe", ValidTill: "12/30", Code: "123"}
+	if err := c.Storage.SaveCard(card, c.Key); err != nil {
+		t.Fatal(err)
+	}
+	sync := syncOf(c, storage.KindCard)
+
+	first, err := sync.load("visa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := sync.load("visa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Data == second.Data {
+		t.Error("the same card is encrypted to the same data twice")
+	}
+	if first.Hash != second.Hash {
+		t.Errorf("content hash changed: %s, %s", first.Hash, second.Hash)
+	}
+}
+
+// Binaries go to the server encrypted anew and come back into the local storage without being decrypted,
+// binaries uploaded in clear by old clients are encrypted when saved
+func TestBinarySyncEncrypted(t *testing.T) {
+	c := newTestClient(t)
+	content := []byte("binary content")
+	if err := c.Storage.SaveBinary(storage.Binary{Name: "file.bin", Data: content}, c.Key); err != nil {
+		t.Fatal(err)
+	}
+	sync := syncOf(c, kindBinary)
+
+	item, err := sync.load("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(item.Binary, content) {
+		t.Error("binary is uploaded in clear")
+	}
+	if want := mustContentHash(t, c, kindBinary, storage.Binary{Name: "file.bin", Data: content}); item.Hash != want {
+		t.Errorf("hash = %s, want %s", item.Hash, want)
+	}
+	again, err := sync.load("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again.Binary, item.Binary) {
+		t.Error("the same binary is encrypted to the same data twice")
+	}
+
+	other := newTestClient(t)
+	for name, data := range map[string][]byte{"file.bin": item.Binary, "legacy.bin": content} {
+		if err := syncOf(other, kindBinary).save(storage.Item{Name: name, Binary: data}); err != nil {
+			t.Fatal(err)
+		}
+		plain, err := other.openBinaryFromStorage(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain.Bytes(), content) {
+			t.Errorf("%s is saved as %q", name, plain.Bytes())
+		}
+		plain.Destroy()
+	}
+}
+
+// Synchronized items aren't read on every check, only the pending ones are.
+// A pending item equal to the server copy is marked synchronized without uploading
+func TestUploadPendingReadsPendingOnly(t *testing.T) {
+	c := newTestClient(t)
+	for _, name := range []string{"wifi", "door"} {
+		if err := c.Storage.SaveNote(storage.Note{Name: name, Text: "code"}, c.Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync := syncOf(c, storage.KindNote)
+	door, err := sync.load("door")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded []string
+	load := sync.load
+	sync.load = func(name string) (storage.Item, error) {
+		loaded = append(loaded, name)
+		return load(name)
+	}
+	known := map[string]localstorage.SyncedItem{
+		"wifi": {Revision: 1, Hash: "old"},
+		"door": {Revision: 2, Hash: door.Hash, Pending: true},
+	}
+	if err := c.uploadPending(sync, known, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0] != "door" {
+		t.Errorf("loaded %v, want only the pending door", loaded)
+	}
+	if got := known["door"]; got.Pending || got.Revision != 2 {
+		t.Errorf("door after upload: %+v", got)
+	}
+}
+
+// serveAs starts a server with the item, sync, share and organization routes of the service
+// for the client, requests are served as the user
+func serveAs(t *testing.T, c *Client, h *handlers.WebService, username string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/cards/list", h.ListCards)
+	mux.HandleFunc("/api/logincreds/list", h.ListLoginCreds)
+	mux.HandleFunc("/api/notes/list", h.ListNotes)
+	mux.HandleFunc("/api/binaries/list", h.ListBinaries)
+	mux.HandleFunc("/api/items/add", h.AddItems)
+	mux.HandleFunc("/api/items/get", h.GetItems)
+	mux.HandleFunc("/api/items/update", h.UpdateItems)
+	mux.HandleFunc("/api/items/delete", h.DeleteItems)
+	mux.HandleFunc("/api/sync/changes", h.SyncChanges)
+	mux.HandleFunc("/api/keys/set", h.SetKeyPair)
+	mux.HandleFunc("/api/keys/get", h.GetKeyPair)
+	mux.HandleFunc("/api/keys/public", h.GetPublicKey)
+	mux.HandleFunc("/api/shares/add", h.AddShare)
+	mux.HandleFunc("/api/shares/list", h.ListSharesReceived)
+	mux.HandleFunc("/api/shares/owned", h.ListSharesOwned)
+	mux.HandleFunc("/api/shares/revoke", h.RevokeShare)
+	mux.HandleFunc("/api/orgs/create", h.CreateOrg)
+	mux.HandleFunc("/api/orgs/list", h.ListOrgs)
+	mux.HandleFunc("/api/orgs/members/add", h.AddOrgMember)
+	mux.HandleFunc("/api/orgs/members/remove", h.RemoveOrgMember)
+	mux.HandleFunc("/api/orgs/members/list", h.ListOrgMembers)
+	mux.HandleFunc("/api/orgs/items/add", h.AddOrgItem)
+	mux.HandleFunc("/api/orgs/items/get", h.GetOrgItem)
+	mux.HandleFunc("/api/orgs/items/list", h.ListOrgItems)
+	mux.HandleFunc("/api/orgs/items/delete", h.DeleteOrgItem)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), config.UserID("userID"), username)))
+	}))
+	t.Cleanup(srv.Close)
+	c.Client = srv.Client()
+	c.Config.Address = srv.URL
+}
+
+// Items saved in clear before blind indexes are uploaded again under blind indexes and deleted,
+// the deletions of the names in clear don't delete the local copies
+func TestSyncDeletesNamesInClear(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	ms := memstorage.NewStorage()
+	h := handlers.NewService(ms, auth.NewMemStorage())
+	serveAs(t, c, h, "user")
+
+	note := storage.Note{Name: "wifi", Text: "password"}
+	if err := c.Storage.SaveNote(note, c.Key); err != nil {
+		t.Fatal(err)
+	}
+	data, err := helpers.EncryptNoteData(note, c.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// saved by an old client before the change feed was kept
+	ms.Notes["user"] = map[string]storage.EncryptedData{"wifi": {Name: "wifi", Data: data}}
+
+	if err := c.syncAll(); err != nil {
+		t.Fatal(err)
+	}
+	names, err := ms.ListNotes(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || !isBlindIndex(names[0]) {
+		t.Fatalf("notes on the server: %v, want only a blind index", names)
+	}
+
+	if err := c.syncChanges(); err != nil {
+		t.Fatal(err)
+	}
+	if local, err := c.Storage.ListNotes(); err != nil || len(local) != 1 || local[0] != "wifi" {
+		t.Errorf("local notes after the deletion in the feed: %v, %v", local, err)
+	}
+}
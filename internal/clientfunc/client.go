@@ -15,6 +15,8 @@ import (
 	"time"
 
 	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/securebuf"
 	"github.com/gambruh/simplevault/internal/storage"
 	"github.com/gambruh/simplevault/internal/storage/localstorage"
 )
@@ -30,14 +32,38 @@ type Client struct {
 	//config of the client
 	Config config.ClientConfig
 
+	// build version of the client, sent to the server with the device on login
+	Version string
+
 	// this cookie will be applied to any http-request sent from the client, in case of successful online authentication
 	AuthCookie *http.Cookie
 
+	// this cookie is used to get a new auth cookie when the old one expires
+	RefreshCookie *http.Cookie
+	// serializes session refreshes, the refresh token can be used only once
+	sessionMu sync.Mutex
+
+	// serializes synchronizations and resolutions of conflicts, both rewrite the sync state
+	syncMu sync.Mutex
+
 	// box to be checked if user logged offline
 	LoggedOffline bool
 
-	// this is an encryption key
-	Key []byte
+	// this is an encryption key, it points into keyBuf locked in memory
+	Key    []byte
+	keyBuf *securebuf.Buffer
+
+	// X25519 key pair used to receive shared items, loaded on online login.
+	// Private key points into privateKeyBuf
+	PublicKey     *[32]byte
+	PrivateKey    *[32]byte
+	privateKeyBuf *securebuf.Buffer
+
+	// organizations vaults the user is a member of, by organization name
+	Orgs map[string]*OrgVault
+
+	// lock state, the keys are wiped when the client is locked
+	lock autoLock
 }
 
 // LocalStorage is an interfance
@@ -47,23 +73,36 @@ type LocalStorage interface {
 
 	//Cards processing methods
 	SaveCard(card storage.Card, key []byte) error
-	GetCard(cardname string, key []byte) (card storage.Card, err error)
+	SaveOpenedCard(cardname string, card *helpers.OpenedItem, key []byte) error
+	OpenCard(cardname string, key []byte) (*helpers.OpenedItem, error)
 	ListCards() (cards []string, err error)
 
 	//Login credentials processing methods
 	SaveLoginCreds(logincreds storage.LoginCreds, key []byte) error
-	GetLoginCreds(logincredsname string, key []byte) (logincreds storage.LoginCreds, err error)
+	SaveOpenedLoginCreds(logincredsname string, logincreds *helpers.OpenedItem, key []byte) error
+	OpenLoginCreds(logincredsname string, key []byte) (*helpers.OpenedItem, error)
 	ListLoginCreds() (logincreds []string, err error)
 
 	//Notes processing methods
 	SaveNote(note storage.Note, key []byte) error
-	GetNote(notename string, key []byte) (note storage.Note, err error)
+	SaveOpenedNote(notename string, note *helpers.OpenedItem, key []byte) error
+	OpenNote(notename string, key []byte) (*helpers.OpenedItem, error)
 	ListNotes() (notes []string, err error)
 
 	//Binaries processing methods
 	SaveBinary(binary storage.Binary, key []byte) error
+	SaveEncryptedBinary(binaryname string, encrypted []byte) error
 	GetBinary(binaryname string, key []byte) (binary storage.Binary, err error)
+	GetEncryptedBinary(binaryname string) (binary storage.Binary, err error)
 	ListBinaries() (binaries []string, err error)
+
+	//Sync methods, items changed on the server are replaced or deleted locally
+	DeleteCard(cardname string, key []byte) error
+	DeleteLoginCreds(logincredsname string, key []byte) error
+	DeleteNote(notename string, key []byte) error
+	DeleteBinary(binaryname string) error
+	LoadSyncState(key []byte) (localstorage.SyncState, error)
+	SaveSyncState(state localstorage.SyncState, key []byte) error
 }
 
 // NewClient function return new clientfunc.Client
@@ -72,6 +111,7 @@ func NewClient(cfg config.ClientConfig) *Client {
 		Config:  cfg,
 		Storage: localstorage.NewStorage(),
 		Client:  NewClientTLS(cfg.ServerCert, cfg.ClientCert, cfg.PrivateKey),
+		Orgs:    make(map[string]*OrgVault),
 	}
 }
 
@@ -110,7 +150,7 @@ func (c *Client) ResponseToCommand(ctxShutdown context.Context, wgShutdown *sync
 
 		// Process the command
 		if input == "quit" {
-			quit <- struct{}{}
+			close(quit)
 			fmt.Println("Exiting...")
 			return
 		}
@@ -129,7 +169,12 @@ func (c *Client) ResponseToCommand(ctxShutdown context.Context, wgShutdown *sync
 
 		// Execute the command
 		if fn, ok := commands[command]; ok {
+			if !c.startCommand(command) {
+				fmt.Println("Client is locked, use unlock command")
+				continue
+			}
 			fn(inpt)
+			c.finishCommand()
 		} else {
 			fmt.Printf("Unknown command: %s\n", command)
 			PrintAvailableCommands(commands)
@@ -147,7 +192,11 @@ func (c *Client) DataChecker(context context.Context, wgShutdown *sync.WaitGroup
 		case <-quit:
 			return
 		case <-ticker.C:
+			if !c.startSync() {
+				continue
+			}
 			err := c.CheckAll()
+			c.finishSync()
 			if err != nil {
 				log.Println("error in DataChecker function returned from CheckAll:", err)
 			}
@@ -2,6 +2,7 @@ package clientfunc
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/gambruh/simplevault/internal/config"
@@ -59,8 +60,12 @@ func (c *Client) GetCardCommand(input []string) {
 	}
 
 	cardname := input[1]
+	if strings.Contains(cardname, "/") {
+		c.printSharedItem(storage.KindCard, cardname)
+		return
+	}
 
-	card, err := c.getCardFromStorage(cardname)
+	card, err := c.openCardFromStorage(cardname)
 	if err != nil {
 		if err == storage.ErrDataNotFound {
 			fmt.Println("No data in local storage")
@@ -70,8 +75,9 @@ func (c *Client) GetCardCommand(input []string) {
 			return
 		}
 	}
+	defer card.Destroy()
 	//result of the command, if no errors
-	fmt.Printf("%+v\n", card)
+	printItem(cardname, card, cardFields)
 }
 
 func (c *Client) ListCardsCommand(input []string) {
@@ -81,12 +87,14 @@ func (c *Client) ListCardsCommand(input []string) {
 		fmt.Println("please login first")
 		return
 	}
-	if len(input) != 1 {
+	prefix, opts, err := parseListOptions(input[1:])
+	if err != nil {
+		fmt.Println(err)
 		printListCardsSyntax()
 		return
 	}
 
-	cards, err := c.listCardsFromStorage()
+	cards, err := c.listNames(storage.KindCard, prefix, opts)
 	if err != nil {
 		fmt.Println(err)
 	} else {
@@ -94,6 +102,11 @@ func (c *Client) ListCardsCommand(input []string) {
 		for _, card := range cards {
 			fmt.Println("  ", card)
 		}
+		// tags are the user's own, shared and organization items have none
+		if opts.Tag == "" {
+			c.printSharedNames(storage.KindCard)
+			c.printOrgNames(storage.KindCard)
+		}
 	}
 }
 
@@ -144,8 +157,12 @@ func (c *Client) GetLoginCredsCommand(input []string) {
 	}
 
 	logincredname := input[1]
+	if strings.Contains(logincredname, "/") {
+		c.printSharedItem(storage.KindLoginCreds, logincredname)
+		return
+	}
 
-	logincreds, err := c.getLoginCredsFromStorage(logincredname)
+	logincreds, err := c.openLoginCredsFromStorage(logincredname)
 	if err != nil {
 		if err == ErrDataNotFound {
 			fmt.Println("No data in local storage")
@@ -155,8 +172,9 @@ func (c *Client) GetLoginCredsCommand(input []string) {
 			return
 		}
 	}
+	defer logincreds.Destroy()
 	//result of the command, if no errors
-	fmt.Printf("%+v\n", logincreds)
+	printItem(logincredname, logincreds, loginCredsFields)
 }
 
 func (c *Client) ListLoginCredsCommand(input []string) {
@@ -166,12 +184,14 @@ func (c *Client) ListLoginCredsCommand(input []string) {
 		fmt.Println("please login first")
 		return
 	}
-	if len(input) != 1 {
+	prefix, opts, err := parseListOptions(input[1:])
+	if err != nil {
+		fmt.Println(err)
 		printListLoginCredsSyntax()
 		return
 	}
 
-	logincreds, err := c.listLoginCredsFromStorage()
+	logincreds, err := c.listNames(storage.KindLoginCreds, prefix, opts)
 	if err != nil {
 		fmt.Println(err)
 	} else {
@@ -179,6 +199,10 @@ func (c *Client) ListLoginCredsCommand(input []string) {
 		for _, logincred := range logincreds {
 			fmt.Println("  ", logincred)
 		}
+		if opts.Tag == "" {
+			c.printSharedNames(storage.KindLoginCreds)
+			c.printOrgNames(storage.KindLoginCreds)
+		}
 	}
 
 }
@@ -223,8 +247,12 @@ func (c *Client) GetNoteCommand(input []string) {
 	}
 
 	notename := input[1]
+	if strings.Contains(notename, "/") {
+		c.printSharedItem(storage.KindNote, notename)
+		return
+	}
 
-	note, err := c.getNoteFromStorage(notename)
+	note, err := c.openNoteFromStorage(notename)
 	if err != nil {
 		if err == ErrDataNotFound {
 			fmt.Println("No data in local storage")
@@ -234,21 +262,25 @@ func (c *Client) GetNoteCommand(input []string) {
 			return
 		}
 	}
+	defer note.Destroy()
 	//result of the command, if no errors
-	fmt.Printf("%+v\n", note)
+	printItem(notename, note, noteFields)
 }
 
 func (c *Client) ListNotesCommand(input []string) {
+	input = helpers.SplitFurther(input)
 	if c.AuthCookie == nil && !c.LoggedOffline {
 		fmt.Println("please login first")
 		return
 	}
-	if len(input) != 1 {
+	prefix, opts, err := parseListOptions(input[1:])
+	if err != nil {
+		fmt.Println(err)
 		printListNotesSyntax()
 		return
 	}
 
-	notes, err := c.listNotesFromStorage()
+	notes, err := c.listNames(storage.KindNote, prefix, opts)
 	if err != nil {
 		fmt.Println(err)
 	} else {
@@ -256,6 +288,10 @@ func (c *Client) ListNotesCommand(input []string) {
 		for _, note := range notes {
 			fmt.Println("  ", note)
 		}
+		if opts.Tag == "" {
+			c.printSharedNames(storage.KindNote)
+			c.printOrgNames(storage.KindNote)
+		}
 	}
 }
 
@@ -311,16 +347,19 @@ func (c *Client) GetBinaryCommand(input []string) {
 }
 
 func (c *Client) ListBinariesCommand(input []string) {
+	input = helpers.SplitFurther(input)
 	if c.AuthCookie == nil && !c.LoggedOffline {
 		fmt.Println("please login first")
 		return
 	}
-	if len(input) != 1 {
+	prefix, opts, err := parseListOptions(input[1:])
+	if err != nil {
+		fmt.Println(err)
 		printListBinariesSyntax()
 		return
 	}
 
-	binaries, err := c.listBinariesFromStorage()
+	binaries, err := c.listNames(kindBinary, prefix, opts)
 	if err != nil {
 		fmt.Println(err)
 	} else {
@@ -330,3 +369,92 @@ func (c *Client) ListBinariesCommand(input []string) {
 		}
 	}
 }
+
+// parseListOptions parses the options of list commands: a prefix of names, sort=<order> and tag=<tag>
+func parseListOptions(options []string) (prefix string, opts storage.ListOptions, err error) {
+	for _, option := range options {
+		name, value, ok := strings.Cut(option, "=")
+		switch {
+		case ok && name == "sort":
+			switch strings.TrimPrefix(value, "-") {
+			case storage.SortName, storage.SortModified:
+			default:
+				return "", opts, fmt.Errorf("wrong sort order %q", value)
+			}
+			opts.Sort = value
+		case ok && name == "tag":
+			opts.Tag = value
+		case prefix == "":
+			prefix = option
+		default:
+			return "", opts, fmt.Errorf("unknown option %q", option)
+		}
+	}
+	return prefix, opts, nil
+}
+
+// listPaths are the server api paths of the lists of every kind
+var listPaths = map[string]string{
+	storage.KindCard:       "/api/cards/list",
+	storage.KindLoginCreds: "/api/logincreds/list",
+	storage.KindNote:       "/api/notes/list",
+	kindBinary:             "/api/binaries/list",
+}
+
+// listNames returns names of the user's items of the kind starting with the prefix.
+// The server knows names only by blind indexes, so it is asked only to filter by tag or to sort
+// by modification time, and the names are revealed through the blind indexes of local names.
+// Items not synchronized yet aren't listed then. Otherwise the names are sorted here
+func (c *Client) listNames(kind string, prefix string, opts storage.ListOptions) ([]string, error) {
+	var list func() ([]string, error)
+	for _, sync := range c.itemSyncs() {
+		if sync.kind == kind {
+			list = sync.list
+		}
+	}
+	localList, err := list()
+	if err != nil {
+		return nil, err
+	}
+
+	names := append([]string(nil), localList...)
+	if opts.Tag != "" || opts.ByModified() {
+		if c.AuthCookie == nil {
+			return nil, ErrLoginRequired
+		}
+		if opts.Tag != "" {
+			opts.Tag = c.tagIndex(opts.Tag)
+		}
+		listed, err := c.listItemsFromDB(listPaths[kind], opts)
+		if err != nil {
+			return nil, err
+		}
+		local := c.indexNames(kind, localList)
+		names = names[:0]
+		for _, name := range listed {
+			if !isBlindIndex(name) {
+				names = append(names, name)
+			} else if localName, ok := local[name]; ok {
+				names = append(names, localName)
+			}
+		}
+	}
+	if !opts.ByModified() {
+		sort.Strings(names)
+		if opts.Descending() {
+			sort.Sort(sort.Reverse(sort.StringSlice(names)))
+		}
+	}
+	return filterByPrefix(names, prefix), nil
+}
+
+// filterByPrefix returns the names starting with prefix
+func filterByPrefix(names []string, prefix string) []string {
+	var filtered []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,278 @@
+package clientfunc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/localstorage"
+)
+
+// policies for items changed both locally and on the server
+const (
+	// ConflictsLastWriter keeps the local copy, the client synchronizing is the last to write
+	ConflictsLastWriter = "lastwriter"
+	// ConflictsKeepBoth keeps the local copy and saves the server one next to it
+	ConflictsKeepBoth = "keepboth"
+	// ConflictsAsk keeps both copies as they are until the user resolves the conflict
+	ConflictsAsk = "ask"
+)
+
+// resolutions of conflicts taken by the conflicts command
+const (
+	resolveLocal  = "local"
+	resolveServer = "server"
+	resolveBoth   = "both"
+)
+
+// conflictPolicy returns the policy of the config, unknown policies keep both copies
+func conflictPolicy() string {
+	switch config.ClientCfg.Conflicts {
+	case ConflictsLastWriter, ConflictsAsk:
+		return config.ClientCfg.Conflicts
+	default:
+		return ConflictsKeepBoth
+	}
+}
+
+// handleConflict resolves the conflict by the policy of the config or records it for the user
+func (c *Client) handleConflict(sync itemSync, conflict localstorage.Conflict, known map[string]localstorage.SyncedItem, state *localstorage.SyncState) error {
+	switch conflictPolicy() {
+	case ConflictsAsk:
+		state.Conflicts = append(withoutConflict(state.Conflicts, sync.kind, conflict.Name), conflict)
+		log.Printf("%s %s was %s, resolve it with conflicts\n", sync.kind, conflict.Name, describeChange(conflict.Change.Deleted, conflict.Change.Device))
+		return nil
+	case ConflictsLastWriter:
+		keepLocal(conflict, known)
+		return nil
+	default:
+		return c.keepBoth(sync, conflict, known)
+	}
+}
+
+// keepLocal marks the local copy to replace the server one on upload
+func keepLocal(conflict localstorage.Conflict, known map[string]localstorage.SyncedItem) {
+	if conflict.Change.Deleted {
+		delete(known, conflict.Name)
+		return
+	}
+	known[conflict.Name] = localstorage.SyncedItem{Revision: conflict.Change.Revision, Hash: conflict.Change.Hash, Pending: true}
+}
+
+// keepServer replaces the local copy with the server one
+func (c *Client) keepServer(sync itemSync, conflict localstorage.Conflict, known map[string]localstorage.SyncedItem) error {
+	if conflict.Change.Deleted {
+		if err := sync.remove(conflict.Name); err != nil && !errors.Is(err, localstorage.ErrNoData) {
+			return err
+		}
+		delete(known, conflict.Name)
+		return nil
+	}
+	item, ok, err := c.fetchConflicting(sync, conflict)
+	if err != nil || !ok {
+		return err
+	}
+	hash, err := c.replaceLocal(sync, item)
+	if err != nil {
+		return err
+	}
+	known[item.Name] = localstorage.SyncedItem{Revision: item.BaseRevision, Hash: hash}
+	return nil
+}
+
+// keepBoth saves the server copy as "name (conflict from device)" and marks the local copy
+// to replace the server one. The copy is uploaded as a new item
+func (c *Client) keepBoth(sync itemSync, conflict localstorage.Conflict, known map[string]localstorage.SyncedItem) error {
+	if !conflict.Change.Deleted {
+		item, ok, err := c.fetchConflicting(sync, conflict)
+		if err != nil {
+			return err
+		}
+		if ok {
+			item.Name, err = c.conflictCopyName(sync, conflict)
+			if err != nil {
+				return err
+			}
+			if err := sync.save(item); err != nil {
+				return err
+			}
+			log.Printf("%s %s was %s, the server copy is saved as %s\n", sync.kind, conflict.Name, describeChange(false, conflict.Change.Device), item.Name)
+		}
+	}
+	keepLocal(conflict, known)
+	return nil
+}
+
+// fetchConflicting downloads the server copy of the conflicting item.
+// Returns false if the item was deleted meanwhile, the deletion comes with the next changes
+func (c *Client) fetchConflicting(sync itemSync, conflict localstorage.Conflict) (storage.Item, bool, error) {
+	items, err := c.fetchItems(sync, []storage.Item{{Kind: sync.kind, Name: conflict.Change.Name}})
+	if err != nil {
+		return storage.Item{}, false, err
+	}
+	item, ok := items[conflict.Change.Name]
+	return item, ok, nil
+}
+
+// conflictCopyName returns a local name free for the server copy of the conflicting item
+func (c *Client) conflictCopyName(sync itemSync, conflict localstorage.Conflict) (string, error) {
+	names, err := sync.list()
+	if err != nil {
+		return "", err
+	}
+	taken := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		taken[name] = struct{}{}
+	}
+
+	device := conflict.Change.Device
+	if device == "" {
+		device = "another device"
+	}
+	name := fmt.Sprintf("%s (conflict from %s)", conflict.Name, device)
+	for i := 2; ; i++ {
+		if _, ok := taken[name]; !ok {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s (conflict %d from %s)", conflict.Name, i, device)
+	}
+}
+
+func describeChange(deleted bool, device string) string {
+	if device == "" {
+		device = "another device"
+	}
+	if deleted {
+		return "deleted on " + device
+	}
+	return "changed on " + device
+}
+
+func hasConflict(conflicts []localstorage.Conflict, kind, name string) bool {
+	for _, conflict := range conflicts {
+		if conflict.Change.Kind == kind && conflict.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutConflict(conflicts []localstorage.Conflict, kind, name string) []localstorage.Conflict {
+	var left []localstorage.Conflict
+	for _, conflict := range conflicts {
+		if conflict.Change.Kind != kind || conflict.Name != name {
+			left = append(left, conflict)
+		}
+	}
+	return left
+}
+
+// resolveConflict resolves the open conflict of the local item by the resolution of the user
+func (c *Client) resolveConflict(kind, name, resolution string) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	state, err := c.Storage.LoadSyncState(c.Key)
+	if err != nil {
+		return err
+	}
+	var conflict *localstorage.Conflict
+	for i := range state.Conflicts {
+		if state.Conflicts[i].Change.Kind == kind && state.Conflicts[i].Name == name {
+			conflict = &state.Conflicts[i]
+		}
+	}
+	if conflict == nil {
+		return ErrNoConflict
+	}
+	var sync itemSync
+	for _, s := range c.itemSyncs() {
+		if s.kind == kind {
+			sync = s
+		}
+	}
+	if state.Items == nil {
+		state.Items = make(map[string]map[string]localstorage.SyncedItem)
+	}
+	if state.Items[kind] == nil {
+		state.Items[kind] = make(map[string]localstorage.SyncedItem)
+	}
+	known := state.Items[kind]
+
+	switch resolution {
+	case resolveLocal:
+		keepLocal(*conflict, known)
+	case resolveServer:
+		err = c.keepServer(sync, *conflict, known)
+	case resolveBoth:
+		err = c.keepBoth(sync, *conflict, known)
+	}
+	if err != nil {
+		return err
+	}
+	state.Conflicts = withoutConflict(state.Conflicts, kind, name)
+	return c.Storage.SaveSyncState(state, c.Key)
+}
+
+// ConflictsCommand lists items changed both locally and on the server, or resolves one of them
+// keeping the local copy, the server one or both
+func (c *Client) ConflictsCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) == 1 {
+		c.printConflicts()
+		return
+	}
+	if len(input) < 4 {
+		printConflictsSyntax()
+		return
+	}
+	kind, resolution := input[1], input[len(input)-1]
+	name := strings.Join(input[2:len(input)-1], " ")
+	switch kind {
+	case storage.KindCard, storage.KindLoginCreds, storage.KindNote, kindBinary:
+	default:
+		printConflictsSyntax()
+		return
+	}
+	switch resolution {
+	case resolveLocal, resolveServer, resolveBoth:
+	default:
+		printConflictsSyntax()
+		return
+	}
+
+	if err := c.resolveConflict(kind, name, resolution); err != nil {
+		fmt.Println("can't resolve the conflict:", err)
+		return
+	}
+	if err := c.CheckAll(); err != nil {
+		fmt.Println("conflict is resolved, but synchronization failed:", err)
+		return
+	}
+	fmt.Println("Conflict resolved")
+}
+
+func (c *Client) printConflicts() {
+	state, err := c.Storage.LoadSyncState(c.Key)
+	if err != nil && !errors.Is(err, localstorage.ErrNoData) {
+		fmt.Println("can't read conflicts:", err)
+		return
+	}
+	if len(state.Conflicts) == 0 {
+		fmt.Println("No conflicts")
+		return
+	}
+	fmt.Println("Conflicts:")
+	for _, conflict := range state.Conflicts {
+		fmt.Printf("   %s %s, %s at revision %d\n", conflict.Change.Kind, conflict.Name,
+			describeChange(conflict.Change.Deleted, conflict.Change.Device), conflict.Change.Revision)
+	}
+}
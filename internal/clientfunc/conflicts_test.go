@@ -0,0 +1,83 @@
+package clientfunc
+
+import (
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/localstorage"
+)
+
+func TestConflictCopyName(t *testing.T) {
+	c := &Client{}
+	names := []string{"wifi", "wifi (conflict from laptop)"}
+	sync := itemSync{kind: storage.KindNote, list: func() ([]string, error) { return names, nil }}
+
+	tests := []struct {
+		device string
+		want   string
+	}{
+		{device: "phone", want: "wifi (conflict from phone)"},
+		{device: "laptop", want: "wifi (conflict 2 from laptop)"},
+		{device: "", want: "wifi (conflict from another device)"},
+	}
+	for _, tt := range tests {
+		conflict := localstorage.Conflict{Name: "wifi", Change: storage.Change{Kind: storage.KindNote, Device: tt.device}}
+		got, err := c.conflictCopyName(sync, conflict)
+		if err != nil || got != tt.want {
+			t.Errorf("conflictCopyName() from %q = %v, %v, want %v", tt.device, got, err, tt.want)
+		}
+	}
+}
+
+func TestKeepLocal(t *testing.T) {
+	known := map[string]localstorage.SyncedItem{"wifi": {Revision: 1, Hash: "a"}}
+
+	keepLocal(localstorage.Conflict{Name: "wifi", Change: storage.Change{Revision: 3, Hash: "b"}}, known)
+	if got := known["wifi"]; got.Revision != 3 || got.Hash != "b" || !got.Pending {
+		t.Errorf("local copy isn't based on the change: %+v", got)
+	}
+	keepLocal(localstorage.Conflict{Name: "wifi", Change: storage.Change{Revision: 4, Deleted: true}}, known)
+	if _, ok := known["wifi"]; ok {
+		t.Error("local copy of a deleted item isn't uploaded as a new one")
+	}
+}
+
+// The server copy kept on conflict is saved locally and encrypted anew when uploaded,
+// its ciphertext is never reused under the same nonce
+func TestReplaceLocalReencrypts(t *testing.T) {
+	c := newTestClient(t)
+	sync := syncOf(c, storage.KindNote)
+	if err := c.Storage.SaveNote(storage.Note{Name: "wifi", Text: "local"}, c.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	server := storage.Note{Name: "wifi", Text: "server"}
+	data, err := helpers.EncryptNoteData(server, c.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.replaceLocal(sync, storage.Item{Name: "wifi", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := c.contentHash(storage.KindNote, server); hash != want {
+		t.Errorf("replaceLocal() hash = %s, want %s", hash, want)
+	}
+
+	note, err := c.Storage.OpenNote("wifi", c.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(note.Rest(1)); text != "server" {
+		t.Fatalf("local note text = %q", text)
+	}
+	note.Destroy()
+	upload, err := sync.load("wifi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Data == data {
+		t.Error("the server copy is uploaded with the same ciphertext")
+	}
+}
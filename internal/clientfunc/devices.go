@@ -0,0 +1,100 @@
+package clientfunc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/helpers"
+)
+
+// name of the file in user data folder keeping the ID of this client install
+const deviceFile = "device.json"
+
+// device returns this client install as a device, sent to the server on login.
+// Its ID is generated once and kept in the user data folder, it survives relogins of other users
+func (c *Client) device() *auth.Device {
+	path := filepath.Join(config.ClientCfg.UserDataFolder, deviceFile)
+
+	var device auth.Device
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &device)
+	}
+	if device.ID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil
+		}
+		device.ID = hex.EncodeToString(id)
+		if err := os.MkdirAll(config.ClientCfg.UserDataFolder, 0700); err == nil {
+			data, _ := json.Marshal(auth.Device{ID: device.ID})
+			os.WriteFile(path, data, 0600)
+		}
+	}
+
+	device.Name, _ = os.Hostname()
+	device.Version = c.Version
+	return &device
+}
+
+// forgetDevice removes the ID of this client install and its login key after the device was revoked,
+// the next login registers the client as a new device
+func forgetDevice() {
+	os.Remove(filepath.Join(config.ClientCfg.UserDataFolder, deviceFile))
+	os.Remove(loginKeyPath())
+}
+
+// DevicesCommand prints devices the user has logged in from
+func (c *Client) DevicesCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 1 {
+		printDevicesSyntax()
+		return
+	}
+
+	devices, err := c.sendListDevicesRequest()
+	if err != nil {
+		fmt.Println("can't list devices:", err)
+		return
+	}
+	fmt.Println("Devices:")
+	for _, d := range devices {
+		status := ""
+		switch {
+		case d.Current:
+			status = " (this device)"
+		case d.Revoked:
+			status = " (revoked)"
+		}
+		fmt.Printf("   %s %s%s, version %s, last seen %s from %s, first seen %s\n",
+			d.ID, d.Name, status, d.Version, formatTime(d.LastSeen, "never"), d.IP, formatTime(d.FirstSeen, "never"))
+	}
+}
+
+// RevokeDeviceCommand revokes the device, its sessions end and its next sync fails until it logs in again
+func (c *Client) RevokeDeviceCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 2 {
+		printRevokeDeviceSyntax()
+		return
+	}
+
+	if err := c.sendRevokeDeviceRequest(input[1]); err != nil {
+		fmt.Println("can't revoke device:", err)
+		return
+	}
+	fmt.Println("Device is revoked")
+}
@@ -3,12 +3,38 @@ package clientfunc
 import "errors"
 
 var (
-	ErrLoginRequired    = errors.New("please login first")
-	ErrNoCookieReturned = errors.New("server has not returned cookie")
-	ErrWrongLoginData   = errors.New("wrong login data")
-	ErrServerIsDown     = errors.New("server is down")
-	ErrUsernameIsTaken  = errors.New("username is taken")
-	ErrMetanameIsTaken  = errors.New("metaname(cardname) already in use, provide new one")
-	ErrDataNotFound     = errors.New("data not found")
-	ErrBadRequest       = errors.New("bad request")
+	ErrLoginRequired        = errors.New("please login first")
+	ErrNoCookieReturned     = errors.New("server has not returned cookie")
+	ErrWrongLoginData       = errors.New("wrong login data")
+	ErrServerIsDown         = errors.New("server is down")
+	ErrUsernameIsTaken      = errors.New("username is taken")
+	ErrMetanameIsTaken      = errors.New("metaname(cardname) already in use, provide new one")
+	ErrDataNotFound         = errors.New("data not found")
+	ErrBadRequest           = errors.New("bad request")
+	ErrKeyPairExists        = errors.New("key pair is already set on the server")
+	ErrRecipientNotFound    = errors.New("recipient not found or has not logged in yet")
+	ErrNoKeyPair            = errors.New("key pair is not loaded, please login online")
+	ErrOrgNameIsTaken       = errors.New("organization name is taken")
+	ErrForbidden            = errors.New("your role in the organization doesn't allow this")
+	ErrReadOnlyOrg          = errors.New("viewers can't add items to the organization vault")
+	ErrWrongRecoveryData    = errors.New("recovery data doesn't match the account")
+	ErrWrongShare           = errors.New("share is malformed, check for typos")
+	ErrWrongRecoveryKey     = errors.New("wrong recovery key")
+	ErrWrongShareKind       = errors.New("wrong kind, use card, logincreds or note")
+	ErrSecondFactorRequired = errors.New("second factor is required")
+	ErrWrongSecondFactor    = errors.New("wrong second factor code")
+	ErrTOTPEnabled          = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrTooManyAttempts      = errors.New("too many attempts")
+	ErrNoClientCert         = errors.New("server has not accepted the client certificate, check it is signed by the server's client CA")
+	ErrCertAuthOff          = errors.New("client certificate authentication is off on the server")
+	ErrCertificateIsTaken   = errors.New("client certificate is bound to another account")
+	ErrLoginKeyIsTaken      = errors.New("login key is registered already")
+	ErrNoConflict           = errors.New("no such conflict, list them with conflicts")
+	ErrOrgChanged           = errors.New("members or items of the organization changed meanwhile, please try again")
+	ErrNotSynced            = errors.New("item is not on the server yet, resolve its conflict or try again after synchronization")
+	ErrItemChanged          = errors.New("item has changed on the server meanwhile, please try again")
+	ErrLastOwner            = errors.New("organization can't be left without an owner, make another member its owner first")
+	ErrDeviceRevoked        = errors.New("this device is revoked")
+	ErrAccountNotFound      = errors.New("account is not found on the server, it may be deleted")
 )
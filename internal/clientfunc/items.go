@@ -0,0 +1,164 @@
+package clientfunc
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/gambruh/simplevault/internal/helpers"
+)
+
+// itemField is a field of an opened item.
+// Label and key are the name of the storage struct field and its JSON key,
+// index is the position of the field in the sealed item
+type itemField struct {
+	label string
+	key   string
+	index int
+}
+
+// fields of the items in the order of the storage structs
+var (
+	cardFields = []itemField{
+		{"Cardname", "cardname", 0},
+		{"Number", "number", 1},
+		{"Name", "name", 2},
+		{"Surname", "surname", 3},
+		{"ValidTill", "valid till", 4},
+		{"Code", "code", 5},
+	}
+	loginCredsFields = []itemField{
+		{"Name", "name", 0},
+		{"Login", "login", 2},
+		{"Password", "password", 3},
+		{"Site", "site", 1},
+	}
+	noteFields = []itemField{
+		{"Name", "name", 0},
+		{"Text", "text", 1},
+	}
+)
+
+// fieldValue returns the value of the field. The name isn't sealed in data received from the database,
+// so it's given apart. The last field takes the rest of the item, as notes may contain commas
+func fieldValue(name string, item *helpers.OpenedItem, fields []itemField, field itemField) []byte {
+	switch field.index {
+	case 0:
+		return []byte(name)
+	case len(fields) - 1:
+		return item.Rest(field.index)
+	default:
+		return item.Field(field.index)
+	}
+}
+
+// printItem prints the item like fmt prints its storage struct with %+v.
+// Values are written straight out of the secure buffer of the item
+func printItem(name string, item *helpers.OpenedItem, fields []itemField) {
+	writeItem(os.Stdout, name, item, fields)
+}
+
+func writeItem(w io.Writer, name string, item *helpers.OpenedItem, fields []itemField) {
+	io.WriteString(w, "{")
+	for i, field := range fields {
+		if i > 0 {
+			io.WriteString(w, " ")
+		}
+		io.WriteString(w, field.label+":")
+		w.Write(fieldValue(name, item, fields, field))
+	}
+	io.WriteString(w, "}\n")
+}
+
+// itemHash returns the same hash as contentHash of the storage struct of the item.
+// The JSON of the struct is written into the hash field by field, so the values aren't copied to the heap
+func (c *Client) itemHash(kind, name string, item *helpers.OpenedItem, fields []itemField) string {
+	mac := c.contentMAC(kind)
+	mac.Write([]byte("{"))
+	for i, field := range fields {
+		if i > 0 {
+			mac.Write([]byte(","))
+		}
+		writeJSONString(mac, []byte(field.key))
+		mac.Write([]byte(":"))
+		writeJSONString(mac, fieldValue(name, item, fields, field))
+	}
+	mac.Write([]byte("}"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// binaryHash returns the same hash as contentHash of the binary.
+// The content is encoded into the hash straight out of the secure buffer
+func (c *Client) binaryHash(name string, data []byte) string {
+	mac := c.contentMAC(kindBinary)
+	mac.Write([]byte(`{"name":`))
+	writeJSONString(mac, []byte(name))
+	mac.Write([]byte(`,"data":`))
+	if len(data) == 0 {
+		// empty content is decrypted to nil, which is encoded as null
+		mac.Write([]byte("null"))
+	} else {
+		mac.Write([]byte(`"`))
+		encoder := base64.NewEncoder(base64.StdEncoding, mac)
+		encoder.Write(data)
+		encoder.Close()
+		mac.Write([]byte(`"`))
+	}
+	mac.Write([]byte("}"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeJSONString writes s quoted and escaped the way encoding/json does it
+func writeJSONString(w io.Writer, s []byte) {
+	const hexDigits = "0123456789abcdef"
+	w.Write([]byte(`"`))
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			w.Write(s[start:i])
+			switch b {
+			case '\\', '"':
+				w.Write([]byte{'\\', b})
+			case '\b':
+				w.Write([]byte(`\b`))
+			case '\f':
+				w.Write([]byte(`\f`))
+			case '\n':
+				w.Write([]byte(`\n`))
+			case '\r':
+				w.Write([]byte(`\r`))
+			case '\t':
+				w.Write([]byte(`\t`))
+			default:
+				w.Write([]byte{'\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF]})
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			w.Write(s[start:i])
+			w.Write([]byte("\ufffd"))
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			w.Write(s[start:i])
+			w.Write([]byte{'\\', 'u', '2', '0', '2', hexDigits[r&0xF]})
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	w.Write(s[start:])
+	w.Write([]byte(`"`))
+}
@@ -0,0 +1,83 @@
+package clientfunc
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+func openTestItem(t *testing.T, key []byte, fields ...string) *helpers.OpenedItem {
+	t.Helper()
+	data, err := helpers.SealFields(key, fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := helpers.OpenItem(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(item.Destroy)
+	return item
+}
+
+// Hashes of opened items are the hashes of their structs, so items synchronized
+// before they were kept in secure buffers aren't taken for changed ones
+func TestItemHashMatchesContentHash(t *testing.T) {
+	c := &Client{Key: bytes.Repeat([]byte{1}, 32)}
+	tricky := "<a href=\"x\">&amp;</a> \\ \n\r\t\b\f\x01 é \u2028\u2029 \xff"
+
+	card := storage.Card{Cardname: "visa", Number: "4111 1111", Name: tricky, Surname: "Doe", ValidTill: "12/30", Code: "123"}
+	item := openTestItem(t, c.Key, "", card.Number, card.Name, card.Surname, card.ValidTill, card.Code)
+	if got, want := c.itemHash(storage.KindCard, card.Cardname, item, cardFields), mustContentHash(t, c, storage.KindCard, card); got != want {
+		t.Errorf("card hash = %s, want %s", got, want)
+	}
+
+	creds := storage.LoginCreds{Name: "mail", Site: "mail.example.com", Login: "john", Password: tricky}
+	item = openTestItem(t, c.Key, creds.Name, creds.Site, creds.Login, creds.Password)
+	if got, want := c.itemHash(storage.KindLoginCreds, creds.Name, item, loginCredsFields), mustContentHash(t, c, storage.KindLoginCreds, creds); got != want {
+		t.Errorf("login credentials hash = %s, want %s", got, want)
+	}
+}
+
+func TestBinaryHashMatchesContentHash(t *testing.T) {
+	c := &Client{Key: bytes.Repeat([]byte{1}, 32)}
+	for _, binary := range []storage.Binary{
+		{Name: "photo <1>.png", Data: []byte{0, 1, 2, 0xff, 'a'}},
+		{Name: "one.bin", Data: []byte{7}},
+		{Name: "empty"},
+	} {
+		if got, want := c.binaryHash(binary.Name, binary.Data), mustContentHash(t, c, kindBinary, binary); got != want {
+			t.Errorf("binary %s hash = %s, want %s", binary.Name, got, want)
+		}
+	}
+}
+
+func mustContentHash(t *testing.T, c *Client, kind string, content any) string {
+	t.Helper()
+	hash, err := c.contentHash(kind, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestWriteItem(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	creds := storage.LoginCreds{Name: "mail", Site: "mail.example.com", Login: "john", Password: "secret"}
+	var out bytes.Buffer
+	writeItem(&out, creds.Name, openTestItem(t, key, "", creds.Site, creds.Login, creds.Password), loginCredsFields)
+	if want := fmt.Sprintf("%+v\n", creds); out.String() != want {
+		t.Errorf("writeItem() = %q, want %q", out.String(), want)
+	}
+
+	// the text of a note is kept whole with its commas
+	out.Reset()
+	writeItem(&out, "wifi", openTestItem(t, key, "wifi", "pin, then the password"), noteFields)
+	if want := "{Name:wifi Text:pin, then the password}\n"; out.String() != want {
+		t.Errorf("writeItem() = %q, want %q", out.String(), want)
+	}
+}
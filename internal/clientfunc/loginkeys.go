@@ -0,0 +1,240 @@
+package clientfunc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
+)
+
+// name of the file in user data folder keeping the login key of this device
+const loginKeyFile = "loginkey.json"
+
+// loginKeyData is the content of the login key file. The vault key is wrapped
+// by a key derived from the private key, so the device opens the vault without the password.
+// The file is as secret as the vault key itself: it is written with 0600 permissions
+// and refused if other users can read it
+type loginKeyData struct {
+	Login    string `json:"login"`
+	ID       string `json:"id"`
+	Key      string `json:"key"`
+	VaultKey string `json:"vaultkey"`
+}
+
+func loginKeyPath() string {
+	return filepath.Join(config.ClientCfg.UserDataFolder, loginKeyFile)
+}
+
+// loginKeyKEK derives the key which wraps the vault key out of the login key seed
+func loginKeyKEK(seed []byte) []byte {
+	key := sha256.Sum256(append([]byte("simplevault-loginkey"), seed...))
+	return key[:]
+}
+
+func readLoginKeyFile() (loginKeyData, error) {
+	var data loginKeyData
+	info, err := os.Stat(loginKeyPath())
+	if err != nil {
+		return data, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return data, fmt.Errorf("%s is readable by other users, it opens the vault: run chmod 600 on it or revoke the key", loginKeyPath())
+	}
+	raw, err := os.ReadFile(loginKeyPath())
+	if err != nil {
+		return data, err
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return data, fmt.Errorf("can't unmarshal login key file:%w", err)
+	}
+	return data, nil
+}
+
+// writeLoginKeyFile replaces the login key file, the permissions of an existing file are reset to 0600
+func writeLoginKeyFile(data []byte) error {
+	if err := os.WriteFile(loginKeyPath(), data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(loginKeyPath(), 0600)
+}
+
+// AddLoginKeyCommand registers a new login key of this device and saves it with the vault key,
+// so the device can login and sync without the password
+func (c *Client) AddLoginKeyCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 2 {
+		printAddLoginKeySyntax()
+		return
+	}
+	if c.AuthCookie == nil || c.Key == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	user, err := readUserFile()
+	if err != nil {
+		fmt.Println("please login online first")
+		return
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Println("can't generate login key:", err)
+		return
+	}
+	seed := private.Seed()
+	wrapped, err := encrypt.WrapKey(c.Key, loginKeyKEK(seed))
+	if err != nil {
+		fmt.Println("can't wrap vault key:", err)
+		return
+	}
+
+	key, err := c.sendAddLoginKeyRequest(auth.LoginKey{Name: input[1], PublicKey: base64.StdEncoding.EncodeToString(public)})
+	if err != nil {
+		fmt.Println("can't register login key:", err)
+		return
+	}
+
+	data, err := json.Marshal(loginKeyData{
+		Login:    user.Login,
+		ID:       key.ID,
+		Key:      base64.StdEncoding.EncodeToString(seed),
+		VaultKey: base64.StdEncoding.EncodeToString(wrapped),
+	})
+	if err != nil {
+		fmt.Println("can't save login key:", err)
+		return
+	}
+	os.MkdirAll(config.ClientCfg.UserDataFolder, 0700)
+	if err := writeLoginKeyFile(data); err != nil {
+		fmt.Println("can't save login key:", err)
+		return
+	}
+	fmt.Println("Login key", key.ID, "is registered, use keylogin command to login without the password")
+	fmt.Println("Anyone who copies", loginKeyPath(), "opens the vault, keep it as safe as the password")
+}
+
+// KeyLoginCommand logs in with the login key of this device and opens the vault
+func (c *Client) KeyLoginCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 1 {
+		printKeyLoginSyntax()
+		return
+	}
+	if err := c.keyLogin(); err != nil {
+		fmt.Println("can't login with the key:", err)
+		return
+	}
+	c.CheckAll()
+	fmt.Println("Successfully logged!")
+}
+
+func (c *Client) keyLogin() error {
+	data, err := readLoginKeyFile()
+	if err != nil {
+		return fmt.Errorf("no login key on this device, use addloginkey command: %w", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(data.Key)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return fmt.Errorf("login key file is malformed")
+	}
+	vaultKey, err := unwrapEncodedKey(data.VaultKey, loginKeyKEK(seed))
+	if err != nil {
+		return err
+	}
+
+	challenge, err := c.sendKeyLoginStartRequest(auth.KeyLoginData{Login: data.Login, KeyID: data.ID})
+	if err != nil {
+		return err
+	}
+	signature := ed25519.Sign(ed25519.NewKeyFromSeed(seed), auth.KeyLoginMessage(data.Login, challenge.Nonce))
+	authcookie, err := c.sendKeyLoginRequest(auth.KeyLoginData{
+		Login:     data.Login,
+		KeyID:     data.ID,
+		Nonce:     challenge.Nonce,
+		Signature: base64.StdEncoding.EncodeToString(signature),
+		Device:    c.device(),
+	})
+	if err == ErrDeviceRevoked {
+		forgetDevice()
+		return fmt.Errorf("%w, its login key is deleted: login with the password to register it as a new device", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.checkLoginFile(auth.LoginData{Login: data.Login})
+	c.AuthCookie = authcookie
+	if err := c.setKey(vaultKey); err != nil {
+		return err
+	}
+	c.Storage.InitStorage(c.Key)
+	if err := c.loadKeyPair(); err != nil {
+		fmt.Println("can't load key pair for sharing:", err)
+	}
+	if err := c.loadOrgs(); err != nil {
+		fmt.Println("can't open organizations vaults:", err)
+	}
+	c.setUnlocked()
+	return nil
+}
+
+// ListLoginKeysCommand prints login keys of the user
+func (c *Client) ListLoginKeysCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 1 {
+		printListLoginKeysSyntax()
+		return
+	}
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+
+	keys, err := c.sendListLoginKeysRequest()
+	if err != nil {
+		fmt.Println("can't list login keys:", err)
+		return
+	}
+	local, _ := readLoginKeyFile()
+	fmt.Println("Login keys:")
+	for _, key := range keys {
+		current := ""
+		if key.ID == local.ID {
+			current = " (this device)"
+		}
+		fmt.Printf("   %s %s%s, created %s, last used %s\n",
+			key.ID, key.Name, current, formatTime(key.CreatedAt, "never"), formatTime(key.LastUsedAt, "never"))
+	}
+}
+
+// RevokeLoginKeyCommand revokes a login key, the key of this device is deleted too
+func (c *Client) RevokeLoginKeyCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 2 {
+		printRevokeLoginKeySyntax()
+		return
+	}
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+
+	if err := c.sendRevokeLoginKeyRequest(input[1]); err != nil {
+		fmt.Println("can't revoke login key:", err)
+		return
+	}
+	if local, err := readLoginKeyFile(); err == nil && local.ID == input[1] {
+		os.Remove(loginKeyPath())
+	}
+	fmt.Println("Login key is revoked")
+}
@@ -0,0 +1,40 @@
+package clientfunc
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+func TestLoginKeyFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on windows")
+	}
+	folder := config.ClientCfg.UserDataFolder
+	config.ClientCfg.UserDataFolder = t.TempDir()
+	defer func() { config.ClientCfg.UserDataFolder = folder }()
+
+	if err := os.WriteFile(loginKeyPath(), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readLoginKeyFile(); err == nil {
+		t.Error("login key file readable by other users is accepted")
+	}
+
+	if err := writeLoginKeyFile([]byte(`{"login":"user"}`)); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(loginKeyPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("login key file permissions = %o, want 600", info.Mode().Perm())
+	}
+	data, err := readLoginKeyFile()
+	if err != nil || data.Login != "user" {
+		t.Errorf("readLoginKeyFile() = %+v, %v", data, err)
+	}
+}
@@ -0,0 +1,85 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+)
+
+func (c *Client) sendCreateAPIKeyRequest(data auth.APIKeyData) (auth.APIKeyData, error) {
+	var created auth.APIKeyData
+
+	res, err := c.sendJSON(http.MethodPost, "/api/apikeys/create", data)
+	if err != nil {
+		return created, fmt.Errorf("error in sendCreateAPIKeyRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+			return created, fmt.Errorf("error when decoding json in sendCreateAPIKeyRequest: %w", err)
+		}
+		return created, nil
+	case 400:
+		return created, ErrBadRequest
+	case 401:
+		return created, ErrLoginRequired
+	case 500:
+		return created, ErrServerIsDown
+	default:
+		return created, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendListAPIKeysRequest() ([]auth.APIKey, error) {
+	var keys []auth.APIKey
+
+	res, err := c.sendJSON(http.MethodGet, "/api/apikeys/list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error in sendListAPIKeysRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&keys); err != nil {
+			return nil, fmt.Errorf("error when decoding json in sendListAPIKeysRequest: %w", err)
+		}
+		return keys, nil
+	case 204:
+		return nil, nil
+	case 401:
+		return nil, ErrLoginRequired
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendRevokeAPIKeyRequest(id string) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/apikeys/revoke", auth.APIKeyData{ID: id})
+	if err != nil {
+		return fmt.Errorf("error in sendRevokeAPIKeyRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 404:
+		return ErrDataNotFound
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
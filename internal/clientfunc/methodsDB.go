@@ -7,11 +7,82 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/gambruh/simplevault/internal/storage"
 )
 
+// apiURL returns full https url of the server api path
+func (c *Client) apiURL(path string) string {
+	address := strings.TrimPrefix(c.Config.Address, "http://")
+	address = strings.TrimPrefix(address, "https://")
+	return "https://" + address + path
+}
+
+// sendJSON sends a request with json body (if any) and auth cookie (if any) to the server api path
+func (c *Client) sendJSON(method, path string, body any) (*http.Response, error) {
+	rbody := &bytes.Buffer{}
+	if body != nil {
+		jsbody, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error when marshaling json: %w", err)
+		}
+		rbody = bytes.NewBuffer(jsbody)
+	}
+
+	r, err := http.NewRequest(method, c.apiURL(path), rbody)
+	if err != nil {
+		return nil, fmt.Errorf("error when creating NewRequest: %w", err)
+	}
+	r.Header.Add("Content-Type", "application/json")
+
+	res, err := c.do(r)
+	if err != nil {
+		return nil, fmt.Errorf("error when sending request to %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// do sends the request with the auth cookie (if any). If the access token has expired,
+// the session is refreshed with the refresh token and the request is sent once again
+func (c *Client) do(r *http.Request) (*http.Response, error) {
+	c.sessionMu.Lock()
+	used := c.AuthCookie
+	c.sessionMu.Unlock()
+
+	res, err := c.Client.Do(withCookie(r, used))
+	if err != nil || res.StatusCode != http.StatusUnauthorized || used == nil {
+		return res, err
+	}
+
+	if err := c.refreshSession(used); err != nil {
+		return res, nil
+	}
+	res.Body.Close()
+
+	retry := r.Clone(r.Context())
+	if r.GetBody != nil {
+		if retry.Body, err = r.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	c.sessionMu.Lock()
+	used = c.AuthCookie
+	c.sessionMu.Unlock()
+	return c.Client.Do(withCookie(retry, used))
+}
+
+// withCookie replaces cookies of the request with the auth cookie
+func withCookie(r *http.Request, cookie *http.Cookie) *http.Request {
+	r.Header.Del("Cookie")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
 func (c *Client) sendCardToDB(encrCard storage.EncryptedData) error {
 	url := fmt.Sprintf("%s/api/cards/add", c.Config.Address)
 
@@ -34,8 +105,7 @@ func (c *Client) sendCardToDB(encrCard storage.EncryptedData) error {
 		return fmt.Errorf("error when creating NewRequest: %w", err)
 	}
 	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
+	res, err := c.do(r)
 	if err != nil {
 		return fmt.Errorf("error when sending request in sendCardToStorage: %w", err)
 	}
@@ -55,39 +125,7 @@ func (c *Client) sendCardToDB(encrCard storage.EncryptedData) error {
 }
 
 func (c *Client) listCardsFromDB() (cards []string, err error) {
-	url := fmt.Sprintf("%s/api/cards/list", c.Config.Address)
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	r, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error when creating NewRequest: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return nil, fmt.Errorf("error when sending request in listCardsFromDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		err := json.NewDecoder(res.Body).Decode(&cards)
-		if err != nil {
-			return nil, fmt.Errorf("error when decoding json in listCardsFromDB: %w", err)
-		}
-	case 401:
-		return nil, ErrLoginRequired
-	case 500:
-		return nil, ErrServerIsDown
-	}
-	return cards, nil
+	return c.listItemsFromDB("/api/cards/list", storage.ListOptions{})
 }
 
 func (c *Client) getCardFromDB(cardname string) (card storage.EncryptedData, err error) {
@@ -112,8 +150,7 @@ func (c *Client) getCardFromDB(cardname string) (card storage.EncryptedData, err
 		return storage.EncryptedData{}, fmt.Errorf("error when creating NewRequest in getCardFromDB: %w", err)
 	}
 	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
+	res, err := c.do(r)
 	if err != nil {
 		return storage.EncryptedData{}, fmt.Errorf("error when sending request in getCardFromDB: %w", err)
 	}
@@ -140,7 +177,10 @@ func (c *Client) getCardFromDB(cardname string) (card storage.EncryptedData, err
 }
 
 func (c *Client) GetCardFromDB(cardname string) {
-	card, err := c.getCardFromDB(cardname)
+	card, err := c.getCardFromDB(c.blindIndex(storage.KindCard, cardname))
+	if err == nil {
+		card, err = c.revealEncryptedData(card)
+	}
 	switch err {
 	case ErrDataNotFound:
 		fmt.Println("Card with that name not found in the DB")
@@ -156,7 +196,10 @@ func (c *Client) GetCardFromDB(cardname string) {
 }
 
 func (c *Client) SendCardToDB(cardData storage.EncryptedData) {
-	err := c.sendCardToDB(cardData)
+	hidden, err := c.hideEncryptedData(storage.KindCard, cardData)
+	if err == nil {
+		err = c.sendCardToDB(hidden)
+	}
 	switch err {
 	case ErrMetanameIsTaken:
 		log.Println("There are already card with this name in database. Please provide new cardname or edit current")
@@ -169,393 +212,60 @@ func (c *Client) SendCardToDB(cardData storage.EncryptedData) {
 	}
 }
 
-func (c *Client) sendLoginCredsToDB(encrData storage.EncryptedData) error {
-	url := fmt.Sprintf("%s/api/logincreds/add", c.Config.Address)
-
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	jsbody, err := json.Marshal(encrData)
-	if err != nil {
-		return fmt.Errorf("error when marshaling json: %w", err)
-	}
-	rbody := bytes.NewBuffer(jsbody)
-	r, err := http.NewRequest(http.MethodPost, url, rbody)
-	if err != nil {
-		return fmt.Errorf("error when creating NewRequest: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return fmt.Errorf("error when sending request in sendLoginCredsToDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		return nil
-	case 401:
-		return ErrLoginRequired
-	case 409:
-		return ErrMetanameIsTaken
-	case 500:
-		fmt.Println("internal server error")
-	}
-	return nil
-}
-
 func (c *Client) listLoginCredsFromDB() (logincreds []string, err error) {
-	url := fmt.Sprintf("%s/api/logincreds/list", c.Config.Address)
-
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	r, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error when creating NewRequest: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return nil, fmt.Errorf("error when sending request in listCardsFromDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		err := json.NewDecoder(res.Body).Decode(&logincreds)
-		if err != nil {
-			return nil, fmt.Errorf("error when decoding json in listCardsFromDB: %w", err)
-		}
-	case 401:
-		return nil, ErrLoginRequired
-	case 500:
-		return nil, ErrServerIsDown
-	}
-	return logincreds, nil
+	return c.listItemsFromDB("/api/logincreds/list", storage.ListOptions{})
 }
 
-func (c *Client) getLoginCredsFromDB(logincredname string) (encrData storage.EncryptedData, err error) {
-	var input storage.EncryptedData
-	input.Name = logincredname
-	url := fmt.Sprintf("%s/api/logincreds/get", c.Config.Address)
-
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	jsbody, err := json.Marshal(input)
-	if err != nil {
-		return storage.EncryptedData{}, fmt.Errorf("error when marshaling json in getLoginCredsFromDB: %w", err)
-	}
-	rbody := bytes.NewBuffer(jsbody)
-	r, err := http.NewRequest(http.MethodPost, url, rbody)
-	if err != nil {
-		return storage.EncryptedData{}, fmt.Errorf("error when creating NewRequest in getLoginCredsFromDB: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return storage.EncryptedData{}, fmt.Errorf("error when sending request in getLoginCredsFromDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		err := json.NewDecoder(res.Body).Decode(&encrData)
-		if err != nil {
-			return storage.EncryptedData{}, fmt.Errorf("error when decoding json in getLoginCredsFromDB: %w", err)
-		}
-		return encrData, nil
-	case 204:
-		return storage.EncryptedData{}, ErrDataNotFound
-	case 400:
-		return storage.EncryptedData{}, ErrBadRequest
-	case 401:
-		return storage.EncryptedData{}, ErrLoginRequired
-	case 500:
-		return storage.EncryptedData{}, ErrServerIsDown
-	default:
-		return storage.EncryptedData{}, errors.New("unexpected error")
-	}
+func (c *Client) listNotesFromDB() (notes []string, err error) {
+	return c.listItemsFromDB("/api/notes/list", storage.ListOptions{})
 }
 
-func (c *Client) sendNoteToDB(encrData storage.EncryptedData) error {
-	url := fmt.Sprintf("%s/api/notes/add", c.Config.Address)
-
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	jsbody, err := json.Marshal(encrData)
-	if err != nil {
-		return fmt.Errorf("error when marshaling json: %w", err)
-	}
-	rbody := bytes.NewBuffer(jsbody)
-	r, err := http.NewRequest(http.MethodPost, url, rbody)
-	if err != nil {
-		return fmt.Errorf("error when creating NewRequest: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return fmt.Errorf("error when sending request in sendLoginCredsToDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		return nil
-	case 401:
-		return ErrLoginRequired
-	case 409:
-		return ErrMetanameIsTaken
-	case 500:
-		fmt.Println("internal server error")
-	}
-	return nil
+func (c *Client) listBinariesFromDB() (binaries []string, err error) {
+	return c.listItemsFromDB("/api/binaries/list", storage.ListOptions{})
 }
 
-func (c *Client) listNotesFromDB() (notes []string, err error) {
-	url := fmt.Sprintf("%s/api/notes/list", c.Config.Address)
-
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
+// listItemsFromDB pages through the list at the server api path and returns all the names
+// in the order of the options. The tag of the options must be a blind index already
+func (c *Client) listItemsFromDB(path string, opts storage.ListOptions) (names []string, err error) {
+	query := url.Values{"limit": {strconv.Itoa(storage.MaxPageSize)}}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
 	}
-
-	r, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error when creating NewRequest: %w", err)
+	if opts.Tag != "" {
+		query.Set("tag", opts.Tag)
 	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return nil, fmt.Errorf("error when sending request in listCardsFromDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		err := json.NewDecoder(res.Body).Decode(&notes)
+	for {
+		res, err := c.sendJSON(http.MethodGet, path+"?"+query.Encode(), nil)
 		if err != nil {
-			return nil, fmt.Errorf("error when decoding json in listCardsFromDB: %w", err)
+			return nil, err
 		}
-	case 401:
-		return nil, ErrLoginRequired
-	case 500:
-		return nil, ErrServerIsDown
-	}
-	return notes, nil
-}
-
-func (c *Client) getNoteFromDB(notename string) (encrData storage.EncryptedData, err error) {
-	var input storage.EncryptedData
-	input.Name = notename
-	url := fmt.Sprintf("%s/api/notes/get", c.Config.Address)
 
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	jsbody, err := json.Marshal(input)
-	if err != nil {
-		return storage.EncryptedData{}, fmt.Errorf("error when marshaling json in getNoteFromDB: %w", err)
-	}
-	rbody := bytes.NewBuffer(jsbody)
-	r, err := http.NewRequest(http.MethodPost, url, rbody)
-	if err != nil {
-		return storage.EncryptedData{}, fmt.Errorf("error when creating NewRequest in getNoteFromDB: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return storage.EncryptedData{}, fmt.Errorf("error when sending request in getNoteFromDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		err := json.NewDecoder(res.Body).Decode(&encrData)
-		if err != nil {
-			return storage.EncryptedData{}, fmt.Errorf("error when decoding json in getNoteFromDB: %w", err)
+		var page []string
+		switch res.StatusCode {
+		case 200:
+			err = json.NewDecoder(res.Body).Decode(&page)
+		case 204:
+			res.Body.Close()
+			return names, nil
+		case 400:
+			err = ErrBadRequest
+		case 401:
+			err = ErrLoginRequired
+		case 500:
+			err = ErrServerIsDown
+		default:
+			err = errors.New("unexpected error")
 		}
-		return encrData, nil
-	case 204:
-		return storage.EncryptedData{}, ErrDataNotFound
-	case 400:
-		return storage.EncryptedData{}, ErrBadRequest
-	case 401:
-		return storage.EncryptedData{}, ErrLoginRequired
-	case 500:
-		return storage.EncryptedData{}, ErrServerIsDown
-	default:
-		return storage.EncryptedData{}, errors.New("unexpected error")
-	}
-}
-
-func (c *Client) sendBinaryToDB(encrData storage.Binary) error {
-	url := fmt.Sprintf("%s/api/binaries/add", c.Config.Address)
-
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	jsbody, err := json.Marshal(encrData)
-	if err != nil {
-		return fmt.Errorf("error when marshaling json: %w", err)
-	}
-	rbody := bytes.NewBuffer(jsbody)
-	r, err := http.NewRequest(http.MethodPost, url, rbody)
-	if err != nil {
-		return fmt.Errorf("error when creating NewRequest: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return fmt.Errorf("error when sending request in sendLoginCredsToDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		return nil
-	case 401:
-		return ErrLoginRequired
-	case 409:
-		return ErrMetanameIsTaken
-	case 500:
-		fmt.Println("internal server error")
-	}
-	return nil
-}
-
-func (c *Client) getBinaryFromDB(binaryname string) (encrData storage.Binary, err error) {
-	var input storage.Binary
-	input.Name = binaryname
-	url := fmt.Sprintf("%s/api/binaries/get", c.Config.Address)
-
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	jsbody, err := json.Marshal(input)
-	if err != nil {
-		return storage.Binary{}, fmt.Errorf("error when marshaling json in getBinaryFromDB: %w", err)
-	}
-	rbody := bytes.NewBuffer(jsbody)
-	r, err := http.NewRequest(http.MethodPost, url, rbody)
-	if err != nil {
-		return storage.Binary{}, fmt.Errorf("error when creating NewRequest in getBinaryFromDB: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return storage.Binary{}, fmt.Errorf("error when sending request in getBinaryFromDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		err := json.NewDecoder(res.Body).Decode(&encrData)
+		res.Body.Close()
 		if err != nil {
-			return storage.Binary{}, fmt.Errorf("error when decoding json in getBinaryFromDB: %w", err)
+			return nil, fmt.Errorf("error listing %s:%w", path, err)
 		}
-		return encrData, nil
-	case 204:
-		return storage.Binary{}, ErrDataNotFound
-	case 400:
-		return storage.Binary{}, ErrBadRequest
-	case 401:
-		return storage.Binary{}, ErrLoginRequired
-	case 500:
-		return storage.Binary{}, ErrServerIsDown
-	default:
-		return storage.Binary{}, errors.New("unexpected error")
-	}
-}
 
-func (c *Client) listBinariesFromDB() (binaries []string, err error) {
-	url := fmt.Sprintf("%s/api/binaries/list", c.Config.Address)
-	if strings.HasPrefix(url, "http://") {
-		strings.CutPrefix(url, "http://")
-		url = "https://" + url
-	}
-	if !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-
-	r, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error when creating NewRequest: %w", err)
-	}
-	r.Header.Add("Content-Type", "application/json")
-	r.AddCookie(c.AuthCookie)
-	res, err := c.Client.Do(r)
-	if err != nil {
-		return nil, fmt.Errorf("error when sending request in listCardsFromDB: %w", err)
-	}
-	defer res.Body.Close()
-
-	switch res.StatusCode {
-	case 200:
-		err := json.NewDecoder(res.Body).Decode(&binaries)
-		if err != nil {
-			return nil, fmt.Errorf("error when decoding json in listCardsFromDB: %w", err)
+		names = append(names, page...)
+		next := res.Header.Get(storage.NextCursorHeader)
+		if next == "" {
+			return names, nil
 		}
-	case 401:
-		return nil, ErrLoginRequired
-	case 500:
-		return nil, ErrServerIsDown
+		query.Set("cursor", next)
 	}
-	return binaries, nil
 }
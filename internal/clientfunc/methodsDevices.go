@@ -0,0 +1,59 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+)
+
+func (c *Client) sendListDevicesRequest() ([]auth.Device, error) {
+	var devices []auth.Device
+
+	res, err := c.sendJSON(http.MethodGet, "/api/devices/list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error in sendListDevicesRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&devices); err != nil {
+			return nil, fmt.Errorf("error when decoding json in sendListDevicesRequest: %w", err)
+		}
+		return devices, nil
+	case 204:
+		return nil, nil
+	case 401:
+		return nil, ErrLoginRequired
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendRevokeDeviceRequest(id string) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/devices/revoke", auth.Device{ID: id})
+	if err != nil {
+		return fmt.Errorf("error in sendRevokeDeviceRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 404:
+		return ErrDataNotFound
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
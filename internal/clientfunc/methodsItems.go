@@ -0,0 +1,107 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// syncBatchSize is the most items sent to the server in one batch request
+const syncBatchSize = 100
+
+// sendItemsToDB saves the items on the server in batches and returns the result of every item
+func (c *Client) sendItemsToDB(items []storage.Item) ([]storage.ItemResult, error) {
+	return c.sendBatches("/api/items/add", items)
+}
+
+// updateItemsInDB replaces existing items on the server in batches and returns the result of every item
+func (c *Client) updateItemsInDB(items []storage.Item) ([]storage.ItemResult, error) {
+	return c.sendBatches("/api/items/update", items)
+}
+
+// deleteItemsInDB deletes items on the server by kind and name in batches and returns the result of every item
+func (c *Client) deleteItemsInDB(items []storage.Item) ([]storage.ItemResult, error) {
+	return c.sendBatches("/api/items/delete", items)
+}
+
+// getItemsFromDB reads the items by kind and name from the server in batches and returns them
+func (c *Client) getItemsFromDB(items []storage.Item) ([]storage.ItemResult, error) {
+	return c.sendBatches("/api/items/get", items)
+}
+
+func (c *Client) sendBatches(path string, items []storage.Item) (results []storage.ItemResult, err error) {
+	for start := 0; start < len(items); start += syncBatchSize {
+		end := start + syncBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		batch, err := c.sendBatch(path, items[start:end])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+	}
+	return results, nil
+}
+
+func (c *Client) sendBatch(path string, items []storage.Item) (results []storage.ItemResult, err error) {
+	res, err := c.sendJSON(http.MethodPost, path, items)
+	if err != nil {
+		return nil, fmt.Errorf("error in sendBatch: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&results)
+		if err != nil {
+			return nil, fmt.Errorf("error when decoding json in sendBatch: %w", err)
+		}
+		if len(results) != len(items) {
+			return nil, errors.New("server returned results of another batch")
+		}
+		return results, nil
+	case 400, 413:
+		return nil, ErrBadRequest
+	case 401:
+		return nil, ErrLoginRequired
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+// getChangesFromDB reads a page of the change feed after the revision since, at most limit changes
+func (c *Client) getChangesFromDB(since int64, limit int) (changes storage.Changes, err error) {
+	query := url.Values{"since": {strconv.FormatInt(since, 10)}, "limit": {strconv.Itoa(limit)}}
+	res, err := c.sendJSON(http.MethodGet, "/api/sync/changes?"+query.Encode(), nil)
+	if err != nil {
+		return storage.Changes{}, fmt.Errorf("error in getChangesFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&changes)
+		if err != nil {
+			return storage.Changes{}, fmt.Errorf("error when decoding json in getChangesFromDB: %w", err)
+		}
+		return changes, nil
+	case 400:
+		return storage.Changes{}, ErrBadRequest
+	case 401:
+		return storage.Changes{}, ErrLoginRequired
+	case 404:
+		return storage.Changes{}, ErrAccountNotFound
+	case 500:
+		return storage.Changes{}, ErrServerIsDown
+	default:
+		return storage.Changes{}, errors.New("unexpected error")
+	}
+}
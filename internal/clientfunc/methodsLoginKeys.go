@@ -0,0 +1,138 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+)
+
+func (c *Client) sendKeyLoginStartRequest(data auth.KeyLoginData) (auth.KeyLoginData, error) {
+	var challenge auth.KeyLoginData
+
+	res, err := c.sendJSON(http.MethodPost, "/api/user/keylogin/start", data)
+	if err != nil {
+		return challenge, fmt.Errorf("error in sendKeyLoginStartRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&challenge); err != nil {
+			return challenge, fmt.Errorf("error when decoding json in sendKeyLoginStartRequest: %w", err)
+		}
+		return challenge, nil
+	case 400:
+		return challenge, ErrBadRequest
+	case 429:
+		return challenge, tooManyAttempts(res)
+	case 500:
+		return challenge, ErrServerIsDown
+	default:
+		return challenge, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendKeyLoginRequest(data auth.KeyLoginData) (*http.Cookie, error) {
+	res, err := c.sendJSON(http.MethodPost, "/api/user/keylogin", data)
+	if err != nil {
+		return nil, fmt.Errorf("error in sendKeyLoginRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return c.sessionCookies(res)
+	case 400:
+		return nil, ErrBadRequest
+	case 401:
+		return nil, ErrWrongLoginData
+	case 410:
+		return nil, ErrDeviceRevoked
+	case 429:
+		return nil, tooManyAttempts(res)
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendAddLoginKeyRequest(key auth.LoginKey) (auth.LoginKey, error) {
+	var added auth.LoginKey
+
+	res, err := c.sendJSON(http.MethodPost, "/api/loginkeys/add", key)
+	if err != nil {
+		return added, fmt.Errorf("error in sendAddLoginKeyRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&added); err != nil {
+			return added, fmt.Errorf("error when decoding json in sendAddLoginKeyRequest: %w", err)
+		}
+		return added, nil
+	case 400:
+		return added, ErrBadRequest
+	case 401:
+		return added, ErrLoginRequired
+	case 409:
+		return added, ErrLoginKeyIsTaken
+	case 500:
+		return added, ErrServerIsDown
+	default:
+		return added, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendListLoginKeysRequest() ([]auth.LoginKey, error) {
+	var keys []auth.LoginKey
+
+	res, err := c.sendJSON(http.MethodGet, "/api/loginkeys/list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error in sendListLoginKeysRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&keys); err != nil {
+			return nil, fmt.Errorf("error when decoding json in sendListLoginKeysRequest: %w", err)
+		}
+		return keys, nil
+	case 204:
+		return nil, nil
+	case 401:
+		return nil, ErrLoginRequired
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendRevokeLoginKeyRequest(id string) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/loginkeys/revoke", auth.LoginKey{ID: id})
+	if err != nil {
+		return fmt.Errorf("error in sendRevokeLoginKeyRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 404:
+		return ErrDataNotFound
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
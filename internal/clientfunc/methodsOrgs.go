@@ -0,0 +1,241 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+func (c *Client) createOrgInDB(org storage.Org) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/orgs/create", org)
+	if err != nil {
+		return fmt.Errorf("error in createOrgInDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 202:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 409:
+		return ErrOrgNameIsTaken
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) listOrgsFromDB() (orgs []storage.Org, err error) {
+	res, err := c.sendJSON(http.MethodGet, "/api/orgs/list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error in listOrgsFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&orgs)
+		if err != nil {
+			return nil, fmt.Errorf("error when decoding json in listOrgsFromDB: %w", err)
+		}
+		return orgs, nil
+	case 204:
+		return nil, nil
+	case 401:
+		return nil, ErrLoginRequired
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendOrgMemberToDB(path string, member storage.OrgMember) error {
+	res, err := c.sendJSON(http.MethodPost, path, member)
+	if err != nil {
+		return fmt.Errorf("error in sendOrgMemberToDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200, 202:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 403:
+		return ErrForbidden
+	case 404:
+		return ErrRecipientNotFound
+	case 409:
+		return ErrLastOwner
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendOrgRotationToDB(rotation storage.OrgRotation) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/orgs/members/remove", rotation)
+	if err != nil {
+		return fmt.Errorf("error in sendOrgRotationToDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 403:
+		return ErrForbidden
+	case 404:
+		return ErrRecipientNotFound
+	case 409:
+		return ErrOrgChanged
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) listOrgMembersFromDB(orgname string) (members []storage.OrgMember, err error) {
+	res, err := c.sendJSON(http.MethodPost, "/api/orgs/members/list", storage.OrgMember{Org: orgname})
+	if err != nil {
+		return nil, fmt.Errorf("error in listOrgMembersFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&members)
+		if err != nil {
+			return nil, fmt.Errorf("error when decoding json in listOrgMembersFromDB: %w", err)
+		}
+		return members, nil
+	case 401:
+		return nil, ErrLoginRequired
+	case 403:
+		return nil, ErrForbidden
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendOrgItemToDB(item storage.OrgItem) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/orgs/items/add", item)
+	if err != nil {
+		return fmt.Errorf("error in sendOrgItemToDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 202:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 403:
+		return ErrForbidden
+	case 409:
+		return ErrMetanameIsTaken
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) deleteOrgItemInDB(orgname, kind, name string) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/orgs/items/delete", storage.OrgItem{Org: orgname, Kind: kind, Name: name})
+	if err != nil {
+		return fmt.Errorf("error in deleteOrgItemInDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 403:
+		return ErrForbidden
+	case 404:
+		return ErrDataNotFound
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) getOrgItemFromDB(orgname, kind, name string) (item storage.OrgItem, err error) {
+	res, err := c.sendJSON(http.MethodPost, "/api/orgs/items/get", storage.OrgItem{Org: orgname, Kind: kind, Name: name})
+	if err != nil {
+		return storage.OrgItem{}, fmt.Errorf("error in getOrgItemFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&item)
+		if err != nil {
+			return storage.OrgItem{}, fmt.Errorf("error when decoding json in getOrgItemFromDB: %w", err)
+		}
+		return item, nil
+	case 204:
+		return storage.OrgItem{}, ErrDataNotFound
+	case 401:
+		return storage.OrgItem{}, ErrLoginRequired
+	case 403:
+		return storage.OrgItem{}, ErrForbidden
+	case 500:
+		return storage.OrgItem{}, ErrServerIsDown
+	default:
+		return storage.OrgItem{}, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) listOrgItemsFromDB(orgname string) (items []storage.OrgItem, err error) {
+	res, err := c.sendJSON(http.MethodPost, "/api/orgs/items/list", storage.OrgItem{Org: orgname})
+	if err != nil {
+		return nil, fmt.Errorf("error in listOrgItemsFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&items)
+		if err != nil {
+			return nil, fmt.Errorf("error when decoding json in listOrgItemsFromDB: %w", err)
+		}
+		return items, nil
+	case 204:
+		return nil, nil
+	case 401:
+		return nil, ErrLoginRequired
+	case 403:
+		return nil, ErrForbidden
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
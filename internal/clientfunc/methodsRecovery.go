@@ -0,0 +1,134 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+)
+
+func (c *Client) sendVaultKeyToDB(data auth.VaultKeyData) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/vaultkey/set", data)
+	if err != nil {
+		return fmt.Errorf("error in sendVaultKeyToDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 202:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 403:
+		return ErrWrongLoginData
+	case 429:
+		return tooManyAttempts(res)
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) getVaultKeyFromDB(kind string) (string, error) {
+	var data auth.VaultKeyData
+
+	res, err := c.sendJSON(http.MethodPost, "/api/vaultkey/get", auth.VaultKeyData{Kind: kind})
+	if err != nil {
+		return "", fmt.Errorf("error in getVaultKeyFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+			return "", fmt.Errorf("error when decoding json in getVaultKeyFromDB: %w", err)
+		}
+		return data.Key, nil
+	case 204:
+		return "", ErrDataNotFound
+	case 401:
+		return "", ErrLoginRequired
+	case 500:
+		return "", ErrServerIsDown
+	default:
+		return "", errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendRecoveryVerifierToDB(data auth.ResetData) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/user/recovery", data)
+	if err != nil {
+		return fmt.Errorf("error in sendRecoveryVerifierToDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 202:
+		return nil
+	case 401:
+		return ErrLoginRequired
+	case 403:
+		return ErrWrongLoginData
+	case 429:
+		return tooManyAttempts(res)
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendResetRequest(data auth.ResetData) (*http.Cookie, error) {
+	data.Device = c.device()
+	res, err := c.sendJSON(http.MethodPost, "/api/user/reset", data)
+	if err != nil {
+		return nil, fmt.Errorf("error in sendResetRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return c.sessionCookies(res)
+	case 400:
+		return nil, ErrBadRequest
+	case 401:
+		return nil, ErrWrongRecoveryData
+	case 410:
+		return nil, ErrDeviceRevoked
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) getRecoveryVaultKeyFromDB(login string) (string, error) {
+	var data auth.VaultKeyData
+
+	res, err := c.sendJSON(http.MethodPost, "/api/user/recoverykey", auth.LoginData{Login: login})
+	if err != nil {
+		return "", fmt.Errorf("error in getRecoveryVaultKeyFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+			return "", fmt.Errorf("error when decoding json in getRecoveryVaultKeyFromDB: %w", err)
+		}
+		return data.Key, nil
+	case 400:
+		return "", ErrBadRequest
+	case 404:
+		return "", ErrDataNotFound
+	case 500:
+		return "", ErrServerIsDown
+	default:
+		return "", errors.New("unexpected error")
+	}
+}
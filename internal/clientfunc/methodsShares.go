@@ -0,0 +1,155 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+func (c *Client) getKeyPairFromDB() (keys storage.KeyPair, err error) {
+	res, err := c.sendJSON(http.MethodGet, "/api/keys/get", nil)
+	if err != nil {
+		return storage.KeyPair{}, fmt.Errorf("error in getKeyPairFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&keys)
+		if err != nil {
+			return storage.KeyPair{}, fmt.Errorf("error when decoding json in getKeyPairFromDB: %w", err)
+		}
+		return keys, nil
+	case 204:
+		return storage.KeyPair{}, ErrDataNotFound
+	case 401:
+		return storage.KeyPair{}, ErrLoginRequired
+	case 500:
+		return storage.KeyPair{}, ErrServerIsDown
+	default:
+		return storage.KeyPair{}, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendKeyPairToDB(keys storage.KeyPair) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/keys/set", keys)
+	if err != nil {
+		return fmt.Errorf("error in sendKeyPairToDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 202:
+		return nil
+	case 401:
+		return ErrLoginRequired
+	case 409:
+		return ErrKeyPairExists
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) getPublicKeyFromDB(login string) (publickey string, err error) {
+	var keys storage.KeyPair
+
+	res, err := c.sendJSON(http.MethodPost, "/api/keys/public", auth.LoginData{Login: login})
+	if err != nil {
+		return "", fmt.Errorf("error in getPublicKeyFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&keys)
+		if err != nil {
+			return "", fmt.Errorf("error when decoding json in getPublicKeyFromDB: %w", err)
+		}
+		return keys.PublicKey, nil
+	case 401:
+		return "", ErrLoginRequired
+	case 404:
+		return "", ErrRecipientNotFound
+	case 500:
+		return "", ErrServerIsDown
+	default:
+		return "", errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendShareToDB(share storage.Share) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/shares/add", share)
+	if err != nil {
+		return fmt.Errorf("error in sendShareToDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 202:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 404:
+		return ErrRecipientNotFound
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+func (c *Client) listSharesFromDB(path string) (shares []storage.Share, err error) {
+	res, err := c.sendJSON(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error in listSharesFromDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		err := json.NewDecoder(res.Body).Decode(&shares)
+		if err != nil {
+			return nil, fmt.Errorf("error when decoding json in listSharesFromDB: %w", err)
+		}
+		return shares, nil
+	case 204:
+		return nil, nil
+	case 401:
+		return nil, ErrLoginRequired
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) revokeShareInDB(share storage.Share) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/shares/revoke", share)
+	if err != nil {
+		return fmt.Errorf("error in revokeShareInDB: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrLoginRequired
+	case 404:
+		return ErrDataNotFound
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
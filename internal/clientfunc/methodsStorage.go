@@ -1,15 +1,26 @@
 package clientfunc
 
 import (
+	"encoding/base64"
 	"fmt"
 	"log"
 
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/securebuf"
 	"github.com/gambruh/simplevault/internal/storage"
 )
 
 // Card commands helpers
 
 func (c *Client) saveCardInStorage(card storage.Card) error {
+	if vault, name, ok := c.orgVaultFor(card.Cardname); ok {
+		if vault.Role == storage.RoleViewer {
+			return ErrReadOnlyOrg
+		}
+		card.Cardname = name
+		return vault.Storage.SaveCard(card, vault.Key)
+	}
 	err := c.Storage.SaveCard(card, c.Key)
 	if err != nil {
 		return fmt.Errorf("error in saveCardInStorage:%w", err)
@@ -27,17 +38,33 @@ func (c *Client) listCardsFromStorage() (cards []string, err error) {
 	return cards, nil
 }
 
-func (c *Client) getCardFromStorage(cardname string) (card storage.Card, err error) {
-
-	card, err = c.Storage.GetCard(cardname, c.Key)
+func (c *Client) openCardFromStorage(cardname string) (*helpers.OpenedItem, error) {
+	if vault, name, ok := c.orgVaultFor(cardname); ok {
+		return vault.Storage.OpenCard(name, vault.Key)
+	}
+	card, err := c.Storage.OpenCard(cardname, c.Key)
 	if err != nil {
-		fmt.Println("err in getCardFromStorage is:", err)
-		return storage.Card{}, err
+		fmt.Println("err in openCardFromStorage is:", err)
+		return nil, err
 	}
 
 	return card, nil
 }
 
+// saveOpenedCardInStorage saves the item opened out of data received from the database
+func (c *Client) saveOpenedCardInStorage(cardname string, card *helpers.OpenedItem) error {
+	if vault, name, ok := c.orgVaultFor(cardname); ok {
+		if vault.Role == storage.RoleViewer {
+			return ErrReadOnlyOrg
+		}
+		return vault.Storage.SaveOpenedCard(name, card, vault.Key)
+	}
+	if err := c.Storage.SaveOpenedCard(cardname, card, c.Key); err != nil {
+		return fmt.Errorf("error in saveOpenedCardInStorage:%w", err)
+	}
+	return nil
+}
+
 func (c *Client) DeleteLocalStorage() {
 
 	err := c.Storage.DeleteLocalStorage()
@@ -49,6 +76,13 @@ func (c *Client) DeleteLocalStorage() {
 }
 
 func (c *Client) saveLoginCredsInStorage(logincreds storage.LoginCreds) error {
+	if vault, name, ok := c.orgVaultFor(logincreds.Name); ok {
+		if vault.Role == storage.RoleViewer {
+			return ErrReadOnlyOrg
+		}
+		logincreds.Name = name
+		return vault.Storage.SaveLoginCreds(logincreds, vault.Key)
+	}
 
 	err := c.Storage.SaveLoginCreds(logincreds, c.Key)
 	if err != nil {
@@ -58,16 +92,33 @@ func (c *Client) saveLoginCredsInStorage(logincreds storage.LoginCreds) error {
 
 }
 
-func (c *Client) getLoginCredsFromStorage(logincredname string) (logincred storage.LoginCreds, err error) {
-	logincred, err = c.Storage.GetLoginCreds(logincredname, c.Key)
+func (c *Client) openLoginCredsFromStorage(logincredname string) (*helpers.OpenedItem, error) {
+	if vault, name, ok := c.orgVaultFor(logincredname); ok {
+		return vault.Storage.OpenLoginCreds(name, vault.Key)
+	}
+	logincred, err := c.Storage.OpenLoginCreds(logincredname, c.Key)
 	if err != nil {
-		fmt.Println("err in getLoginCredsFromStorage is:", err)
-		return storage.LoginCreds{}, err
+		fmt.Println("err in openLoginCredsFromStorage is:", err)
+		return nil, err
 	}
 
 	return logincred, nil
 }
 
+// saveOpenedLoginCredsInStorage saves the item opened out of data received from the database
+func (c *Client) saveOpenedLoginCredsInStorage(logincredname string, logincred *helpers.OpenedItem) error {
+	if vault, name, ok := c.orgVaultFor(logincredname); ok {
+		if vault.Role == storage.RoleViewer {
+			return ErrReadOnlyOrg
+		}
+		return vault.Storage.SaveOpenedLoginCreds(name, logincred, vault.Key)
+	}
+	if err := c.Storage.SaveOpenedLoginCreds(logincredname, logincred, c.Key); err != nil {
+		return fmt.Errorf("error in saveOpenedLoginCredsInStorage:%w", err)
+	}
+	return nil
+}
+
 func (c *Client) listLoginCredsFromStorage() (logincreds []string, err error) {
 	logincreds, err = c.Storage.ListLoginCreds()
 	if err != nil {
@@ -78,6 +129,13 @@ func (c *Client) listLoginCredsFromStorage() (logincreds []string, err error) {
 }
 
 func (c *Client) saveNoteInStorage(note storage.Note) error {
+	if vault, name, ok := c.orgVaultFor(note.Name); ok {
+		if vault.Role == storage.RoleViewer {
+			return ErrReadOnlyOrg
+		}
+		note.Name = name
+		return vault.Storage.SaveNote(note, vault.Key)
+	}
 
 	err := c.Storage.SaveNote(note, c.Key)
 	if err != nil {
@@ -87,16 +145,33 @@ func (c *Client) saveNoteInStorage(note storage.Note) error {
 
 }
 
-func (c *Client) getNoteFromStorage(notename string) (note storage.Note, err error) {
-	note, err = c.Storage.GetNote(notename, c.Key)
+func (c *Client) openNoteFromStorage(notename string) (*helpers.OpenedItem, error) {
+	if vault, name, ok := c.orgVaultFor(notename); ok {
+		return vault.Storage.OpenNote(name, vault.Key)
+	}
+	note, err := c.Storage.OpenNote(notename, c.Key)
 	if err != nil {
-		fmt.Println("err in getNoteFromStorage is:", err)
-		return storage.Note{}, err
+		fmt.Println("err in openNoteFromStorage is:", err)
+		return nil, err
 	}
 
 	return note, nil
 }
 
+// saveOpenedNoteInStorage saves the item opened out of data received from the database
+func (c *Client) saveOpenedNoteInStorage(notename string, note *helpers.OpenedItem) error {
+	if vault, name, ok := c.orgVaultFor(notename); ok {
+		if vault.Role == storage.RoleViewer {
+			return ErrReadOnlyOrg
+		}
+		return vault.Storage.SaveOpenedNote(name, note, vault.Key)
+	}
+	if err := c.Storage.SaveOpenedNote(notename, note, c.Key); err != nil {
+		return fmt.Errorf("error in saveOpenedNoteInStorage:%w", err)
+	}
+	return nil
+}
+
 func (c *Client) listNotesFromStorage() (notes []string, err error) {
 	notes, err = c.Storage.ListNotes()
 	if err != nil {
@@ -126,6 +201,34 @@ func (c *Client) getBinaryFromStorage(binaryname string) (binary storage.Binary,
 	return binary, nil
 }
 
+// openBinaryFromStorage decrypts the binary right into a secure buffer, the caller must destroy it
+func (c *Client) openBinaryFromStorage(binaryname string) (*securebuf.Buffer, error) {
+	binary, err := c.Storage.GetEncryptedBinary(binaryname)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(string(binary.Data))
+	if err != nil {
+		return nil, fmt.Errorf("error in openBinaryFromStorage:%w", err)
+	}
+	return encrypt.DecryptDataSecure(encrypted, c.Key)
+}
+
+// saveSealedBinaryInStorage saves the binary encrypted with the vault key received from the database
+// without decrypting it into the heap. Binaries uploaded before they were encrypted come in clear
+func (c *Client) saveSealedBinaryInStorage(binaryname string, data []byte) error {
+	plain, err := encrypt.DecryptDataSecure(data, c.Key)
+	switch err {
+	case nil:
+		plain.Destroy()
+		return c.Storage.SaveEncryptedBinary(binaryname, data)
+	case encrypt.ErrWrongKey:
+		return c.saveBinaryInStorage(storage.Binary{Name: binaryname, Data: data})
+	default:
+		return err
+	}
+}
+
 func (c *Client) listBinariesFromStorage() (binaries []string, err error) {
 	binaries, err = c.Storage.ListBinaries()
 	if err != nil {
@@ -0,0 +1,87 @@
+package clientfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+)
+
+func (c *Client) sendTOTPEnrollRequest() (data auth.TOTPData, err error) {
+	res, err := c.sendJSON(http.MethodPost, "/api/totp/enroll", nil)
+	if err != nil {
+		return data, fmt.Errorf("error in sendTOTPEnrollRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+			return data, fmt.Errorf("error when decoding json in sendTOTPEnrollRequest: %w", err)
+		}
+		return data, nil
+	case 401:
+		return data, ErrLoginRequired
+	case 409:
+		return data, ErrTOTPEnabled
+	case 500:
+		return data, ErrServerIsDown
+	default:
+		return data, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendTOTPVerifyRequest(code string) (codes []string, err error) {
+	var data auth.TOTPData
+
+	res, err := c.sendJSON(http.MethodPost, "/api/totp/verify", auth.TOTPData{Code: code})
+	if err != nil {
+		return nil, fmt.Errorf("error in sendTOTPVerifyRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+			return nil, fmt.Errorf("error when decoding json in sendTOTPVerifyRequest: %w", err)
+		}
+		return data.BackupCodes, nil
+	case 400:
+		return nil, ErrBadRequest
+	case 401:
+		return nil, ErrWrongSecondFactor
+	case 404:
+		return nil, ErrTOTPNotEnabled
+	case 409:
+		return nil, ErrTOTPEnabled
+	case 500:
+		return nil, ErrServerIsDown
+	default:
+		return nil, errors.New("unexpected error")
+	}
+}
+
+func (c *Client) sendTOTPDisableRequest(code string) error {
+	res, err := c.sendJSON(http.MethodPost, "/api/totp/disable", auth.TOTPData{Code: code})
+	if err != nil {
+		return fmt.Errorf("error in sendTOTPDisableRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrWrongSecondFactor
+	case 404:
+		return ErrTOTPNotEnabled
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
@@ -0,0 +1,700 @@
+package clientfunc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/securebuf"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/localstorage"
+)
+
+const orgsFile = "orgs.json"
+
+// OrgVault is an organization vault the user is a member of
+type OrgVault struct {
+	Role    string
+	Key     []byte
+	Storage LocalStorage
+
+	// keyBuf keeps Key locked in memory
+	keyBuf *securebuf.Buffer
+}
+
+// loadOrgs gets user's organizations from the server and opens their vault keys with user's private key.
+// Organizations are cached in the userdata folder so their vaults are available offline
+func (c *Client) loadOrgs() error {
+	if c.PrivateKey == nil {
+		return ErrNoKeyPair
+	}
+	orgs, err := c.listOrgsFromDB()
+	if err != nil {
+		return err
+	}
+
+	// local vaults are encrypted with the cached keys, they are re-encrypted if the key was rotated
+	if len(c.Orgs) == 0 {
+		if err := c.loadOrgsFromFile(); err != nil {
+			log.Println("can't open cached organizations vaults:", err)
+		}
+	}
+
+	vaults := make(map[string]*OrgVault)
+	for _, org := range orgs {
+		sealedKey, err := base64.StdEncoding.DecodeString(org.VaultKey)
+		if err != nil {
+			return fmt.Errorf("can't decode vault key of %s:%w", org.Name, err)
+		}
+		key, ok := box.OpenAnonymous(nil, sealedKey, c.PublicKey, c.PrivateKey)
+		if !ok {
+			return fmt.Errorf("can't open vault key of %s:%w", org.Name, encrypt.ErrWrongKey)
+		}
+		vault := c.openOrgVault(org.Name, org.Role, key)
+		if old, ok := c.Orgs[org.Name]; ok && !bytes.Equal(old.Key, vault.Key) {
+			if err := reencryptOrgVault(old, vault); err != nil {
+				return fmt.Errorf("can't re-encrypt vault of %s:%w", org.Name, err)
+			}
+		}
+		vaults[org.Name] = vault
+	}
+	c.closeOrgVaults()
+	c.Orgs = vaults
+
+	return c.saveOrgsFile()
+}
+
+func (c *Client) openOrgVault(orgname, role string, key []byte) *OrgVault {
+	vault := &OrgVault{
+		Role:    role,
+		Key:     key,
+		Storage: localstorage.NewOrgStorage(orgname),
+	}
+	if buf, err := securebuf.FromBytes(key); err == nil {
+		vault.Key, vault.keyBuf = buf.Bytes(), buf
+	} else {
+		log.Println("can't protect vault key of", orgname, err)
+	}
+	vault.Storage.InitStorage(vault.Key)
+	return vault
+}
+
+// reencryptOrgVault moves local items of the organization from the vault with the old key
+// to the vault with the rotated one. Both vaults share the folder
+func reencryptOrgVault(old, vault *OrgVault) error {
+	cards, err := old.Storage.ListCards()
+	if err != nil {
+		return err
+	}
+	err = moveOrgItems(cards, old.Storage.OpenCard, old.Storage.DeleteCard, vault.Storage.SaveOpenedCard, old.Key, vault.Key)
+	if err != nil {
+		return err
+	}
+
+	logincreds, err := old.Storage.ListLoginCreds()
+	if err != nil {
+		return err
+	}
+	err = moveOrgItems(logincreds, old.Storage.OpenLoginCreds, old.Storage.DeleteLoginCreds, vault.Storage.SaveOpenedLoginCreds, old.Key, vault.Key)
+	if err != nil {
+		return err
+	}
+
+	notes, err := old.Storage.ListNotes()
+	if err != nil {
+		return err
+	}
+	return moveOrgItems(notes, old.Storage.OpenNote, old.Storage.DeleteNote, vault.Storage.SaveOpenedNote, old.Key, vault.Key)
+}
+
+// moveOrgItems opens the items with the old key, deletes them and saves them again with the new key.
+// Lines are found by decrypting them, so all the old ones are deleted before any is saved with the new key
+func moveOrgItems(names []string,
+	open func(string, []byte) (*helpers.OpenedItem, error),
+	remove func(string, []byte) error,
+	save func(string, *helpers.OpenedItem, []byte) error,
+	oldKey, newKey []byte) error {
+	items := make([]*helpers.OpenedItem, 0, len(names))
+	defer func() {
+		for _, item := range items {
+			item.Destroy()
+		}
+	}()
+	for _, name := range names {
+		item, err := open(name, oldKey)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	for _, name := range names {
+		if err := remove(name, oldKey); err != nil {
+			return err
+		}
+	}
+	for i, name := range names {
+		if err := save(name, items[i], newKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeOrgVaults wipes vault keys of the organizations
+func (c *Client) closeOrgVaults() {
+	for _, vault := range c.Orgs {
+		securebuf.Wipe(vault.Key)
+		vault.keyBuf.Destroy()
+	}
+	c.Orgs = make(map[string]*OrgVault)
+}
+
+// saveOrgsFile saves organizations with vault keys wrapped by user's vault key
+func (c *Client) saveOrgsFile() error {
+	var orgs []storage.Org
+	for name, vault := range c.Orgs {
+		wrapped, err := encrypt.WrapKey(vault.Key, c.Key)
+		if err != nil {
+			return err
+		}
+		orgs = append(orgs, storage.Org{
+			Name:     name,
+			Role:     vault.Role,
+			VaultKey: base64.StdEncoding.EncodeToString(wrapped),
+		})
+	}
+
+	os.Mkdir(config.ClientCfg.UserDataFolder, 0600)
+	file, err := os.OpenFile(filepath.Join(config.ClientCfg.UserDataFolder, orgsFile), os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("error when trying to create/open organizations file:%w", err)
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(orgs)
+}
+
+// loadOrgsFromFile opens cached organizations vaults when logging offline
+func (c *Client) loadOrgsFromFile() error {
+	var orgs []storage.Org
+
+	file, err := os.Open(filepath.Join(config.ClientCfg.UserDataFolder, orgsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&orgs); err != nil {
+		return fmt.Errorf("can't decode organizations file:%w", err)
+	}
+
+	vaults := make(map[string]*OrgVault)
+	for _, org := range orgs {
+		wrapped, err := base64.StdEncoding.DecodeString(org.VaultKey)
+		if err != nil {
+			return fmt.Errorf("can't decode vault key of %s:%w", org.Name, err)
+		}
+		key, err := encrypt.UnwrapKey(wrapped, c.Key)
+		if err != nil {
+			return fmt.Errorf("can't unwrap vault key of %s:%w", org.Name, err)
+		}
+		vaults[org.Name] = c.openOrgVault(org.Name, org.Role, key)
+	}
+	c.closeOrgVaults()
+	c.Orgs = vaults
+	return nil
+}
+
+// orgVaultFor checks if the item name is in "org:name" format with one of user's organizations.
+// Returns the organization vault and the item name inside of it
+func (c *Client) orgVaultFor(name string) (*OrgVault, string, bool) {
+	orgname, itemname, ok := strings.Cut(name, ":")
+	if !ok {
+		return nil, "", false
+	}
+	vault, ok := c.Orgs[orgname]
+	if !ok {
+		return nil, "", false
+	}
+	return vault, itemname, true
+}
+
+// CreateOrgCommand creates new organization with a fresh vault key, the user becomes its owner
+func (c *Client) CreateOrgCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 2 || strings.Contains(input[1], ":") {
+		printCreateOrgSyntax()
+		return
+	}
+	orgname := input[1]
+
+	err := c.createOrg(orgname)
+	switch err {
+	case nil:
+		fmt.Printf("Organization %s created!\n", orgname)
+	case ErrOrgNameIsTaken:
+		fmt.Println("Organization name is taken, please provide another")
+	default:
+		fmt.Println("error when trying to create organization:", err)
+	}
+}
+
+func (c *Client) createOrg(orgname string) error {
+	if c.PrivateKey == nil {
+		return ErrNoKeyPair
+	}
+	key, err := encrypt.NewKey()
+	if err != nil {
+		return err
+	}
+	sealedKey, err := box.SealAnonymous(nil, key, c.PublicKey, rand.Reader)
+	if err != nil {
+		return fmt.Errorf("can't seal vault key:%w", err)
+	}
+
+	err = c.createOrgInDB(storage.Org{Name: orgname, VaultKey: base64.StdEncoding.EncodeToString(sealedKey)})
+	if err != nil {
+		return err
+	}
+
+	if c.Orgs == nil {
+		c.Orgs = make(map[string]*OrgVault)
+	}
+	c.Orgs[orgname] = c.openOrgVault(orgname, storage.RoleOwner, key)
+	return c.saveOrgsFile()
+}
+
+// ListOrgsCommand prints organizations of the user and user's roles in them
+func (c *Client) ListOrgsCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil && !c.LoggedOffline {
+		fmt.Println("please login first")
+		return
+	}
+	if len(input) != 1 {
+		printListOrgsSyntax()
+		return
+	}
+
+	fmt.Println("Organizations:")
+	for name, vault := range c.Orgs {
+		fmt.Printf("   %s (%s)\n", name, vault.Role)
+	}
+}
+
+// AddMemberCommand adds a user to the organization or changes role of a member.
+// Organization vault key is sealed for the member's public key
+func (c *Client) AddMemberCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 4 {
+		printAddMemberSyntax()
+		return
+	}
+	orgname, login, role := input[1], input[2], input[3]
+
+	err := c.addOrgMember(orgname, login, role)
+	switch err {
+	case nil:
+		fmt.Printf("%s is now %s of %s\n", login, role, orgname)
+	case ErrRecipientNotFound:
+		fmt.Printf("user %s not found or has not logged in yet\n", login)
+	case ErrLastOwner:
+		fmt.Println(err)
+	default:
+		fmt.Println("error when trying to add member:", err)
+	}
+}
+
+func (c *Client) addOrgMember(orgname, login, role string) error {
+	vault, ok := c.Orgs[orgname]
+	if !ok {
+		return ErrDataNotFound
+	}
+
+	sealedKey, err := c.sealForMember(login, vault.Key)
+	if err != nil {
+		return err
+	}
+
+	return c.sendOrgMemberToDB("/api/orgs/members/add", storage.OrgMember{
+		Org:      orgname,
+		Login:    login,
+		Role:     role,
+		VaultKey: sealedKey,
+	})
+}
+
+// sealForMember seals the organization vault key for the member's public key
+func (c *Client) sealForMember(login string, key []byte) (string, error) {
+	encodedKey, err := c.getPublicKeyFromDB(login)
+	if err != nil {
+		return "", err
+	}
+	decodedKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(decodedKey) != 32 {
+		return "", fmt.Errorf("member's public key is malformed:%w", err)
+	}
+	var memberKey [32]byte
+	copy(memberKey[:], decodedKey)
+
+	sealedKey, err := box.SealAnonymous(nil, key, &memberKey, rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("can't seal vault key:%w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sealedKey), nil
+}
+
+// RemoveMemberCommand removes a member from the organization and rotates the organization vault key,
+// so the removed member can't read items added afterwards
+func (c *Client) RemoveMemberCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 3 {
+		printRemoveMemberSyntax()
+		return
+	}
+
+	err := c.removeOrgMember(input[1], input[2])
+	switch err {
+	case nil:
+		fmt.Printf("%s removed from %s, the organization key is rotated\n", input[2], input[1])
+	case ErrRecipientNotFound:
+		fmt.Printf("%s is not a member of %s\n", input[2], input[1])
+	case ErrOrgChanged, ErrLastOwner:
+		fmt.Println(err)
+	default:
+		fmt.Println("error when trying to remove member:", err)
+	}
+}
+
+// removeOrgMember seals a new vault key for the remaining members and re-encrypts the items with it.
+// The server removes the member and stores the new key and items at once
+func (c *Client) removeOrgMember(orgname, login string) error {
+	vault, ok := c.Orgs[orgname]
+	if !ok {
+		return ErrDataNotFound
+	}
+	key, err := encrypt.NewKey()
+	if err != nil {
+		return err
+	}
+
+	rotation, err := c.orgRotation(orgname, login, vault.Key, key)
+	if err == nil {
+		err = c.sendOrgRotationToDB(rotation)
+	}
+	if err != nil {
+		securebuf.Wipe(key)
+		return err
+	}
+
+	rotated := c.openOrgVault(orgname, vault.Role, key)
+	if rotated.keyBuf != nil {
+		securebuf.Wipe(key)
+	}
+	if err := reencryptOrgVault(vault, rotated); err != nil {
+		return fmt.Errorf("can't re-encrypt local vault:%w", err)
+	}
+	c.Orgs[orgname] = rotated
+	securebuf.Wipe(vault.Key)
+	vault.keyBuf.Destroy()
+	return c.saveOrgsFile()
+}
+
+// orgRotation seals the new key for every member but the removed one
+// and re-encrypts items of the organization from the old key to the new one
+func (c *Client) orgRotation(orgname, login string, oldKey, newKey []byte) (storage.OrgRotation, error) {
+	rotation := storage.OrgRotation{Org: orgname, Login: login}
+
+	members, err := c.listOrgMembersFromDB(orgname)
+	if err != nil {
+		return rotation, err
+	}
+	items, err := c.listOrgItemsFromDB(orgname)
+	if err != nil {
+		return rotation, err
+	}
+
+	// the server refuses to remove the last owner, the check here saves re-encrypting the items
+	found, owners := false, 0
+	for _, member := range members {
+		if member.Login == login {
+			found = true
+			continue
+		}
+		if member.Role == storage.RoleOwner {
+			owners++
+		}
+		sealedKey, err := c.sealForMember(member.Login, newKey)
+		if err != nil {
+			return rotation, err
+		}
+		rotation.Members = append(rotation.Members, storage.OrgMember{
+			Org:      orgname,
+			Login:    member.Login,
+			Role:     member.Role,
+			VaultKey: sealedKey,
+		})
+	}
+	if !found {
+		return rotation, ErrRecipientNotFound
+	}
+	if owners == 0 {
+		return rotation, ErrLastOwner
+	}
+
+	for _, item := range items {
+		item, err := c.getOrgItemFromDB(orgname, item.Kind, item.Name)
+		if err == ErrDataNotFound {
+			return rotation, ErrOrgChanged
+		}
+		if err != nil {
+			return rotation, err
+		}
+		// blind indexes are keyed by the vault key, so items get new ones.
+		// Items uploaded before names were hidden get them too
+		name, err := openName(item.Name, item.EncName, oldKey)
+		if err != nil {
+			return rotation, err
+		}
+		item.Rename = blindIndexWith(newKey, item.Kind, name)
+		if item.EncName, err = sealName(name, newKey); err != nil {
+			return rotation, err
+		}
+		item.Data, err = helpers.ResealFields(item.Data, oldKey, newKey)
+		if err != nil {
+			return rotation, fmt.Errorf("can't re-encrypt %s %s:%w", item.Kind, name, err)
+		}
+		rotation.Items = append(rotation.Items, item)
+	}
+	return rotation, nil
+}
+
+// ListMembersCommand prints members of the organization
+func (c *Client) ListMembersCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 2 {
+		printListMembersSyntax()
+		return
+	}
+
+	members, err := c.listOrgMembersFromDB(input[1])
+	if err != nil {
+		fmt.Println("error when trying to list members:", err)
+		return
+	}
+	fmt.Printf("Members of %s:\n", input[1])
+	for _, member := range members {
+		fmt.Printf("   %s (%s)\n", member.Login, member.Role)
+	}
+}
+
+// printOrgNames adds items of organizations vaults to the output of list commands
+func (c *Client) printOrgNames(kind string) {
+	var names []string
+	for orgname, vault := range c.Orgs {
+		list, err := orgListByKind(vault, kind)
+		if err != nil {
+			fmt.Println("can't get organization items:", err)
+			return
+		}
+		for _, name := range list {
+			names = append(names, orgname+":"+name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	fmt.Println("Organizations:")
+	for _, name := range names {
+		fmt.Println("  ", name)
+	}
+}
+
+func orgListByKind(vault *OrgVault, kind string) ([]string, error) {
+	switch kind {
+	case storage.KindCard:
+		return vault.Storage.ListCards()
+	case storage.KindLoginCreds:
+		return vault.Storage.ListLoginCreds()
+	case storage.KindNote:
+		return vault.Storage.ListNotes()
+	}
+	return nil, ErrWrongShareKind
+}
+
+// checkOrgs synchronizes organizations vaults between client and server
+func (c *Client) checkOrgs() error {
+	if c.AuthCookie == nil {
+		return nil
+	}
+	// organization keys are rotated when members are removed
+	if c.PrivateKey != nil {
+		if err := c.loadOrgs(); err != nil {
+			return err
+		}
+	}
+	for orgname, vault := range c.Orgs {
+		if err := c.checkOrg(orgname, vault); err != nil {
+			return fmt.Errorf("error when synchronizing %s:%w", orgname, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) checkOrg(orgname string, vault *OrgVault) error {
+	items, err := c.listOrgItemsFromDB(orgname)
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range []string{storage.KindCard, storage.KindLoginCreds, storage.KindNote} {
+		listLocal, err := orgListByKind(vault, kind)
+		if err != nil {
+			return err
+		}
+		local := indexNamesWith(vault.Key, kind, listLocal)
+		plainLocal := helpers.CreateMapFromList(listLocal)
+
+		// local names on the server under blind indexes and in clear, as old clients uploaded them
+		onServer := make(map[string]bool)
+		var legacy []string
+		var download []string
+		for _, item := range items {
+			if item.Kind != kind {
+				continue
+			}
+			if name, ok := local[item.Name]; ok {
+				onServer[name] = true
+			} else if _, ok := plainLocal[item.Name]; ok && !isBlindIndex(item.Name) {
+				legacy = append(legacy, item.Name)
+			} else {
+				download = append(download, item.Name)
+			}
+		}
+
+		// viewers can't add items, so their local-only items stay local
+		if vault.Role != storage.RoleViewer {
+			for _, name := range listLocal {
+				if onServer[name] {
+					continue
+				}
+				if err := c.uploadOrgItem(orgname, vault, kind, name); err != nil {
+					return err
+				}
+				onServer[name] = true
+			}
+			// names in clear are deleted once the items are uploaded under blind indexes
+			for _, name := range legacy {
+				if !onServer[name] {
+					continue
+				}
+				if err := c.deleteOrgItemInDB(orgname, kind, name); err != nil && err != ErrDataNotFound {
+					return err
+				}
+			}
+		}
+
+		for _, name := range download {
+			item, err := c.getOrgItemFromDB(orgname, kind, name)
+			if err != nil {
+				return err
+			}
+			if item.Name, err = openName(item.Name, item.EncName, vault.Key); err != nil {
+				return err
+			}
+			if err := saveOrgItem(vault, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// uploadOrgItem sends the local item to the organization vault under the blind index of its name
+func (c *Client) uploadOrgItem(orgname string, vault *OrgVault, kind, name string) error {
+	data, err := encryptOrgItem(vault, kind, name)
+	if err != nil {
+		return err
+	}
+	encname, err := sealName(name, vault.Key)
+	if err != nil {
+		return err
+	}
+	return c.sendOrgItemToDB(storage.OrgItem{
+		Org:     orgname,
+		Kind:    kind,
+		Name:    blindIndexWith(vault.Key, kind, name),
+		EncName: encname,
+		Data:    data,
+	})
+}
+
+func encryptOrgItem(vault *OrgVault, kind, name string) (string, error) {
+	var item *helpers.OpenedItem
+	var err error
+	switch kind {
+	case storage.KindCard:
+		item, err = vault.Storage.OpenCard(name, vault.Key)
+	case storage.KindLoginCreds:
+		item, err = vault.Storage.OpenLoginCreds(name, vault.Key)
+	case storage.KindNote:
+		item, err = vault.Storage.OpenNote(name, vault.Key)
+	default:
+		return "", ErrWrongShareKind
+	}
+	if err != nil {
+		return "", err
+	}
+	defer item.Destroy()
+	return item.Seal("", vault.Key)
+}
+
+func saveOrgItem(vault *OrgVault, item storage.OrgItem) error {
+	var save func(string, *helpers.OpenedItem, []byte) error
+	switch item.Kind {
+	case storage.KindCard:
+		save = vault.Storage.SaveOpenedCard
+	case storage.KindLoginCreds:
+		save = vault.Storage.SaveOpenedLoginCreds
+	case storage.KindNote:
+		save = vault.Storage.SaveOpenedNote
+	default:
+		return ErrWrongShareKind
+	}
+	opened, err := helpers.OpenItem(item.Data, vault.Key)
+	if err != nil {
+		return err
+	}
+	defer opened.Destroy()
+	return save(item.Name, opened, vault.Key)
+}
@@ -0,0 +1,147 @@
+package clientfunc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/handlers"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/memstorage"
+)
+
+// newOrgTestClients returns clients of alice and bob with key pairs on the same server,
+// organization vaults are kept in temporary folders
+func newOrgTestClients(t *testing.T) (*memstorage.MemStorage, *Client, *Client) {
+	t.Helper()
+	cfg := config.ClientCfg
+	config.ClientCfg.LocalStorage, config.ClientCfg.UserDataFolder = t.TempDir(), t.TempDir()
+	t.Cleanup(func() { config.ClientCfg = cfg })
+
+	ms := memstorage.NewStorage()
+	h := handlers.NewService(ms, auth.NewMemStorage())
+	alice := newTestClient(t)
+	alice.AuthCookie = &http.Cookie{}
+	serveAs(t, alice, h, "alice")
+	bob := newTestClient(t)
+	bob.Key = bytes.Repeat([]byte{2}, 32)
+	bob.AuthCookie = &http.Cookie{}
+	serveAs(t, bob, h, "bob")
+	for _, c := range []*Client{alice, bob} {
+		if err := c.createKeyPair(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ms, alice, bob
+}
+
+// orgItemNames returns names of the organization items on the server
+func orgItemNames(t *testing.T, ms *memstorage.MemStorage, orgname string) []string {
+	t.Helper()
+	items, err := ms.ListOrgItems(context.Background(), orgname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range items {
+		if !isBlindIndex(item.Name) || item.EncName == "" {
+			t.Errorf("organization item %q is not behind a blind index", item.Name)
+		}
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+// Organization items go to the server as blind indexes of the vault key, items uploaded in clear
+// are moved under blind indexes and get new ones when the key is rotated
+func TestOrgItemNamesHidden(t *testing.T) {
+	ms, alice, _ := newOrgTestClients(t)
+
+	if err := alice.createOrg("team"); err != nil {
+		t.Fatal(err)
+	}
+	vault := alice.Orgs["team"]
+	if err := vault.Storage.SaveNote(storage.Note{Name: "wifi", Text: "password"}, vault.Key); err != nil {
+		t.Fatal(err)
+	}
+	// uploaded by an old client
+	door := storage.Note{Name: "door", Text: "1234"}
+	data, err := helpers.EncryptNoteData(door, vault.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SetOrgItem(context.Background(), storage.OrgItem{Org: "team", Kind: storage.KindNote, Name: "door", Data: data}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first check downloads the legacy item, the second one moves it under a blind index
+	for i := 0; i < 2; i++ {
+		if err := alice.checkOrg("team", vault); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := orgItemNames(t, ms, "team")
+	if len(names) != 2 {
+		t.Fatalf("organization items on the server: %v, want 2", names)
+	}
+
+	if err := alice.addOrgMember("team", "bob", storage.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.removeOrgMember("team", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	rotated := orgItemNames(t, ms, "team")
+	if len(rotated) != 2 || rotated[0] == names[0] || rotated[0] == names[1] {
+		t.Fatalf("organization items after the rotation: %v, were %v", rotated, names)
+	}
+
+	vault = alice.Orgs["team"]
+	if err := alice.checkOrg("team", vault); err != nil {
+		t.Fatal(err)
+	}
+	if after := orgItemNames(t, ms, "team"); !reflect.DeepEqual(after, rotated) {
+		t.Errorf("organization items after the check: %v, want %v", after, rotated)
+	}
+	local, err := vault.Storage.ListNotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(local)
+	if want := []string{"door", "wifi"}; !reflect.DeepEqual(local, want) {
+		t.Errorf("local organization notes %v, want %v", local, want)
+	}
+}
+
+// The last owner can neither be removed nor demoted, the client stops before re-encrypting the items
+func TestLastOrgOwner(t *testing.T) {
+	_, alice, bob := newOrgTestClients(t)
+	if err := alice.createOrg("team"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alice.removeOrgMember("team", "alice"); err != ErrLastOwner {
+		t.Errorf("removing the last owner: %v, want %v", err, ErrLastOwner)
+	}
+	if err := alice.addOrgMember("team", "alice", storage.RoleAdmin); err != ErrLastOwner {
+		t.Errorf("demoting the last owner: %v, want %v", err, ErrLastOwner)
+	}
+
+	if err := alice.addOrgMember("team", "bob", storage.RoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	// organizations are cached in the userdata folder of the user
+	config.ClientCfg.UserDataFolder = t.TempDir()
+	if err := bob.loadOrgs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.removeOrgMember("team", "alice"); err != nil {
+		t.Errorf("removing an owner with another one left: %v", err)
+	}
+}
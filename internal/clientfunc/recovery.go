@@ -0,0 +1,207 @@
+package clientfunc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"rsc.io/qr"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/shamir"
+)
+
+const sharePrefix = "svshare-"
+
+// encodeShare returns text form of a recovery share with a short checksum to catch typos
+func encodeShare(share []byte) string {
+	sum := sha256.Sum256(share)
+	return sharePrefix + hex.EncodeToString(share) + "-" + hex.EncodeToString(sum[:2])
+}
+
+func decodeShare(text string) ([]byte, error) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), sharePrefix)
+	data, checksum, ok := strings.Cut(text, "-")
+	if !ok {
+		return nil, ErrWrongShare
+	}
+	share, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, ErrWrongShare
+	}
+	sum := sha256.Sum256(share)
+	if checksum != hex.EncodeToString(sum[:2]) {
+		return nil, ErrWrongShare
+	}
+	return share, nil
+}
+
+// RecoveryKitCommand splits the vault key into shares, any threshold of which can restore the vault
+func (c *Client) RecoveryKitCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 4 && !(len(input) == 5 && input[4] == "qr") {
+		printRecoveryKitSyntax()
+		return
+	}
+	user, err := readUserFile()
+	if err != nil {
+		fmt.Println("please login online first")
+		return
+	}
+	parts, err := strconv.Atoi(input[1])
+	if err != nil {
+		printRecoveryKitSyntax()
+		return
+	}
+	threshold, err := strconv.Atoi(input[2])
+	if err != nil {
+		printRecoveryKitSyntax()
+		return
+	}
+
+	shares, err := shamir.Split(c.Key, parts, threshold)
+	if err != nil {
+		fmt.Println("can't split the vault key:", err)
+		return
+	}
+
+	// the server has to be able to check the recovered key before it lets anyone reset the password
+	if err := c.saveRecoveryToken(user.Login, input[3]); err != nil {
+		fmt.Println("can't save recovery verifier on the server:", err)
+		return
+	}
+
+	fmt.Printf("Recovery kit: any %d of %d shares restore your vault. Keep them in different places!\n", threshold, parts)
+	for i, share := range shares {
+		text := encodeShare(share)
+		fmt.Printf("\nShare %d of %d:\n%s\n", i+1, parts, text)
+		if len(input) == 5 {
+			if err := printQR(text); err != nil {
+				fmt.Println("can't print QR code:", err)
+			}
+		}
+	}
+}
+
+// RecoverSharesCommand restores the vault key out of recovery kit shares and sets a new password
+func (c *Client) RecoverSharesCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 3 {
+		printRecoverSharesSyntax()
+		return
+	}
+	login, password := input[1], input[2]
+
+	var shares [][]byte
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("Enter recovery shares one per line, empty line to finish:")
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" || err != nil {
+			break
+		}
+		share, err := decodeShare(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		shares = append(shares, share)
+	}
+
+	vaultKey, err := shamir.Combine(shares)
+	if err != nil {
+		fmt.Println("can't restore the vault key:", err)
+		return
+	}
+
+	err = c.completeRecovery(login, password, vaultKey)
+	switch err {
+	case nil:
+		fmt.Println("Vault recovered, your new password is set!")
+	case ErrWrongRecoveryData:
+		fmt.Println("shares don't restore the vault key of this account, maybe there are not enough of them")
+	default:
+		fmt.Println("error when trying to recover the vault:", err)
+	}
+}
+
+// completeRecovery sets new password using the recovered vault key and logs the user in
+func (c *Client) completeRecovery(login, password string, vaultKey []byte) error {
+	encoded, err := wrapWithPassword(vaultKey, password)
+	if err != nil {
+		return err
+	}
+
+	verifier, err := auth.NewSRPVerifier(password)
+	if err != nil {
+		return err
+	}
+	authcookie, err := c.sendResetRequest(auth.ResetData{
+		Login:    login,
+		Token:    recoveryToken(vaultKey),
+		Verifier: verifier,
+		VaultKey: encoded,
+	})
+	if err == ErrDeviceRevoked {
+		// the password is reset before the session is refused
+		forgetDevice()
+		markVerifier(login)
+		return fmt.Errorf("the password is reset, but %w: login with the new password to register it as a new device", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	markVerifier(login)
+	c.checkLoginFile(auth.LoginData{Login: login})
+	c.AuthCookie = authcookie
+	if err := c.setKey(vaultKey); err != nil {
+		return err
+	}
+	if err := c.createUserLoginFile(login, password, encoded); err != nil {
+		return err
+	}
+	c.Storage.InitStorage(c.Key)
+	if err := c.loadKeyPair(); err != nil {
+		fmt.Println("can't load key pair for sharing:", err)
+	}
+	if err := c.loadOrgs(); err != nil {
+		fmt.Println("can't open organizations vaults:", err)
+	}
+	return c.CheckAll()
+}
+
+// printQR prints text as a QR code with unicode blocks.
+// Light modules are printed as blocks, so the code scans on dark terminals
+func printQR(text string) error {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return err
+	}
+
+	const quiet = 2
+	var buf bytes.Buffer
+	for y := -quiet; y < code.Size+quiet; y++ {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			if x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Black(x, y) {
+				buf.WriteString("  ")
+			} else {
+				buf.WriteString("██")
+			}
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Print(buf.String())
+	return nil
+}
@@ -0,0 +1,135 @@
+package clientfunc
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
+)
+
+var recoveryKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// formatRecoveryKey returns the recovery key as groups of 4 base32 characters
+func formatRecoveryKey(key []byte) string {
+	encoded := recoveryKeyEncoding.EncodeToString(key)
+	var groups []string
+	for len(encoded) > 4 {
+		groups = append(groups, encoded[:4])
+		encoded = encoded[4:]
+	}
+	groups = append(groups, encoded)
+	return strings.Join(groups, "-")
+}
+
+// parseRecoveryKey accepts the recovery key in any case, with or without dashes
+func parseRecoveryKey(text string) ([]byte, error) {
+	text = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(text))
+	key, err := recoveryKeyEncoding.DecodeString(text)
+	if err != nil || len(key) != 32 {
+		return nil, ErrWrongRecoveryKey
+	}
+	return key, nil
+}
+
+// issueRecoveryKey generates a new recovery key and saves the vault key wrapped by it on the server,
+// confirmed by the password of the login. Any previous recovery key stops working.
+// The recovery key itself never leaves the client
+func (c *Client) issueRecoveryKey(login, password string) (string, error) {
+	recoveryKey, err := encrypt.NewKey()
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := encrypt.WrapKey(c.Key, recoveryKey)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.saveVaultKey(login, password, auth.VaultKeyRecovery, base64.StdEncoding.EncodeToString(wrapped)); err != nil {
+		return "", err
+	}
+	if err := c.saveRecoveryToken(login, password); err != nil {
+		return "", err
+	}
+
+	return formatRecoveryKey(recoveryKey), nil
+}
+
+func printRecoveryKey(recoveryKey string) {
+	fmt.Println("Your recovery key is shown only once, write it down and keep it safe:")
+	fmt.Println("  ", recoveryKey)
+	fmt.Println("It is the only way to restore your data if you forget the password.")
+}
+
+// RecoveryKeyCommand issues a new recovery key, the previous one stops working
+func (c *Client) RecoveryKeyCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 2 {
+		printRecoveryKeySyntax()
+		return
+	}
+	user, err := readUserFile()
+	if err != nil {
+		fmt.Println("please login online first")
+		return
+	}
+
+	recoveryKey, err := c.issueRecoveryKey(user.Login, input[1])
+	if err != nil {
+		fmt.Println("can't issue recovery key:", err)
+		return
+	}
+	printRecoveryKey(recoveryKey)
+}
+
+// RecoverCommand unwraps the vault key with the recovery key and sets a new password.
+// The used recovery key is replaced by a new one
+func (c *Client) RecoverCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 4 {
+		printRecoverSyntax()
+		return
+	}
+	login, password := input[1], input[3]
+
+	recoveryKey, err := parseRecoveryKey(input[2])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	encoded, err := c.getRecoveryVaultKeyFromDB(login)
+	if err != nil {
+		if err == ErrDataNotFound {
+			fmt.Println("there is no recovery key for this account")
+			return
+		}
+		fmt.Println("error when trying to get recovery data:", err)
+		return
+	}
+	vaultKey, err := unwrapEncodedKey(encoded, recoveryKey)
+	if err != nil {
+		fmt.Println(ErrWrongRecoveryKey)
+		return
+	}
+
+	if err := c.completeRecovery(login, password, vaultKey); err != nil {
+		fmt.Println("error when trying to recover the vault:", err)
+		return
+	}
+	fmt.Println("Vault recovered, your new password is set!")
+
+	newKey, err := c.issueRecoveryKey(login, password)
+	if err != nil {
+		fmt.Println("can't issue new recovery key, use recoverykey command:", err)
+		return
+	}
+	printRecoveryKey(newKey)
+}
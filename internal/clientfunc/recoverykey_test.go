@@ -0,0 +1,35 @@
+package clientfunc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFormatParseRecoveryKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	formatted := formatRecoveryKey(key)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "Formatted key", input: formatted},
+		{name: "Lowercase key", input: strings.ToLower(formatted)},
+		{name: "Key without dashes", input: strings.ReplaceAll(formatted, "-", "")},
+		{name: "Truncated key", input: formatted[:20], wantErr: true},
+		{name: "Garbage", input: "not-a-recovery-key", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRecoveryKey(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRecoveryKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, key) {
+				t.Errorf("parseRecoveryKey() = %x, want %x", got, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package clientfunc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/securebuf"
+)
+
+// sessionCookies takes the auth and refresh cookies from the response of login-like request.
+// The refresh cookie is saved in the client, the auth cookie is returned
+func (c *Client) sessionCookies(res *http.Response) (*http.Cookie, error) {
+	var authcookie *http.Cookie
+	for _, cookie := range res.Cookies() {
+		switch cookie.Name {
+		case auth.AccessCookie:
+			authcookie = cookie
+		case auth.RefreshCookie:
+			c.sessionMu.Lock()
+			c.RefreshCookie = cookie
+			c.sessionMu.Unlock()
+		}
+	}
+	if authcookie == nil {
+		return nil, ErrNoCookieReturned
+	}
+	return authcookie, nil
+}
+
+// refreshSession gets new session cookies from the server.
+// used is the auth cookie rejected by the server, if it has been replaced already, nothing is done
+func (c *Client) refreshSession(used *http.Cookie) error {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	if c.AuthCookie != used {
+		return nil
+	}
+	if c.RefreshCookie == nil {
+		return ErrLoginRequired
+	}
+
+	r, err := http.NewRequest(http.MethodPost, c.apiURL("/api/user/refresh"), nil)
+	if err != nil {
+		return fmt.Errorf("error when creating NewRequest: %w", err)
+	}
+	r.AddCookie(c.RefreshCookie)
+	res, err := c.Client.Do(r)
+	if err != nil {
+		return fmt.Errorf("error in refreshSession: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+	case 401:
+		// the session is over, the user has to login again
+		c.AuthCookie, c.RefreshCookie = nil, nil
+		return ErrLoginRequired
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+
+	var authcookie, refreshcookie *http.Cookie
+	for _, cookie := range res.Cookies() {
+		switch cookie.Name {
+		case auth.AccessCookie:
+			authcookie = cookie
+		case auth.RefreshCookie:
+			refreshcookie = cookie
+		}
+	}
+	if authcookie == nil || refreshcookie == nil {
+		return ErrNoCookieReturned
+	}
+	c.AuthCookie, c.RefreshCookie = authcookie, refreshcookie
+	return nil
+}
+
+func (c *Client) sendLogoutRequest(path string) error {
+	res, err := c.sendJSON(http.MethodPost, path, nil)
+	if err != nil {
+		return fmt.Errorf("error in sendLogoutRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return nil
+	case 401:
+		return ErrLoginRequired
+	case 500:
+		return ErrServerIsDown
+	default:
+		return errors.New("unexpected error")
+	}
+}
+
+// LogoutCommand ends the current session and wipes the keys
+func (c *Client) LogoutCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 1 {
+		printLogoutSyntax()
+		return
+	}
+	c.logout("/api/user/logout")
+}
+
+// LogoutAllCommand ends all the sessions of the user on all devices and wipes the keys
+func (c *Client) LogoutAllCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if len(input) != 1 {
+		printLogoutAllSyntax()
+		return
+	}
+	c.logout("/api/user/logoutall")
+}
+
+func (c *Client) logout(path string) {
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+
+	c.lock.mu.Lock()
+	defer c.lock.mu.Unlock()
+	// the logout command itself is running, anything else means synchronization is in progress
+	if c.lock.busy > 1 {
+		fmt.Println("synchronization is in progress, try again")
+		return
+	}
+
+	if err := c.sendLogoutRequest(path); err != nil {
+		fmt.Println("can't logout:", err)
+		return
+	}
+
+	c.WipeKeys()
+	securebuf.Wipe(c.lock.pinKey)
+	c.lock.pinKey, c.lock.pinSalt = nil, nil
+	fmt.Println("Logged out")
+}
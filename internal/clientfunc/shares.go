@@ -0,0 +1,387 @@
+package clientfunc
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/securebuf"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// loadKeyPair gets user's key pair from the server and unwraps the private key with the vault key.
+// If user has no key pair yet, a new one is generated and published
+func (c *Client) loadKeyPair() error {
+	keys, err := c.getKeyPairFromDB()
+	switch err {
+	case nil:
+	case ErrDataNotFound:
+		return c.createKeyPair()
+	default:
+		return err
+	}
+
+	publickey, err := base64.StdEncoding.DecodeString(keys.PublicKey)
+	if err != nil || len(publickey) != 32 {
+		return fmt.Errorf("can't decode public key in loadKeyPair:%w", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(keys.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("can't decode private key in loadKeyPair:%w", err)
+	}
+	privatekey, err := encrypt.UnwrapKey(wrapped, c.Key)
+	if err != nil || len(privatekey) != 32 {
+		return fmt.Errorf("can't unwrap private key in loadKeyPair:%w", err)
+	}
+
+	c.PublicKey = new([32]byte)
+	copy(c.PublicKey[:], publickey)
+	return c.setPrivateKey(privatekey)
+}
+
+// setPrivateKey moves the private key into a secure buffer, the key slice is wiped
+func (c *Client) setPrivateKey(privatekey []byte) error {
+	buf, err := securebuf.FromBytes(privatekey)
+	if err != nil {
+		return fmt.Errorf("can't protect private key:%w", err)
+	}
+	old := c.privateKeyBuf
+	c.privateKeyBuf, c.PrivateKey = buf, (*[32]byte)(buf.Bytes())
+	old.Destroy()
+	return nil
+}
+
+func (c *Client) createKeyPair() error {
+	publickey, privatekey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("can't generate key pair:%w", err)
+	}
+
+	wrapped, err := encrypt.WrapKey(privatekey[:], c.Key)
+	if err != nil {
+		return err
+	}
+
+	keys := storage.KeyPair{
+		PublicKey:  base64.StdEncoding.EncodeToString(publickey[:]),
+		PrivateKey: base64.StdEncoding.EncodeToString(wrapped),
+	}
+	if err := c.sendKeyPairToDB(keys); err != nil {
+		return err
+	}
+
+	c.PublicKey = publickey
+	return c.setPrivateKey(privatekey[:])
+}
+
+// ShareCommand encrypts an item for another user and sends it to the server
+func (c *Client) ShareCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 4 {
+		printShareSyntax()
+		return
+	}
+	kind, name, recipient := input[1], input[2], input[3]
+
+	err := c.shareItem(kind, name, recipient)
+	switch err {
+	case nil:
+		fmt.Printf("%s %s shared with %s\n", kind, name, recipient)
+	case ErrRecipientNotFound:
+		fmt.Printf("user %s not found or has not logged in yet\n", recipient)
+	default:
+		fmt.Println("error when trying to share:", err)
+	}
+}
+
+// UnshareCommand revokes a share made by the user
+func (c *Client) UnshareCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 4 {
+		printUnshareSyntax()
+		return
+	}
+
+	kind, name, recipient := input[1], input[2], input[3]
+	err := c.revokeShare(kind, name, recipient)
+	switch err {
+	case nil:
+		fmt.Printf("%s %s is no longer shared with %s\n", kind, name, recipient)
+	case ErrDataNotFound:
+		fmt.Println("no such share")
+	default:
+		fmt.Println("error when trying to revoke share:", err)
+	}
+}
+
+// ListSharesCommand prints items the user has shared with others
+func (c *Client) ListSharesCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 1 {
+		printListSharesSyntax()
+		return
+	}
+
+	shares, err := c.listSharesFromDB("/api/shares/owned")
+	if err != nil {
+		fmt.Println("error when trying to list shares:", err)
+		return
+	}
+	names, err := c.shareIndexes()
+	if err != nil {
+		fmt.Println("error when trying to list shares:", err)
+		return
+	}
+	fmt.Println("Shared by you:")
+	for _, share := range shares {
+		name, ok := names[share.Name]
+		if !ok {
+			// the item is deleted locally, its name is known only by the blind index
+			name = share.Name
+		}
+		fmt.Printf("   %s %s -> %s\n", share.Kind, name, share.Recipient)
+	}
+}
+
+// shareIndexes maps blind indexes of shares of local items to the item names
+func (c *Client) shareIndexes() (map[string]string, error) {
+	lists := map[string]func() ([]string, error){
+		storage.KindCard:       c.listCardsFromStorage,
+		storage.KindLoginCreds: c.listLoginCredsFromStorage,
+		storage.KindNote:       c.listNotesFromStorage,
+	}
+	names := make(map[string]string)
+	for kind, listLocal := range lists {
+		list, err := listLocal()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range list {
+			names[c.shareIndex(kind, name)] = name
+		}
+	}
+	return names, nil
+}
+
+// revokeShare revokes the share by its blind index, shares made before names were hidden by the name
+func (c *Client) revokeShare(kind, name, recipient string) error {
+	err := c.revokeShareInDB(storage.Share{Kind: kind, Name: c.shareIndex(kind, name), Recipient: recipient})
+	if err != ErrDataNotFound {
+		return err
+	}
+	return c.revokeShareInDB(storage.Share{Kind: kind, Name: name, Recipient: recipient})
+}
+
+func (c *Client) shareItem(kind, name, recipient string) error {
+	if c.PrivateKey == nil {
+		return ErrNoKeyPair
+	}
+
+	encodedKey, err := c.getPublicKeyFromDB(recipient)
+	if err != nil {
+		return err
+	}
+	decodedKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(decodedKey) != 32 {
+		return fmt.Errorf("recipient's public key is malformed:%w", err)
+	}
+	var recipientKey [32]byte
+	copy(recipientKey[:], decodedKey)
+
+	// every share gets its own item key, so revoking one share doesn't affect others
+	itemKey, err := encrypt.NewKey()
+	if err != nil {
+		return err
+	}
+
+	var item *helpers.OpenedItem
+	switch kind {
+	case storage.KindCard:
+		item, err = c.openCardFromStorage(name)
+	case storage.KindLoginCreds:
+		item, err = c.openLoginCredsFromStorage(name)
+	case storage.KindNote:
+		item, err = c.openNoteFromStorage(name)
+	default:
+		return ErrWrongShareKind
+	}
+	if err != nil {
+		return err
+	}
+	defer item.Destroy()
+	data, err := item.Seal("", itemKey)
+	if err != nil {
+		return err
+	}
+
+	encname, err := sealName(name, itemKey)
+	if err != nil {
+		return err
+	}
+
+	sealedKey, err := box.SealAnonymous(nil, itemKey, &recipientKey, rand.Reader)
+	if err != nil {
+		return fmt.Errorf("can't seal item key:%w", err)
+	}
+
+	return c.sendShareToDB(storage.Share{
+		Recipient: recipient,
+		Kind:      kind,
+		Name:      c.shareIndex(kind, name),
+		EncName:   encname,
+		Data:      data,
+		Key:       base64.StdEncoding.EncodeToString(sealedKey),
+	})
+}
+
+// listSharedNames returns names of items of the kind shared with the user, in "owner/name" format
+func (c *Client) listSharedNames(kind string) ([]string, error) {
+	if c.AuthCookie == nil {
+		return nil, nil
+	}
+	shares, err := c.listSharesFromDB("/api/shares/list")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, share := range shares {
+		if share.Kind != kind {
+			continue
+		}
+		name, err := c.revealShareName(share)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, share.Owner+"/"+name)
+	}
+	return names, nil
+}
+
+// openShareKey opens the item key of the share with the user's private key
+func (c *Client) openShareKey(share storage.Share) ([]byte, error) {
+	if c.PrivateKey == nil {
+		return nil, ErrNoKeyPair
+	}
+	sealedKey, err := base64.StdEncoding.DecodeString(share.Key)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode item key:%w", err)
+	}
+	itemKey, ok := box.OpenAnonymous(nil, sealedKey, c.PublicKey, c.PrivateKey)
+	if !ok {
+		return nil, encrypt.ErrWrongKey
+	}
+	return itemKey, nil
+}
+
+// revealShareName decrypts the name of the share with the user with the item key.
+// Shares made before names were hidden keep the name in clear
+func (c *Client) revealShareName(share storage.Share) (string, error) {
+	if share.EncName == "" {
+		return share.Name, nil
+	}
+	itemKey, err := c.openShareKey(share)
+	if err != nil {
+		return "", err
+	}
+	defer securebuf.Wipe(itemKey)
+	return openName(share.Name, share.EncName, itemKey)
+}
+
+// printSharedNames adds items shared with the user to the output of list commands
+func (c *Client) printSharedNames(kind string) {
+	names, err := c.listSharedNames(kind)
+	if err != nil {
+		fmt.Println("can't get shared items:", err)
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+	fmt.Println("Shared with you:")
+	for _, name := range names {
+		fmt.Println("  ", name)
+	}
+}
+
+// getSharedItem finds an item shared with the user by its "owner/name" and returns it
+// with the item key opened by the user's private key
+func (c *Client) getSharedItem(kind, sharedname string) (storage.EncryptedData, []byte, error) {
+	if c.AuthCookie == nil {
+		return storage.EncryptedData{}, nil, ErrLoginRequired
+	}
+	if c.PrivateKey == nil {
+		return storage.EncryptedData{}, nil, ErrNoKeyPair
+	}
+	owner, name, _ := strings.Cut(sharedname, "/")
+
+	shares, err := c.listSharesFromDB("/api/shares/list")
+	if err != nil {
+		return storage.EncryptedData{}, nil, err
+	}
+
+	for _, share := range shares {
+		if share.Kind != kind || share.Owner != owner {
+			continue
+		}
+		itemKey, err := c.openShareKey(share)
+		if err != nil {
+			return storage.EncryptedData{}, nil, err
+		}
+		sharename, err := openName(share.Name, share.EncName, itemKey)
+		if err != nil || sharename != name {
+			securebuf.Wipe(itemKey)
+			if err != nil {
+				return storage.EncryptedData{}, nil, err
+			}
+			continue
+		}
+		return storage.EncryptedData{Name: sharename, Data: share.Data}, itemKey, nil
+	}
+	return storage.EncryptedData{}, nil, ErrDataNotFound
+}
+
+func (c *Client) printSharedItem(kind, sharedname string) {
+	eData, itemKey, err := c.getSharedItem(kind, sharedname)
+	if err != nil {
+		if err == ErrDataNotFound {
+			fmt.Println("No such item shared with you")
+			return
+		}
+		fmt.Println("error when trying to get shared item:", err)
+		return
+	}
+
+	item, err := helpers.OpenItem(eData.Data, itemKey)
+	if err != nil {
+		fmt.Println("error when trying to decrypt shared item:", err)
+		return
+	}
+	defer item.Destroy()
+
+	switch kind {
+	case storage.KindCard:
+		printItem(eData.Name, item, cardFields)
+	case storage.KindLoginCreds:
+		printItem(eData.Name, item, loginCredsFields)
+	case storage.KindNote:
+		printItem(eData.Name, item, noteFields)
+	}
+}
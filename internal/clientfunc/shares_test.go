@@ -0,0 +1,80 @@
+package clientfunc
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/handlers"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/memstorage"
+)
+
+// Shared names go to the server as blind indexes of the owner and encrypted with the item key,
+// the recipient sees the names and the owner can still revoke the shares
+func TestShareNamesHidden(t *testing.T) {
+	ms := memstorage.NewStorage()
+	h := handlers.NewService(ms, auth.NewMemStorage())
+
+	alice := newTestClient(t)
+	alice.AuthCookie = &http.Cookie{}
+	serveAs(t, alice, h, "alice")
+	bob := newTestClient(t)
+	bob.Key = bytes.Repeat([]byte{2}, 32)
+	bob.AuthCookie = &http.Cookie{}
+	serveAs(t, bob, h, "bob")
+	for _, c := range []*Client{alice, bob} {
+		if err := c.createKeyPair(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := alice.Storage.SaveNote(storage.Note{Name: "wifi", Text: "password"}, alice.Key); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.shareItem(storage.KindNote, "wifi", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ms.Shares) != 1 || !isBlindIndex(ms.Shares[0].Name) || ms.Shares[0].EncName == "" {
+		t.Fatalf("shares on the server: %+v, want the name behind a blind index", ms.Shares)
+	}
+
+	// shared before names were hidden
+	legacy := ms.Shares[0]
+	legacy.Name, legacy.EncName = "door", ""
+	ms.Shares = append(ms.Shares, legacy)
+
+	names, err := bob.listSharedNames(storage.KindNote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice/wifi", "alice/door"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("shared names %v, want %v", names, want)
+	}
+	item, key, err := bob.getSharedItem(storage.KindNote, "alice/wifi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "wifi" || len(key) != 32 {
+		t.Errorf("shared item %q with key of %d bytes", item.Name, len(key))
+	}
+
+	indexes, err := alice.shareIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexes[ms.Shares[0].Name] != "wifi" {
+		t.Errorf("owner can't map the share index to the name: %v", indexes)
+	}
+
+	for _, name := range []string{"wifi", "door"} {
+		if err := alice.revokeShare(storage.KindNote, name, "bob"); err != nil {
+			t.Errorf("revoke %s: %v", name, err)
+		}
+	}
+	if len(ms.Shares) != 0 {
+		t.Errorf("shares left after revoking: %+v", ms.Shares)
+	}
+}
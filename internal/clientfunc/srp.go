@@ -0,0 +1,140 @@
+package clientfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+func (c *Client) sendLoginStartRequest(start auth.SRPStart) (auth.SRPChallenge, error) {
+	var challenge auth.SRPChallenge
+
+	res, err := c.sendJSON(http.MethodPost, "/api/user/login/start", start)
+	if err != nil {
+		return challenge, fmt.Errorf("error in sendLoginStartRequest: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		if err := json.NewDecoder(res.Body).Decode(&challenge); err != nil {
+			return challenge, fmt.Errorf("error when decoding json in sendLoginStartRequest: %w", err)
+		}
+		return challenge, nil
+	case 400:
+		return challenge, ErrBadRequest
+	case 429:
+		return challenge, tooManyAttempts(res)
+	case 500:
+		return challenge, ErrServerIsDown
+	default:
+		return challenge, errors.New("unexpected error")
+	}
+}
+
+// srpProve runs SRP handshake, so the password is proved to the server without being sent.
+// Returns the SRP client to check the proof of the server
+func (c *Client) srpProve(login, password string) (*auth.SRPClient, auth.SRPProof, error) {
+	srp, err := auth.NewSRPClient(login)
+	if err != nil {
+		return nil, auth.SRPProof{}, err
+	}
+	challenge, err := c.sendLoginStartRequest(srp.Start())
+	if err != nil {
+		return nil, auth.SRPProof{}, err
+	}
+	proof, err := srp.Proof(password, challenge)
+	if err != nil {
+		return nil, auth.SRPProof{}, err
+	}
+	return srp, proof, nil
+}
+
+// name of the file in user data folder with logins known to have SRP verifier on the server
+const verifiersFile = "verifiers.json"
+
+// hasVerifier reports whether the login is known to have SRP verifier on the server.
+// The password of such login is never sent, whatever the server answers
+func hasVerifier(login string) bool {
+	for _, known := range readVerifiers() {
+		if known == login {
+			return true
+		}
+	}
+	return false
+}
+
+// markVerifier records that the login has SRP verifier on the server
+func markVerifier(login string) {
+	if hasVerifier(login) {
+		return
+	}
+	data, err := json.Marshal(append(readVerifiers(), login))
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(config.ClientCfg.UserDataFolder, 0700); err != nil {
+		log.Println("can't record password verifier:", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(config.ClientCfg.UserDataFolder, verifiersFile), data, 0600); err != nil {
+		log.Println("can't record password verifier:", err)
+	}
+}
+
+func readVerifiers() (logins []string) {
+	data, err := os.ReadFile(filepath.Join(config.ClientCfg.UserDataFolder, verifiersFile))
+	if err != nil {
+		return nil
+	}
+	json.Unmarshal(data, &logins)
+	return logins
+}
+
+// legacyLoginAllowed reports whether the password may be sent to upgrade an account without verifier.
+// The user has to allow it, and the login must not be known to have verifier already
+func legacyLoginAllowed(login string) bool {
+	return config.ClientCfg.LegacyLogin && !hasVerifier(login)
+}
+
+// upgradeVerifier replaces the password hash of a legacy account by SRP verifier,
+// so the password isn't sent to the server anymore
+func (c *Client) upgradeVerifier(authcookie *http.Cookie, login, password string) {
+	verifier, err := auth.NewSRPVerifier(password)
+	if err != nil {
+		log.Println("can't create password verifier:", err)
+		return
+	}
+	jsbody, err := json.Marshal(verifier)
+	if err != nil {
+		log.Println("error when marshaling json:", err)
+		return
+	}
+	r, err := http.NewRequest(http.MethodPost, c.apiURL("/api/user/verifier"), bytes.NewBuffer(jsbody))
+	if err != nil {
+		log.Println("error when creating NewRequest:", err)
+		return
+	}
+	r.Header.Add("Content-Type", "application/json")
+	r.AddCookie(authcookie)
+
+	res, err := c.Client.Do(r)
+	if err != nil {
+		log.Println("can't save password verifier:", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Println("can't save password verifier, server responded with", res.Status)
+		return
+	}
+	markVerifier(login)
+}
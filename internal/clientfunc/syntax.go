@@ -24,7 +24,7 @@ func printGetCardSyntax() {
 
 func printListCardsSyntax() {
 	fmt.Println("Wrong input!")
-	fmt.Println("Right syntax: listcards")
+	fmt.Println("Right syntax: listcards [prefix] [sort=name|-name|modified|-modified] [tag=<tag>]")
 }
 
 func printSetLoginCredsSyntax() {
@@ -39,7 +39,7 @@ func printGetLoginCredsSyntax() {
 
 func printListLoginCredsSyntax() {
 	fmt.Println("Wrong input!")
-	fmt.Println("Right syntax: listlogincreds")
+	fmt.Println("Right syntax: listlogincreds [prefix] [sort=name|-name|modified|-modified] [tag=<tag>]")
 }
 
 func printSetNoteSyntax() {
@@ -54,7 +54,7 @@ func printGetNoteSyntax() {
 
 func printListNotesSyntax() {
 	fmt.Println("Wrong input!")
-	fmt.Println("Right syntax: listnotes")
+	fmt.Println("Right syntax: listnotes [prefix] [sort=name|-name|modified|-modified] [tag=<tag>]")
 }
 
 func printSetBinarySyntax() {
@@ -70,5 +70,170 @@ func printGetBinarySyntax() {
 
 func printListBinariesSyntax() {
 	fmt.Println("Wrong input!")
-	fmt.Println("Right syntax: listbinaries")
+	fmt.Println("Right syntax: listbinaries [prefix] [sort=name|-name|modified|-modified] [tag=<tag>]")
+}
+
+func printShareSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: share <card|logincreds|note> <name> <recipient login>")
+}
+
+func printUnshareSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: unshare <card|logincreds|note> <name> <recipient login>")
+}
+
+func printListSharesSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: listshares")
+}
+
+func printCreateOrgSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: createorg <organization name without ':'>")
+}
+
+func printListOrgsSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: listorgs")
+}
+
+func printAddMemberSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: addmember <organization> <login> <owner|admin|editor|viewer>")
+}
+
+func printRemoveMemberSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: removemember <organization> <login>")
+}
+
+func printListMembersSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: listmembers <organization>")
+}
+
+func printRecoveryKitSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: recoverykit <number of shares> <shares needed to recover> <password> [qr]")
+}
+
+func printRecoverSharesSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: recovershares <login> <new password>")
+}
+
+func printRecoveryKeySyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: recoverykey <password>")
+}
+
+func printRecoverSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: recover <login> <recovery key> <new password>")
+}
+
+func printEnable2FASyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: enable2fa [qr]")
+}
+
+func printDisable2FASyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: disable2fa <code>")
+}
+
+func printLockSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: lock")
+}
+
+func printUnlockSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: unlock <password or PIN>")
+}
+
+func printSetPINSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: setpin <PIN>")
+}
+
+func printLogoutSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: logout")
+}
+
+func printLogoutAllSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: logoutall")
+}
+
+func printBindCertSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: bindcert")
+}
+
+func printCreateAPIKeySyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: createapikey <name> [ttl=<duration>] [readonly] [kinds=card,logincreds,note,binary] [orgs=<org1,org2>]")
+}
+
+func printListAPIKeysSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: listapikeys")
+}
+
+func printRevokeAPIKeySyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: revokeapikey <id>")
+}
+
+func printDevicesSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: devices")
+}
+
+func printRevokeDeviceSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: revokedevice <id>")
+}
+
+func printChangeUsernameSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: changeusername <new login> <password>")
+}
+
+func printDeleteAccountSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: deleteaccount <password>")
+}
+
+func printAddLoginKeySyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: addloginkey <name>")
+}
+
+func printKeyLoginSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: keylogin")
+}
+
+func printListLoginKeysSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: listloginkeys")
+}
+
+func printRevokeLoginKeySyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: revokeloginkey <id>")
+}
+
+func printConflictsSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: conflicts [<card|logincreds|note|binary> <name> <local|server|both>]")
+}
+
+func printTagSyntax() {
+	fmt.Println("Wrong input!")
+	fmt.Println("Right syntax: tag <card|logincreds|note|binary> <name> [tag1,tag2,...]")
 }
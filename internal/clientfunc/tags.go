@@ -0,0 +1,114 @@
+package clientfunc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/localstorage"
+)
+
+// TagCommand replaces tags of the user's item, items are listed by them with tag=<tag>.
+// The server gets blind indexes of the tags only
+func (c *Client) TagCommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 3 && len(input) != 4 {
+		printTagSyntax()
+		return
+	}
+	kind, name := input[1], input[2]
+	if _, ok := listPaths[kind]; !ok {
+		printTagSyntax()
+		return
+	}
+	var tags []string
+	if len(input) == 4 {
+		tags = strings.Split(input[3], ",")
+	}
+
+	err := c.setTags(kind, name, tags)
+	switch err {
+	case nil:
+		if len(tags) == 0 {
+			fmt.Printf("%s %s has no tags now\n", kind, name)
+		} else {
+			fmt.Printf("%s %s is tagged %s\n", kind, name, strings.Join(tags, ", "))
+		}
+	case ErrDataNotFound:
+		fmt.Println("No data in local storage")
+	case ErrNotSynced, ErrItemChanged:
+		fmt.Println(err)
+	default:
+		fmt.Println("error when trying to tag:", err)
+	}
+}
+
+// setTags synchronizes items and uploads the item again with blind indexes of the tags,
+// which replace the tags it had. Uploads without tags keep them, so other devices don't remove them
+func (c *Client) setTags(kind, name string, tags []string) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	if err := c.syncChanges(); err != nil {
+		return err
+	}
+	state, err := c.Storage.LoadSyncState(c.Key)
+	if err != nil {
+		return err
+	}
+
+	var sync itemSync
+	for _, s := range c.itemSyncs() {
+		if s.kind == kind {
+			sync = s
+		}
+	}
+	item, err := sync.load(name)
+	if errors.Is(err, localstorage.ErrNoData) || errors.Is(err, storage.ErrDataNotFound) {
+		return ErrDataNotFound
+	}
+	if err != nil {
+		return err
+	}
+	synced, ok := state.Items[kind][name]
+	if !ok || hasConflict(state.Conflicts, kind, name) {
+		return ErrNotSynced
+	}
+
+	item.Kind = kind
+	item.BaseRevision = synced.Revision
+	if d := c.device(); d != nil {
+		item.Device = d.Name
+	}
+	item.Name, item.EncName, err = c.hideName(kind, name)
+	if err != nil {
+		return err
+	}
+	// an empty list, not nil, removes the tags
+	item.Tags = make([]string, 0, len(tags))
+	for _, tag := range tags {
+		item.Tags = append(item.Tags, c.tagIndex(tag))
+	}
+
+	results, err := c.updateItemsInDB([]storage.Item{item})
+	if err != nil {
+		return err
+	}
+	switch results[0].Error {
+	case "":
+	case storage.ItemErrConflict:
+		return ErrItemChanged
+	case storage.ItemErrNotFound:
+		return ErrNotSynced
+	default:
+		return fmt.Errorf("can't tag %s %s: %s", kind, name, results[0].Error)
+	}
+	state.Items[kind][name] = localstorage.SyncedItem{Revision: results[0].Revision, Hash: item.Hash}
+	return c.Storage.SaveSyncState(state, c.Key)
+}
@@ -0,0 +1,84 @@
+package clientfunc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/handlers"
+	"github.com/gambruh/simplevault/internal/storage"
+	"github.com/gambruh/simplevault/internal/storage/memstorage"
+)
+
+// Tags reach the server as blind indexes, list commands filter and sort through the server
+// and reveal the names with the local ones
+func TestTagsAndListOptions(t *testing.T) {
+	ms := memstorage.NewStorage()
+	h := handlers.NewService(ms, auth.NewMemStorage())
+	c := newTestClient(t)
+	c.AuthCookie = &http.Cookie{}
+	serveAs(t, c, h, "user")
+
+	for _, name := range []string{"wifi", "alarm", "door"} {
+		if err := c.Storage.SaveNote(storage.Note{Name: name, Text: "secret"}, c.Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.setTags(storage.KindNote, "wifi", []string{"home"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.setTags(storage.KindNote, "door", []string{"home", "work"}); err != nil {
+		t.Fatal(err)
+	}
+	for index, note := range ms.Notes["user"] {
+		for _, tag := range note.Tags {
+			if !isBlindIndex(tag) {
+				t.Errorf("note %s has tag %q in clear", index, tag)
+			}
+		}
+	}
+
+	list := func(prefix string, opts storage.ListOptions, want ...string) {
+		t.Helper()
+		names, err := c.listNames(storage.KindNote, prefix, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("list %q %+v: got %v, want %v", prefix, opts, names, want)
+		}
+	}
+	list("", storage.ListOptions{}, "alarm", "door", "wifi")
+	list("", storage.ListOptions{Sort: "-" + storage.SortName}, "wifi", "door", "alarm")
+	list("", storage.ListOptions{Tag: "home"}, "door", "wifi")
+	list("", storage.ListOptions{Tag: "work"}, "door")
+	list("w", storage.ListOptions{Tag: "home"}, "wifi")
+	list("", storage.ListOptions{Tag: "travel"})
+	// door was tagged last
+	list("d", storage.ListOptions{Sort: "-" + storage.SortModified}, "door")
+	names, err := c.listNames(storage.KindNote, "", storage.ListOptions{Sort: "-" + storage.SortModified})
+	if err != nil || len(names) != 3 || names[0] != "door" {
+		t.Errorf("list by modification time: got %v, %v", names, err)
+	}
+
+	if err := c.setTags(storage.KindNote, "door", nil); err != nil {
+		t.Fatal(err)
+	}
+	list("", storage.ListOptions{Tag: "home"}, "wifi")
+	if err := c.setTags(storage.KindNote, "missing", []string{"home"}); err != ErrDataNotFound {
+		t.Errorf("tag missing note: got %v, want %v", err, ErrDataNotFound)
+	}
+}
+
+func TestParseListOptions(t *testing.T) {
+	prefix, opts, err := parseListOptions([]string{"sort=-modified", "wi", "tag=home"})
+	if err != nil || prefix != "wi" || opts.Sort != "-modified" || opts.Tag != "home" {
+		t.Errorf("got %q %+v %v", prefix, opts, err)
+	}
+	for _, options := range [][]string{{"sort=size"}, {"a", "b"}} {
+		if _, _, err := parseListOptions(options); err == nil {
+			t.Errorf("options %v are accepted", options)
+		}
+	}
+}
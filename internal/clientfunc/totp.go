@@ -0,0 +1,83 @@
+package clientfunc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/helpers"
+)
+
+// readLine prints the prompt and reads one trimmed line from stdin
+func readLine(prompt string) string {
+	fmt.Println(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// promptSecondFactor asks for the authenticator app code or one of the backup codes
+func promptSecondFactor() string {
+	return readLine("Enter the code from your authenticator app or a backup code (empty to skip online login):")
+}
+
+// Enable2FACommand enrolls the user into two-factor authentication with TOTP
+func (c *Client) Enable2FACommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) > 2 || (len(input) == 2 && input[1] != "qr") {
+		printEnable2FASyntax()
+		return
+	}
+
+	data, err := c.sendTOTPEnrollRequest()
+	if err != nil {
+		fmt.Println("can't enroll into two-factor authentication:", err)
+		return
+	}
+
+	fmt.Println("Add this account to your authenticator app:")
+	fmt.Println("  ", data.URI)
+	fmt.Println("or enter the secret manually:", data.Secret)
+	if len(input) == 2 {
+		if err := printQR(data.URI); err != nil {
+			fmt.Println("can't print QR code:", err)
+		}
+	}
+
+	code := readLine("Enter the code from your authenticator app to confirm:")
+	codes, err := c.sendTOTPVerifyRequest(code)
+	if err != nil {
+		fmt.Println("two-factor authentication is not enabled:", err)
+		return
+	}
+
+	fmt.Println("Two-factor authentication is enabled!")
+	fmt.Println("Backup codes are shown only once, each of them can be used instead of the app code one time:")
+	for _, code := range codes {
+		fmt.Println("  ", code)
+	}
+}
+
+// Disable2FACommand turns two-factor authentication off
+func (c *Client) Disable2FACommand(input []string) {
+	input = helpers.SplitFurther(input)
+	if c.AuthCookie == nil {
+		fmt.Println("please login online first")
+		return
+	}
+	if len(input) != 2 {
+		printDisable2FASyntax()
+		return
+	}
+
+	err := c.sendTOTPDisableRequest(input[1])
+	if err != nil {
+		fmt.Println("can't disable two-factor authentication:", err)
+		return
+	}
+	fmt.Println("Two-factor authentication is disabled")
+}
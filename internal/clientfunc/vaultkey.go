@@ -0,0 +1,206 @@
+package clientfunc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/securebuf"
+	"golang.org/x/crypto/argon2"
+)
+
+// userFile is the content of the user data file
+type userFile struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	VaultKey string `json:"vaultkey,omitempty"`
+}
+
+// vault keys wrapped by argon2id key are saved as "argon2id$salt$wrapped key", both base64 encoded.
+// Older ones are the wrapped key only, wrapped by passwordKey
+const passwordKeyPrefix = "argon2id$"
+
+// passwordKey is the legacy key wrapping the vault key, derived from user's login and password.
+// Users registered before vault keys were introduced have it as their vault key
+func passwordKey(login, password string) []byte {
+	key := sha256.Sum256([]byte(login + password))
+	return key[:]
+}
+
+// passwordKDF derives the key which wraps the vault key out of the password.
+// argon2id with a random salt makes guessing the password out of the wrapped key slow
+func passwordKDF(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, 3, 64*1024, 4, 32)
+}
+
+// wrapWithPassword wraps the key by the password with a new random salt and encodes it with the salt
+func wrapWithPassword(key []byte, password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("can't generate salt:%w", err)
+	}
+	wrapped, err := encrypt.WrapKey(key, passwordKDF(password, salt))
+	if err != nil {
+		return "", err
+	}
+	return passwordKeyPrefix + base64.StdEncoding.EncodeToString(salt) + "$" + base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// unwrapWithPassword unwraps the key encoded by wrapWithPassword, or a legacy one wrapped by passwordKey
+func unwrapWithPassword(encoded, login, password string) ([]byte, error) {
+	if !isPasswordWrapped(encoded) {
+		return unwrapEncodedKey(encoded, passwordKey(login, password))
+	}
+	parts := strings.SplitN(strings.TrimPrefix(encoded, passwordKeyPrefix), "$", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed wrapped key")
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("can't decode salt:%w", err)
+	}
+	return unwrapEncodedKey(parts[1], passwordKDF(password, salt))
+}
+
+func isPasswordWrapped(encoded string) bool {
+	return strings.HasPrefix(encoded, passwordKeyPrefix)
+}
+
+// recoveryToken derives a token out of the vault key.
+// The server keeps its hash to check that someone resetting the password holds the vault key
+func recoveryToken(vaultKey []byte) string {
+	mac := hmac.New(sha256.New, vaultKey)
+	mac.Write([]byte("simplevault-recovery"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// saveVaultKey saves the wrapped vault key of the kind on the server, the change is confirmed by the password
+func (c *Client) saveVaultKey(login, password, kind, wrapped string) error {
+	confirm, err := c.proveLogin(login, password)
+	if err != nil {
+		return err
+	}
+	return c.sendVaultKeyToDB(auth.VaultKeyData{Kind: kind, Key: wrapped, Handshake: confirm.Handshake, Proof: confirm.Proof})
+}
+
+// saveRecoveryToken saves the recovery token of the vault key on the server, the change is confirmed by the password
+func (c *Client) saveRecoveryToken(login, password string) error {
+	confirm, err := c.proveLogin(login, password)
+	if err != nil {
+		return err
+	}
+	return c.sendRecoveryVerifierToDB(auth.ResetData{Token: recoveryToken(c.Key), Handshake: confirm.Handshake, Proof: confirm.Proof})
+}
+
+// createVault generates a vault key for a new user, wraps it by the password
+// and saves it on the server. Returns the wrapped vault key
+func (c *Client) createVault(login, password string) (string, error) {
+	vaultKey, err := encrypt.NewKey()
+	if err != nil {
+		return "", err
+	}
+	encoded, err := wrapWithPassword(vaultKey, password)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.saveVaultKey(login, password, auth.VaultKeyPassword, encoded); err != nil {
+		return "", err
+	}
+
+	return encoded, c.setKey(vaultKey)
+}
+
+// unlockVaultOnline gets the vault key wrapped by the password from the server and unwraps it.
+// Users registered before vault keys were introduced have the password key as their vault key,
+// it gets wrapped and saved on the server on their first login. Vault keys wrapped by the legacy
+// password key are wrapped anew. Returns the wrapped vault key
+func (c *Client) unlockVaultOnline(login, password string) (string, error) {
+	var vaultKey []byte
+	encoded, err := c.getVaultKeyFromDB(auth.VaultKeyPassword)
+	switch err {
+	case nil:
+		vaultKey, err = unwrapWithPassword(encoded, login, password)
+		if err != nil {
+			return "", err
+		}
+	case ErrDataNotFound:
+		vaultKey = passwordKey(login, password)
+	default:
+		return "", err
+	}
+
+	if !isPasswordWrapped(encoded) {
+		encoded, err = wrapWithPassword(vaultKey, password)
+		if err != nil {
+			return "", err
+		}
+		if err := c.saveVaultKey(login, password, auth.VaultKeyPassword, encoded); err != nil {
+			return "", err
+		}
+	}
+	return encoded, c.setKey(vaultKey)
+}
+
+// unlockVaultOffline unwraps the vault key saved in the user data file
+func (c *Client) unlockVaultOffline(login, password string) error {
+	data, err := readUserFile()
+	if err != nil {
+		return err
+	}
+	if data.VaultKey == "" {
+		return c.setKey(passwordKey(login, password))
+	}
+
+	vaultKey, err := unwrapWithPassword(data.VaultKey, login, password)
+	if err != nil {
+		return err
+	}
+	return c.setKey(vaultKey)
+}
+
+// setKey moves the vault key into a secure buffer, the key slice and the previous key are wiped
+func (c *Client) setKey(key []byte) error {
+	buf, err := securebuf.FromBytes(key)
+	if err != nil {
+		return fmt.Errorf("can't protect vault key:%w", err)
+	}
+	// the key is swapped before the old buffer is destroyed, so c.Key never points to released memory
+	old := c.keyBuf
+	c.keyBuf, c.Key = buf, buf.Bytes()
+	old.Destroy()
+	return nil
+}
+
+func unwrapEncodedKey(encoded string, kek []byte) ([]byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode wrapped key:%w", err)
+	}
+	return encrypt.UnwrapKey(wrapped, kek)
+}
+
+func readUserFile() (userFile, error) {
+	var data userFile
+
+	file, err := os.Open(config.ClientCfg.UserDataFile)
+	if err != nil {
+		return userFile{}, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return userFile{}, fmt.Errorf("can't unmarshal user data file:%w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,57 @@
+package clientfunc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/encrypt"
+)
+
+func TestWrapWithPassword(t *testing.T) {
+	vaultKey := bytes.Repeat([]byte{7}, 32)
+
+	encoded, err := wrapWithPassword(vaultKey, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := wrapWithPassword(vaultKey, "password"); again == encoded {
+		t.Error("salt is not random")
+	}
+	if key, err := unwrapWithPassword(encoded, "user", "password"); err != nil || !bytes.Equal(key, vaultKey) {
+		t.Errorf("unwrapWithPassword() = %v, %v", key, err)
+	}
+	if _, err := unwrapWithPassword(encoded, "user", "wrong"); err == nil {
+		t.Error("wrong password unwraps the key")
+	}
+
+	// keys wrapped before are unwrapped by the legacy password key
+	wrapped, err := encrypt.WrapKey(vaultKey, passwordKey("user", "password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := base64.StdEncoding.EncodeToString(wrapped)
+	if key, err := unwrapWithPassword(legacy, "user", "password"); err != nil || !bytes.Equal(key, vaultKey) {
+		t.Errorf("legacy unwrapWithPassword() = %v, %v", key, err)
+	}
+}
+
+// The key may be set again from the key the client holds, c.Key then aliases the buffer being replaced
+func TestSetKeyFromHeldKey(t *testing.T) {
+	c := &Client{}
+	want := bytes.Repeat([]byte{7}, 32)
+	if err := c.setKey(append([]byte(nil), want...)); err != nil {
+		t.Fatal(err)
+	}
+	old := c.keyBuf
+	if err := c.setKey(c.Key); err != nil {
+		t.Fatal(err)
+	}
+	if c.keyBuf == old || !bytes.Equal(c.Key, want) {
+		t.Errorf("key = %x, want %x in a new buffer", c.Key, want)
+	}
+	if old.Bytes() != nil {
+		t.Error("the previous buffer isn't destroyed")
+	}
+	c.WipeKeys()
+}
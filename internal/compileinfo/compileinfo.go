@@ -18,3 +18,14 @@ func PrintCompileInfo(buildVersion string, buildDate string, buildCommit string)
 	fmt.Printf("Build date: %s\n", buildDate)
 	fmt.Printf("Build commit: %s\n", buildCommit)
 }
+
+// Version returns the build version with the commit, to tell the server which client it talks to
+func Version(buildVersion string, buildCommit string) string {
+	if buildVersion == "" {
+		buildVersion = "N/A"
+	}
+	if buildCommit == "" {
+		return buildVersion
+	}
+	return buildVersion + " (" + buildCommit + ")"
+}
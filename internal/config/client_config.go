@@ -23,6 +23,11 @@ type ClientConfig struct {
 	UserDataFile    string        `env:"GK_USERDATA_FILE" envDefault:"./userdata/user.json"`
 	BinOutputFolder string        `env:"GK_BINARIES_OUTPUT" envDefault:"./filesrcv"`
 	CheckTime       time.Duration `env:"GK_CHECKINTERVAL" envDefault:"60s"`
+	LockTime        time.Duration `env:"GK_LOCKTIME" envDefault:"5m"`
+	// Conflicts is the policy for items changed on two devices: lastwriter, keepboth or ask
+	Conflicts string `env:"GK_CONFLICTS" envDefault:"keepboth"`
+	// LegacyLogin allows sending the password once to upgrade an account registered without SRP verifier
+	LegacyLogin bool `env:"GK_LEGACY_LOGIN" envDefault:"false"`
 }
 
 // ClientFlagConfig is a structure to store client flag values
@@ -37,6 +42,9 @@ type ClientFlagConfig struct {
 	BinInputFolder  *string
 	BinOutputFolder *string
 	CheckTime       *time.Duration
+	LockTime        *time.Duration
+	Conflicts       *string
+	LegacyLogin     *bool
 }
 
 // InitClientFlags simply initiates the client flags
@@ -46,6 +54,9 @@ func InitClientFlags() {
 	ClientFlags.PrivateKey = flag.String("p", "privatekey.pem", "path to file with public key for agent")
 	ClientFlags.LocalStorage = flag.String("localstorage", "./localstorage", "address of the folder to store files")
 	ClientFlags.CheckTime = flag.Duration("t", 60*time.Second, "interval in time.Duration format (10s, 5m) to check data from DB")
+	ClientFlags.LockTime = flag.Duration("lock", 5*time.Minute, "inactivity interval in time.Duration format after which the client is locked, 0 to turn off")
+	ClientFlags.Conflicts = flag.String("conflicts", "keepboth", "policy for items changed on two devices: lastwriter, keepboth or ask")
+	ClientFlags.LegacyLogin = flag.Bool("legacylogin", false, "send the password once to upgrade an account registered without SRP verifier")
 	ClientFlags.BinInputFolder = flag.String("bininputfolder", "./filetosend", "folder to put binaries in to be sent")
 	ClientFlags.BinOutputFolder = flag.String("binoutputfolder", "./filesrcv", "folder to store received binaries")
 }
@@ -73,6 +84,15 @@ func SetClientConfig() (cfg ClientConfig) {
 	if _, check := os.LookupEnv("GK_CHECKINTERVAL"); !check {
 		cfg.CheckTime = *ClientFlags.CheckTime
 	}
+	if _, check := os.LookupEnv("GK_LOCKTIME"); !check {
+		ClientCfg.LockTime = *ClientFlags.LockTime
+	}
+	if _, check := os.LookupEnv("GK_CONFLICTS"); !check {
+		ClientCfg.Conflicts = *ClientFlags.Conflicts
+	}
+	if _, check := os.LookupEnv("GK_LEGACY_LOGIN"); !check {
+		ClientCfg.LegacyLogin = *ClientFlags.LegacyLogin
+	}
 	if _, check := os.LookupEnv("GK_BINARIES_INPUT"); !check {
 		ClientCfg.BinInputFolder = *ClientFlags.BinInputFolder
 	}
@@ -2,56 +2,123 @@
 package encrypt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+
+	"github.com/gambruh/simplevault/internal/securebuf"
 )
 
-// EncryptData encrypts the data using secret key and returns encrypted result
-func EncryptData(data, key []byte) ([]byte, error) {
+// ErrWrongKey is returned when wrapped key can't be opened with provided key
+var ErrWrongKey = errors.New("can't unwrap key - wrong key or corrupted data")
 
-	aesblock, err := aes.NewCipher(key)
+// data encrypted with a random nonce is prefixed by the version and the nonce.
+// Data encrypted before has the nonce derived from the key, it is still decrypted
+var dataVersion = []byte("sv2\x00")
+
+// EncryptData encrypts the data using secret key and returns encrypted result.
+// Every call uses a new random nonce, so the same key safely encrypts many messages
+func EncryptData(data, key []byte) ([]byte, error) {
+	aesgcm, err := newGCM(key)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("can't create cipher in EncryptData:%w", err)
 	}
-	aesgcm, err := cipher.NewGCM(aesblock)
-	if err != nil {
-		panic(err)
+	sealed := make([]byte, len(dataVersion)+aesgcm.NonceSize(), len(dataVersion)+aesgcm.NonceSize()+len(data)+aesgcm.Overhead())
+	copy(sealed, dataVersion)
+	nonce := sealed[len(dataVersion):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("can't generate nonce in EncryptData:%w", err)
 	}
-
-	// создаём вектор инициализации
-	nonce := key[len(key)-aesgcm.NonceSize():]
-
-	// Encrypt the plaintext using the GCM cipher
-	encryptedData := aesgcm.Seal(nil, nonce, data, nil)
-
-	return encryptedData, nil
+	return aesgcm.Seal(sealed, nonce, data, nil), nil
 }
 
 // DecryptData decrypts []byte data, using the secret key, and returns the result
 func DecryptData(encryptedData, key []byte) (decryptedData []byte, err error) {
-
-	aesblock, err := aes.NewCipher(key[:])
+	aesgcm, err := newGCM(key)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("can't create cipher in DecryptData:%w", err)
 	}
-	aesgcm, err := cipher.NewGCM(aesblock)
+	nonce, data := splitNonce(aesgcm, encryptedData, key)
+	if decryptedData, err = aesgcm.Open(nil, nonce, data, nil); err == nil {
+		return decryptedData, nil
+	}
+	// legacy data may start with the version by chance
+	if len(data) != len(encryptedData) {
+		if decryptedData, err = aesgcm.Open(nil, legacyNonce(aesgcm, key), encryptedData, nil); err == nil {
+			return decryptedData, nil
+		}
+	}
+	return nil, ErrWrongKey
+}
+
+// DecryptDataSecure decrypts the data like DecryptData, but right into a secure buffer,
+// so the plaintext never touches the Go heap. The caller must destroy the buffer
+func DecryptDataSecure(encryptedData, key []byte) (*securebuf.Buffer, error) {
+	aesgcm, err := newGCM(key)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("can't create cipher in DecryptDataSecure:%w", err)
+	}
+	nonce, data := splitNonce(aesgcm, encryptedData, key)
+	buf, err := openSecure(aesgcm, nonce, data)
+	if err == ErrWrongKey && len(data) != len(encryptedData) {
+		buf, err = openSecure(aesgcm, legacyNonce(aesgcm, key), encryptedData)
 	}
+	return buf, err
+}
 
-	// создаём вектор инициализации
-	nonce := key[len(key)-aesgcm.NonceSize():]
+func openSecure(aesgcm cipher.AEAD, nonce, data []byte) (*securebuf.Buffer, error) {
+	if len(data) < aesgcm.Overhead() {
+		return nil, ErrWrongKey
+	}
+	buf, err := securebuf.New(len(data) - aesgcm.Overhead())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := aesgcm.Open(buf.Bytes()[:0], nonce, data, nil); err != nil {
+		buf.Destroy()
+		return nil, ErrWrongKey
+	}
+	return buf, nil
+}
 
-	//Decrypt the data
-	decryptedData, err = aesgcm.Open(nil, nonce, encryptedData, nil) // расшифровываем
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesblock, err := aes.NewCipher(key)
 	if err != nil {
-		fmt.Printf("error: %v\n", err)
-		return
+		return nil, err
 	}
+	return cipher.NewGCM(aesblock)
+}
+
+// splitNonce returns the random nonce and the ciphertext of versioned data.
+// Data without the version is returned with the legacy nonce as is
+func splitNonce(aesgcm cipher.AEAD, encryptedData, key []byte) (nonce, data []byte) {
+	header := len(dataVersion) + aesgcm.NonceSize()
+	if len(encryptedData) < header+aesgcm.Overhead() || !bytes.Equal(encryptedData[:len(dataVersion)], dataVersion) {
+		return legacyNonce(aesgcm, key), encryptedData
+	}
+	return encryptedData[len(dataVersion):header], encryptedData[header:]
+}
+
+// legacyNonce is the nonce of data encrypted before random nonces, the tail of the key
+func legacyNonce(aesgcm cipher.AEAD, key []byte) []byte {
+	return key[len(key)-aesgcm.NonceSize():]
+}
 
-	return decryptedData, nil
+// NewSecureKey returns a new random 32 bytes key in a secure buffer
+func NewSecureKey() (*securebuf.Buffer, error) {
+	buf, err := securebuf.New(32)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(buf.Bytes()); err != nil {
+		buf.Destroy()
+		return nil, fmt.Errorf("can't generate key:%w", err)
+	}
+	return buf, nil
 }
 
 // DecryptFromString initially decodes data from hexadecimal string to []byte, then cals DecryptData
@@ -71,3 +138,56 @@ func EncryptFromString(s string, key []byte) (decryptedData []byte, err error) {
 	}
 	return EncryptData(dst, key)
 }
+
+// WrapKey encrypts a key with another key (key encryption key).
+// Unlike EncryptData it uses a random nonce, which is prepended to the result,
+// so the same kek can safely wrap many keys
+func WrapKey(key, kek []byte) ([]byte, error) {
+	aesblock, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("can't create cipher in WrapKey:%w", err)
+	}
+	aesgcm, err := cipher.NewGCM(aesblock)
+	if err != nil {
+		return nil, fmt.Errorf("can't create GCM in WrapKey:%w", err)
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("can't generate nonce in WrapKey:%w", err)
+	}
+
+	return aesgcm.Seal(nonce, nonce, key, nil), nil
+}
+
+// UnwrapKey decrypts a key wrapped by WrapKey
+func UnwrapKey(wrapped, kek []byte) ([]byte, error) {
+	aesblock, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("can't create cipher in UnwrapKey:%w", err)
+	}
+	aesgcm, err := cipher.NewGCM(aesblock)
+	if err != nil {
+		return nil, fmt.Errorf("can't create GCM in UnwrapKey:%w", err)
+	}
+
+	if len(wrapped) < aesgcm.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	nonce, data := wrapped[:aesgcm.NonceSize()], wrapped[aesgcm.NonceSize():]
+
+	key, err := aesgcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
+
+// NewKey returns a new random 32 bytes key
+func NewKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("can't generate key:%w", err)
+	}
+	return key, nil
+}
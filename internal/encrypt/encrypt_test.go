@@ -23,3 +23,82 @@ func TestEncryptDataDecryptData(t *testing.T) {
 		t.Errorf("Decrypted data doesn't match the original plaintext")
 	}
 }
+
+func TestWrapKeyUnwrapKey(t *testing.T) {
+	kek := []byte("0123456789abcdef0123456789abcdef")
+	key := []byte("fedcba9876543210fedcba9876543210")
+
+	wrapped, err := WrapKey(key, kek)
+	if err != nil {
+		t.Fatalf("Error wrapping key: %v", err)
+	}
+
+	unwrapped, err := UnwrapKey(wrapped, kek)
+	if err != nil {
+		t.Fatalf("Error unwrapping key: %v", err)
+	}
+	if !bytes.Equal(key, unwrapped) {
+		t.Errorf("Unwrapped key doesn't match the original key")
+	}
+
+	if _, err := UnwrapKey(wrapped, key); err != ErrWrongKey {
+		t.Errorf("expected ErrWrongKey when unwrapping with another key, got %v", err)
+	}
+}
+
+func TestDecryptDataSecure(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encrypted, err := EncryptData([]byte("card,1234"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := DecryptDataSecure(encrypted, key)
+	if err != nil {
+		t.Fatalf("DecryptDataSecure() error = %v", err)
+	}
+	defer buf.Destroy()
+	if string(buf.Bytes()) != "card,1234" {
+		t.Errorf("DecryptDataSecure() = %q", buf.Bytes())
+	}
+
+	if _, err := DecryptDataSecure(encrypted, []byte("fedcba9876543210fedcba9876543210")); err == nil {
+		t.Error("DecryptDataSecure() with wrong key returned no error")
+	}
+}
+
+func TestEncryptDataRandomNonce(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	plaintext := []byte("card,1234")
+
+	first, err := EncryptData(plaintext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := EncryptData(plaintext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("the same data is encrypted twice into the same ciphertext")
+	}
+
+	// data encrypted with the nonce derived from the key is still decrypted
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := aesgcm.Seal(nil, legacyNonce(aesgcm, key), plaintext, nil)
+	if data, err := DecryptData(legacy, key); err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("DecryptData() of legacy data = %q, %v", data, err)
+	}
+	buf, err := DecryptDataSecure(legacy, key)
+	if err != nil || !bytes.Equal(buf.Bytes(), plaintext) {
+		t.Errorf("DecryptDataSecure() of legacy data = %q, %v", buf.Bytes(), err)
+	}
+	buf.Destroy()
+
+	if _, err := DecryptData(first, []byte("fedcba9876543210fedcba9876543210")); err != ErrWrongKey {
+		t.Errorf("expected ErrWrongKey when decrypting with another key, got %v", err)
+	}
+}
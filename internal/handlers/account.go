@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// confirmPassword checks SRP proof of the password of the current user before changing the account.
+// Wrong passwords are throttled as failed logins and get 403, so clients don't take them for an expired session
+func (h *WebService) confirmPassword(w http.ResponseWriter, r *http.Request, login string, data auth.AccountData) bool {
+	ip := clientIP(r)
+	if wait := h.loginLimiter.RetryAfter(ip, time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return false
+	}
+	failures, err := h.AuthStorage.GetLoginFailures(r.Context(), login)
+	if err != nil {
+		log.Println("error when getting login failures:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	if wait := failures.RetryAfter(time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return false
+	}
+
+	_, err = h.handshakes.Finish(login, auth.SRPProof{Handshake: data.Handshake, Proof: data.Proof})
+	switch err {
+	case nil:
+		return true
+	case auth.ErrWrongPassword, auth.ErrHandshakeNotFound, auth.ErrWrongSRPData:
+		log.Println("Invalid password confirmation:", login)
+		h.countLoginFailure(r, ip, login)
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	default:
+		log.Println("error when verifying password:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+}
+
+// ChangeUsername renames the current user. The session goes on with a new access token
+func (h *WebService) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	var data auth.AccountData
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+	sessionID := r.Context().Value(config.UserID("sessionID")).(string)
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Login == "" || data.Handshake == "" || data.VaultKey == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !h.confirmPassword(w, r, username, data) {
+		return
+	}
+
+	err = h.AuthStorage.ChangeUsername(r.Context(), username, data.Login, data.VaultKey)
+	switch err {
+	case nil:
+	case auth.ErrUsernameIsTaken:
+		w.WriteHeader(http.StatusConflict)
+		return
+	default:
+		log.Println("error in ChangeUsername handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if mover, ok := h.Storage.(storage.AccountMover); ok {
+		if err := mover.MoveAccount(r.Context(), username, data.Login); err != nil {
+			log.Println("error when moving account data:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// the old access token names the old login, other sessions get new ones on refresh
+	access, err := auth.GenerateToken(data.Login, sessionID)
+	if err != nil {
+		log.Println("error when generating token:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.AccessCookie,
+		Value:    access,
+		HttpOnly: true,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteAccount deletes the current user with all the data
+func (h *WebService) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var data auth.AccountData
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Handshake == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !h.confirmPassword(w, r, username, data) {
+		return
+	}
+
+	if err := h.AuthStorage.DeleteAccount(r.Context(), username); err != nil {
+		log.Println("error in DeleteAccount handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if mover, ok := h.Storage.(storage.AccountMover); ok {
+		if err := mover.MoveAccount(r.Context(), username, ""); err != nil {
+			log.Println("error when deleting account data:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// CreateAPIKey creates an API key of the current user. The token is returned only once
+func (h *WebService) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var data auth.APIKeyData
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Name == "" || data.TTL < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, kind := range data.Scope.Kinds {
+		if !validKind(kind) && kind != storage.KindBinary {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, token, err := auth.NewAPIKey(r.Context(), h.AuthStorage, username, data.Name, data.Scope, time.Duration(data.TTL)*time.Second)
+	if err != nil {
+		log.Println("error in CreateAPIKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(auth.APIKeyData{
+		ID:    key.ID,
+		Name:  key.Name,
+		Scope: key.Scope,
+		TTL:   data.TTL,
+		Key:   token,
+	})
+}
+
+// ListAPIKeys returns API keys of the current user without their tokens
+func (h *WebService) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	keys, err := h.AuthStorage.ListAPIKeys(r.Context(), username)
+	switch {
+	case err == nil && len(keys) > 0:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(keys)
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in ListAPIKeys handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RevokeAPIKey deletes an API key of the current user
+func (h *WebService) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	var data auth.APIKeyData
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := h.AuthStorage.RevokeAPIKey(r.Context(), username, data.ID)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case auth.ErrAPIKeyNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in RevokeAPIKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// allowedByScope responds with 403 if the request is made with an API key whose scope doesn't allow
+// access to items of the kind in the organization vault
+func allowedByScope(w http.ResponseWriter, r *http.Request, kind string, org string, write bool) bool {
+	if scope, ok := auth.ScopeFromContext(r.Context()); ok && !scope.Allows(kind, org, write) {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// scopeOrgs leaves the organizations the scope allows
+func scopeOrgs(scope auth.APIKeyScope, orgs []storage.Org) []storage.Org {
+	var allowed []storage.Org
+	for _, org := range orgs {
+		if scope.Allows("", org.Name, false) {
+			allowed = append(allowed, org)
+		}
+	}
+	return allowed
+}
+
+// scopeOrgItems leaves the items of the organization of kinds the scope allows
+func scopeOrgItems(scope auth.APIKeyScope, org string, items []storage.OrgItem) []storage.OrgItem {
+	var allowed []storage.OrgItem
+	for _, item := range items {
+		if scope.Allows(item.Kind, org, false) {
+			allowed = append(allowed, item)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// newAPIKey creates an API key of the user with the scope and returns its token.
+// The user is registered if there is no such user yet
+func newAPIKey(t *testing.T, h *WebService, username string, scope auth.APIKeyScope) string {
+	t.Helper()
+	ctx := context.Background()
+	err := h.AuthStorage.Register(ctx, username, auth.SRPVerifier{Salt: "salt", Verifier: "verifier"})
+	if err != nil && err != auth.ErrUsernameIsTaken {
+		t.Fatal(err)
+	}
+	_, token, err := auth.NewAPIKey(ctx, h.AuthStorage, username, "ci", scope, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serveToken sends the request with body encoded to json through the router of the service
+func serveToken(t *testing.T, h *WebService, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, bytes.NewReader(data))
+	r.Header.Set("Content-type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.Service().ServeHTTP(w, r)
+	return w
+}
+
+func TestAPIKeyScopeRoutes(t *testing.T) {
+	h := newTestService()
+	notes := newAPIKey(t, h, "alice", auth.APIKeyScope{Kinds: []string{storage.KindNote}})
+	readonly := newAPIKey(t, h, "alice", auth.APIKeyScope{ReadOnly: true})
+	note := storage.EncryptedData{Name: "bi1-9c0e", Data: "data"}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{"kind in scope", http.MethodPost, "/api/notes/add", notes, note, http.StatusAccepted},
+		{"kind out of scope", http.MethodPost, "/api/cards/add", notes, note, http.StatusForbidden},
+		{"list out of scope", http.MethodGet, "/api/cards/list", notes, nil, http.StatusForbidden},
+		{"readonly read", http.MethodPost, "/api/notes/get", readonly, note, http.StatusOK},
+		{"readonly write", http.MethodPost, "/api/notes/add", readonly, note, http.StatusForbidden},
+		{"change feed", http.MethodGet, "/api/sync/changes?since=0", notes, nil, http.StatusForbidden},
+		{"session only route", http.MethodPost, "/api/apikeys/create", notes, auth.APIKeyData{Name: "other"}, http.StatusForbidden},
+		{"vault key", http.MethodPost, "/api/vaultkey/get", readonly, auth.VaultKeyData{Kind: auth.VaultKeyPassword}, http.StatusForbidden},
+		{"key pair", http.MethodGet, "/api/keys/get", notes, nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantStatus(t, tt.name, serveToken(t, h, tt.method, tt.path, tt.token, tt.body), tt.want)
+		})
+	}
+	if _, err := h.Storage.GetCard(context.Background(), "alice", note.Name); err != storage.ErrDataNotFound {
+		t.Errorf("card out of scope is saved: %v", err)
+	}
+}
+
+func TestAPIKeyScopeBatch(t *testing.T) {
+	h := newTestService()
+	ctx := context.Background()
+	notes := newAPIKey(t, h, "alice", auth.APIKeyScope{Kinds: []string{storage.KindNote}})
+	readonly := newAPIKey(t, h, "alice", auth.APIKeyScope{ReadOnly: true})
+
+	decode := func(w *httptest.ResponseRecorder) []storage.ItemResult {
+		t.Helper()
+		var results []storage.ItemResult
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	items := []storage.Item{
+		{Kind: storage.KindCard, Name: "bi1-1f7a", Data: "data"},
+		{Kind: storage.KindNote, Name: "bi1-9c0e", Data: "data"},
+	}
+	w := serveToken(t, h, http.MethodPost, "/api/items/add", notes, items)
+	wantStatus(t, "add items", w, http.StatusOK)
+	results := decode(w)
+	if len(results) != 2 || results[0].Error != storage.ItemErrForbidden || results[1].Error != "" {
+		t.Fatalf("add items: got %+v", results)
+	}
+	if results[0].Kind != storage.KindCard || results[0].Name != "bi1-1f7a" {
+		t.Errorf("forbidden item: got %+v", results[0])
+	}
+	if _, err := h.Storage.GetCard(ctx, "alice", "bi1-1f7a"); err != storage.ErrDataNotFound {
+		t.Errorf("card out of scope is saved: %v", err)
+	}
+	if _, err := h.Storage.GetNote(ctx, "alice", "bi1-9c0e"); err != nil {
+		t.Errorf("note in scope isn't saved: %v", err)
+	}
+
+	// nothing is allowed, so the storage isn't asked at all
+	w = serveToken(t, h, http.MethodPost, "/api/items/delete", readonly, items[1:])
+	wantStatus(t, "delete items", w, http.StatusOK)
+	if results := decode(w); len(results) != 1 || results[0].Error != storage.ItemErrForbidden {
+		t.Fatalf("delete items: got %+v", results)
+	}
+	if _, err := h.Storage.GetNote(ctx, "alice", "bi1-9c0e"); err != nil {
+		t.Errorf("note is deleted with a readonly key: %v", err)
+	}
+
+	w = serveToken(t, h, http.MethodPost, "/api/items/get", readonly, items)
+	wantStatus(t, "get items", w, http.StatusOK)
+	results = decode(w)
+	if len(results) != 2 || results[0].Error != storage.ItemErrNotFound || results[1].Error != "" || results[1].Data != "data" {
+		t.Errorf("get items: got %+v", results)
+	}
+}
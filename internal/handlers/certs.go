@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// certAuth returns the role of client certificates, empty if mTLS is off
+func certAuth() string {
+	if config.Cfg.ClientCA == "" {
+		return ""
+	}
+	return config.Cfg.CertAuth
+}
+
+// CertLogin logs in the user the verified client certificate is bound to, without the password.
+// The second factor is still checked, if user has enabled it
+func (h *WebService) CertLogin(w http.ResponseWriter, r *http.Request) {
+	if certAuth() != auth.CertAuthLogin {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var data auth.LoginData
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Throttle by address and by account like logins with the password
+	ip := clientIP(r)
+	if wait := h.loginLimiter.RetryAfter(ip, time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	login, err := auth.CertLogin(h.AuthStorage, r, config.Cfg.CertMapping)
+	switch err {
+	case nil:
+	case auth.ErrNoClientCert, auth.ErrCertificateNotFound:
+		// there is no account to count the failure for
+		h.loginLimiter.Fail(ip, time.Now())
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	default:
+		log.Println("error in CertLogin handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	failures, err := h.AuthStorage.GetLoginFailures(r.Context(), login)
+	if err != nil {
+		log.Println("error when getting login failures:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if wait := failures.RetryAfter(time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	err = auth.CheckSecondFactor(r.Context(), h.AuthStorage, login, data.OTP)
+	switch err {
+	case nil:
+	case auth.ErrSecondFactorRequired:
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case auth.ErrWrongSecondFactor:
+		fmt.Println("Invalid second factor:", login)
+		h.loginFailed(w, r, ip, login)
+		return
+	default:
+		log.Println("error in CertLogin handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.loginLimiter.Reset(ip)
+	if err := h.AuthStorage.ResetLoginFailures(r.Context(), login); err != nil {
+		log.Println("error when resetting login failures:", err)
+	}
+
+	if err := h.startSession(w, r, login, data.Device); err != nil {
+		sessionFailed(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auth.LoginData{Login: login})
+}
+
+// BindCert binds the verified client certificate of the request to the current user
+func (h *WebService) BindCert(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if certAuth() == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err := auth.BindClientCert(h.AuthStorage, r, username, config.Cfg.CertMapping)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case auth.ErrNoClientCert:
+		w.WriteHeader(http.StatusBadRequest)
+	case auth.ErrCertificateIsTaken:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.Println("error in BindCert handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// useCertLogin turns client certificates on as a replacement of the password for the test
+func useCertLogin(t *testing.T) {
+	saved := config.Cfg
+	config.Cfg.ClientCA = "ca.pem"
+	config.Cfg.CertAuth = auth.CertAuthLogin
+	config.Cfg.CertMapping = auth.CertMappingFingerprint
+	t.Cleanup(func() { config.Cfg = saved })
+}
+
+// certLogin calls CertLogin with a verified client certificate
+func certLogin(h *WebService, cert *x509.Certificate) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/user/certlogin", nil)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	w := httptest.NewRecorder()
+	h.CertLogin(w, r)
+	return w
+}
+
+func newCert(t *testing.T, commonName string) *x509.Certificate {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, public, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertLoginLockout(t *testing.T) {
+	useCertLogin(t)
+	ctx := context.Background()
+	h := newTestService()
+	if err := h.AuthStorage.Register(ctx, "user", auth.SRPVerifier{Salt: "salt", Verifier: "verifier"}); err != nil {
+		t.Fatal(err)
+	}
+	cert := newCert(t, "user")
+	id, err := auth.CertID(cert, auth.CertMappingFingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AuthStorage.BindCertificate(ctx, "user", id); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(t, "bound certificate", certLogin(h, cert), http.StatusOK)
+
+	// a failed login with the password backs the account off for certificates too
+	if _, err := h.AuthStorage.AddLoginFailure(ctx, "user", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(t, "certificate during backoff", certLogin(h, cert), http.StatusTooManyRequests)
+
+	for i := 0; i < auth.MaxLoginFailures; i++ {
+		if _, err := h.AuthStorage.AddLoginFailure(ctx, "user", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := certLogin(h, cert)
+	wantStatus(t, "certificate of locked account", w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+
+	if err := h.AuthStorage.ResetLoginFailures(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(t, "certificate of unlocked account", certLogin(h, cert), http.StatusOK)
+
+	// unknown certificates count against the address, it backs off after the free ones
+	for i := 0; i <= ipFreeLogins; i++ {
+		wantStatus(t, "unknown certificate", certLogin(h, newCert(t, "user")), http.StatusUnauthorized)
+	}
+	wantStatus(t, "bound certificate from throttled address", certLogin(h, cert), http.StatusTooManyRequests)
+}
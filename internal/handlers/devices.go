@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// ListDevices returns devices of the current user, the device of the current session is marked
+func (h *WebService) ListDevices(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+	sessionID := r.Context().Value(config.UserID("sessionID")).(string)
+
+	devices, err := h.AuthStorage.ListDevices(r.Context(), username)
+	if err != nil {
+		log.Println("error in ListDevices handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(devices) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if session, err := h.AuthStorage.GetSession(r.Context(), sessionID); err == nil {
+		for i := range devices {
+			devices[i].Current = devices[i].ID == session.DeviceID
+		}
+	}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(devices)
+}
+
+// RevokeDevice revokes the device of the current user and all its sessions
+func (h *WebService) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	var device auth.Device
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if err := json.NewDecoder(r.Body).Decode(&device); err != nil || device.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := h.AuthStorage.RevokeDevice(r.Context(), username, device.ID)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case auth.ErrDeviceNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in RevokeDevice handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -4,12 +4,14 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -17,7 +19,6 @@ import (
 	"github.com/gambruh/simplevault/internal/auth"
 	"github.com/gambruh/simplevault/internal/config"
 	"github.com/gambruh/simplevault/internal/storage"
-	"github.com/gambruh/simplevault/internal/storage/database"
 )
 
 // WebService is a class to
@@ -25,29 +26,98 @@ type WebService struct {
 	Storage     Storage
 	AuthStorage AuthStorage
 	Mu          *sync.Mutex
+	// failed logins and registrations by IP address
+	loginLimiter    *auth.Limiter
+	registerLimiter *auth.Limiter
+	// SRP login handshakes waiting for the proof of the password
+	handshakes *auth.SRPHandshakes
+	// nonces waiting to be signed by login keys
+	keyChallenges *auth.KeyChallenges
 }
 
 // AuthStorage stores login and passwords of app users
 // Different databases for authentication implementation can be used
 type AuthStorage interface {
-	Register(login string, password string) error
-	VerifyCredentials(login string, password string) error
+	Register(ctx context.Context, login string, verifier auth.SRPVerifier) error
+	VerifyCredentials(ctx context.Context, login string, password string) error
+	GetVerifier(ctx context.Context, login string) (auth.SRPVerifier, error)
+	SetVerifier(ctx context.Context, login string, verifier auth.SRPVerifier) error
+	SetVaultKey(ctx context.Context, login string, kind string, wrapped string) error
+	GetVaultKey(ctx context.Context, login string, kind string) (string, error)
+	SetRecoveryVerifier(ctx context.Context, login string, token string) error
+	ResetPassword(ctx context.Context, data auth.ResetData) error
+	SetTOTP(ctx context.Context, login string, secret string) error
+	EnableTOTP(ctx context.Context, login string, backupcodes []string) error
+	DisableTOTP(ctx context.Context, login string) error
+	GetTOTP(ctx context.Context, login string) (secret string, enabled bool, err error)
+	UseBackupCode(ctx context.Context, login string, code string) error
+	CreateSession(ctx context.Context, session auth.Session) error
+	GetSession(ctx context.Context, id string) (auth.Session, error)
+	RotateRefreshToken(ctx context.Context, id string, oldHash string, newHash string, expires time.Time) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeAllSessions(ctx context.Context, login string) error
+	GetLoginFailures(ctx context.Context, login string) (auth.LoginFailures, error)
+	AddLoginFailure(ctx context.Context, login string, now time.Time) (auth.LoginFailures, error)
+	ResetLoginFailures(ctx context.Context, login string) error
+	BindCertificate(ctx context.Context, login string, certID string) error
+	GetCertificateLogin(ctx context.Context, certID string) (string, error)
+	ListCertificates(ctx context.Context, login string) ([]string, error)
+	CreateAPIKey(ctx context.Context, key auth.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (auth.APIKey, error)
+	ListAPIKeys(ctx context.Context, login string) ([]auth.APIKey, error)
+	RevokeAPIKey(ctx context.Context, login string, id string) error
+	TouchAPIKey(ctx context.Context, id string, used time.Time) error
+	SaveDevice(ctx context.Context, login string, device auth.Device) error
+	TouchDevice(ctx context.Context, login string, id string, ip string, seen time.Time) error
+	ListDevices(ctx context.Context, login string) ([]auth.Device, error)
+	RevokeDevice(ctx context.Context, login string, id string) error
+	ChangeUsername(ctx context.Context, login string, newLogin string, vaultKey string) error
+	DeleteAccount(ctx context.Context, login string) error
+	AddLoginKey(ctx context.Context, login string, key auth.LoginKey) error
+	GetLoginKey(ctx context.Context, login string, id string) (auth.LoginKey, error)
+	ListLoginKeys(ctx context.Context, login string) ([]auth.LoginKey, error)
+	DeleteLoginKey(ctx context.Context, login string, id string) error
+	TouchLoginKey(ctx context.Context, id string, used time.Time) error
 }
 
 // Storage interface is a data storage. Implementation may vary
 type Storage interface {
-	SetLoginCred(username string, logincreds storage.EncryptedData) error
-	SetNote(username string, note storage.EncryptedData) error
-	SetBinary(username string, binary storage.Binary) error
-	SetCard(username string, card storage.EncryptedData) error
-	GetLoginCred(username string, name string) (storage.EncryptedData, error)
-	GetNote(username string, name string) (storage.EncryptedData, error)
-	GetBinary(username string, name string) (storage.Binary, error)
-	GetCard(username string, name string) (storage.EncryptedData, error)
-	ListLoginCreds(username string) ([]string, error)
-	ListNotes(username string) ([]string, error)
-	ListBinaries(username string) ([]string, error)
-	ListCards(username string) ([]string, error)
+	SetLoginCred(ctx context.Context, username string, logincreds storage.EncryptedData) error
+	SetNote(ctx context.Context, username string, note storage.EncryptedData) error
+	SetBinary(ctx context.Context, username string, binary storage.Binary) error
+	SetCard(ctx context.Context, username string, card storage.EncryptedData) error
+	GetLoginCred(ctx context.Context, username string, name string) (storage.EncryptedData, error)
+	GetNote(ctx context.Context, username string, name string) (storage.EncryptedData, error)
+	GetBinary(ctx context.Context, username string, name string) (storage.Binary, error)
+	GetCard(ctx context.Context, username string, name string) (storage.EncryptedData, error)
+	ListLoginCreds(ctx context.Context, username string) ([]string, error)
+	ListNotes(ctx context.Context, username string) ([]string, error)
+	ListBinaries(ctx context.Context, username string) ([]string, error)
+	ListCards(ctx context.Context, username string) ([]string, error)
+	SetKeyPair(ctx context.Context, username string, keys storage.KeyPair) error
+	GetKeyPair(ctx context.Context, username string) (storage.KeyPair, error)
+	SetShare(ctx context.Context, username string, share storage.Share) error
+	ListSharesReceived(ctx context.Context, username string) ([]storage.Share, error)
+	ListSharesOwned(ctx context.Context, username string) ([]storage.Share, error)
+	DeleteShare(ctx context.Context, username string, share storage.Share) error
+	CreateOrg(ctx context.Context, username string, org storage.Org) error
+	ListOrgs(ctx context.Context, username string) ([]storage.Org, error)
+	GetOrgRole(ctx context.Context, username string, orgname string) (string, error)
+	SetOrgMember(ctx context.Context, member storage.OrgMember) error
+	DeleteOrgMember(ctx context.Context, orgname string, login string) error
+	RotateOrgKey(ctx context.Context, rotation storage.OrgRotation) error
+	ListOrgMembers(ctx context.Context, orgname string) ([]storage.OrgMember, error)
+	SetOrgItem(ctx context.Context, item storage.OrgItem) error
+	UpdateOrgItem(ctx context.Context, item storage.OrgItem) error
+	DeleteOrgItem(ctx context.Context, orgname string, kind string, name string) error
+	GetOrgItem(ctx context.Context, orgname string, kind string, name string) (storage.OrgItem, error)
+	ListOrgItems(ctx context.Context, orgname string) ([]storage.OrgItem, error)
+	ListItems(ctx context.Context, username string, kind string, opts storage.ListOptions) (storage.Page, error)
+	SetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	GetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	UpdateItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	DeleteItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	ListChanges(ctx context.Context, username string, since int64, limit int) (storage.Changes, error)
 }
 
 var (
@@ -62,22 +132,81 @@ func (h *WebService) Service() http.Handler {
 	r.Use(middleware.Compress(5, "text/plain", "text/html", "application/json"))
 
 	r.Post("/api/user/register", h.Register)
+	r.Post("/api/user/login/start", h.LoginStart)
 	r.Post("/api/user/login", h.Login)
+	r.Post("/api/user/reset", h.ResetPassword)
+	r.Post("/api/user/recoverykey", h.GetRecoveryVaultKey)
+	r.Post("/api/user/refresh", h.Refresh)
+	r.Get("/.well-known/jwks.json", h.JWKS)
+	r.Post("/api/user/certlogin", h.CertLogin)
+	r.Post("/api/user/keylogin/start", h.KeyLoginStart)
+	r.Post("/api/user/keylogin", h.KeyLogin)
 
 	r.Group(func(r chi.Router) {
-		r.Use(auth.AuthMiddleware)
-		r.Post("/api/logincreds/add", h.AddLoginCreds)
-		r.Post("/api/logincreds/get", h.GetLoginCreds)
-		r.Get("/api/logincreds/list", h.ListLoginCreds)
-		r.Post("/api/cards/add", h.AddCard)
-		r.Post("/api/cards/get", h.GetCard)
-		r.Get("/api/cards/list", h.ListCards)
-		r.Post("/api/notes/add", h.AddNote)
-		r.Post("/api/notes/get", h.GetNote)
-		r.Get("/api/notes/list", h.ListNotes)
-		r.Post("/api/binaries/add", h.AddBinary)
-		r.Post("/api/binaries/get", h.GetBinary)
-		r.Get("/api/binaries/list", h.ListBinaries)
+		r.Use(auth.AuthMiddleware(h.AuthStorage))
+
+		// routes available to API keys within their scope
+		r.With(auth.RequireScope(storage.KindLoginCreds, true)).Post("/api/logincreds/add", h.AddLoginCreds)
+		r.With(auth.RequireScope(storage.KindLoginCreds, false)).Post("/api/logincreds/get", h.GetLoginCreds)
+		r.With(auth.RequireScope(storage.KindLoginCreds, false)).Get("/api/logincreds/list", h.ListLoginCreds)
+		r.With(auth.RequireScope(storage.KindCard, true)).Post("/api/cards/add", h.AddCard)
+		r.With(auth.RequireScope(storage.KindCard, false)).Post("/api/cards/get", h.GetCard)
+		r.With(auth.RequireScope(storage.KindCard, false)).Get("/api/cards/list", h.ListCards)
+		r.With(auth.RequireScope(storage.KindNote, true)).Post("/api/notes/add", h.AddNote)
+		r.With(auth.RequireScope(storage.KindNote, false)).Post("/api/notes/get", h.GetNote)
+		r.With(auth.RequireScope(storage.KindNote, false)).Get("/api/notes/list", h.ListNotes)
+		r.With(auth.RequireScope(storage.KindBinary, true)).Post("/api/binaries/add", h.AddBinary)
+		r.With(auth.RequireScope(storage.KindBinary, false)).Post("/api/binaries/get", h.GetBinary)
+		r.With(auth.RequireScope(storage.KindBinary, false)).Get("/api/binaries/list", h.ListBinaries)
+		r.Post("/api/items/add", h.AddItems)
+		r.Post("/api/items/get", h.GetItems)
+		r.Post("/api/items/update", h.UpdateItems)
+		r.Post("/api/items/delete", h.DeleteItems)
+		// organizations and kinds of their items are checked against the scope in the handlers
+		r.Get("/api/orgs/list", h.ListOrgs)
+		r.Post("/api/orgs/items/add", h.AddOrgItem)
+		r.Post("/api/orgs/items/update", h.UpdateOrgItem)
+		r.Post("/api/orgs/items/delete", h.DeleteOrgItem)
+		r.Post("/api/orgs/items/get", h.GetOrgItem)
+		r.Post("/api/orgs/items/list", h.ListOrgItems)
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.SessionOnly)
+			r.Post("/api/user/logout", h.Logout)
+			// the change feed names items of all kinds, so API keys can't read it
+			r.Get("/api/sync/changes", h.SyncChanges)
+			// wrapped keys open every kind, so API keys of any scope can't read them
+			r.Post("/api/vaultkey/get", h.GetVaultKey)
+			r.Get("/api/keys/get", h.GetKeyPair)
+			r.Post("/api/user/logoutall", h.LogoutAll)
+			r.Post("/api/user/verifier", h.SetVerifier)
+			r.Post("/api/user/rename", h.ChangeUsername)
+			r.Post("/api/user/delete", h.DeleteAccount)
+			r.Post("/api/user/cert/bind", h.BindCert)
+			r.Post("/api/apikeys/create", h.CreateAPIKey)
+			r.Get("/api/apikeys/list", h.ListAPIKeys)
+			r.Post("/api/apikeys/revoke", h.RevokeAPIKey)
+			r.Post("/api/loginkeys/add", h.AddLoginKey)
+			r.Get("/api/loginkeys/list", h.ListLoginKeys)
+			r.Post("/api/loginkeys/revoke", h.RevokeLoginKey)
+			r.Get("/api/devices/list", h.ListDevices)
+			r.Post("/api/devices/revoke", h.RevokeDevice)
+			r.Post("/api/vaultkey/set", h.SetVaultKey)
+			r.Post("/api/user/recovery", h.SetRecoveryVerifier)
+			r.Post("/api/totp/enroll", h.EnrollTOTP)
+			r.Post("/api/totp/verify", h.VerifyTOTP)
+			r.Post("/api/totp/disable", h.DisableTOTP)
+			r.Post("/api/keys/set", h.SetKeyPair)
+			r.Post("/api/keys/public", h.GetPublicKey)
+			r.Post("/api/shares/add", h.AddShare)
+			r.Get("/api/shares/list", h.ListSharesReceived)
+			r.Get("/api/shares/owned", h.ListSharesOwned)
+			r.Post("/api/shares/revoke", h.RevokeShare)
+			r.Post("/api/orgs/create", h.CreateOrg)
+			r.Post("/api/orgs/members/add", h.AddOrgMember)
+			r.Post("/api/orgs/members/remove", h.RemoveOrgMember)
+			r.Post("/api/orgs/members/list", h.ListOrgMembers)
+		})
 	})
 
 	return r
@@ -88,6 +217,11 @@ func NewService(storage Storage, authstorage AuthStorage) *WebService {
 		Storage:     storage,
 		AuthStorage: authstorage,
 		Mu:          &sync.Mutex{},
+
+		loginLimiter:    auth.NewLimiter(ipFreeLogins),
+		registerLimiter: auth.NewLimiter(ipFreeRegistrations),
+		handshakes:      auth.NewSRPHandshakes(),
+		keyChallenges:   auth.NewKeyChallenges(),
 	}
 }
 
@@ -106,31 +240,47 @@ func (h *WebService) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if data.Password == "" {
+	// the password itself is never sent, only its SRP verifier
+	if data.Verifier == nil || !data.Verifier.Valid() {
 		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Empty password field"))
+		w.Write([]byte("Wrong password verifier"))
 		return
 	}
 
-	err = h.AuthStorage.Register(data.Login, data.Password)
+	// every registration counts, so logins can't be enumerated and accounts mass-created from one address
+	ip := clientIP(r)
+	if wait := h.registerLimiter.RetryAfter(ip, time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	h.registerLimiter.Fail(ip, time.Now())
+
+	// the client certificate, if any, must be free to be bound to the new account
+	if certAuth() != "" {
+		if _, err := auth.CertLogin(h.AuthStorage, r, config.Cfg.CertMapping); err == nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+
+	err = h.AuthStorage.Register(r.Context(), data.Login, *data.Verifier)
 	switch err {
 	case auth.ErrUsernameIsTaken:
 		fmt.Println("Username is taken")
 		w.WriteHeader(http.StatusConflict)
 		return
 	case nil:
-		// Generate token
-		token, err := auth.GenerateToken(data.Login)
-		if err != nil {
-			fmt.Println("error when generating token", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		// a certificate issued to the login is bound to the new account
+		if cert, err := auth.VerifiedCert(r); err == nil && certAuth() != "" && cert.Subject.CommonName == data.Login {
+			if err := auth.BindClientCert(h.AuthStorage, r, data.Login, config.Cfg.CertMapping); err != nil {
+				log.Println("error when binding client certificate:", err)
+			}
+		}
+		// Start a session and set its tokens in "Cookies"
+		if err := h.startSession(w, r, data.Login, data.Device); err != nil {
+			sessionFailed(w, err)
 			return
 		}
-		// Set the token in "Cookies"
-		http.SetCookie(w, &http.Cookie{
-			Name:  "simplevault-auth",
-			Value: token,
-		})
 		// Return a success response
 		w.WriteHeader(http.StatusOK)
 	default:
@@ -149,17 +299,31 @@ func (h *WebService) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Throttle by address and by account before checking anything
+	ip := clientIP(r)
+	if wait := h.loginLimiter.RetryAfter(ip, time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	failures, err := h.AuthStorage.GetLoginFailures(r.Context(), data.Login)
+	if err != nil {
+		log.Println("error when getting login failures:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if wait := failures.RetryAfter(time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
 	// Verify the user's credentials
-	err = h.AuthStorage.VerifyCredentials(data.Login, data.Password)
+	serverProof, err := h.verifyCredentials(r, data)
 	switch err {
 	case nil:
 		//login and password are verified
-	case auth.ErrUserNotFound:
-		fmt.Println("Invalid login credentials:", data.Login)
-		w.WriteHeader(http.StatusUnauthorized)
-	case auth.ErrWrongPassword:
+	case auth.ErrUserNotFound, auth.ErrWrongPassword, auth.ErrHandshakeNotFound, auth.ErrWrongSRPData:
 		fmt.Println("Invalid login credentials:", data.Login)
-		w.WriteHeader(http.StatusUnauthorized)
+		h.loginFailed(w, r, ip, data.Login)
 		return
 	default:
 		fmt.Println("error when verifying login credentials:", err)
@@ -167,22 +331,58 @@ func (h *WebService) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate a token
-	token, err := auth.GenerateToken(data.Login)
-	if err != nil {
-		fmt.Println("error when generating token", err)
+	// Verify the second factor, if user has enabled it
+	err = auth.CheckSecondFactor(r.Context(), h.AuthStorage, data.Login, data.OTP)
+	switch err {
+	case nil:
+	case auth.ErrSecondFactorRequired:
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case auth.ErrWrongSecondFactor:
+		fmt.Println("Invalid second factor:", data.Login)
+		h.loginFailed(w, r, ip, data.Login)
+		return
+	default:
+		fmt.Println("error when verifying second factor:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Set the token as a cookie in the response
-	http.SetCookie(w, &http.Cookie{
-		Name:  "simplevault-auth",
-		Value: token,
-	})
+	// Verify the client certificate, if it is required along with the password
+	if certAuth() == auth.CertAuthSecondFactor {
+		err = auth.CheckClientCert(h.AuthStorage, r, data.Login, config.Cfg.CertMapping, config.Cfg.CertAutoBind)
+		switch err {
+		case nil:
+		case auth.ErrNoClientCert, auth.ErrWrongCertificate, auth.ErrCertificateIsTaken:
+			fmt.Println("Invalid client certificate:", data.Login)
+			h.loginFailed(w, r, ip, data.Login)
+			return
+		default:
+			fmt.Println("error when verifying client certificate:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.loginLimiter.Reset(ip)
+	if err := h.AuthStorage.ResetLoginFailures(r.Context(), data.Login); err != nil {
+		log.Println("error when resetting login failures:", err)
+	}
+
+	// Start a session and set its tokens as cookies in the response
+	if err := h.startSession(w, r, data.Login, data.Device); err != nil {
+		sessionFailed(w, err)
+		return
+	}
 
-	// Return a success response
+	// Return a success response with the proof of the server, legacy logins have none
+	if serverProof.Proof == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Add("Content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serverProof)
 }
 
 // AddLoginCreds sets new login credentials in a database
@@ -205,15 +405,13 @@ func (h *WebService) AddLoginCreds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Storage.SetLoginCred(username.(string), logincred)
+	err = h.Storage.SetLoginCred(r.Context(), username.(string), logincred)
 	switch err {
 	case nil:
 		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrMetanameIsTaken:
+		w.WriteHeader(http.StatusConflict)
 	default:
-		if database.IsUniqueConstraintViolation(err) {
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
 		log.Println("Unexpected case in AddLoginCreds Handler:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -239,52 +437,24 @@ func (h *WebService) AddCard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Storage.SetCard(username.(string), carddata)
+	err = h.Storage.SetCard(r.Context(), username.(string), carddata)
 	switch err {
 	case nil:
 		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrMetanameIsTaken:
+		w.WriteHeader(http.StatusConflict)
 	default:
-		if database.IsUniqueConstraintViolation(err) {
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
 		fmt.Println("Unexpected case in AddCard Handler:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
 func (h *WebService) ListCards(w http.ResponseWriter, r *http.Request) {
-	username := r.Context().Value(config.UserID("userID"))
-
-	cards, err := h.Storage.ListCards(username.(string))
-	switch err {
-	case nil:
-		w.Header().Add("Content-type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(cards)
-	case storage.ErrDataNotFound:
-		w.WriteHeader(http.StatusNoContent)
-	default:
-		log.Println("error in ListCards handler:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	h.listItems(w, r, storage.KindCard)
 }
 
 func (h *WebService) ListLoginCreds(w http.ResponseWriter, r *http.Request) {
-	username := r.Context().Value(config.UserID("userID"))
-
-	logins, err := h.Storage.ListLoginCreds(username.(string))
-	switch err {
-	case nil:
-		w.Header().Add("Content-type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(logins)
-	case storage.ErrDataNotFound:
-		w.WriteHeader(http.StatusNoContent)
-	default:
-		log.Println("error in ListCards handler:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	h.listItems(w, r, storage.KindLoginCreds)
 }
 
 func (h *WebService) GetCard(w http.ResponseWriter, r *http.Request) {
@@ -303,7 +473,7 @@ func (h *WebService) GetCard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	card, err := h.Storage.GetCard(username.(string), carddata.Name)
+	card, err := h.Storage.GetCard(r.Context(), username.(string), carddata.Name)
 
 	switch err {
 	case nil:
@@ -336,7 +506,7 @@ func (h *WebService) GetLoginCreds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logincreds, err := h.Storage.GetLoginCred(username.(string), input.Name)
+	logincreds, err := h.Storage.GetLoginCred(r.Context(), username.(string), input.Name)
 
 	switch err {
 	case nil:
@@ -369,15 +539,13 @@ func (h *WebService) AddNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Storage.SetNote(username.(string), note)
+	err = h.Storage.SetNote(r.Context(), username.(string), note)
 	switch err {
 	case nil:
 		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrMetanameIsTaken:
+		w.WriteHeader(http.StatusConflict)
 	default:
-		if database.IsUniqueConstraintViolation(err) {
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
 		log.Println("Unexpected case in AddNote Handler:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -400,7 +568,7 @@ func (h *WebService) GetNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	note, err := h.Storage.GetNote(username.(string), input.Name)
+	note, err := h.Storage.GetNote(r.Context(), username.(string), input.Name)
 
 	switch err {
 	case nil:
@@ -416,20 +584,7 @@ func (h *WebService) GetNote(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *WebService) ListNotes(w http.ResponseWriter, r *http.Request) {
-	username := r.Context().Value(config.UserID("userID"))
-
-	notes, err := h.Storage.ListNotes(username.(string))
-	switch err {
-	case nil:
-		w.Header().Add("Content-type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(notes)
-	case storage.ErrDataNotFound:
-		w.WriteHeader(http.StatusNoContent)
-	default:
-		log.Println("error in ListNotes handler:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	h.listItems(w, r, storage.KindNote)
 }
 
 func (h *WebService) AddBinary(w http.ResponseWriter, r *http.Request) {
@@ -450,15 +605,13 @@ func (h *WebService) AddBinary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Storage.SetBinary(username.(string), binary)
+	err = h.Storage.SetBinary(r.Context(), username.(string), binary)
 	switch err {
 	case nil:
 		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrMetanameIsTaken:
+		w.WriteHeader(http.StatusConflict)
 	default:
-		if database.IsUniqueConstraintViolation(err) {
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
 		log.Println("Unexpected case in AddBinary Handler:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -481,7 +634,7 @@ func (h *WebService) GetBinary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	binary, err := h.Storage.GetBinary(username.(string), input.Name)
+	binary, err := h.Storage.GetBinary(r.Context(), username.(string), input.Name)
 
 	switch err {
 	case nil:
@@ -497,18 +650,5 @@ func (h *WebService) GetBinary(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *WebService) ListBinaries(w http.ResponseWriter, r *http.Request) {
-	username := r.Context().Value(config.UserID("userID"))
-
-	notes, err := h.Storage.ListBinaries(username.(string))
-	switch err {
-	case nil:
-		w.Header().Add("Content-type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(notes)
-	case storage.ErrDataNotFound:
-		w.WriteHeader(http.StatusNoContent)
-	default:
-		log.Println("error in ListNotes handler:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	h.listItems(w, r, storage.KindBinary)
 }
@@ -1 +1,125 @@
 package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage/memstorage"
+)
+
+func newTestService() *WebService {
+	return NewService(memstorage.NewStorage(), auth.NewMemStorage())
+}
+
+// serve calls the handler as the user with body encoded to json and returns the recorded response
+func serve(t *testing.T, handler http.HandlerFunc, username string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveSession(t, handler, username, "", body)
+}
+
+// serveSession calls the handler in the session of the user
+func serveSession(t *testing.T, handler http.HandlerFunc, username string, sessionID string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-type", "application/json")
+	if username != "" {
+		ctx := context.WithValue(r.Context(), config.UserID("userID"), username)
+		ctx = context.WithValue(ctx, config.UserID("sessionID"), sessionID)
+		r = r.WithContext(ctx)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func wantStatus(t *testing.T, what string, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Errorf("%s: got status %d, want %d", what, w.Code, want)
+	}
+}
+
+// login calls Login from the address with the login data
+func login(h *WebService, addr string, data auth.LoginData) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	r := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewReader(body))
+	r.RemoteAddr = addr
+	w := httptest.NewRecorder()
+	h.Login(w, r)
+	return w
+}
+
+func wantRetryAfter(t *testing.T, what string, w *httptest.ResponseRecorder) {
+	t.Helper()
+	wantStatus(t, what, w, http.StatusTooManyRequests)
+	if wait, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || wait <= 0 {
+		t.Errorf("%s: got Retry-After %q", what, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	h := newTestService()
+	if err := h.AuthStorage.Register(ctx, "user", auth.SRPVerifier{Salt: "salt", Verifier: "verifier"}); err != nil {
+		t.Fatal(err)
+	}
+	wrong := auth.LoginData{Login: "user", Handshake: "unknown", Proof: "proof"}
+
+	wantStatus(t, "wrong proof", login(h, "192.0.2.1:1234", wrong), http.StatusUnauthorized)
+	// the account backs off after a failure from any address, before the proof is checked
+	wantRetryAfter(t, "account during backoff", login(h, "192.0.2.2:1234", wrong))
+
+	for i := 0; i < auth.MaxLoginFailures; i++ {
+		if _, err := h.AuthStorage.AddLoginFailure(ctx, "user", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failures, err := h.AuthStorage.GetLoginFailures(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures.LockedUntil.Before(time.Now()) {
+		t.Fatalf("account isn't locked after %d failures: %+v", failures.Count, failures)
+	}
+	wantRetryAfter(t, "locked account", login(h, "192.0.2.3:1234", wrong))
+}
+
+func TestLoginAddressThrottle(t *testing.T) {
+	h := newTestService()
+
+	// every login is another account, so only the address backs off
+	for i := 0; i <= ipFreeLogins; i++ {
+		data := auth.LoginData{Login: fmt.Sprintf("user%d", i), Password: "password"}
+		wantStatus(t, "unknown account", login(h, "192.0.2.1:1234", data), http.StatusUnauthorized)
+	}
+	data := auth.LoginData{Login: "other", Password: "password"}
+	wantRetryAfter(t, "throttled address", login(h, "192.0.2.1:1234", data))
+	wantStatus(t, "another address", login(h, "192.0.2.2:1234", data), http.StatusUnauthorized)
+
+	// throttled addresses can't start handshakes either
+	start := func(addr string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(auth.SRPStart{Login: "other", A: "01"})
+		r := httptest.NewRequest(http.MethodPost, "/api/user/login/start", bytes.NewReader(body))
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.LoginStart(w, r)
+		return w
+	}
+	wantRetryAfter(t, "handshake from throttled address", start("192.0.2.1:1234"))
+	if w := start("192.0.2.2:1234"); w.Code == http.StatusTooManyRequests {
+		t.Error("handshake from another address is throttled")
+	}
+}
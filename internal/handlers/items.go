@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// listItems responds with a page of names of the user's items of the kind.
+// The page is selected by sort, tag, cursor and limit query parameters,
+// the cursor of the next page is sent in X-Next-Cursor header, which is empty on the last page.
+// Names are blind indexes, so they can't be filtered by prefix, clients filter the names they reveal
+func (h *WebService) listItems(w http.ResponseWriter, r *http.Request, kind string) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	query := r.URL.Query()
+	if query.Has("prefix") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	opts := storage.ListOptions{
+		Sort:   query.Get("sort"),
+		Tag:    query.Get("tag"),
+		Cursor: query.Get("cursor"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if opts.Limit, err = strconv.Atoi(limit); err != nil || opts.Limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.Storage.ListItems(r.Context(), username, kind, opts)
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.Header().Set(storage.NextCursorHeader, page.Next)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(page.Names)
+	case storage.ErrWrongCursor:
+		w.WriteHeader(http.StatusBadRequest)
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Printf("error when listing %s: %v\n", kind, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// maxBatchItems is the most items one batch request may carry
+const maxBatchItems = 1000
+
+// decodeBatch reads the items of a batch request. If the request is malformed,
+// it responds with http.StatusBadRequest or http.StatusRequestEntityTooLarge and returns false
+func decodeBatch(w http.ResponseWriter, r *http.Request) ([]storage.Item, bool) {
+	if r.Header.Get("Content-type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	var items []storage.Item
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	if len(items) > maxBatchItems {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return items, true
+}
+
+// batch runs the items the API key scope allows through the storage in one call,
+// the others fail as forbidden. Results are in the order of the items
+func batch(r *http.Request, items []storage.Item, write bool,
+	run func(items []storage.Item) ([]storage.ItemResult, error)) ([]storage.ItemResult, error) {
+	results := make([]storage.ItemResult, len(items))
+	var allowed []storage.Item
+	var positions []int
+	scope, limited := auth.ScopeFromContext(r.Context())
+	for i, item := range items {
+		if limited && !scope.Allows(item.Kind, "", write) {
+			results[i].Kind, results[i].Name, results[i].Error = item.Kind, item.Name, storage.ItemErrForbidden
+			continue
+		}
+		allowed = append(allowed, item)
+		positions = append(positions, i)
+	}
+	if len(allowed) == 0 {
+		return results, nil
+	}
+
+	done, err := run(allowed)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range done {
+		results[positions[i]] = result
+	}
+	return results, nil
+}
+
+// serveBatch decodes a batch request, runs it with batch and responds with the result of every item
+func serveBatch(w http.ResponseWriter, r *http.Request, handler string, write bool,
+	run func(items []storage.Item) ([]storage.ItemResult, error)) {
+	items, ok := decodeBatch(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := batch(r, items, write, run)
+	if err != nil {
+		log.Printf("error in %s handler: %v\n", handler, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+// AddItems saves many items of any kinds in one transaction.
+// Responds with the result of every item, failed items don't fail the others
+func (h *WebService) AddItems(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+	serveBatch(w, r, "AddItems", true, func(items []storage.Item) ([]storage.ItemResult, error) {
+		return h.Storage.SetItems(r.Context(), username, items)
+	})
+}
+
+// GetItems returns many items of any kinds by kind and name, read in one transaction.
+// Responds with the result of every item, missing items don't fail the others
+func (h *WebService) GetItems(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+	serveBatch(w, r, "GetItems", false, func(items []storage.Item) ([]storage.ItemResult, error) {
+		return h.Storage.GetItems(r.Context(), username, items)
+	})
+}
+
+// UpdateItems replaces many existing items of any kinds in one transaction.
+// Responds with the result and the revision of every item, missing items don't fail the others
+func (h *WebService) UpdateItems(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+	serveBatch(w, r, "UpdateItems", true, func(items []storage.Item) ([]storage.ItemResult, error) {
+		return h.Storage.UpdateItems(r.Context(), username, items)
+	})
+}
+
+// DeleteItems deletes many items of any kinds by kind and name in one transaction.
+// Responds with the result and the revision of every item, missing items don't fail the others
+func (h *WebService) DeleteItems(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+	serveBatch(w, r, "DeleteItems", true, func(items []storage.Item) ([]storage.ItemResult, error) {
+		return h.Storage.DeleteItems(r.Context(), username, items)
+	})
+}
+
+// SyncChanges responds with a page of the user's change feed after the revision in since query parameter.
+// limit query parameter is the most changes of the page, 0 asks only for the current revision
+func (h *WebService) SyncChanges(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	query := r.URL.Query()
+	since, err := strconv.ParseInt(query.Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit := storage.DefaultPageSize
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := h.Storage.ListChanges(r.Context(), username, since, limit)
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(changes)
+	case storage.ErrDataNotFound:
+		// the account is deleted while the token is still valid
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in SyncChanges handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// listNotes lists the notes of the user with the query parameters
+func listNotes(h *WebService, username, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/notes?"+query, nil)
+	r = r.WithContext(context.WithValue(r.Context(), config.UserID("userID"), username))
+	w := httptest.NewRecorder()
+	h.ListNotes(w, r)
+	return w
+}
+
+func TestListItemsPaging(t *testing.T) {
+	h := newTestService()
+	ctx := context.Background()
+	for _, name := range []string{"bi1-9c0e", "bi1-1f7a", "bi1-e45b"} {
+		if err := h.Storage.SetNote(ctx, "alice", storage.EncryptedData{Name: name, Data: "data"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	query := "limit=2"
+	for i := 0; i < 3; i++ {
+		w := listNotes(h, "alice", query)
+		wantStatus(t, "list page", w, http.StatusOK)
+		var page []string
+		if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, page...)
+		next := w.Header().Get(storage.NextCursorHeader)
+		if next == "" {
+			break
+		}
+		query = "limit=2&cursor=" + next
+	}
+	if want := []string{"bi1-1f7a", "bi1-9c0e", "bi1-e45b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("pages = %v, want %v", names, want)
+	}
+
+	first := listNotes(h, "alice", "limit=1").Header().Get(storage.NextCursorHeader)
+	for _, tt := range []struct {
+		query string
+		want  int
+	}{
+		{"limit=abc", http.StatusBadRequest},
+		{"limit=0", http.StatusBadRequest},
+		{"limit=-5", http.StatusBadRequest},
+		{"limit=5000", http.StatusOK},
+		{"cursor=malformed", http.StatusBadRequest},
+		{"sort=size", http.StatusBadRequest},
+		{"sort=modified&cursor=" + first, http.StatusBadRequest},
+		{"prefix=bi1-1", http.StatusBadRequest},
+		{"sort=-modified&tag=work", http.StatusOK},
+	} {
+		wantStatus(t, tt.query, listNotes(h, "alice", tt.query), tt.want)
+	}
+}
+
+// deletedAccount is the storage of an account deleted while its token is still valid
+type deletedAccount struct {
+	Storage
+}
+
+func (deletedAccount) ListChanges(ctx context.Context, username string, since int64, limit int) (storage.Changes, error) {
+	return storage.Changes{}, storage.ErrDataNotFound
+}
+
+// syncChanges asks the change feed of the user with the query parameters
+func syncChanges(h *WebService, username, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/sync/changes?"+query, nil)
+	r = r.WithContext(context.WithValue(r.Context(), config.UserID("userID"), username))
+	w := httptest.NewRecorder()
+	h.SyncChanges(w, r)
+	return w
+}
+
+func TestSyncChanges(t *testing.T) {
+	h := newTestService()
+	if err := h.Storage.SetNote(context.Background(), "alice", storage.EncryptedData{Name: "bi1-9c0e", Data: "data"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := syncChanges(h, "alice", "since=0&limit=10")
+	wantStatus(t, "sync", w, http.StatusOK)
+	var changes storage.Changes
+	if err := json.NewDecoder(w.Body).Decode(&changes); err != nil {
+		t.Fatal(err)
+	}
+	if changes.Revision != 1 || len(changes.Changes) != 1 {
+		t.Errorf("sync: got %+v", changes)
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusBadRequest},
+		{"since=abc", http.StatusBadRequest},
+		{"since=-1", http.StatusBadRequest},
+		{"since=0&limit=abc", http.StatusBadRequest},
+		{"since=0&limit=-1", http.StatusBadRequest},
+		{"since=0&limit=0", http.StatusOK},
+		{"since=5", http.StatusOK},
+	} {
+		wantStatus(t, tt.query, syncChanges(h, "alice", tt.query), tt.want)
+	}
+
+	h.Storage = deletedAccount{h.Storage}
+	wantStatus(t, "sync of deleted account", syncChanges(h, "alice", "since=0"), http.StatusNotFound)
+}
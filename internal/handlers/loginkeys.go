@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// KeyLoginStart issues a nonce to be signed by the login key
+func (h *WebService) KeyLoginStart(w http.ResponseWriter, r *http.Request) {
+	var data auth.KeyLoginData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Login == "" || data.KeyID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if wait := h.loginLimiter.RetryAfter(clientIP(r), time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	nonce, err := h.keyChallenges.Issue(data.Login, data.KeyID)
+	switch err {
+	case nil:
+	case auth.ErrTooManyChallenges:
+		tooManyAttempts(w, auth.KeyChallengeTTL)
+		return
+	default:
+		log.Println("error in KeyLoginStart handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(auth.KeyLoginData{Login: data.Login, KeyID: data.KeyID, Nonce: nonce})
+}
+
+// KeyLogin starts a session for the signed nonce, without the password.
+// The key was registered from a session which has passed the second factor, so it isn't asked again
+// and unattended devices can log in. A client certificate is still checked if it is required
+func (h *WebService) KeyLogin(w http.ResponseWriter, r *http.Request) {
+	var data auth.KeyLoginData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Login == "" || data.Nonce == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	if wait := h.loginLimiter.RetryAfter(ip, time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	failures, err := h.AuthStorage.GetLoginFailures(r.Context(), data.Login)
+	if err != nil {
+		log.Println("error when getting login failures:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if wait := failures.RetryAfter(time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	err = h.keyChallenges.Verify(r.Context(), h.AuthStorage, data)
+	switch err {
+	case nil:
+	case auth.ErrChallengeNotFound, auth.ErrLoginKeyNotFound, auth.ErrWrongLoginKey, auth.ErrWrongKeySignature, auth.ErrWrongKeyDevice:
+		fmt.Println("Invalid login key signature:", data.Login)
+		h.loginFailed(w, r, ip, data.Login)
+		return
+	default:
+		log.Println("error in KeyLogin handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if certAuth() == auth.CertAuthSecondFactor {
+		err = auth.CheckClientCert(h.AuthStorage, r, data.Login, config.Cfg.CertMapping, config.Cfg.CertAutoBind)
+		switch err {
+		case nil:
+		case auth.ErrNoClientCert, auth.ErrWrongCertificate, auth.ErrCertificateIsTaken:
+			fmt.Println("Invalid client certificate:", data.Login)
+			h.loginFailed(w, r, ip, data.Login)
+			return
+		default:
+			log.Println("error in KeyLogin handler:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.loginLimiter.Reset(ip)
+	if err := h.AuthStorage.ResetLoginFailures(r.Context(), data.Login); err != nil {
+		log.Println("error when resetting login failures:", err)
+	}
+
+	if err := h.startSession(w, r, data.Login, data.Device); err != nil {
+		sessionFailed(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// AddLoginKey registers a login key of the current user for the device of the current session.
+// Sessions without a device can't register keys
+func (h *WebService) AddLoginKey(w http.ResponseWriter, r *http.Request) {
+	var data auth.LoginKey
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+	sessionID := r.Context().Value(config.UserID("sessionID")).(string)
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	session, err := h.AuthStorage.GetSession(r.Context(), sessionID)
+	switch {
+	case err == auth.ErrSessionNotFound:
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Println("error in AddLoginKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	case session.DeviceID == "":
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	key, err := auth.NewLoginKey(username, data.Name, data.PublicKey, session.DeviceID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.AuthStorage.AddLoginKey(r.Context(), username, key)
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(key)
+	case auth.ErrLoginKeyIsTaken:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.Println("error in AddLoginKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListLoginKeys returns login keys of the current user
+func (h *WebService) ListLoginKeys(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	keys, err := h.AuthStorage.ListLoginKeys(r.Context(), username)
+	switch {
+	case err == nil && len(keys) > 0:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(keys)
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in ListLoginKeys handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RevokeLoginKey deletes a login key of the current user
+func (h *WebService) RevokeLoginKey(w http.ResponseWriter, r *http.Request) {
+	var data auth.LoginKey
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := h.AuthStorage.DeleteLoginKey(r.Context(), username, data.ID)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case auth.ErrLoginKeyNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in RevokeLoginKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+)
+
+func TestKeyLoginFromRevokedDevice(t *testing.T) {
+	ctx := context.Background()
+	h := newTestService()
+	if err := h.AuthStorage.Register(ctx, "user", auth.SRPVerifier{Salt: "salt", Verifier: "verifier"}); err != nil {
+		t.Fatal(err)
+	}
+	laptop := &auth.Device{ID: "laptop", LastSeen: time.Now()}
+	if err := h.AuthStorage.SaveDevice(ctx, "user", *laptop); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AuthStorage.CreateSession(ctx, auth.Session{ID: "deviceless", Login: "user", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AuthStorage.CreateSession(ctx, auth.Session{ID: "session", Login: "user", ExpiresAt: time.Now().Add(time.Hour), DeviceID: "laptop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := auth.LoginKey{Name: "laptop", PublicKey: base64.StdEncoding.EncodeToString(public)}
+	wantStatus(t, "add key without a device", serveSession(t, h.AddLoginKey, "user", "deviceless", request), http.StatusBadRequest)
+	w := serveSession(t, h.AddLoginKey, "user", "session", request)
+	wantStatus(t, "add key", w, http.StatusOK)
+	var key auth.LoginKey
+	if err := json.NewDecoder(w.Body).Decode(&key); err != nil {
+		t.Fatal(err)
+	}
+	if key.DeviceID != "laptop" {
+		t.Errorf("key is bound to device %q", key.DeviceID)
+	}
+
+	keyLogin := func(device *auth.Device) int {
+		w := serve(t, h.KeyLoginStart, "", auth.KeyLoginData{Login: "user", KeyID: key.ID})
+		var challenge auth.KeyLoginData
+		if err := json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+			t.Fatal(err)
+		}
+		signature := ed25519.Sign(private, auth.KeyLoginMessage("user", challenge.Nonce))
+		return serve(t, h.KeyLogin, "", auth.KeyLoginData{
+			Login:     "user",
+			KeyID:     key.ID,
+			Nonce:     challenge.Nonce,
+			Signature: base64.StdEncoding.EncodeToString(signature),
+			Device:    device,
+		}).Code
+	}
+	if code := keyLogin(laptop); code != http.StatusOK {
+		t.Errorf("key login: got status %d", code)
+	}
+	if code := keyLogin(&auth.Device{ID: "phone"}); code != http.StatusUnauthorized {
+		t.Errorf("key login from another device: got status %d", code)
+	}
+	// the failure above backs the account off
+	if err := h.AuthStorage.ResetLoginFailures(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatus(t, "revoke device", serve(t, h.RevokeDevice, "user", auth.Device{ID: "laptop"}), http.StatusOK)
+	if code := keyLogin(laptop); code != http.StatusUnauthorized {
+		t.Errorf("key login from revoked device: got status %d", code)
+	}
+	if _, err := h.AuthStorage.GetLoginKey(ctx, "user", key.ID); err != auth.ErrLoginKeyNotFound {
+		t.Errorf("key of revoked device: got %v", err)
+	}
+}
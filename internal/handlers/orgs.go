@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// roleRank orders organization roles, bigger rank means more privileges
+var roleRank = map[string]int{
+	storage.RoleViewer: 1,
+	storage.RoleEditor: 2,
+	storage.RoleAdmin:  3,
+	storage.RoleOwner:  4,
+}
+
+// checkOrgRole checks that the user has at least minRole in the organization and returns user's role.
+// If not, it responds with http.StatusForbidden and returns false
+func (h *WebService) checkOrgRole(w http.ResponseWriter, r *http.Request, username, orgname, minRole string) (string, bool) {
+	role, err := h.Storage.GetOrgRole(r.Context(), username, orgname)
+	switch err {
+	case nil:
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	default:
+		log.Println("error when checking organization role:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return "", false
+	}
+
+	if roleRank[role] < roleRank[minRole] {
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	}
+	return role, true
+}
+
+// CreateOrg creates new organization, current user becomes its owner
+// returns http.StatusConflict if the organization name is taken
+func (h *WebService) CreateOrg(w http.ResponseWriter, r *http.Request) {
+	var org storage.Org
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&org)
+	if err != nil || org.Name == "" || org.VaultKey == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.Storage.CreateOrg(r.Context(), username.(string), org)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrMetanameIsTaken:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.Println("Unexpected case in CreateOrg Handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListOrgs returns organizations of current user with the user's role and sealed vault key
+func (h *WebService) ListOrgs(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID"))
+
+	orgs, err := h.Storage.ListOrgs(r.Context(), username.(string))
+	if scope, ok := auth.ScopeFromContext(r.Context()); ok {
+		orgs = scopeOrgs(scope, orgs)
+	}
+	switch {
+	case err == nil && len(orgs) > 0:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(orgs)
+	case err == nil, err == storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in ListOrgs handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// AddOrgMember adds a user to the organization or changes role of existing member.
+// Requires admin role, only owners can grant or change owner role.
+// Returns http.StatusConflict if it demotes the only owner
+func (h *WebService) AddOrgMember(w http.ResponseWriter, r *http.Request) {
+	var member storage.OrgMember
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&member)
+	if err != nil || member.Org == "" || member.Login == "" || member.VaultKey == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, ok := roleRank[member.Role]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	role, ok := h.checkOrgRole(w, r, username.(string), member.Org, storage.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	currentRole, err := h.Storage.GetOrgRole(r.Context(), member.Login, member.Org)
+	if err != nil && err != storage.ErrDataNotFound {
+		log.Println("error in AddOrgMember handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if (member.Role == storage.RoleOwner || currentRole == storage.RoleOwner) && role != storage.RoleOwner {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	_, err = h.Storage.GetKeyPair(r.Context(), member.Login)
+	switch err {
+	case nil:
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	default:
+		log.Println("error in AddOrgMember handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Storage.SetOrgMember(r.Context(), member)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrLastOwner:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.Println("Unexpected case in AddOrgMember Handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RemoveOrgMember removes a member from the organization and rotates the organization key.
+// The request carries the new key sealed for every remaining member and the items encrypted with it,
+// returns http.StatusConflict if members or items changed meanwhile or the member is the only owner.
+// Requires admin role, only owners can remove owners
+func (h *WebService) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	var rotation storage.OrgRotation
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&rotation)
+	if err != nil || rotation.Org == "" || rotation.Login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, member := range rotation.Members {
+		if member.Login == "" || member.VaultKey == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	for _, item := range rotation.Items {
+		if item.Name == "" || item.Data == "" || !validKind(item.Kind) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	role, ok := h.checkOrgRole(w, r, username.(string), rotation.Org, storage.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	currentRole, err := h.Storage.GetOrgRole(r.Context(), rotation.Login, rotation.Org)
+	switch {
+	case err == storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case err != nil:
+		log.Println("error in RemoveOrgMember handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	case currentRole == storage.RoleOwner && role != storage.RoleOwner:
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err = h.Storage.RotateOrgKey(r.Context(), rotation)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case storage.ErrOrgChanged, storage.ErrLastOwner:
+		w.WriteHeader(http.StatusConflict)
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in RemoveOrgMember handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListOrgMembers returns members of the organization and their roles
+func (h *WebService) ListOrgMembers(w http.ResponseWriter, r *http.Request) {
+	var input storage.OrgMember
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Org == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := h.checkOrgRole(w, r, username.(string), input.Org, storage.RoleViewer); !ok {
+		return
+	}
+
+	members, err := h.Storage.ListOrgMembers(r.Context(), input.Org)
+	if err != nil {
+		log.Println("error in ListOrgMembers handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(members)
+}
+
+// AddOrgItem saves new item in the organization vault. Requires editor role
+func (h *WebService) AddOrgItem(w http.ResponseWriter, r *http.Request) {
+	var item storage.OrgItem
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil || item.Org == "" || item.Name == "" || !validKind(item.Kind) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !allowedByScope(w, r, item.Kind, item.Org, true) {
+		return
+	}
+	if _, ok := h.checkOrgRole(w, r, username.(string), item.Org, storage.RoleEditor); !ok {
+		return
+	}
+
+	err = h.Storage.SetOrgItem(r.Context(), item)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrMetanameIsTaken:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.Println("Unexpected case in AddOrgItem Handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// UpdateOrgItem replaces the data of an item in the organization vault. Requires editor role
+func (h *WebService) UpdateOrgItem(w http.ResponseWriter, r *http.Request) {
+	var item storage.OrgItem
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil || item.Org == "" || item.Name == "" || item.Data == "" || !validKind(item.Kind) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !allowedByScope(w, r, item.Kind, item.Org, true) {
+		return
+	}
+	if _, ok := h.checkOrgRole(w, r, username.(string), item.Org, storage.RoleEditor); !ok {
+		return
+	}
+
+	err = h.Storage.UpdateOrgItem(r.Context(), item)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in UpdateOrgItem handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// DeleteOrgItem removes an item from the organization vault. Requires editor role
+func (h *WebService) DeleteOrgItem(w http.ResponseWriter, r *http.Request) {
+	var item storage.OrgItem
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil || item.Org == "" || item.Name == "" || !validKind(item.Kind) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !allowedByScope(w, r, item.Kind, item.Org, true) {
+		return
+	}
+	if _, ok := h.checkOrgRole(w, r, username.(string), item.Org, storage.RoleEditor); !ok {
+		return
+	}
+
+	err = h.Storage.DeleteOrgItem(r.Context(), item.Org, item.Kind, item.Name)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in DeleteOrgItem handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetOrgItem returns an item of the organization vault. Requires viewer role
+func (h *WebService) GetOrgItem(w http.ResponseWriter, r *http.Request) {
+	var input storage.OrgItem
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Org == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !allowedByScope(w, r, input.Kind, input.Org, false) {
+		return
+	}
+	if _, ok := h.checkOrgRole(w, r, username.(string), input.Org, storage.RoleViewer); !ok {
+		return
+	}
+
+	item, err := h.Storage.GetOrgItem(r.Context(), input.Org, input.Kind, input.Name)
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(item)
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in GetOrgItem handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListOrgItems returns kinds and names of items in the organization vault. Requires viewer role
+func (h *WebService) ListOrgItems(w http.ResponseWriter, r *http.Request) {
+	var input storage.OrgItem
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Org == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !allowedByScope(w, r, "", input.Org, false) {
+		return
+	}
+	if _, ok := h.checkOrgRole(w, r, username.(string), input.Org, storage.RoleViewer); !ok {
+		return
+	}
+
+	items, err := h.Storage.ListOrgItems(r.Context(), input.Org)
+	if scope, ok := auth.ScopeFromContext(r.Context()); ok {
+		items = scopeOrgItems(scope, input.Org, items)
+	}
+	switch {
+	case err == nil && len(items) > 0:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(items)
+	case err == nil, err == storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in ListOrgItems handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
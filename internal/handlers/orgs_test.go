@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// newOrg creates the organization of owner with members of the given roles, every member has a key pair
+func newOrg(t *testing.T, h *WebService, org string, owner string, members map[string]string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := h.Storage.CreateOrg(ctx, owner, storage.Org{Name: org, VaultKey: "sealed"}); err != nil {
+		t.Fatal(err)
+	}
+	for login, role := range members {
+		if err := h.Storage.SetKeyPair(ctx, login, storage.KeyPair{PublicKey: "public"}); err != nil {
+			t.Fatal(err)
+		}
+		if role == "" {
+			continue
+		}
+		if err := h.Storage.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: login, Role: role, VaultKey: "sealed"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAddOrgMemberRoles(t *testing.T) {
+	h := newTestService()
+	newOrg(t, h, "team", "owner", map[string]string{
+		"admin":  storage.RoleAdmin,
+		"editor": storage.RoleEditor,
+		"viewer": storage.RoleViewer,
+		"other":  storage.RoleOwner,
+		"guest":  "",
+	})
+
+	tests := []struct {
+		name   string
+		user   string
+		member storage.OrgMember
+		want   int
+	}{
+		{"viewer can't add", "viewer", storage.OrgMember{Login: "guest", Role: storage.RoleViewer}, http.StatusForbidden},
+		{"editor can't add", "editor", storage.OrgMember{Login: "guest", Role: storage.RoleViewer}, http.StatusForbidden},
+		{"outsider can't add", "guest", storage.OrgMember{Login: "guest", Role: storage.RoleViewer}, http.StatusForbidden},
+		{"admin can't grant owner", "admin", storage.OrgMember{Login: "guest", Role: storage.RoleOwner}, http.StatusForbidden},
+		{"admin can't change owner", "admin", storage.OrgMember{Login: "other", Role: storage.RoleViewer}, http.StatusForbidden},
+		{"unknown role", "owner", storage.OrgMember{Login: "guest", Role: "superuser"}, http.StatusBadRequest},
+		{"user without key pair", "owner", storage.OrgMember{Login: "nobody", Role: storage.RoleViewer}, http.StatusNotFound},
+		{"admin adds editor", "admin", storage.OrgMember{Login: "guest", Role: storage.RoleEditor}, http.StatusAccepted},
+		{"owner grants owner", "owner", storage.OrgMember{Login: "admin", Role: storage.RoleOwner}, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.member.Org, tt.member.VaultKey = "team", "sealed"
+			wantStatus(t, "add member", serve(t, h.AddOrgMember, tt.user, tt.member), tt.want)
+		})
+	}
+
+	role, err := h.Storage.GetOrgRole(context.Background(), "guest", "team")
+	if err != nil || role != storage.RoleEditor {
+		t.Errorf("role of added member: got %q, %v", role, err)
+	}
+}
+
+func TestRemoveOrgMemberRoles(t *testing.T) {
+	ctx := context.Background()
+	h := newTestService()
+	newOrg(t, h, "team", "owner", map[string]string{
+		"admin":  storage.RoleAdmin,
+		"editor": storage.RoleEditor,
+		"viewer": storage.RoleViewer,
+	})
+	if err := h.Storage.SetOrgItem(ctx, storage.OrgItem{Org: "team", Kind: storage.KindNote, Name: "n", Data: "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotation := func(login string, members ...string) storage.OrgRotation {
+		r := storage.OrgRotation{
+			Org:   "team",
+			Login: login,
+			Items: []storage.OrgItem{{Org: "team", Kind: storage.KindNote, Name: "n", Data: "new"}},
+		}
+		for _, member := range members {
+			r.Members = append(r.Members, storage.OrgMember{Org: "team", Login: member, VaultKey: "rotated"})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		rotation storage.OrgRotation
+		want     int
+	}{
+		{"viewer can't remove", "viewer", rotation("editor", "owner", "admin", "viewer"), http.StatusForbidden},
+		{"editor can't remove", "editor", rotation("viewer", "owner", "admin", "editor"), http.StatusForbidden},
+		{"admin can't remove owner", "admin", rotation("owner", "admin", "editor", "viewer"), http.StatusForbidden},
+		{"not a member", "admin", rotation("nobody", "owner", "admin", "editor", "viewer"), http.StatusNotFound},
+		{"missing key", "admin", storage.OrgRotation{Org: "team", Login: "viewer", Members: []storage.OrgMember{{Login: "owner"}}}, http.StatusBadRequest},
+		{"stale members", "admin", rotation("viewer", "owner", "admin"), http.StatusConflict},
+		{"admin removes viewer", "admin", rotation("viewer", "owner", "admin", "editor"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantStatus(t, "remove member", serve(t, h.RemoveOrgMember, tt.user, tt.rotation), tt.want)
+		})
+	}
+
+	if _, err := h.Storage.GetOrgRole(ctx, "viewer", "team"); err != storage.ErrDataNotFound {
+		t.Errorf("role of removed member: got %v", err)
+	}
+	orgs, err := h.Storage.ListOrgs(ctx, "editor")
+	if err != nil || len(orgs) != 1 || orgs[0].VaultKey != "rotated" {
+		t.Errorf("key of remaining member: got %+v, %v", orgs, err)
+	}
+	item, err := h.Storage.GetOrgItem(ctx, "team", storage.KindNote, "n")
+	if err != nil || item.Data != "new" {
+		t.Errorf("item after rotation: got %+v, %v", item, err)
+	}
+}
+
+func TestLastOrgOwner(t *testing.T) {
+	ctx := context.Background()
+	h := newTestService()
+	newOrg(t, h, "team", "owner", map[string]string{"owner": "", "admin": storage.RoleAdmin})
+
+	demote := storage.OrgMember{Org: "team", Login: "owner", Role: storage.RoleAdmin, VaultKey: "sealed"}
+	wantStatus(t, "demote the last owner", serve(t, h.AddOrgMember, "owner", demote), http.StatusConflict)
+	leave := storage.OrgRotation{Org: "team", Login: "owner", Members: []storage.OrgMember{{Org: "team", Login: "admin", VaultKey: "rotated"}}}
+	wantStatus(t, "remove the last owner", serve(t, h.RemoveOrgMember, "owner", leave), http.StatusConflict)
+	if role, err := h.Storage.GetOrgRole(ctx, "owner", "team"); err != nil || role != storage.RoleOwner {
+		t.Fatalf("role of the last owner: got %q, %v", role, err)
+	}
+
+	// with another owner the first one can step down
+	promote := storage.OrgMember{Org: "team", Login: "admin", Role: storage.RoleOwner, VaultKey: "sealed"}
+	wantStatus(t, "grant owner", serve(t, h.AddOrgMember, "owner", promote), http.StatusAccepted)
+	wantStatus(t, "demote an owner of two", serve(t, h.AddOrgMember, "owner", demote), http.StatusAccepted)
+	if role, err := h.Storage.GetOrgRole(ctx, "owner", "team"); err != nil || role != storage.RoleAdmin {
+		t.Errorf("role of demoted owner: got %q, %v", role, err)
+	}
+}
+
+func TestOrgItemChanges(t *testing.T) {
+	ctx := context.Background()
+	h := newTestService()
+	newOrg(t, h, "team", "owner", map[string]string{
+		"editor": storage.RoleEditor,
+		"viewer": storage.RoleViewer,
+		"guest":  "",
+	})
+	if err := h.Storage.SetOrgItem(ctx, storage.OrgItem{Org: "team", Kind: storage.KindNote, Name: "n", Data: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	item := storage.OrgItem{Org: "team", Kind: storage.KindNote, Name: "n", Data: "new"}
+	missing := storage.OrgItem{Org: "team", Kind: storage.KindNote, Name: "missing", Data: "new"}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		user    string
+		item    storage.OrgItem
+		want    int
+	}{
+		{"viewer can't update", h.UpdateOrgItem, "viewer", item, http.StatusForbidden},
+		{"outsider can't update", h.UpdateOrgItem, "guest", item, http.StatusForbidden},
+		{"update without data", h.UpdateOrgItem, "editor", storage.OrgItem{Org: "team", Kind: storage.KindNote, Name: "n"}, http.StatusBadRequest},
+		{"update missing item", h.UpdateOrgItem, "editor", missing, http.StatusNotFound},
+		{"editor updates", h.UpdateOrgItem, "editor", item, http.StatusAccepted},
+		{"viewer can't delete", h.DeleteOrgItem, "viewer", item, http.StatusForbidden},
+		{"delete missing item", h.DeleteOrgItem, "editor", missing, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantStatus(t, tt.name, serve(t, tt.handler, tt.user, tt.item), tt.want)
+		})
+	}
+
+	got, err := h.Storage.GetOrgItem(ctx, "team", storage.KindNote, "n")
+	if err != nil || got.Data != "new" {
+		t.Fatalf("item after update: got %+v, %v", got, err)
+	}
+	wantStatus(t, "editor deletes", serve(t, h.DeleteOrgItem, "editor", item), http.StatusOK)
+	if _, err := h.Storage.GetOrgItem(ctx, "team", storage.KindNote, "n"); err != storage.ErrDataNotFound {
+		t.Errorf("item after delete: got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// proveKeyChange lets the current user replace the keys the password is reset with only after
+// proving the password, so a stolen session can't take the account over. Responds with 403 otherwise
+func (h *WebService) proveKeyChange(w http.ResponseWriter, r *http.Request, login string, handshake string, proof string) bool {
+	if handshake == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	return h.confirmPassword(w, r, login, auth.AccountData{Handshake: handshake, Proof: proof})
+}
+
+// SetVaultKey saves current user's vault key, wrapped on the client side
+func (h *WebService) SetVaultKey(w http.ResponseWriter, r *http.Request) {
+	var data auth.VaultKeyData
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Kind == "" || data.Key == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !h.proveKeyChange(w, r, username.(string), data.Handshake, data.Proof) {
+		return
+	}
+
+	err = h.AuthStorage.SetVaultKey(r.Context(), username.(string), data.Kind, data.Key)
+	if err != nil {
+		log.Println("error in SetVaultKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GetVaultKey returns current user's wrapped vault key of requested kind
+func (h *WebService) GetVaultKey(w http.ResponseWriter, r *http.Request) {
+	var data auth.VaultKeyData
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Kind == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	data.Key, err = h.AuthStorage.GetVaultKey(r.Context(), username.(string), data.Kind)
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(data)
+	case auth.ErrVaultKeyNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in GetVaultKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// SetRecoveryVerifier saves the recovery token of current user, the password is reset with it.
+// The token is derived from the vault key on the client, the server can't check it, so replacing it
+// needs the password
+func (h *WebService) SetRecoveryVerifier(w http.ResponseWriter, r *http.Request) {
+	var data auth.ResetData
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !h.proveKeyChange(w, r, username.(string), data.Handshake, data.Proof) {
+		return
+	}
+
+	err = h.AuthStorage.SetRecoveryVerifier(r.Context(), username.(string), data.Token)
+	if err != nil {
+		log.Println("error in SetRecoveryVerifier handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password for a user who has recovered the vault key
+// and logs the user in
+func (h *WebService) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var data auth.ResetData
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Login == "" || data.Token == "" || !data.Verifier.Valid() || data.VaultKey == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.AuthStorage.ResetPassword(r.Context(), data)
+	switch err {
+	case nil:
+	case auth.ErrUserNotFound, auth.ErrWrongRecoveryToken:
+		log.Println("Invalid recovery attempt:", data.Login)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	default:
+		log.Println("error when resetting password:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// sessions started with the old password are revoked
+	if err := h.AuthStorage.RevokeAllSessions(r.Context(), data.Login); err != nil {
+		log.Println("error when revoking sessions:", err)
+	}
+	if err := h.startSession(w, r, data.Login, data.Device); err != nil {
+		sessionFailed(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetRecoveryVaultKey returns the vault key wrapped by the recovery key of the user with requested login.
+// It is available without authentication, as only the recovery key holder can unwrap it
+func (h *WebService) GetRecoveryVaultKey(w http.ResponseWriter, r *http.Request) {
+	var input auth.LoginData
+
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil || input.Login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	wrapped, err := h.AuthStorage.GetVaultKey(r.Context(), input.Login, auth.VaultKeyRecovery)
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(auth.VaultKeyData{Kind: auth.VaultKeyRecovery, Key: wrapped})
+	case auth.ErrVaultKeyNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in GetRecoveryVaultKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/auth"
+)
+
+// proveAccount proves the password of the user with SRP handshake as the client does
+func proveAccount(t *testing.T, h *WebService, login, password string) auth.SRPProof {
+	t.Helper()
+	client, err := auth.NewSRPClient(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(t, h.LoginStart, "", client.Start())
+	wantStatus(t, "login start", w, http.StatusOK)
+	var challenge auth.SRPChallenge
+	if err := json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+	proof, err := client.Proof(password, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+// A stolen session must not be enough to replace the keys the password is reset with
+func TestKeyChangesNeedPassword(t *testing.T) {
+	ctx := context.Background()
+	h := newTestService()
+	verifier, err := auth.NewSRPVerifier("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AuthStorage.Register(ctx, "user", verifier); err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{auth.VaultKeyPassword, auth.VaultKeyRecovery} {
+		if err := h.AuthStorage.SetVaultKey(ctx, "user", kind, "old"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.AuthStorage.SetRecoveryVerifier(ctx, "user", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kind := range []string{auth.VaultKeyPassword, auth.VaultKeyRecovery} {
+		w := serve(t, h.SetVaultKey, "user", auth.VaultKeyData{Kind: kind, Key: "attacker"})
+		wantStatus(t, "set "+kind+" vault key with a session", w, http.StatusForbidden)
+	}
+	w := serve(t, h.SetRecoveryVerifier, "user", auth.ResetData{Token: "attacker"})
+	wantStatus(t, "set recovery token with a session", w, http.StatusForbidden)
+
+	reset := auth.ResetData{Login: "user", Token: "attacker", Verifier: verifier, VaultKey: "attacker"}
+	if err := h.AuthStorage.ResetPassword(ctx, reset); err != auth.ErrWrongRecoveryToken {
+		t.Fatalf("reset with the token of the attacker: got %v", err)
+	}
+	for _, kind := range []string{auth.VaultKeyPassword, auth.VaultKeyRecovery} {
+		if key, _ := h.AuthStorage.GetVaultKey(ctx, "user", kind); key != "old" {
+			t.Errorf("%s vault key is replaced with %q", kind, key)
+		}
+	}
+
+	proof := proveAccount(t, h, "user", "password")
+	w = serve(t, h.SetRecoveryVerifier, "user", auth.ResetData{Token: "new", Handshake: proof.Handshake, Proof: proof.Proof})
+	wantStatus(t, "set recovery token with the password", w, http.StatusAccepted)
+	proof = proveAccount(t, h, "user", "password")
+	w = serve(t, h.SetVaultKey, "user", auth.VaultKeyData{Kind: auth.VaultKeyRecovery, Key: "new", Handshake: proof.Handshake, Proof: proof.Proof})
+	wantStatus(t, "set vault key with the password", w, http.StatusAccepted)
+	if key, _ := h.AuthStorage.GetVaultKey(ctx, "user", auth.VaultKeyRecovery); key != "new" {
+		t.Errorf("recovery vault key = %q, want new", key)
+	}
+
+	// a proof is good for one change only, wrong passwords count as failed logins
+	w = serve(t, h.SetVaultKey, "user", auth.VaultKeyData{Kind: auth.VaultKeyPassword, Key: "attacker", Handshake: proof.Handshake, Proof: proof.Proof})
+	wantStatus(t, "reused proof", w, http.StatusForbidden)
+	if failures, _ := h.AuthStorage.GetLoginFailures(ctx, "user"); failures.Count != 1 {
+		t.Errorf("failures after reused proof = %d, want 1", failures.Count)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// startSession registers the device the user logs in from, creates a new session on it
+// and sets its tokens as cookies. Clients may not tell the device, such sessions aren't bound to any
+func (h *WebService) startSession(w http.ResponseWriter, r *http.Request, login string, device *auth.Device) error {
+	var deviceID string
+	if device != nil && device.Valid() {
+		device.IP = clientIP(r)
+		device.LastSeen = time.Now()
+		if err := h.AuthStorage.SaveDevice(r.Context(), login, *device); err != nil {
+			return err
+		}
+		deviceID = device.ID
+	}
+
+	access, refresh, err := auth.NewSession(r.Context(), h.AuthStorage, login, deviceID)
+	if err != nil {
+		return err
+	}
+	setSessionCookies(w, access, refresh)
+	return nil
+}
+
+// sessionFailed responds to the error of startSession. Revoked devices stay revoked,
+// the client has to log in as a new device
+func sessionFailed(w http.ResponseWriter, err error) {
+	if err == auth.ErrDeviceRevoked {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	log.Println("error when starting session", err)
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func setSessionCookies(w http.ResponseWriter, access, refresh string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.AccessCookie,
+		Value:    access,
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.RefreshCookie,
+		Value:    refresh,
+		Path:     "/api/user/refresh",
+		MaxAge:   int(auth.RefreshTokenTTL.Seconds()),
+		HttpOnly: true,
+	})
+}
+
+// Refresh issues a new access token and rotates the refresh token
+func (h *WebService) Refresh(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(auth.RefreshCookie)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	access, refresh, err := auth.RefreshSession(r.Context(), h.AuthStorage, cookie.Value)
+	switch err {
+	case nil:
+	case auth.ErrSessionNotFound, auth.ErrSessionRevoked, auth.ErrWrongRefreshToken:
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	default:
+		log.Println("error in Refresh handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setSessionCookies(w, access, refresh)
+	h.touchSessionDevice(r, refresh)
+	w.WriteHeader(http.StatusOK)
+}
+
+// touchSessionDevice saves the time and address the device of the session was seen last
+func (h *WebService) touchSessionDevice(r *http.Request, refresh string) {
+	id, _, _ := strings.Cut(refresh, ".")
+	session, err := h.AuthStorage.GetSession(r.Context(), id)
+	if err != nil || session.DeviceID == "" {
+		return
+	}
+	if err := h.AuthStorage.TouchDevice(r.Context(), session.Login, session.DeviceID, clientIP(r), time.Now()); err != nil {
+		log.Println("error when saving device last seen:", err)
+	}
+}
+
+// Logout revokes the current session
+func (h *WebService) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Context().Value(config.UserID("sessionID")).(string)
+
+	if err := h.AuthStorage.RevokeSession(r.Context(), sessionID); err != nil {
+		log.Println("error in Logout handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// LogoutAll revokes all sessions of the current user on all devices
+func (h *WebService) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if err := h.AuthStorage.RevokeAllSessions(r.Context(), username); err != nil {
+		log.Println("error in LogoutAll handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// JWKS publishes public keys verifying access tokens, so other services can check them
+func (h *WebService) JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := auth.Keys()
+	if err != nil {
+		log.Println("error in JWKS handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(keys.JWKS()); err != nil {
+		log.Println("error in JWKS handler:", err)
+	}
+}
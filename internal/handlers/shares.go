@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// SetKeyPair saves user's public key and private key wrapped by the vault key.
+// Key pair is set once, returns http.StatusConflict if user already has one
+func (h *WebService) SetKeyPair(w http.ResponseWriter, r *http.Request) {
+	var keys storage.KeyPair
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&keys)
+	if err != nil || keys.PublicKey == "" || keys.PrivateKey == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.Storage.SetKeyPair(r.Context(), username.(string), keys)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case storage.ErrMetanameIsTaken:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.Println("Unexpected case in SetKeyPair Handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetKeyPair returns current user's key pair
+func (h *WebService) GetKeyPair(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID"))
+
+	keys, err := h.Storage.GetKeyPair(r.Context(), username.(string))
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(keys)
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in GetKeyPair handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetPublicKey returns public key of the user with requested login
+func (h *WebService) GetPublicKey(w http.ResponseWriter, r *http.Request) {
+	var input auth.LoginData
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil || input.Login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	keys, err := h.Storage.GetKeyPair(r.Context(), input.Login)
+	switch err {
+	case nil:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(storage.KeyPair{PublicKey: keys.PublicKey})
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in GetPublicKey handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// AddShare saves an item shared by current user with share.Recipient
+// returns http.StatusNotFound if recipient doesn't exist or has no public key yet
+func (h *WebService) AddShare(w http.ResponseWriter, r *http.Request) {
+	var share storage.Share
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&share)
+	if err != nil || !validShare(share) || share.Data == "" || share.Key == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if share.Recipient == username.(string) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.Storage.GetKeyPair(r.Context(), share.Recipient)
+	switch err {
+	case nil:
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	default:
+		log.Println("error in AddShare handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Storage.SetShare(r.Context(), username.(string), share)
+	if err != nil {
+		log.Println("Unexpected case in AddShare Handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ListSharesReceived returns items shared with current user
+func (h *WebService) ListSharesReceived(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID"))
+
+	shares, err := h.Storage.ListSharesReceived(r.Context(), username.(string))
+	switch {
+	case err == nil && len(shares) > 0:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(shares)
+	case err == nil, err == storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in ListSharesReceived handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListSharesOwned returns items current user has shared with others
+func (h *WebService) ListSharesOwned(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID"))
+
+	shares, err := h.Storage.ListSharesOwned(r.Context(), username.(string))
+	switch {
+	case err == nil && len(shares) > 0:
+		w.Header().Add("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(shares)
+	case err == nil, err == storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Println("error in ListSharesOwned handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RevokeShare deletes a share made by current user
+func (h *WebService) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	var share storage.Share
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID"))
+
+	err := json.NewDecoder(r.Body).Decode(&share)
+	if err != nil || !validShare(share) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.Storage.DeleteShare(r.Context(), username.(string), share)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case storage.ErrDataNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		log.Println("error in RevokeShare handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func validShare(share storage.Share) bool {
+	if share.Recipient == "" || share.Name == "" {
+		return false
+	}
+	return validKind(share.Kind)
+}
+
+// validKind checks if items of the kind can be shared with other users
+func validKind(kind string) bool {
+	switch kind {
+	case storage.KindCard, storage.KindLoginCreds, storage.KindNote:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// LoginStart starts SRP handshake of the login, the client answers with the proof of the password to Login
+func (h *WebService) LoginStart(w http.ResponseWriter, r *http.Request) {
+	var start auth.SRPStart
+	if err := json.NewDecoder(r.Body).Decode(&start); err != nil || start.Login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// handshakes aren't counted as failures, but throttled logins can't start them
+	if wait := h.loginLimiter.RetryAfter(clientIP(r), time.Now()); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	challenge, err := h.handshakes.Start(r.Context(), h.AuthStorage, start)
+	switch err {
+	case nil:
+	case auth.ErrWrongSRPData:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case auth.ErrTooManyHandshakes:
+		tooManyAttempts(w, auth.SRPHandshakeTTL)
+		return
+	default:
+		log.Println("error in LoginStart handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// verifyCredentials checks SRP proof of the login and returns the proof of the server.
+// Legacy accounts without verifier send the password instead, if the user allows the client to
+func (h *WebService) verifyCredentials(r *http.Request, data auth.LoginData) (auth.SRPProof, error) {
+	if data.Handshake != "" {
+		return h.handshakes.Finish(data.Login, auth.SRPProof{Handshake: data.Handshake, Proof: data.Proof})
+	}
+
+	// accounts with verifier never take the password, so it can't be phished out of old clients
+	_, err := h.AuthStorage.GetVerifier(r.Context(), data.Login)
+	switch err {
+	case auth.ErrVerifierNotFound:
+	case nil:
+		return auth.SRPProof{}, auth.ErrWrongPassword
+	default:
+		return auth.SRPProof{}, err
+	}
+	return auth.SRPProof{}, h.AuthStorage.VerifyCredentials(r.Context(), data.Login, data.Password)
+}
+
+// SetVerifier saves SRP verifier of a legacy account, replacing its password hash.
+// Verifiers are changed only by password reset afterwards
+func (h *WebService) SetVerifier(w http.ResponseWriter, r *http.Request) {
+	var verifier auth.SRPVerifier
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	if err := json.NewDecoder(r.Body).Decode(&verifier); err != nil || !verifier.Valid() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.AuthStorage.GetVerifier(r.Context(), username)
+	switch err {
+	case auth.ErrVerifierNotFound:
+	case nil:
+		w.WriteHeader(http.StatusConflict)
+		return
+	default:
+		log.Println("error in SetVerifier handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.AuthStorage.SetVerifier(r.Context(), username, verifier); err != nil {
+		log.Println("error in SetVerifier handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
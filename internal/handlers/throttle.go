@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// failed logins from one address before backoff starts, addresses may be shared behind NAT
+	ipFreeLogins = 10
+	// registrations from one address before backoff starts
+	ipFreeRegistrations = 5
+)
+
+// loginFailed counts the failed login for the address and the account and responds with 401
+func (h *WebService) loginFailed(w http.ResponseWriter, r *http.Request, ip string, login string) {
+	h.countLoginFailure(r, ip, login)
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// countLoginFailure counts the failed password check for the address and the account
+func (h *WebService) countLoginFailure(r *http.Request, ip string, login string) {
+	now := time.Now()
+	h.loginLimiter.Fail(ip, now)
+	failures, err := h.AuthStorage.AddLoginFailure(r.Context(), login, now)
+	if err != nil {
+		log.Println("error when counting login failure:", err)
+	} else if !failures.LockedUntil.Before(now) {
+		log.Printf("account %s is locked until %s", login, failures.LockedUntil.Format(time.RFC3339))
+	}
+}
+
+// tooManyAttempts responds with 429 and Retry-After header in seconds
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+// clientIP returns the address of the client without port.
+// Forwarding headers are not trusted, so a client can't pick its address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
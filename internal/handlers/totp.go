@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/config"
+)
+
+// EnrollTOTP generates a new TOTP secret for current user and returns it with otpauth URI.
+// Two-factor authentication is not enabled until the code is verified with VerifyTOTP
+func (h *WebService) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	_, enabled, err := h.AuthStorage.GetTOTP(r.Context(), username)
+	if err != nil && err != auth.ErrTOTPNotEnabled {
+		log.Println("error in EnrollTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Println("error in EnrollTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = h.AuthStorage.SetTOTP(r.Context(), username, secret)
+	if err != nil {
+		log.Println("error in EnrollTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(auth.TOTPData{
+		Secret: secret,
+		URI:    auth.TOTPURI(username, secret),
+	})
+}
+
+// VerifyTOTP checks the code from authenticator app against enrolled secret,
+// enables two-factor authentication and returns one-time backup codes
+func (h *WebService) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	var data auth.TOTPData
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, err := h.AuthStorage.GetTOTP(r.Context(), username)
+	switch err {
+	case nil:
+	case auth.ErrTOTPNotEnabled:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	default:
+		log.Println("error in VerifyTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if !auth.ValidateTOTP(secret, data.Code, time.Now()) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := auth.GenerateBackupCodes()
+	if err != nil {
+		log.Println("error in VerifyTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = h.AuthStorage.EnableTOTP(r.Context(), username, codes)
+	if err != nil {
+		log.Println("error in VerifyTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(auth.TOTPData{BackupCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off. Requires a valid TOTP or backup code
+func (h *WebService) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var data auth.TOTPData
+
+	contentType := r.Header.Get("Content-type")
+	if contentType != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := r.Context().Value(config.UserID("userID")).(string)
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, enabled, err := h.AuthStorage.GetTOTP(r.Context(), username)
+	if err != nil && err != auth.ErrTOTPNotEnabled {
+		log.Println("error in DisableTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !enabled {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = auth.CheckSecondFactor(r.Context(), h.AuthStorage, username, data.Code)
+	switch err {
+	case nil:
+	case auth.ErrWrongSecondFactor:
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	default:
+		log.Println("error in DisableTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = h.AuthStorage.DisableTOTP(r.Context(), username)
+	if err != nil {
+		log.Println("error in DisableTOTP handler:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/securebuf"
 	"github.com/gambruh/simplevault/internal/storage"
 )
 
@@ -48,103 +49,16 @@ func CreateMapFromList(list []string) (outputMap map[string]struct{}) {
 	return outputMap
 }
 
+// EncryptCardData encrypts storage.Card and returns base64 string to be stored in a database.
+// The name isn't sealed, the server keeps it hidden, the first field is left empty
 func EncryptCardData(card storage.Card, key []byte) (string, error) {
-	// concatenating card to string
-	cardStr := card.Cardname + "," + card.Number + "," + card.Name + "," + card.Surname + "," + card.ValidTill + "," + card.Code
-
-	// encrypting the card data
-	encrypted, err := encrypt.EncryptData([]byte(cardStr), key)
-	if err != nil {
-		return "", err
-	}
-	// Encode the encrypted password in base64 for storage
-	encodedData := base64.StdEncoding.EncodeToString(encrypted)
-
-	return encodedData, nil
-}
-
-// DecryptCardData returns storage.Card struct out of encrypted data received from database
-func DecryptCardData(encrCard storage.EncryptedData, key []byte) (storage.Card, error) {
-	var card storage.Card
-	decodedData, err := base64.StdEncoding.DecodeString(encrCard.Data)
-	if err != nil {
-		return storage.Card{}, err
-	}
-
-	decryptedData, err := encrypt.DecryptData(decodedData, key)
-	if err != nil {
-		return storage.Card{}, err
-	}
-
-	dst := string(decryptedData)
-
-	cardArr := strings.Split(dst, ",")
-
-	for i, data := range cardArr {
-		switch i {
-		case 0:
-			card.Cardname = encrCard.Name
-		case 1:
-			card.Number = data
-		case 2:
-			card.Name = data
-		case 3:
-			card.Surname = data
-		case 4:
-			card.ValidTill = data
-		case 5:
-			card.Code = data
-		}
-	}
-	return card, nil
+	return SealFields(key, "", card.Number, card.Name, card.Surname, card.ValidTill, card.Code)
 }
 
+// EncryptLoginCredsData encrypts storage.LoginCreds and returns base64 string to be stored in a database.
+// The name isn't sealed, like in EncryptCardData
 func EncryptLoginCredsData(logincred storage.LoginCreds, key []byte) (string, error) {
-	// concatenating data to string
-	logincredStr := logincred.Name + "," + logincred.Site + "," + logincred.Login + "," + logincred.Password
-
-	// encrypting the data
-	encrypted, err := encrypt.EncryptData([]byte(logincredStr), key)
-	if err != nil {
-		return "", err
-	}
-	// Encode the encrypted password in base64 for storage
-	encodedData := base64.StdEncoding.EncodeToString(encrypted)
-
-	return encodedData, nil
-}
-
-// DecryptLoginCredsData returns storage.LoginCreds struct out of encrypted data received from database
-func DecryptLoginCredsData(encrData storage.EncryptedData, key []byte) (storage.LoginCreds, error) {
-	var logincred storage.LoginCreds
-
-	decodedData, err := base64.StdEncoding.DecodeString(encrData.Data)
-	if err != nil {
-		return storage.LoginCreds{}, err
-	}
-
-	decryptedData, err := encrypt.DecryptData(decodedData, key)
-	if err != nil {
-		return storage.LoginCreds{}, err
-	}
-
-	dst := string(decryptedData)
-
-	logincredArr := strings.Split(dst, ",")
-
-	for i, data := range logincredArr {
-		switch i {
-		case 0:
-			logincred.Name = encrData.Name
-		case 1:
-			logincred.Site = data
-		case 2:
-			logincred.Login = data
-		case 3:
-			logincred.Password = data
-		}
-	}
-	return logincred, nil
+	return SealFields(key, "", logincred.Site, logincred.Login, logincred.Password)
 }
 
 // SplitFurther is a helper function to work with commands in CLI
@@ -162,47 +76,68 @@ func SplitFurther(input []string) (output []string) {
 	return output
 }
 
-// EncryptNoteData encrypts storage.Note and saves it to a hexadecimal string to be stored in a database
+// EncryptNoteData encrypts storage.Note and returns base64 string to be stored in a database.
+// The name isn't sealed, like in EncryptCardData
 func EncryptNoteData(note storage.Note, key []byte) (string, error) {
-	// concatenating data to string
-	noteStr := note.Name + "," + note.Text
+	return SealFields(key, "", note.Text)
+}
 
-	// encrypting the data
-	encrypted, err := encrypt.EncryptData([]byte(noteStr), key)
+// SealFields joins the fields with commas in a secure buffer and encrypts them,
+// so the plaintext doesn't linger on the heap
+func SealFields(key []byte, fields ...string) (string, error) {
+	size := len(fields) - 1
+	for _, field := range fields {
+		size += len(field)
+	}
+	plain, err := securebuf.New(size)
 	if err != nil {
 		return "", err
 	}
-	// Encode the encrypted password in base64 for storage
-	encodedData := base64.StdEncoding.EncodeToString(encrypted)
-
-	return encodedData, nil
-}
+	defer plain.Destroy()
 
-func DecryptNoteData(encrData storage.EncryptedData, key []byte) (note storage.Note, err error) {
+	data := plain.Bytes()[:0]
+	for i, field := range fields {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		data = append(data, field...)
+	}
 
-	decodedData, err := base64.StdEncoding.DecodeString(encrData.Data)
+	encrypted, err := encrypt.EncryptData(plain.Bytes(), key)
 	if err != nil {
-		return storage.Note{}, err
+		return "", err
 	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
 
-	decryptedData, err := encrypt.DecryptData(decodedData, key)
+// OpenFields decrypts base64 data into a secure buffer and splits it by commas.
+// Fields point into the buffer, the caller must destroy it
+func OpenFields(data string, key []byte) (*securebuf.Buffer, [][]byte, error) {
+	decodedData, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
-		return storage.Note{}, err
+		return nil, nil, err
 	}
+	plain, err := encrypt.DecryptDataSecure(decodedData, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plain, plain.Fields(','), nil
+}
 
-	dst := string(decryptedData)
-
-	noteArr := strings.Split(dst, ",")
+// ResealFields decrypts base64 data with oldKey and encrypts it with newKey,
+// the plaintext stays in a secure buffer
+func ResealFields(data string, oldKey, newKey []byte) (string, error) {
+	plain, _, err := OpenFields(data, oldKey)
+	if err != nil {
+		return "", err
+	}
+	defer plain.Destroy()
 
-	for i, data := range noteArr {
-		switch i {
-		case 0:
-			note.Name = encrData.Name
-		case 1:
-			note.Text = data
-		}
+	encrypted, err := encrypt.EncryptData(plain.Bytes(), newKey)
+	if err != nil {
+		return "", err
 	}
-	return note, nil
+	return base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
 // ReadBinaryFile reads data from binary file and returns its contents
@@ -1,6 +1,10 @@
 package helpers
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
 
 func TestCompareTwoMaps(t *testing.T) {
 	mapServer := map[string]struct{}{
@@ -48,3 +52,30 @@ func TestCompareTwoMaps(t *testing.T) {
 		}
 	}
 }
+
+func TestEncryptCardDataHidesName(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	card := storage.Card{Cardname: "chase-visa", Number: "4111111111111111", Code: "123"}
+
+	data, err := EncryptCardData(card, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, fields, err := OpenFields(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Destroy()
+	if len(fields[0]) != 0 {
+		t.Errorf("name is sealed into the data: %q", fields[0])
+	}
+
+	item, err := OpenItem(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer item.Destroy()
+	if string(item.Field(1)) != card.Number || string(item.Field(5)) != card.Code {
+		t.Errorf("OpenItem() fields = %q, want number %q and code %q", item.fields, card.Number, card.Code)
+	}
+}
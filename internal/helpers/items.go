@@ -0,0 +1,82 @@
+package helpers
+
+import (
+	"encoding/base64"
+
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/securebuf"
+)
+
+// OpenedItem keeps decrypted fields of one item in its own secure buffer
+// until they are displayed or sealed again. The first field is the name in the local storage
+// and is empty in data received from the database
+type OpenedItem struct {
+	plain  *securebuf.Buffer
+	fields [][]byte
+}
+
+// OpenItem decrypts base64 data of one item, the caller must destroy the item
+func OpenItem(data string, key []byte) (*OpenedItem, error) {
+	plain, fields, err := OpenFields(data, key)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenedItem{plain: plain, fields: fields}, nil
+}
+
+// Len returns the number of fields
+func (o *OpenedItem) Len() int {
+	return len(o.fields)
+}
+
+// Field returns the field by its index, nil if the item hasn't got it.
+// The slice must not be used after Destroy
+func (o *OpenedItem) Field(i int) []byte {
+	if i >= len(o.fields) {
+		return nil
+	}
+	return o.fields[i]
+}
+
+// Rest returns the field by its index together with all the fields after it,
+// so the last field of an item may contain commas
+func (o *OpenedItem) Rest(i int) []byte {
+	if i >= len(o.fields) {
+		return nil
+	}
+	offset := 0
+	for _, field := range o.fields[:i] {
+		offset += len(field) + 1
+	}
+	return o.plain.Bytes()[offset:]
+}
+
+// Seal encrypts the fields of the item with the name put into the first one.
+// The local storage keeps the name there, the database gets an empty one
+func (o *OpenedItem) Seal(name string, key []byte) (string, error) {
+	if len(o.fields) == 0 {
+		return "", securebuf.ErrDestroyed
+	}
+	rest := o.plain.Bytes()[len(o.fields[0]):]
+	plain, err := securebuf.New(len(name) + len(rest))
+	if err != nil {
+		return "", err
+	}
+	defer plain.Destroy()
+
+	copy(plain.Bytes()[copy(plain.Bytes(), name):], rest)
+	encrypted, err := encrypt.EncryptData(plain.Bytes(), key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// Destroy wipes the fields. It is safe to call Destroy more than once
+func (o *OpenedItem) Destroy() {
+	if o == nil {
+		return
+	}
+	o.plain.Destroy()
+	o.fields = nil
+}
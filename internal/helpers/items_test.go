@@ -0,0 +1,42 @@
+package helpers
+
+import (
+	"testing"
+)
+
+func TestOpenedItemSeal(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	data, err := SealFields(key, "", "pin, then the password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := OpenItem(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(item.Rest(1)); got != "pin, then the password" {
+		t.Errorf("Rest(1) = %q, the text is cut by its comma", got)
+	}
+
+	local, err := item.Seal("wifi", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Destroy()
+	if item.Field(0) != nil {
+		t.Errorf("fields are kept after Destroy")
+	}
+	if _, err := item.Seal("wifi", key); err == nil {
+		t.Errorf("destroyed item is sealed")
+	}
+
+	sealed, err := OpenItem(local, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sealed.Destroy()
+	if string(sealed.Field(0)) != "wifi" || string(sealed.Rest(1)) != "pin, then the password" {
+		t.Errorf("sealed item = %q", sealed.fields)
+	}
+}
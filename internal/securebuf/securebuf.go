@@ -0,0 +1,117 @@
+// Package securebuf provides buffers for keys and decrypted secrets.
+// Buffers live outside of Go heap in memory locked from swapping and surrounded by guard pages,
+// and are wiped when destroyed
+package securebuf
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"sync"
+)
+
+// ErrDestroyed is returned when a destroyed buffer is used
+var ErrDestroyed = errors.New("buffer is destroyed")
+
+// Buffer is a fixed size piece of protected memory
+type Buffer struct {
+	mu   sync.Mutex
+	mem  []byte
+	data []byte
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[*Buffer]struct{})
+
+	// lock failures are only reported once, e.g. when RLIMIT_MEMLOCK is too low
+	lockWarning sync.Once
+)
+
+// New returns a zeroed buffer of the size
+func New(size int) (*Buffer, error) {
+	mem, data, err := alloc(size)
+	if err != nil {
+		return nil, err
+	}
+	b := &Buffer{mem: mem, data: data}
+
+	registryMu.Lock()
+	registry[b] = struct{}{}
+	registryMu.Unlock()
+	return b, nil
+}
+
+// FromBytes moves src into a new buffer, src is wiped
+func FromBytes(src []byte) (*Buffer, error) {
+	b, err := New(len(src))
+	if err != nil {
+		return nil, err
+	}
+	copy(b.data, src)
+	Wipe(src)
+	return b, nil
+}
+
+// Bytes returns contents of the buffer. The slice must not be used after Destroy
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.data
+}
+
+// Len returns the size of the buffer
+func (b *Buffer) Len() int {
+	return len(b.Bytes())
+}
+
+// Fields splits contents of the buffer by the separator.
+// Fields point into the buffer, so they are wiped together with it
+func (b *Buffer) Fields(sep byte) [][]byte {
+	return bytes.Split(b.Bytes(), []byte{sep})
+}
+
+// Destroy wipes the buffer and releases its memory. It is safe to call Destroy more than once
+func (b *Buffer) Destroy() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.mem == nil {
+		return
+	}
+	Wipe(b.data)
+	if err := free(b.mem); err != nil {
+		log.Println("can't release secure buffer:", err)
+	}
+	b.mem, b.data = nil, nil
+
+	registryMu.Lock()
+	delete(registry, b)
+	registryMu.Unlock()
+}
+
+// DestroyAll destroys all buffers which are still alive. Called when the client exits
+func DestroyAll() {
+	registryMu.Lock()
+	buffers := make([]*Buffer, 0, len(registry))
+	for b := range registry {
+		buffers = append(buffers, b)
+	}
+	registryMu.Unlock()
+
+	for _, b := range buffers {
+		b.Destroy()
+	}
+}
+
+// Wipe zeroes the slice
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
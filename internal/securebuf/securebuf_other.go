@@ -0,0 +1,14 @@
+//go:build !unix
+
+package securebuf
+
+// alloc falls back to ordinary memory where locking and guard pages are not available.
+// The data is still wiped on Destroy
+func alloc(size int) (mem, data []byte, err error) {
+	mem = make([]byte, size)
+	return mem, mem, nil
+}
+
+func free(mem []byte) error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package securebuf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFromBytes(t *testing.T) {
+	src := []byte("secret key")
+	b, err := FromBytes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), []byte("secret key")) {
+		t.Errorf("Bytes() = %q", b.Bytes())
+	}
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Errorf("source is not wiped: %q", src)
+	}
+
+	b.Destroy()
+	if b.Bytes() != nil {
+		t.Error("destroyed buffer returns data")
+	}
+	b.Destroy()
+}
+
+func TestSizes(t *testing.T) {
+	for _, size := range []int{0, 1, 4096, 4097, 100000} {
+		b, err := New(size)
+		if err != nil {
+			t.Fatalf("New(%d) error = %v", size, err)
+		}
+		data := b.Bytes()
+		if len(data) != size || cap(data) != size {
+			t.Errorf("New(%d) len = %d cap = %d", size, len(data), cap(data))
+		}
+		for i := range data {
+			data[i] = 0xff
+		}
+		b.Destroy()
+	}
+}
+
+func TestFields(t *testing.T) {
+	b, _ := FromBytes([]byte("name,number,code"))
+	defer b.Destroy()
+	fields := b.Fields(',')
+	if len(fields) != 3 || string(fields[1]) != "number" {
+		t.Errorf("Fields() = %q", fields)
+	}
+}
+
+func TestDestroyAll(t *testing.T) {
+	a, _ := FromBytes([]byte("a"))
+	b, _ := FromBytes([]byte("b"))
+	DestroyAll()
+	if a.Bytes() != nil || b.Bytes() != nil {
+		t.Error("buffers are not destroyed")
+	}
+}
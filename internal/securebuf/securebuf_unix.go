@@ -0,0 +1,48 @@
+//go:build unix
+
+package securebuf
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// alloc maps pages for the data with a guard page on each side.
+// The data is placed at the end of the inner pages, so overflows hit the guard page
+func alloc(size int) (mem, data []byte, err error) {
+	page := os.Getpagesize()
+	inner := (size + page - 1) / page * page
+	if inner == 0 {
+		inner = page
+	}
+
+	mem, err = unix.Mmap(-1, 0, inner+2*page, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't map memory:%w", err)
+	}
+	if err := unix.Mprotect(mem[:page], unix.PROT_NONE); err != nil {
+		unix.Munmap(mem)
+		return nil, nil, fmt.Errorf("can't protect guard page:%w", err)
+	}
+	if err := unix.Mprotect(mem[page+inner:], unix.PROT_NONE); err != nil {
+		unix.Munmap(mem)
+		return nil, nil, fmt.Errorf("can't protect guard page:%w", err)
+	}
+	if err := unix.Mlock(mem[page : page+inner]); err != nil {
+		lockWarning.Do(func() {
+			log.Println("can't lock memory, secrets may be swapped to disk:", err)
+		})
+	}
+
+	return mem, mem[page+inner-size : page+inner : page+inner], nil
+}
+
+// free unlocks and unmaps the memory, the data is wiped by the caller beforehand
+func free(mem []byte) error {
+	page := os.Getpagesize()
+	unix.Munlock(mem[page : len(mem)-page])
+	return unix.Munmap(mem)
+}
@@ -0,0 +1,139 @@
+// Package shamir provides Shamir's secret sharing over GF(256).
+// A secret is split into parts, any threshold of them are enough to combine the secret back
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Shamir errors
+var (
+	ErrWrongParts     = errors.New("parts must be between threshold and 255")
+	ErrWrongThreshold = errors.New("threshold must be at least 2")
+	ErrEmptySecret    = errors.New("secret can't be empty")
+	ErrNotEnough      = errors.New("at least 2 shares are required")
+	ErrWrongShares    = errors.New("shares are malformed or don't belong together")
+)
+
+// exp and log tables of GF(256) with polynomial x^8+x^4+x^3+x+1 and generator 3
+var (
+	expTable [510]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		expTable[i+255] = x
+		logTable[x] = byte(i)
+		// multiply by generator 3: x*2 xor x
+		x2 := x << 1
+		if x&0x80 != 0 {
+			x2 ^= 0x1b
+		}
+		x = x2 ^ x
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+// Split splits the secret into parts shares, any threshold of which can combine the secret.
+// Each share is len(secret)+1 bytes long, the last byte is the share's x coordinate
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+	if threshold < 2 {
+		return nil, ErrWrongThreshold
+	}
+	if parts < threshold || parts > 255 {
+		return nil, ErrWrongParts
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for idx, b := range secret {
+		// random polynomial of threshold-1 degree with the secret byte as a constant
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("can't generate polynomial in Split:%w", err)
+		}
+		coefficients[0] = b
+
+		for i := range shares {
+			x := shares[i][len(secret)]
+			// Horner's method
+			var y byte
+			for j := threshold - 1; j >= 0; j-- {
+				y = mul(y, x) ^ coefficients[j]
+			}
+			shares[i][idx] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine restores the secret out of shares made by Split.
+// If there are less shares than the threshold, the result is a wrong secret
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrNotEnough
+	}
+
+	length := len(shares[0])
+	if length < 2 {
+		return nil, ErrWrongShares
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]struct{})
+	for i, share := range shares {
+		if len(share) != length {
+			return nil, ErrWrongShares
+		}
+		x := share[length-1]
+		if _, ok := seen[x]; ok || x == 0 {
+			return nil, ErrWrongShares
+		}
+		seen[x] = struct{}{}
+		xs[i] = x
+	}
+
+	secret := make([]byte, length-1)
+	for idx := range secret {
+		// Lagrange interpolation at x = 0
+		var value byte
+		for i := range shares {
+			basis := byte(1)
+			for j := range shares {
+				if i == j {
+					continue
+				}
+				basis = mul(basis, div(xs[j], xs[j]^xs[i]))
+			}
+			value ^= mul(shares[i][idx], basis)
+		}
+		secret[idx] = value
+	}
+
+	return secret, nil
+}
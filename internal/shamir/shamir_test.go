@@ -0,0 +1,85 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("expected 5 shares, got %d", len(shares))
+	}
+
+	tests := []struct {
+		name   string
+		shares [][]byte
+		want   bool
+	}{
+		{
+			name:   "Threshold shares",
+			shares: [][]byte{shares[0], shares[2], shares[4]},
+			want:   true,
+		},
+		{
+			name:   "All shares",
+			shares: shares,
+			want:   true,
+		},
+		{
+			name:   "Other threshold shares",
+			shares: [][]byte{shares[3], shares[1], shares[0]},
+			want:   true,
+		},
+		{
+			name:   "Less than threshold",
+			shares: [][]byte{shares[0], shares[1]},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Combine(tt.shares)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(got, secret) != tt.want {
+				t.Errorf("Combine() restored secret = %v, want %v", bytes.Equal(got, secret), tt.want)
+			}
+		})
+	}
+}
+
+func TestCombineWrongShares(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Combine([][]byte{shares[0]}); err != ErrNotEnough {
+		t.Errorf("expected ErrNotEnough, got %v", err)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[0]}); err != ErrWrongShares {
+		t.Errorf("expected ErrWrongShares for duplicated shares, got %v", err)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[1][1:]}); err != ErrWrongShares {
+		t.Errorf("expected ErrWrongShares for shares of different length, got %v", err)
+	}
+}
+
+func TestSplitWrongParams(t *testing.T) {
+	if _, err := Split([]byte("secret"), 3, 1); err != ErrWrongThreshold {
+		t.Errorf("expected ErrWrongThreshold, got %v", err)
+	}
+	if _, err := Split([]byte("secret"), 2, 3); err != ErrWrongParts {
+		t.Errorf("expected ErrWrongParts, got %v", err)
+	}
+	if _, err := Split(nil, 3, 2); err != ErrEmptySecret {
+		t.Errorf("expected ErrEmptySecret, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package storage
+
+// Change is the last change of an item in the change feed of the user.
+// Every change takes the next revision of the user, so revisions only grow
+type Change struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Revision int64  `json:"revision"`
+	Deleted  bool   `json:"deleted,omitempty"`
+	// Hash and Device are Item.Hash and Item.Device of the change
+	Hash   string `json:"hash,omitempty"`
+	Device string `json:"device,omitempty"`
+}
+
+// Changes is a page of the change feed ordered by revision
+type Changes struct {
+	Changes []Change `json:"changes"`
+	// Revision is the current revision of the user, the page has no changes after it
+	Revision int64 `json:"revision"`
+	// More is set if there are changes after the page up to Revision,
+	// the next page starts after the revision of the last change
+	More bool `json:"more,omitempty"`
+}
+
+// ChangesPage makes the page of changes read up to the limit and one more
+func ChangesPage(revision int64, changes []Change, limit int) Changes {
+	page := Changes{Changes: changes, Revision: revision}
+	if len(changes) > limit {
+		page.Changes, page.More = changes[:limit], true
+	}
+	return page
+}
@@ -1,53 +1,109 @@
-// Package database provides Postgres DB implementation of Storage interface
+// Package database provides Postgres and SQLite DB implementations of Storage interface
 package database
 
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 
 	"github.com/gambruh/simplevault/internal/config"
 	"github.com/gambruh/simplevault/internal/storage"
 )
 
 type Storage interface {
-	SetLoginCred(username string, logincreds storage.EncryptedData) error
-	SetNote(username string, note storage.EncryptedData) error
-	SetBinary(username string, binary storage.Binary) error
-	SetCard(username string, card storage.EncryptedData) error
-	GetLoginCred(username string, name string) (storage.EncryptedData, error)
-	GetNote(username string, name string) (storage.EncryptedData, error)
-	GetBinary(username string, name string) (storage.Binary, error)
-	GetCard(username string, name string) (storage.EncryptedData, error)
-	ListLoginCreds(username string) ([]string, error)
-	ListNotes(username string) ([]string, error)
-	ListBinaries(username string) ([]string, error)
-	ListCards(username string) ([]string, error)
+	SetLoginCred(ctx context.Context, username string, logincreds storage.EncryptedData) error
+	SetNote(ctx context.Context, username string, note storage.EncryptedData) error
+	SetBinary(ctx context.Context, username string, binary storage.Binary) error
+	SetCard(ctx context.Context, username string, card storage.EncryptedData) error
+	GetLoginCred(ctx context.Context, username string, name string) (storage.EncryptedData, error)
+	GetNote(ctx context.Context, username string, name string) (storage.EncryptedData, error)
+	GetBinary(ctx context.Context, username string, name string) (storage.Binary, error)
+	GetCard(ctx context.Context, username string, name string) (storage.EncryptedData, error)
+	ListLoginCreds(ctx context.Context, username string) ([]string, error)
+	ListNotes(ctx context.Context, username string) ([]string, error)
+	ListBinaries(ctx context.Context, username string) ([]string, error)
+	ListCards(ctx context.Context, username string) ([]string, error)
+	SetKeyPair(ctx context.Context, username string, keys storage.KeyPair) error
+	GetKeyPair(ctx context.Context, username string) (storage.KeyPair, error)
+	SetShare(ctx context.Context, username string, share storage.Share) error
+	ListSharesReceived(ctx context.Context, username string) ([]storage.Share, error)
+	ListSharesOwned(ctx context.Context, username string) ([]storage.Share, error)
+	DeleteShare(ctx context.Context, username string, share storage.Share) error
+	CreateOrg(ctx context.Context, username string, org storage.Org) error
+	ListOrgs(ctx context.Context, username string) ([]storage.Org, error)
+	GetOrgRole(ctx context.Context, username string, orgname string) (string, error)
+	SetOrgMember(ctx context.Context, member storage.OrgMember) error
+	DeleteOrgMember(ctx context.Context, orgname string, login string) error
+	RotateOrgKey(ctx context.Context, rotation storage.OrgRotation) error
+	ListOrgMembers(ctx context.Context, orgname string) ([]storage.OrgMember, error)
+	SetOrgItem(ctx context.Context, item storage.OrgItem) error
+	UpdateOrgItem(ctx context.Context, item storage.OrgItem) error
+	DeleteOrgItem(ctx context.Context, orgname string, kind string, name string) error
+	GetOrgItem(ctx context.Context, orgname string, kind string, name string) (storage.OrgItem, error)
+	ListOrgItems(ctx context.Context, orgname string) ([]storage.OrgItem, error)
+	ListItems(ctx context.Context, username string, kind string, opts storage.ListOptions) (storage.Page, error)
+	SetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	GetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	UpdateItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	DeleteItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error)
+	ListChanges(ctx context.Context, username string, since int64, limit int) (storage.Changes, error)
 }
 
 type SQLdb struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
+	// QueryTimeout is the deadline of each method on top of the caller's context, 0 for none
+	QueryTimeout time.Duration
+}
+
+// WithTimeout returns the context with the deadline d from now, or the context itself if d is 0
+func WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+func (s *SQLdb) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return WithTimeout(ctx, s.QueryTimeout)
 }
 
 func NewSQLdb(postgresStr string) *SQLdb {
 	DB, _ := sql.Open("pgx", postgresStr)
 	return &SQLdb{
-		DB: DB,
+		DB:      DB,
+		Dialect: Postgres,
+	}
+}
+
+// OpenDB opens the storage database and creates its tables, see Open for the arguments
+func OpenDB(storage string, postgresStr string) (*SQLdb, error) {
+	conn, dialect, err := Open(storage, postgresStr)
+	if err != nil {
+		return nil, err
 	}
+	db := &SQLdb{DB: conn, Dialect: dialect}
+	if err := db.InitDatabase(); err != nil {
+		return nil, err
+	}
+	return db, nil
 }
 
 func GetDB() (defstorage Storage) {
 
-	db := NewSQLdb(config.Cfg.Database)
-	err := db.InitDatabase()
+	db, err := OpenDB(config.Cfg.Storage, config.Cfg.Database)
 	if err != nil {
 		log.Fatal(err)
 	}
+	db.QueryTimeout = config.Cfg.QueryTimeout
 	defstorage = db
 
 	return defstorage
@@ -71,135 +127,30 @@ func (s *SQLdb) CheckConn(dbAddress string) error {
 	return nil
 }
 
-// InitDatabase creates tables in an empty database
+// InitDatabase applies pending migrations, so an empty database gets all the tables
 func (s *SQLdb) InitDatabase() error {
-	err := s.createLoginCredsTable()
-	if err != nil {
-		return fmt.Errorf("error creating logincreds table:%w", err)
-	}
-	err = s.createCardsTable()
+	migrator, err := NewMigrator(s.DB, s.Dialect)
 	if err != nil {
-		return fmt.Errorf("error creating cards table:%w", err)
-	}
-	err = s.createNotesTable()
-	if err != nil {
-		return fmt.Errorf("error creating notes table:%w", err)
-	}
-	err = s.createBinariesTable()
-	if err != nil {
-		return fmt.Errorf("error creating binaries table:%w", err)
-	}
-
-	return nil
-}
-
-func (s *SQLdb) checkTableExists(tablename string) error {
-	var check bool
-	err := s.DB.QueryRow(checkTableExistsQuery, tablename).Scan(&check)
-	if err != nil {
-		fmt.Printf("error checking if table exists: %v", err)
 		return err
 	}
-	if !check {
-		return storage.ErrTableDoesntExist
+	if _, err := migrator.Up(); err != nil {
+		return fmt.Errorf("error migrating database:%w", err)
 	}
 	return nil
 }
 
-func (s *SQLdb) createLoginCredsTable() error {
-	err := s.checkTableExists("gk_logincreds")
-	if err == storage.ErrTableDoesntExist {
-		if _, err := s.DB.Exec(createLoginCredsTableQuery); err != nil {
-			return err
-		}
-		if _, err = s.DB.Exec(alterTableLC); err != nil {
-			return err
-		}
-		if _, err = s.DB.Exec(alterTableLC2); err != nil {
-			return err
-		}
-		if _, err = s.DB.Exec(createUniqueLoginCredsConstraint); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (s *SQLdb) createCardsTable() error {
-	err := s.checkTableExists("gk_cards")
-	if err == storage.ErrTableDoesntExist {
-		_, err := s.DB.Exec(createCardsTableQuery)
-		if err != nil {
-			return err
-		}
-		_, err = s.DB.Exec(createUniqueCardConstraint)
-		if err != nil {
-			return err
-		}
-		_, err = s.DB.Exec(encryptedCardsTable)
-		if err != nil {
-			return err
-		}
-		_, err = s.DB.Exec(addColumnData)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-
+func (s *SQLdb) SetCard(ctx context.Context, username string, cardData storage.EncryptedData) error {
+	return s.setItem(ctx, username, storage.Item{
+		Kind: storage.KindCard, Name: cardData.Name, Data: cardData.Data, EncName: cardData.EncName, Tags: cardData.Tags,
+	})
 }
 
-func (s *SQLdb) createNotesTable() error {
-	err := s.checkTableExists("gk_notes")
-	if err == storage.ErrTableDoesntExist {
-		_, err := s.DB.Exec(createNotesTableQuery)
-		if err != nil {
-			return err
-		}
-		_, err = s.DB.Exec(createUniqueNoteConstraint)
-		if err != nil {
-			return err
-		}
-		_, err = s.DB.Exec(alterTableNotes)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (s *SQLdb) createBinariesTable() error {
-	err := s.checkTableExists("gk_binaries")
-	if err == storage.ErrTableDoesntExist {
-		if _, err := s.DB.Exec(createBinariesTableQuery); err != nil {
-			return err
-		}
-		if _, err := s.DB.Exec(createUniqueBinaryConstraint); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (s *SQLdb) SetCard(username string, cardData storage.EncryptedData) error {
-
-	var cardname string
-	err := s.DB.QueryRow(checkCardNameQuery, cardData.Name, username).Scan(&cardname)
-	if err != sql.ErrNoRows {
-		return storage.ErrMetanameIsTaken
-	}
-
-	_, err = s.DB.Exec(setCardQuery, cardData.Name, cardData.Data, username)
-	if err != nil {
-		return fmt.Errorf("error setting card data in SetCard:%w", err)
-	}
-	return nil
-}
+func (s *SQLdb) GetCard(ctx context.Context, username string, cardname string) (storage.EncryptedData, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-func (s *SQLdb) GetCard(username string, cardname string) (storage.EncryptedData, error) {
 	var cardData storage.EncryptedData
-	err := s.DB.QueryRow(getCardQuery, cardname, username).Scan(&cardData.Name, &cardData.Data)
+	err := s.DB.QueryRowContext(ctx, getCardQuery, cardname, username).Scan(&cardData.Name, &cardData.Data, &cardData.EncName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return storage.EncryptedData{}, storage.ErrDataNotFound
@@ -210,9 +161,11 @@ func (s *SQLdb) GetCard(username string, cardname string) (storage.EncryptedData
 	return cardData, nil
 }
 
-func (s *SQLdb) ListCards(username string) (cardnames []string, err error) {
+func (s *SQLdb) ListCards(ctx context.Context, username string) (cardnames []string, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query(listCardsQuery, username)
+	rows, err := s.DB.QueryContext(ctx, listCardsQuery, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, storage.ErrDataNotFound
@@ -239,17 +192,18 @@ func (s *SQLdb) ListCards(username string) (cardnames []string, err error) {
 	return cardnames, nil
 }
 
-func (s *SQLdb) SetLoginCred(username string, loginData storage.EncryptedData) error {
-	_, err := s.DB.Exec(setLoginCredsQuery, loginData.Name, loginData.Data, username)
-	if err != nil {
-		return fmt.Errorf("error setting data in SetLoginCred:%w", err)
-	}
-	return nil
+func (s *SQLdb) SetLoginCred(ctx context.Context, username string, loginData storage.EncryptedData) error {
+	return s.setItem(ctx, username, storage.Item{
+		Kind: storage.KindLoginCreds, Name: loginData.Name, Data: loginData.Data, EncName: loginData.EncName, Tags: loginData.Tags,
+	})
 }
 
-func (s *SQLdb) GetLoginCred(username string, loginname string) (logincred storage.EncryptedData, err error) {
+func (s *SQLdb) GetLoginCred(ctx context.Context, username string, loginname string) (logincred storage.EncryptedData, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	var encrData storage.EncryptedData
-	err = s.DB.QueryRow(getLoginCredsQuery, loginname, username).Scan(&encrData.Name, &encrData.Data)
+	err = s.DB.QueryRowContext(ctx, getLoginCredsQuery, loginname, username).Scan(&encrData.Name, &encrData.Data, &encrData.EncName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return storage.EncryptedData{}, storage.ErrDataNotFound
@@ -260,9 +214,11 @@ func (s *SQLdb) GetLoginCred(username string, loginname string) (logincred stora
 	return encrData, nil
 }
 
-func (s *SQLdb) ListLoginCreds(username string) (logincrednames []string, err error) {
+func (s *SQLdb) ListLoginCreds(ctx context.Context, username string) (logincrednames []string, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query(listLoginCredsQuery, username)
+	rows, err := s.DB.QueryContext(ctx, listLoginCredsQuery, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, storage.ErrDataNotFound
@@ -290,17 +246,17 @@ func (s *SQLdb) ListLoginCreds(username string) (logincrednames []string, err er
 	return logincrednames, nil
 }
 
-func (s *SQLdb) SetNote(username string, data storage.EncryptedData) error {
-	_, err := s.DB.Exec(setNoteQuery, data.Name, data.Data, username)
-	if err != nil {
-		return fmt.Errorf("error setting data in SetLoginCred:%w", err)
-	}
-	return nil
+func (s *SQLdb) SetNote(ctx context.Context, username string, data storage.EncryptedData) error {
+	return s.setItem(ctx, username, storage.Item{
+		Kind: storage.KindNote, Name: data.Name, Data: data.Data, EncName: data.EncName, Tags: data.Tags,
+	})
 }
 
-func (s *SQLdb) GetNote(username string, notename string) (encrData storage.EncryptedData, err error) {
+func (s *SQLdb) GetNote(ctx context.Context, username string, notename string) (encrData storage.EncryptedData, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	err = s.DB.QueryRow(getNoteQuery, notename, username).Scan(&encrData.Name, &encrData.Data)
+	err = s.DB.QueryRowContext(ctx, getNoteQuery, notename, username).Scan(&encrData.Name, &encrData.Data, &encrData.EncName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return storage.EncryptedData{}, storage.ErrDataNotFound
@@ -311,9 +267,11 @@ func (s *SQLdb) GetNote(username string, notename string) (encrData storage.Encr
 	return encrData, nil
 }
 
-func (s *SQLdb) ListNotes(username string) (notenames []string, err error) {
+func (s *SQLdb) ListNotes(ctx context.Context, username string) (notenames []string, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query(listNotesQuery, username)
+	rows, err := s.DB.QueryContext(ctx, listNotesQuery, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, storage.ErrDataNotFound
@@ -341,17 +299,17 @@ func (s *SQLdb) ListNotes(username string) (notenames []string, err error) {
 	return notenames, nil
 }
 
-func (s *SQLdb) SetBinary(username string, binary storage.Binary) error {
-	_, err := s.DB.Exec(setBinaryQuery, binary.Name, binary.Data, username)
-	if err != nil {
-		return fmt.Errorf("error setting data in SetLoginCred:%w", err)
-	}
-	return nil
+func (s *SQLdb) SetBinary(ctx context.Context, username string, binary storage.Binary) error {
+	return s.setItem(ctx, username, storage.Item{
+		Kind: storage.KindBinary, Name: binary.Name, Binary: binary.Data, EncName: binary.EncName, Tags: binary.Tags,
+	})
 }
 
-func (s *SQLdb) GetBinary(username string, binaryname string) (binary storage.Binary, err error) {
+func (s *SQLdb) GetBinary(ctx context.Context, username string, binaryname string) (binary storage.Binary, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	err = s.DB.QueryRow(getBinaryQuery, binaryname, username).Scan(&binary.Name, &binary.Data)
+	err = s.DB.QueryRowContext(ctx, getBinaryQuery, binaryname, username).Scan(&binary.Name, &binary.Data, &binary.EncName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return storage.Binary{}, storage.ErrDataNotFound
@@ -362,9 +320,11 @@ func (s *SQLdb) GetBinary(username string, binaryname string) (binary storage.Bi
 	return binary, nil
 }
 
-func (s *SQLdb) ListBinaries(username string) (binarynames []string, err error) {
+func (s *SQLdb) ListBinaries(ctx context.Context, username string) (binarynames []string, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query(listBinariesQuery, username)
+	rows, err := s.DB.QueryContext(ctx, listBinariesQuery, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, storage.ErrDataNotFound
@@ -392,9 +352,29 @@ func (s *SQLdb) ListBinaries(username string) (binarynames []string, err error)
 	return binarynames, nil
 }
 
+// IsUniqueConstraintViolation reports whether err is a unique or primary key conflict in either dialect
 func IsUniqueConstraintViolation(err error) bool {
-	if pgErr, ok := err.(*pgconn.PgError); ok {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
 		return pgErr.Code == "23505"
 	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
+
+// IsNotNullViolation reports whether err is a NOT NULL violation in either dialect.
+// Inserts look IDs up by names, so it means the user or organization doesn't exist
+func IsNotNullViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23502"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_NOTNULL
+	}
 	return false
 }
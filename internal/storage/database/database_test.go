@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("zero timeout set a deadline")
+	}
+
+	ctx, cancel = WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("deadline %v, %v", deadline, ok)
+	}
+}
+
+func TestQueryInterrupted(t *testing.T) {
+	db, _, err := Open("sqlite://"+filepath.Join(t.TempDir(), "vault.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var n int
+	err = db.QueryRowContext(ctx, `
+		WITH RECURSIVE r(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM r)
+		SELECT COUNT(*) FROM r;
+	`).Scan(&n)
+	if err == nil {
+		t.Fatal("endless query returned")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("query ran %v after the deadline", elapsed)
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("query failed before the deadline: %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// itemQueries are the queries, the table and its name column of each kind of items
+var itemQueries = map[string]struct{ set, get, update, delete, table, name string }{
+	storage.KindCard:       {setCardQuery, getCardQuery, updateCardQuery, deleteCardQuery, "gk_cards", "cardname"},
+	storage.KindLoginCreds: {setLoginCredsQuery, getLoginCredsQuery, updateLoginCredsQuery, deleteLoginCredsQuery, "gk_logincreds", "name"},
+	storage.KindNote:       {setNoteQuery, getNoteQuery, updateNoteQuery, deleteNoteQuery, "gk_notes", "name"},
+	storage.KindBinary:     {setBinaryQuery, getBinaryQuery, updateBinaryQuery, deleteBinaryQuery, "gk_binaries", "name"},
+}
+
+// setItem saves one item along with its tags.
+// Returns storage.ErrMetanameIsTaken if there is an item of the kind with the name already
+func (s *SQLdb) setItem(ctx context.Context, username string, item storage.Item) error {
+	results, err := s.SetItems(ctx, username, []storage.Item{item})
+	if err != nil {
+		return err
+	}
+	if results[0].Error == storage.ItemErrNameTaken {
+		return storage.ErrMetanameIsTaken
+	}
+	return nil
+}
+
+// itemData returns the content of the item to be saved in the data column of its kind
+func itemData(item storage.Item) any {
+	if item.Kind == storage.KindBinary {
+		return item.Binary
+	}
+	return item.Data
+}
+
+// writeItems writes the items in one transaction, each one within its own savepoint,
+// and records the change of each written item in the change feed with the next revision of the user.
+// write returns the error of an item failed alone, its savepoint is rolled back then.
+// Any other error fails the whole batch
+func (s *SQLdb) writeItems(ctx context.Context, method string, username string, items []storage.Item, deleted bool,
+	write func(tx *sql.Tx, item storage.Item) (string, error)) ([]storage.ItemResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't begin transaction in %s:%w", method, err)
+	}
+	defer tx.Rollback()
+
+	results := make([]storage.ItemResult, len(items))
+	for i, item := range items {
+		results[i].Kind, results[i].Name = item.Kind, item.Name
+		if _, ok := itemQueries[item.Kind]; !ok {
+			results[i].Error = storage.ItemErrWrongKind
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, itemSavepointQuery); err != nil {
+			return nil, fmt.Errorf("error in %s:%w", method, err)
+		}
+		itemErr, err := write(tx, item)
+		if err != nil {
+			return nil, fmt.Errorf("error writing %s %s in %s:%w", item.Kind, item.Name, method, err)
+		}
+		if itemErr != "" {
+			results[i].Error = itemErr
+			if _, err := tx.ExecContext(ctx, rollbackItemQuery); err != nil {
+				return nil, fmt.Errorf("error in %s:%w", method, err)
+			}
+		} else {
+			results[i].Revision, err = recordChange(ctx, tx, username, item, deleted)
+			if err != nil {
+				return nil, fmt.Errorf("error recording change of %s %s in %s:%w", item.Kind, item.Name, method, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, releaseItemQuery); err != nil {
+			return nil, fmt.Errorf("error in %s:%w", method, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit transaction in %s:%w", method, err)
+	}
+	return results, nil
+}
+
+// recordChange takes the next revision of the user and marks the item changed with it.
+// The revision row of the user stays locked until the transaction ends,
+// so changes of the user are committed in the order of their revisions
+func recordChange(ctx context.Context, tx *sql.Tx, username string, item storage.Item, deleted bool) (int64, error) {
+	var revision int64
+	if err := tx.QueryRowContext(ctx, nextRevisionQuery, username).Scan(&revision); err != nil {
+		return 0, err
+	}
+	hash := item.Hash
+	if deleted {
+		hash = ""
+	}
+	if _, err := tx.ExecContext(ctx, setChangeQuery, username, item.Kind, item.Name, revision, deleted, hash, item.Device); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// lastChange returns the last change of the item, the zero change if the item has never changed
+// since the change feed was added
+func lastChange(ctx context.Context, tx *sql.Tx, username string, kind string, name string) (storage.Change, error) {
+	change := storage.Change{Kind: kind, Name: name}
+	err := tx.QueryRowContext(ctx, getChangeQuery, username, kind, name).Scan(&change.Revision, &change.Hash, &change.Device)
+	if err == sql.ErrNoRows {
+		return change, nil
+	}
+	return change, err
+}
+
+// checkBase returns storage.ItemErrConflict if the item has changed after the base revision of the write.
+// It is called after the item row is written, so concurrent writes of the item wait for each other
+// and the later one sees the change of the former
+func checkBase(ctx context.Context, tx *sql.Tx, username string, item storage.Item) (string, error) {
+	if item.BaseRevision == 0 {
+		return "", nil
+	}
+	change, err := lastChange(ctx, tx, username, item.Kind, item.Name)
+	if err != nil {
+		return "", err
+	}
+	if change.Revision != item.BaseRevision {
+		return storage.ItemErrConflict, nil
+	}
+	return "", nil
+}
+
+// setItemTags saves the tags of the item
+func setItemTags(ctx context.Context, tx *sql.Tx, username string, item storage.Item) error {
+	for _, tag := range item.Tags {
+		if _, err := tx.ExecContext(ctx, setItemTagQuery, username, item.Kind, item.Name, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetItems saves the items of any kinds in one transaction.
+// Items with taken names or unknown kinds fail alone, any other error fails the whole batch
+func (s *SQLdb) SetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	now := time.Now().UTC()
+	return s.writeItems(ctx, "SetItems", username, items, false, func(tx *sql.Tx, item storage.Item) (string, error) {
+		_, err := tx.ExecContext(ctx, itemQueries[item.Kind].set, item.Name, itemData(item), username, item.EncName, now)
+		if err == nil {
+			err = setItemTags(ctx, tx, username, item)
+		}
+		if IsUniqueConstraintViolation(err) {
+			return storage.ItemErrNameTaken, nil
+		}
+		return "", err
+	})
+}
+
+// UpdateItems replaces the content of the existing items in one transaction, and their tags
+// unless the items come without them. Missing items, items changed after their base revisions and unknown kinds fail alone,
+// any other error fails the whole batch
+func (s *SQLdb) UpdateItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	now := time.Now().UTC()
+	return s.writeItems(ctx, "UpdateItems", username, items, false, func(tx *sql.Tx, item storage.Item) (string, error) {
+		res, err := tx.ExecContext(ctx, itemQueries[item.Kind].update, item.Name, itemData(item), username, item.EncName, now)
+		if err != nil {
+			return "", err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return storage.ItemErrNotFound, err
+		}
+		if itemErr, err := checkBase(ctx, tx, username, item); itemErr != "" || err != nil {
+			return itemErr, err
+		}
+		if item.Tags == nil {
+			return "", nil
+		}
+		if _, err := tx.ExecContext(ctx, deleteItemTagsQuery, username, item.Kind, item.Name); err != nil {
+			return "", err
+		}
+		return "", setItemTags(ctx, tx, username, item)
+	})
+}
+
+// DeleteItems deletes the items by kind and name along with their tags in one transaction.
+// Missing items, items changed after their base revisions and unknown kinds fail alone,
+// any other error fails the whole batch
+func (s *SQLdb) DeleteItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	return s.writeItems(ctx, "DeleteItems", username, items, true, func(tx *sql.Tx, item storage.Item) (string, error) {
+		res, err := tx.ExecContext(ctx, itemQueries[item.Kind].delete, item.Name, username)
+		if err != nil {
+			return "", err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return storage.ItemErrNotFound, err
+		}
+		if itemErr, err := checkBase(ctx, tx, username, item); itemErr != "" || err != nil {
+			return itemErr, err
+		}
+		_, err = tx.ExecContext(ctx, deleteItemTagsQuery, username, item.Kind, item.Name)
+		return "", err
+	})
+}
+
+// GetItems returns the items of any kinds by kind and name along with their last changes, read in one transaction.
+// Missing items and unknown kinds fail alone, any other error fails the whole batch
+func (s *SQLdb) GetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't begin transaction in GetItems:%w", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]storage.ItemResult, len(items))
+	for i, item := range items {
+		results[i].Kind, results[i].Name = item.Kind, item.Name
+		queries, ok := itemQueries[item.Kind]
+		if !ok {
+			results[i].Error = storage.ItemErrWrongKind
+			continue
+		}
+		var data any = &results[i].Data
+		if item.Kind == storage.KindBinary {
+			data = &results[i].Binary
+		}
+
+		err := tx.QueryRowContext(ctx, queries.get, item.Name, username).Scan(&results[i].Name, data, &results[i].EncName)
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			results[i].Error = storage.ItemErrNotFound
+			continue
+		default:
+			return nil, fmt.Errorf("error getting %s %s in GetItems:%w", item.Kind, item.Name, err)
+		}
+
+		change, err := lastChange(ctx, tx, username, item.Kind, item.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error getting change of %s %s in GetItems:%w", item.Kind, item.Name, err)
+		}
+		results[i].Revision, results[i].Hash, results[i].Device = change.Revision, change.Hash, change.Device
+	}
+	return results, tx.Commit()
+}
+
+// ListItems returns a page of names of the user's items of the kind.
+// Returns storage.ErrWrongCursor if the options are malformed
+func (s *SQLdb) ListItems(ctx context.Context, username string, kind string, opts storage.ListOptions) (storage.Page, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	after, err := opts.Check()
+	if err != nil {
+		return storage.Page{}, err
+	}
+	queries, ok := itemQueries[kind]
+	if !ok {
+		return storage.Page{}, storage.ErrDataNotFound
+	}
+
+	var query strings.Builder
+	args := []any{username}
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	fmt.Fprintf(&query, `
+		SELECT t.%[2]s, t.modified_at
+		FROM %[1]s AS t
+		JOIN gk_users ON t.user_id = gk_users.id
+		WHERE gk_users.username = $1`, queries.table, queries.name)
+	if opts.Tag != "" {
+		fmt.Fprintf(&query, `
+		AND EXISTS (
+			SELECT 1 FROM gk_item_tags
+			WHERE gk_item_tags.user_id = t.user_id AND gk_item_tags.kind = %s
+			AND gk_item_tags.tag = %s AND gk_item_tags.name = t.%s
+		)`, arg(kind), arg(opts.Tag), queries.name)
+	}
+
+	cmp, order := ">", ""
+	if opts.Descending() {
+		cmp, order = "<", " DESC"
+	}
+	if opts.ByModified() {
+		if after != nil {
+			modified, name := arg(after.Modified.UTC()), arg(after.Name)
+			fmt.Fprintf(&query, " AND (t.modified_at %[1]s %[2]s OR (t.modified_at = %[2]s AND t.%[3]s %[1]s %[4]s))",
+				cmp, modified, queries.name, name)
+		}
+		fmt.Fprintf(&query, " ORDER BY t.modified_at%[1]s, t.%[2]s%[1]s", order, queries.name)
+	} else {
+		if after != nil {
+			fmt.Fprintf(&query, " AND t.%s %s %s", queries.name, cmp, arg(after.Name))
+		}
+		fmt.Fprintf(&query, " ORDER BY t.%s%s", queries.name, order)
+	}
+	fmt.Fprintf(&query, " LIMIT %s;", arg(opts.Limit+1))
+
+	rows, err := s.DB.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return storage.Page{}, fmt.Errorf("couldn't ask database in ListItems:%w", err)
+	}
+	defer rows.Close()
+
+	var items []storage.ListedItem
+	for rows.Next() {
+		var item storage.ListedItem
+		if err := rows.Scan(&item.Name, &item.Modified); err != nil {
+			return storage.Page{}, fmt.Errorf("error scanning in ListItems:%w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return storage.Page{}, fmt.Errorf("error scanning with rows.Next() in ListItems:%w", err)
+	}
+	return storage.NewPage(opts, items), nil
+}
+
+// ListChanges returns a page of the user's change feed after the revision since, at most limit changes.
+// The revision of the user and the changes are read in one transaction, with limit 0 only the revision is read.
+// Returns storage.ErrDataNotFound if there is no such user
+func (s *SQLdb) ListChanges(ctx context.Context, username string, since int64, limit int) (storage.Changes, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if limit < 0 || limit > storage.MaxPageSize {
+		limit = storage.MaxPageSize
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Changes{}, fmt.Errorf("can't begin transaction in ListChanges:%w", err)
+	}
+	defer tx.Rollback()
+
+	var revision int64
+	err = tx.QueryRowContext(ctx, getRevisionQuery, username).Scan(&revision)
+	switch {
+	case err == sql.ErrNoRows:
+		return storage.Changes{}, storage.ErrDataNotFound
+	case err != nil:
+		return storage.Changes{}, fmt.Errorf("error getting revision in ListChanges:%w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, listChangesQuery, username, since, revision, limit+1)
+	if err != nil {
+		return storage.Changes{}, fmt.Errorf("couldn't ask database in ListChanges:%w", err)
+	}
+	defer rows.Close()
+
+	var changes []storage.Change
+	for rows.Next() {
+		var change storage.Change
+		if err := rows.Scan(&change.Kind, &change.Name, &change.Revision, &change.Deleted, &change.Hash, &change.Device); err != nil {
+			return storage.Changes{}, fmt.Errorf("error scanning in ListChanges:%w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return storage.Changes{}, fmt.Errorf("error scanning with rows.Next() in ListChanges:%w", err)
+	}
+	return storage.ChangesPage(revision, changes, limit), tx.Commit()
+}
@@ -1,53 +1,298 @@
 package database
 
-const encryptedCardsTable = `
-	ALTER TABLE gk_cards
-	DROP COLUMN number,
-	DROP COLUMN name,
-	DROP COLUMN surname,
-	DROP COLUMN valid_till,
-	DROP COLUMN code
-`
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
-const addColumnData = `
-	ALTER TABLE gk_cards
-	ADD COLUMN data TEXT
-`
+// Migrations of both dialects are embedded in the binary, in files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
 
-const alterTableLC = `
-	ALTER TABLE gk_logincreds
-	ADD COLUMN data TEXT
-`
+// migrationLockID is the key of the Postgres advisory lock, so concurrent servers don't migrate at once
+const migrationLockID = 5107401
 
-const alterTableLC2 = `
-	ALTER TABLE gk_logincreds
-	DROP COLUMN login,
-	DROP COLUMN password,
-	DROP COLUMN site
+const createMigrationsTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	);
 `
 
-const alterTableNotes = `
-	ALTER TABLE gk_notes
-	RENAME COLUMN note TO data
+// SQLite parses times back only from columns declared TIMESTAMP
+const createSQLiteMigrationsTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);
 `
 
-// UNIQUE constrains
-const createUniqueCardConstraint = `
-	ALTER TABLE gk_cards
-	ADD CONSTRAINT gk_unique_cardname UNIQUE (cardname, user_id)
+const listMigrationsQuery = `
+	SELECT version, name, applied_at
+	FROM schema_migrations
+	ORDER BY version;
 `
 
-const createUniqueNoteConstraint = `
-	ALTER TABLE gk_notes
-	ADD CONSTRAINT gk_unique_notename UNIQUE (name, user_id)
+const addMigrationQuery = `
+	INSERT INTO schema_migrations(version, name, applied_at)
+	VALUES ($1,$2,$3);
 `
 
-const createUniqueLoginCredsConstraint = `
-	ALTER TABLE gk_logincreds
-	ADD CONSTRAINT gk_unique_name UNIQUE (name, user_id)
+const deleteMigrationQuery = `
+	DELETE FROM schema_migrations
+	WHERE version = $1;
 `
 
-const createUniqueBinaryConstraint = `
-	ALTER TABLE gk_binaries
-	ADD CONSTRAINT gk_unique_binaryname UNIQUE (name, user_id)
-`
+// ErrUnknownMigration means the database was migrated by a newer version of the server
+var ErrUnknownMigration = errors.New("database has migrations unknown to this version, migrate down with the newer version first")
+
+// Migration is a versioned schema change with SQL to apply and to revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String returns the migration as it is named in the files
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrationStatus is a migration with the time it was applied, zero if it is pending
+type MigrationStatus struct {
+	Migration
+	AppliedAt time.Time
+	// Unknown marks migrations applied by a newer version of the server
+	Unknown bool
+}
+
+// Migrator applies migrations to the database, each command runs in one transaction
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// NewMigrator returns the migrator of the database with migrations of its dialect
+func NewMigrator(db *sql.DB, dialect Dialect) (*Migrator, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Migrations returns embedded migrations of the dialect ordered by version
+func Migrations(dialect Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations of %s:%w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		up := strings.HasSuffix(file, ".up.sql")
+		if !up && !strings.HasSuffix(file, ".down.sql") {
+			return nil, fmt.Errorf("unexpected migration file %s", file)
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(file, ".up.sql"), ".down.sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration file %s has no version", file)
+		}
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s:%w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", m, base)
+		}
+		if up {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s must have both up and down files", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// begin starts the transaction of a command and creates the table of applied migrations.
+// Postgres servers wait for each other on the advisory lock, SQLite transactions
+// take the write lock at once as the database is opened with _txlock=immediate
+func (m *Migrator) begin() (*sql.Tx, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("can't begin migration transaction:%w", err)
+	}
+	createTable := createSQLiteMigrationsTableQuery
+	if m.dialect == Postgres {
+		createTable = createMigrationsTableQuery
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("can't lock migrations:%w", err)
+		}
+	}
+	if _, err := tx.Exec(createTable); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating schema_migrations table:%w", err)
+	}
+	return tx, nil
+}
+
+// applied returns applied migrations by version
+func (m *Migrator) applied(tx *sql.Tx) (map[int]MigrationStatus, error) {
+	rows, err := tx.Query(listMigrationsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error listing applied migrations:%w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		var s MigrationStatus
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning applied migrations:%w", err)
+		}
+		s.Unknown = true
+		applied[s.Version] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning applied migrations:%w", err)
+	}
+	for _, migration := range m.migrations {
+		if s, ok := applied[migration.Version]; ok {
+			s.Migration, s.Unknown = migration, false
+			applied[migration.Version] = s
+		}
+	}
+	return applied, nil
+}
+
+// Up applies pending migrations in order and returns them.
+// Returns ErrUnknownMigration if a newer version of the server has migrated the database
+func (m *Migrator) Up() ([]Migration, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.applied(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range applied {
+		if s.Unknown {
+			return nil, ErrUnknownMigration
+		}
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if _, err := tx.Exec(migration.Up); err != nil {
+			return nil, fmt.Errorf("error applying migration %s:%w", migration, err)
+		}
+		if _, err := tx.Exec(addMigrationQuery, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("error saving migration %s:%w", migration, err)
+		}
+		done = append(done, migration)
+	}
+	return done, tx.Commit()
+}
+
+// Down reverts the last steps applied migrations and returns them, the last one first
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.applied(tx)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	var done []Migration
+	for _, version := range versions {
+		s := applied[version]
+		if s.Unknown {
+			return nil, ErrUnknownMigration
+		}
+		if _, err := tx.Exec(s.Down); err != nil {
+			return nil, fmt.Errorf("error reverting migration %s:%w", s.Migration, err)
+		}
+		if _, err := tx.Exec(deleteMigrationQuery, version); err != nil {
+			return nil, fmt.Errorf("error deleting migration %s:%w", s.Migration, err)
+		}
+		done = append(done, s.Migration)
+	}
+	return done, tx.Commit()
+}
+
+// Status returns all migrations known to this version and applied to the database, ordered by version
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied, err := m.applied(tx)
+	if err != nil {
+		return nil, err
+	}
+	var status []MigrationStatus
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			status = append(status, MigrationStatus{Migration: migration})
+		}
+	}
+	for _, s := range applied {
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
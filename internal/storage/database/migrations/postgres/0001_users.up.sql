@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS gk_users (
+	id SERIAL,
+	username text NOT NULL UNIQUE,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS gk_passwords (
+	id integer PRIMARY KEY,
+	password TEXT NOT NULL,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
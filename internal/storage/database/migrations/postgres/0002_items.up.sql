@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS gk_logincreds (
+	name TEXT NOT NULL,
+	data TEXT,
+	user_id integer NOT NULL,
+	encname TEXT NOT NULL DEFAULT '',
+	CONSTRAINT gk_unique_name UNIQUE (name, user_id),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_cards (
+	cardname TEXT NOT NULL,
+	user_id integer NOT NULL,
+	data TEXT,
+	encname TEXT NOT NULL DEFAULT '',
+	CONSTRAINT gk_unique_cardname UNIQUE (cardname, user_id),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_notes (
+	name TEXT NOT NULL,
+	data TEXT,
+	user_id integer NOT NULL,
+	encname TEXT NOT NULL DEFAULT '',
+	CONSTRAINT gk_unique_notename UNIQUE (name, user_id),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_binaries (
+	id SERIAL,
+	user_id integer NOT NULL,
+	name TEXT NOT NULL,
+	data BYTEA,
+	encname TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (id),
+	CONSTRAINT gk_unique_binaryname UNIQUE (name, user_id),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+-- databases created before migrations may have the tables without encrypted names
+ALTER TABLE gk_logincreds ADD COLUMN IF NOT EXISTS encname TEXT NOT NULL DEFAULT '';
+ALTER TABLE gk_cards ADD COLUMN IF NOT EXISTS encname TEXT NOT NULL DEFAULT '';
+ALTER TABLE gk_notes ADD COLUMN IF NOT EXISTS encname TEXT NOT NULL DEFAULT '';
+ALTER TABLE gk_binaries ADD COLUMN IF NOT EXISTS encname TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS gk_userkeys (
+	user_id integer PRIMARY KEY,
+	public_key TEXT NOT NULL,
+	private_key TEXT NOT NULL,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_shares (
+	id SERIAL,
+	owner_id integer NOT NULL,
+	recipient_id integer NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	data TEXT,
+	key TEXT,
+	PRIMARY KEY (id),
+	CONSTRAINT gk_unique_share UNIQUE (owner_id, recipient_id, kind, name),
+	CONSTRAINT fk_gk_owner
+		FOREIGN KEY (owner_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE,
+	CONSTRAINT fk_gk_recipient
+		FOREIGN KEY (recipient_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS gk_org_items;
+DROP TABLE IF EXISTS gk_org_members;
+DROP TABLE IF EXISTS gk_orgs;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS gk_orgs (
+	id SERIAL,
+	name TEXT NOT NULL UNIQUE,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS gk_org_members (
+	org_id integer NOT NULL,
+	user_id integer NOT NULL,
+	role TEXT NOT NULL,
+	vault_key TEXT NOT NULL,
+	PRIMARY KEY (org_id, user_id),
+	CONSTRAINT fk_gk_orgs
+		FOREIGN KEY (org_id)
+			REFERENCES gk_orgs(id)
+			ON DELETE CASCADE,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_org_items (
+	id SERIAL,
+	org_id integer NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	data TEXT,
+	PRIMARY KEY (id),
+	CONSTRAINT gk_unique_org_item UNIQUE (org_id, kind, name),
+	CONSTRAINT fk_gk_orgs
+		FOREIGN KEY (org_id)
+			REFERENCES gk_orgs(id)
+			ON DELETE CASCADE
+);
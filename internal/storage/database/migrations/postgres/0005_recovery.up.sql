@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS gk_srp_verifiers (
+	id integer PRIMARY KEY,
+	salt TEXT NOT NULL,
+	verifier TEXT NOT NULL,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_vaultkeys (
+	user_id integer NOT NULL,
+	kind TEXT NOT NULL,
+	wrapped_key TEXT NOT NULL,
+	PRIMARY KEY (user_id, kind),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_recovery (
+	id integer PRIMARY KEY,
+	verifier TEXT NOT NULL,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS gk_backup_codes;
+DROP TABLE IF EXISTS gk_totp;
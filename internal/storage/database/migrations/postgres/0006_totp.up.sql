@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS gk_totp (
+	id integer PRIMARY KEY,
+	secret TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_backup_codes (
+	id SERIAL,
+	user_id integer NOT NULL,
+	code TEXT NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS gk_sessions (
+	id TEXT PRIMARY KEY,
+	user_id integer NOT NULL,
+	refresh_hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked BOOLEAN NOT NULL DEFAULT FALSE,
+	device_id TEXT,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_login_failures (
+	login TEXT PRIMARY KEY,
+	failures integer NOT NULL,
+	last_failure TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS gk_devices (
+	id TEXT NOT NULL,
+	user_id integer NOT NULL,
+	name TEXT NOT NULL,
+	version TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	first_seen TIMESTAMPTZ NOT NULL,
+	last_seen TIMESTAMPTZ NOT NULL,
+	revoked BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (user_id, id),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+-- databases created before migrations may have sessions without devices
+ALTER TABLE gk_sessions ADD COLUMN IF NOT EXISTS device_id TEXT;
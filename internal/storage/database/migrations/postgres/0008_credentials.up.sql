@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS gk_user_certs (
+	cert_id TEXT PRIMARY KEY,
+	user_id integer NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_api_keys (
+	id TEXT PRIMARY KEY,
+	user_id integer NOT NULL,
+	name TEXT NOT NULL,
+	key_hash TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_login_keys (
+	id TEXT PRIMARY KEY,
+	user_id integer NOT NULL,
+	name TEXT NOT NULL,
+	public_key TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL,
+	last_used_at TIMESTAMPTZ,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
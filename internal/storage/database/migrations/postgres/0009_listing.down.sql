@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS gk_item_tags;
+DROP INDEX IF EXISTS gk_binaries_modified;
+DROP INDEX IF EXISTS gk_notes_modified;
+DROP INDEX IF EXISTS gk_cards_modified;
+DROP INDEX IF EXISTS gk_logincreds_modified;
+ALTER TABLE gk_binaries DROP COLUMN IF EXISTS modified_at;
+ALTER TABLE gk_notes DROP COLUMN IF EXISTS modified_at;
+ALTER TABLE gk_cards DROP COLUMN IF EXISTS modified_at;
+ALTER TABLE gk_logincreds DROP COLUMN IF EXISTS modified_at;
@@ -0,0 +1,2 @@
+ALTER TABLE gk_changes DROP COLUMN IF EXISTS device;
+ALTER TABLE gk_changes DROP COLUMN IF EXISTS hash;
@@ -0,0 +1,3 @@
+-- clients detect conflicting edits by hashes of the content and name the device of the change
+ALTER TABLE gk_changes ADD COLUMN IF NOT EXISTS hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE gk_changes ADD COLUMN IF NOT EXISTS device TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE gk_login_keys DROP COLUMN IF EXISTS device_id;
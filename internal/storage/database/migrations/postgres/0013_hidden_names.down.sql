@@ -0,0 +1,2 @@
+ALTER TABLE gk_org_items DROP COLUMN IF EXISTS encname;
+ALTER TABLE gk_shares DROP COLUMN IF EXISTS encname;
@@ -0,0 +1,4 @@
+-- names of shares and organization items are blind indexes, the names are kept encrypted
+-- with the share or organization key. Rows saved before keep their names in clear
+ALTER TABLE gk_shares ADD COLUMN IF NOT EXISTS encname TEXT NOT NULL DEFAULT '';
+ALTER TABLE gk_org_items ADD COLUMN IF NOT EXISTS encname TEXT NOT NULL DEFAULT '';
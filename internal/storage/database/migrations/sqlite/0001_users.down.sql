@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS gk_passwords;
+DROP TABLE IF EXISTS gk_users;
@@ -0,0 +1,16 @@
+-- keys referring to users are INT, not INTEGER: INTEGER PRIMARY KEY is the rowid in SQLite
+-- and would get a new id instead of NULL for an unknown user
+
+CREATE TABLE IF NOT EXISTS gk_users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS gk_passwords (
+	id INT NOT NULL PRIMARY KEY,
+	password TEXT NOT NULL,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
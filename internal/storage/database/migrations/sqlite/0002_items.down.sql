@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS gk_binaries;
+DROP TABLE IF EXISTS gk_notes;
+DROP TABLE IF EXISTS gk_cards;
+DROP TABLE IF EXISTS gk_logincreds;
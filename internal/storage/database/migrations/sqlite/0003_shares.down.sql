@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS gk_shares;
+DROP TABLE IF EXISTS gk_userkeys;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS gk_orgs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS gk_org_members (
+	org_id integer NOT NULL,
+	user_id integer NOT NULL,
+	role TEXT NOT NULL,
+	vault_key TEXT NOT NULL,
+	PRIMARY KEY (org_id, user_id),
+	CONSTRAINT fk_gk_orgs
+		FOREIGN KEY (org_id)
+			REFERENCES gk_orgs(id)
+			ON DELETE CASCADE,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_org_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	org_id integer NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	data TEXT,
+	CONSTRAINT gk_unique_org_item UNIQUE (org_id, kind, name),
+	CONSTRAINT fk_gk_orgs
+		FOREIGN KEY (org_id)
+			REFERENCES gk_orgs(id)
+			ON DELETE CASCADE
+);
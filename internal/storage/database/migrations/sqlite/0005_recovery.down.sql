@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS gk_recovery;
+DROP TABLE IF EXISTS gk_vaultkeys;
+DROP TABLE IF EXISTS gk_srp_verifiers;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS gk_totp (
+	id INT NOT NULL PRIMARY KEY,
+	secret TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_backup_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id integer NOT NULL,
+	code TEXT NOT NULL,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS gk_devices;
+DROP TABLE IF EXISTS gk_login_failures;
+DROP TABLE IF EXISTS gk_sessions;
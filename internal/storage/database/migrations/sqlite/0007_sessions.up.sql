@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS gk_sessions (
+	id TEXT PRIMARY KEY,
+	user_id integer NOT NULL,
+	refresh_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	revoked BOOLEAN NOT NULL DEFAULT FALSE,
+	device_id TEXT,
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS gk_login_failures (
+	login TEXT PRIMARY KEY,
+	failures integer NOT NULL,
+	last_failure TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS gk_devices (
+	id TEXT NOT NULL,
+	user_id integer NOT NULL,
+	name TEXT NOT NULL,
+	version TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	first_seen TIMESTAMP NOT NULL,
+	last_seen TIMESTAMP NOT NULL,
+	revoked BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (user_id, id),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS gk_login_keys;
+DROP TABLE IF EXISTS gk_api_keys;
+DROP TABLE IF EXISTS gk_user_certs;
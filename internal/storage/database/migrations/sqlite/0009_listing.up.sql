@@ -0,0 +1,22 @@
+-- items are listed by modification time and filtered by tags
+ALTER TABLE gk_logincreds ADD COLUMN modified_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE gk_cards ADD COLUMN modified_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE gk_notes ADD COLUMN modified_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE gk_binaries ADD COLUMN modified_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+
+CREATE INDEX IF NOT EXISTS gk_logincreds_modified ON gk_logincreds(user_id, modified_at, name);
+CREATE INDEX IF NOT EXISTS gk_cards_modified ON gk_cards(user_id, modified_at, cardname);
+CREATE INDEX IF NOT EXISTS gk_notes_modified ON gk_notes(user_id, modified_at, name);
+CREATE INDEX IF NOT EXISTS gk_binaries_modified ON gk_binaries(user_id, modified_at, name);
+
+CREATE TABLE IF NOT EXISTS gk_item_tags (
+	user_id integer NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (user_id, kind, tag, name),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
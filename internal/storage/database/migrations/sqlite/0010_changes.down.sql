@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS gk_changes_revision;
+DROP TABLE IF EXISTS gk_changes;
+ALTER TABLE gk_users DROP COLUMN revision;
@@ -0,0 +1,18 @@
+-- every change of the user's items takes the next revision of the user
+ALTER TABLE gk_users ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
+
+-- the last change of each item, deleted items are kept so the deletion reaches every device
+CREATE TABLE IF NOT EXISTS gk_changes (
+	user_id integer NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	revision BIGINT NOT NULL,
+	deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (user_id, kind, name),
+	CONSTRAINT fk_gk_users
+		FOREIGN KEY (user_id)
+			REFERENCES gk_users(id)
+			ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS gk_changes_revision ON gk_changes(user_id, revision);
@@ -0,0 +1,2 @@
+ALTER TABLE gk_changes DROP COLUMN device;
+ALTER TABLE gk_changes DROP COLUMN hash;
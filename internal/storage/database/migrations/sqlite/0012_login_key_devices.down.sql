@@ -0,0 +1 @@
+ALTER TABLE gk_login_keys DROP COLUMN device_id;
@@ -0,0 +1,3 @@
+-- login keys belong to the device they were registered from and are deleted when it is revoked.
+-- Keys registered before have no device and are refused, they have to be added again
+ALTER TABLE gk_login_keys ADD COLUMN device_id TEXT NOT NULL DEFAULT '';
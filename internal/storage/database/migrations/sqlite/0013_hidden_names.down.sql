@@ -0,0 +1,2 @@
+ALTER TABLE gk_org_items DROP COLUMN encname;
+ALTER TABLE gk_shares DROP COLUMN encname;
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newMigrator(t *testing.T) *Migrator {
+	t.Helper()
+	db, dialect, err := Open("sqlite://"+filepath.Join(t.TempDir(), "vault.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := NewMigrator(db, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func tableExists(t *testing.T, m *Migrator, table string) bool {
+	t.Helper()
+	var n int
+	err := m.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1`, table).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func columnExists(t *testing.T, m *Migrator, table string, column string) bool {
+	t.Helper()
+	var n int
+	err := m.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2`, table, column).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestMigrationsOfDialectsMatch(t *testing.T) {
+	names := func(dialect Dialect) []string {
+		migrations, err := Migrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, m := range migrations {
+			names = append(names, m.String())
+		}
+		return names
+	}
+	postgres, sqlite := names(Postgres), names(SQLite)
+	if len(postgres) == 0 || !reflect.DeepEqual(postgres, sqlite) {
+		t.Fatalf("migrations differ: postgres %v, sqlite %v", postgres, sqlite)
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	m := newMigrator(t)
+	last := m.migrations[len(m.migrations)-1]
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.migrations) || !tableExists(t, m, "gk_users") || !tableExists(t, m, "gk_login_keys") || !tableExists(t, m, "gk_item_tags") || !columnExists(t, m, "gk_login_keys", "device_id") || !columnExists(t, m, "gk_shares", "encname") {
+		t.Fatalf("up: applied %v", applied)
+	}
+	if applied, err = m.Up(); err != nil || len(applied) != 0 {
+		t.Fatalf("up again: applied %v, error %v", applied, err)
+	}
+
+	reverted, err := m.Down(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != last.Version || columnExists(t, m, "gk_shares", "encname") || columnExists(t, m, "gk_org_items", "encname") {
+		t.Fatalf("down: reverted %v", reverted)
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if pending := s.AppliedAt.IsZero(); pending != (s.Version == last.Version) {
+			t.Fatalf("status after down: %+v", status)
+		}
+	}
+
+	if applied, err = m.Up(); err != nil || len(applied) != 1 || applied[0].Version != last.Version {
+		t.Fatalf("up after down: applied %v, error %v", applied, err)
+	}
+	if reverted, err = m.Down(len(m.migrations) + 1); err != nil || len(reverted) != len(m.migrations) {
+		t.Fatalf("down all: reverted %v, error %v", reverted, err)
+	}
+	if tableExists(t, m, "gk_users") {
+		t.Fatal("down all: gk_users is left")
+	}
+	if reverted, err = m.Down(1); err != nil || len(reverted) != 0 {
+		t.Fatalf("down of empty database: reverted %v, error %v", reverted, err)
+	}
+}
+
+func TestMigrateUnknown(t *testing.T) {
+	m := newMigrator(t)
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.db.Exec(addMigrationQuery, 9999, "newer", "2026-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(); err != ErrUnknownMigration {
+		t.Fatalf("up: got error %v", err)
+	}
+	if _, err := m.Down(1); err != ErrUnknownMigration {
+		t.Fatalf("down: got error %v", err)
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := status[len(status)-1]; !s.Unknown || s.Name != "newer" {
+		t.Fatalf("status: got %+v", s)
+	}
+}
+
+func TestMigrateConcurrently(t *testing.T) {
+	path := "sqlite://" + filepath.Join(t.TempDir(), "vault.db")
+	results := make(chan int)
+	for i := 0; i < 3; i++ {
+		go func() {
+			db, dialect, err := Open(path, "")
+			if err != nil {
+				t.Error(err)
+				results <- 0
+				return
+			}
+			defer db.Close()
+			m, err := NewMigrator(db, dialect)
+			if err != nil {
+				t.Error(err)
+				results <- 0
+				return
+			}
+			applied, err := m.Up()
+			if err != nil {
+				t.Error(err)
+			}
+			results <- len(applied)
+		}()
+	}
+
+	var total int
+	for i := 0; i < 3; i++ {
+		total += <-results
+	}
+	migrations, _ := Migrations(SQLite)
+	if total != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", total, len(migrations))
+	}
+}
@@ -0,0 +1,387 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// CreateOrg creates new organization with the user as its owner.
+// Returns storage.ErrMetanameIsTaken if the name is taken
+func (s *SQLdb) CreateOrg(ctx context.Context, username string, org storage.Org) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in CreateOrg:%w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRowContext(ctx, createOrgQuery, org.Name).Scan(&id); err != nil {
+		if IsUniqueConstraintViolation(err) {
+			return storage.ErrMetanameIsTaken
+		}
+		return fmt.Errorf("error in CreateOrg:%w", err)
+	}
+	if _, err := tx.ExecContext(ctx, addOrgOwnerQuery, id, username, storage.RoleOwner, org.VaultKey); err != nil {
+		return fmt.Errorf("error adding owner in CreateOrg:%w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ListOrgs returns organizations the user is a member of, with user's role and sealed vault key
+func (s *SQLdb) ListOrgs(ctx context.Context, username string) (orgs []storage.Org, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, listOrgsQuery, username)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't ask database in ListOrgs:%w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var org storage.Org
+		if err := rows.Scan(&org.Name, &org.Role, &org.VaultKey); err != nil {
+			return nil, fmt.Errorf("error scanning in ListOrgs:%w", err)
+		}
+		orgs = append(orgs, org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning with rows.Next() in ListOrgs:%w", err)
+	}
+
+	return orgs, nil
+}
+
+// GetOrgRole returns user's role in the organization.
+// Returns storage.ErrDataNotFound if user is not a member
+func (s *SQLdb) GetOrgRole(ctx context.Context, username string, orgname string) (role string, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err = s.DB.QueryRowContext(ctx, getOrgRoleQuery, username, orgname).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", storage.ErrDataNotFound
+		}
+		return "", fmt.Errorf("error in GetOrgRole:%w", err)
+	}
+	return role, nil
+}
+
+// SetOrgMember adds a member to the organization or updates role and vault key of existing one.
+// Returns storage.ErrDataNotFound if there is no such organization or user
+// and storage.ErrLastOwner if it demotes the only owner
+func (s *SQLdb) SetOrgMember(ctx context.Context, member storage.OrgMember) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.beginOrgTx(ctx)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in SetOrgMember:%w", err)
+	}
+	defer tx.Rollback()
+
+	if member.Role != storage.RoleOwner {
+		last, err := lastOwner(ctx, tx, member.Org, member.Login)
+		if err != nil {
+			return fmt.Errorf("error counting owners in SetOrgMember:%w", err)
+		}
+		if last {
+			return storage.ErrLastOwner
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, setOrgMemberQuery, member.Org, member.Login, member.Role, member.VaultKey)
+	if err != nil {
+		if IsNotNullViolation(err) {
+			return storage.ErrDataNotFound
+		}
+		return fmt.Errorf("error setting member in SetOrgMember:%w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteOrgMember removes a member from the organization.
+// Returns storage.ErrLastOwner if the member is the only owner
+func (s *SQLdb) DeleteOrgMember(ctx context.Context, orgname string, login string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.beginOrgTx(ctx)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in DeleteOrgMember:%w", err)
+	}
+	defer tx.Rollback()
+
+	if last, err := lastOwner(ctx, tx, orgname, login); err != nil {
+		return fmt.Errorf("error counting owners in DeleteOrgMember:%w", err)
+	} else if last {
+		return storage.ErrLastOwner
+	}
+
+	res, err := tx.ExecContext(ctx, deleteOrgMemberQuery, orgname, login)
+	if err != nil {
+		return fmt.Errorf("error deleting member in DeleteOrgMember:%w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error in DeleteOrgMember:%w", err)
+	}
+	if n == 0 {
+		return storage.ErrDataNotFound
+	}
+	return tx.Commit()
+}
+
+// beginOrgTx begins a transaction changing members or items of an organization. On Postgres
+// the transaction is serializable, so concurrent changes of the same organization fail one of the transactions,
+// SQLite transactions are serial anyway
+func (s *SQLdb) beginOrgTx(ctx context.Context) (*sql.Tx, error) {
+	var opts *sql.TxOptions
+	if s.Dialect == Postgres {
+		opts = &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+	return s.DB.BeginTx(ctx, opts)
+}
+
+// lastOwner reports whether the user is the only owner of the organization
+func lastOwner(ctx context.Context, tx *sql.Tx, orgname, login string) (bool, error) {
+	var role string
+	err := tx.QueryRowContext(ctx, getOrgRoleQuery, login, orgname).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil || role != storage.RoleOwner {
+		return false, err
+	}
+	var owners int
+	if err := tx.QueryRowContext(ctx, countOrgRoleQuery, orgname, storage.RoleOwner).Scan(&owners); err != nil {
+		return false, err
+	}
+	return owners == 1, nil
+}
+
+// RotateOrgKey removes the member and replaces the vault keys of the remaining members and the data
+// of the items, renaming them to their new blind indexes, in one transaction. Returns storage.ErrOrgChanged
+// if the rotation doesn't cover exactly the remaining members and the items, members and items added
+// meanwhile fail one of the transactions. Returns storage.ErrLastOwner if the member is the only owner
+func (s *SQLdb) RotateOrgKey(ctx context.Context, rotation storage.OrgRotation) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.beginOrgTx(ctx)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction in RotateOrgKey:%w", err)
+	}
+	defer tx.Rollback()
+
+	if last, err := lastOwner(ctx, tx, rotation.Org, rotation.Login); err != nil {
+		return fmt.Errorf("error counting owners in RotateOrgKey:%w", err)
+	} else if last {
+		return storage.ErrLastOwner
+	}
+
+	res, err := tx.ExecContext(ctx, deleteOrgMemberQuery, rotation.Org, rotation.Login)
+	if err != nil {
+		return fmt.Errorf("error deleting member in RotateOrgKey:%w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error in RotateOrgKey:%w", err)
+	} else if n == 0 {
+		return storage.ErrDataNotFound
+	}
+
+	members, err := queryKeys(ctx, tx, memberKey, listOrgMembersQuery, rotation.Org)
+	if err != nil {
+		return fmt.Errorf("error listing members in RotateOrgKey:%w", err)
+	}
+	items, err := queryKeys(ctx, tx, itemKey, listOrgItemKeysQuery, rotation.Org)
+	if err != nil {
+		return fmt.Errorf("error listing items in RotateOrgKey:%w", err)
+	}
+	if len(members) != len(rotation.Members) || len(items) != len(rotation.Items) {
+		return storage.ErrOrgChanged
+	}
+	for _, member := range rotation.Members {
+		if _, ok := members[member.Login]; !ok {
+			return storage.ErrOrgChanged
+		}
+		delete(members, member.Login)
+		if _, err := tx.ExecContext(ctx, rotateOrgMemberKeyQuery, rotation.Org, member.Login, member.VaultKey); err != nil {
+			return fmt.Errorf("error updating member in RotateOrgKey:%w", err)
+		}
+	}
+	for _, item := range rotation.Items {
+		if _, ok := items[itemKey(item.Kind, item.Name)]; !ok {
+			return storage.ErrOrgChanged
+		}
+		delete(items, itemKey(item.Kind, item.Name))
+		name := item.Name
+		if item.Rename != "" {
+			name = item.Rename
+		}
+		if _, err := tx.ExecContext(ctx, rotateOrgItemQuery, rotation.Org, item.Kind, item.Name, name, item.EncName, item.Data); err != nil {
+			return fmt.Errorf("error updating item in RotateOrgKey:%w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func memberKey(login, _ string) string { return login }
+
+func itemKey(kind, name string) string { return kind + "/" + name }
+
+// queryKeys returns the keys of the rows of two columns, logins of members or kinds with names of items
+func queryKeys(ctx context.Context, tx *sql.Tx, key func(first, second string) string, query string, args ...any) (map[string]struct{}, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]struct{})
+	for rows.Next() {
+		var first, second string
+		if err := rows.Scan(&first, &second); err != nil {
+			return nil, err
+		}
+		names[key(first, second)] = struct{}{}
+	}
+	return names, rows.Err()
+}
+
+// ListOrgMembers returns members of the organization and their roles
+func (s *SQLdb) ListOrgMembers(ctx context.Context, orgname string) (members []storage.OrgMember, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, listOrgMembersQuery, orgname)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't ask database in ListOrgMembers:%w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member := storage.OrgMember{Org: orgname}
+		if err := rows.Scan(&member.Login, &member.Role); err != nil {
+			return nil, fmt.Errorf("error scanning in ListOrgMembers:%w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning with rows.Next() in ListOrgMembers:%w", err)
+	}
+
+	return members, nil
+}
+
+// SetOrgItem saves new item in the organization vault.
+// Returns storage.ErrMetanameIsTaken if there is an item of the kind with the name already
+func (s *SQLdb) SetOrgItem(ctx context.Context, item storage.OrgItem) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, setOrgItemQuery, item.Org, item.Kind, item.Name, item.Data, item.EncName)
+	if err != nil {
+		switch {
+		case IsUniqueConstraintViolation(err):
+			return storage.ErrMetanameIsTaken
+		case IsNotNullViolation(err):
+			return storage.ErrDataNotFound
+		}
+		return fmt.Errorf("error setting item in SetOrgItem:%w", err)
+	}
+	return nil
+}
+
+// UpdateOrgItem replaces the data of an item in the organization vault.
+// Returns storage.ErrDataNotFound if there is no such item
+func (s *SQLdb) UpdateOrgItem(ctx context.Context, item storage.OrgItem) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, updateOrgItemQuery, item.Org, item.Kind, item.Name, item.Data, item.EncName)
+	if err != nil {
+		return fmt.Errorf("error updating item in UpdateOrgItem:%w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error in UpdateOrgItem:%w", err)
+	}
+	if n == 0 {
+		return storage.ErrDataNotFound
+	}
+	return nil
+}
+
+// DeleteOrgItem removes an item from the organization vault.
+// Returns storage.ErrDataNotFound if there is no such item
+func (s *SQLdb) DeleteOrgItem(ctx context.Context, orgname string, kind string, name string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, deleteOrgItemQuery, orgname, kind, name)
+	if err != nil {
+		return fmt.Errorf("error deleting item in DeleteOrgItem:%w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error in DeleteOrgItem:%w", err)
+	}
+	if n == 0 {
+		return storage.ErrDataNotFound
+	}
+	return nil
+}
+
+// GetOrgItem returns an item of the organization vault
+func (s *SQLdb) GetOrgItem(ctx context.Context, orgname string, kind string, name string) (item storage.OrgItem, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	item.Org = orgname
+	err = s.DB.QueryRowContext(ctx, getOrgItemQuery, orgname, kind, name).Scan(&item.Kind, &item.Name, &item.EncName, &item.Data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.OrgItem{}, storage.ErrDataNotFound
+		}
+		return storage.OrgItem{}, fmt.Errorf("error in GetOrgItem:%w", err)
+	}
+	return item, nil
+}
+
+// ListOrgItems returns kinds, names and encrypted names of all items in the organization vault
+func (s *SQLdb) ListOrgItems(ctx context.Context, orgname string) (items []storage.OrgItem, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, listOrgItemsQuery, orgname)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't ask database in ListOrgItems:%w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := storage.OrgItem{Org: orgname}
+		if err := rows.Scan(&item.Kind, &item.Name, &item.EncName); err != nil {
+			return nil, fmt.Errorf("error scanning in ListOrgItems:%w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning with rows.Next() in ListOrgItems:%w", err)
+	}
+
+	return items, nil
+}
@@ -1,70 +1,6 @@
 package database
 
-// SQL queries
-// database init queries
-const checkTableExistsQuery = `
-	SELECT EXISTS (
-		SELECT 	1 
-		FROM 	information_schema.tables
-		WHERE 	table_name = $1
-	);
-`
-
-const createLoginCredsTableQuery = `
-	CREATE TABLE gk_logincreds (
-		name TEXT NOT NULL,
-		login TEXT,
-		password TEXT,
-		site TEXT,
-		user_id integer NOT NULL,
-		CONSTRAINT fk_gk_users
-			FOREIGN KEY (user_id)
-				REFERENCES gk_users(id)
-				ON DELETE CASCADE
-	);
-`
-
-const createCardsTableQuery = `
-	CREATE TABLE gk_cards (
-		cardname TEXT NOT NULL,
-		number TEXT,
-		name TEXT,
-		surname TEXT,
-		valid_till TEXT,
-		code TEXT,
-		user_id integer NOT NULL,
-		CONSTRAINT fk_gk_users
-			FOREIGN KEY (user_id)
-				REFERENCES gk_users(id)
-				ON DELETE CASCADE
-	);
-`
-
-const createNotesTableQuery = `
-	CREATE TABLE gk_notes (
-		name TEXT NOT NULL,
-		note TEXT,
-		user_id integer NOT NULL,
-		CONSTRAINT fk_gk_users
-			FOREIGN KEY (user_id)
-				REFERENCES gk_users(id)
-				ON DELETE CASCADE
-	)
-`
-
-const createBinariesTableQuery = `
-	CREATE TABLE gk_binaries (
-		id SERIAL,
-		user_id integer NOT NULL,
-		name TEXT NOT NULL,
-		data BYTEA,
-		PRIMARY KEY (id),
-		CONSTRAINT fk_gk_users
-			FOREIGN KEY (user_id)
-				REFERENCES gk_users(id)
-				ON DELETE CASCADE
-	)
-`
+// SQL queries, the tables are created by migrations
 
 // set/get queries
 
@@ -76,42 +12,57 @@ const listCardsQuery = `
 `
 
 const setCardQuery = `
-	INSERT INTO gk_cards(cardname, data, user_id)
-	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3));
+	INSERT INTO gk_cards(cardname, data, user_id, encname, modified_at)
+	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3),$4,$5);
 `
 
 const getCardQuery = `
-	SELECT gk_cards.cardname, gk_cards.data
+	SELECT gk_cards.cardname, gk_cards.data, gk_cards.encname
 	FROM gk_cards
 	JOIN gk_users ON gk_cards.user_id = gk_users.id
 	WHERE gk_cards.cardname=$1 AND gk_users.username=$2;
 `
 
+const updateCardQuery = `
+	UPDATE gk_cards
+	SET data = $2, encname = $4, modified_at = $5
+	WHERE cardname = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$3);
+`
+
+const deleteCardQuery = `
+	DELETE FROM gk_cards
+	WHERE cardname = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$2);
+`
+
 const CheckIDbyUsernameQuery = `
 	SELECT id 
 	FROM gk_users 
 	WHERE username = $1;
 `
 
-const checkCardNameQuery = `
-	SELECT gk_cards.cardname
-	FROM gk_cards
-	JOIN gk_users ON gk_cards.user_id = gk_users.id
-	WHERE gk_cards.cardname=$1 AND gk_users.username=$2;
-`
-
 const setLoginCredsQuery = `
-	INSERT INTO gk_logincreds(name, data, user_id)
-	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3));
+	INSERT INTO gk_logincreds(name, data, user_id, encname, modified_at)
+	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3),$4,$5);
 `
 
 const getLoginCredsQuery = `
-	SELECT gk_logincreds.name, gk_logincreds.data 
+	SELECT gk_logincreds.name, gk_logincreds.data, gk_logincreds.encname
 	FROM gk_logincreds
 	JOIN gk_users ON gk_logincreds.user_id = gk_users.id
 	WHERE gk_logincreds.name=$1 AND gk_users.username=$2;
 `
 
+const updateLoginCredsQuery = `
+	UPDATE gk_logincreds
+	SET data = $2, encname = $4, modified_at = $5
+	WHERE name = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$3);
+`
+
+const deleteLoginCredsQuery = `
+	DELETE FROM gk_logincreds
+	WHERE name = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$2);
+`
+
 const listLoginCredsQuery = `
 	SELECT gk_logincreds.name
 	FROM gk_logincreds
@@ -120,17 +71,28 @@ const listLoginCredsQuery = `
 `
 
 const setNoteQuery = `
-	INSERT INTO gk_notes(name, data, user_id)
-	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3));
+	INSERT INTO gk_notes(name, data, user_id, encname, modified_at)
+	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3),$4,$5);
 `
 
 const getNoteQuery = `
-	SELECT gk_notes.name, gk_notes.data 
+	SELECT gk_notes.name, gk_notes.data, gk_notes.encname
 	FROM gk_notes
 	JOIN gk_users ON gk_notes.user_id = gk_users.id
 	WHERE gk_notes.name=$1 AND gk_users.username=$2;
 `
 
+const updateNoteQuery = `
+	UPDATE gk_notes
+	SET data = $2, encname = $4, modified_at = $5
+	WHERE name = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$3);
+`
+
+const deleteNoteQuery = `
+	DELETE FROM gk_notes
+	WHERE name = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$2);
+`
+
 const listNotesQuery = `
 	SELECT gk_notes.name
 	FROM gk_notes
@@ -139,20 +101,243 @@ const listNotesQuery = `
 `
 
 const setBinaryQuery = `
-	INSERT INTO gk_binaries(name, data, user_id)
-	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3));
+	INSERT INTO gk_binaries(name, data, user_id, encname, modified_at)
+	VALUES ($1,$2,(SELECT id FROM gk_users WHERE username=$3),$4,$5);
 `
 
 const getBinaryQuery = `
-	SELECT gk_binaries.name, gk_binaries.data 
+	SELECT gk_binaries.name, gk_binaries.data, gk_binaries.encname
 	FROM gk_binaries
 	JOIN gk_users ON gk_binaries.user_id = gk_users.id
 	WHERE gk_binaries.name=$1 AND gk_users.username=$2;
 `
 
+const updateBinaryQuery = `
+	UPDATE gk_binaries
+	SET data = $2, encname = $4, modified_at = $5
+	WHERE name = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$3);
+`
+
+const deleteBinaryQuery = `
+	DELETE FROM gk_binaries
+	WHERE name = $1 AND user_id = (SELECT id FROM gk_users WHERE username=$2);
+`
+
 const listBinariesQuery = `
 	SELECT gk_binaries.name
 	FROM gk_binaries
 	JOIN gk_users ON gk_binaries.user_id = gk_users.id
 	WHERE gk_users.username = $1;
 `
+
+const setKeyPairQuery = `
+	INSERT INTO gk_userkeys(user_id, public_key, private_key)
+	VALUES ((SELECT id FROM gk_users WHERE username=$1),$2,$3);
+`
+
+const getKeyPairQuery = `
+	SELECT gk_userkeys.public_key, gk_userkeys.private_key
+	FROM gk_userkeys
+	JOIN gk_users ON gk_userkeys.user_id = gk_users.id
+	WHERE gk_users.username = $1;
+`
+
+const setShareQuery = `
+	INSERT INTO gk_shares(owner_id, recipient_id, kind, name, data, key, encname)
+	VALUES (
+		(SELECT id FROM gk_users WHERE username=$1),
+		(SELECT id FROM gk_users WHERE username=$2),
+		$3,$4,$5,$6,$7
+	)
+	ON CONFLICT (owner_id, recipient_id, kind, name)
+	DO UPDATE SET data = EXCLUDED.data, key = EXCLUDED.key, encname = EXCLUDED.encname;
+`
+
+const listSharesReceivedQuery = `
+	SELECT owners.username, recipients.username, gk_shares.kind, gk_shares.name, gk_shares.encname, gk_shares.data, gk_shares.key
+	FROM gk_shares
+	JOIN gk_users AS owners ON gk_shares.owner_id = owners.id
+	JOIN gk_users AS recipients ON gk_shares.recipient_id = recipients.id
+	WHERE recipients.username = $1;
+`
+
+const listSharesOwnedQuery = `
+	SELECT owners.username, recipients.username, gk_shares.kind, gk_shares.name
+	FROM gk_shares
+	JOIN gk_users AS owners ON gk_shares.owner_id = owners.id
+	JOIN gk_users AS recipients ON gk_shares.recipient_id = recipients.id
+	WHERE owners.username = $1;
+`
+
+const deleteShareQuery = `
+	DELETE FROM gk_shares
+	WHERE owner_id = (SELECT id FROM gk_users WHERE username=$1)
+	AND recipient_id = (SELECT id FROM gk_users WHERE username=$2)
+	AND kind = $3 AND name = $4;
+`
+
+const createOrgQuery = `
+	INSERT INTO gk_orgs(name)
+	VALUES ($1)
+	RETURNING id;
+`
+
+const addOrgOwnerQuery = `
+	INSERT INTO gk_org_members(org_id, user_id, role, vault_key)
+	VALUES ($1,(SELECT id FROM gk_users WHERE username=$2),$3,$4);
+`
+
+const listOrgsQuery = `
+	SELECT gk_orgs.name, gk_org_members.role, gk_org_members.vault_key
+	FROM gk_org_members
+	JOIN gk_orgs ON gk_org_members.org_id = gk_orgs.id
+	JOIN gk_users ON gk_org_members.user_id = gk_users.id
+	WHERE gk_users.username = $1;
+`
+
+const getOrgRoleQuery = `
+	SELECT gk_org_members.role
+	FROM gk_org_members
+	JOIN gk_orgs ON gk_org_members.org_id = gk_orgs.id
+	JOIN gk_users ON gk_org_members.user_id = gk_users.id
+	WHERE gk_users.username = $1 AND gk_orgs.name = $2;
+`
+
+const setOrgMemberQuery = `
+	INSERT INTO gk_org_members(org_id, user_id, role, vault_key)
+	VALUES (
+		(SELECT id FROM gk_orgs WHERE name=$1),
+		(SELECT id FROM gk_users WHERE username=$2),
+		$3,$4
+	)
+	ON CONFLICT (org_id, user_id)
+	DO UPDATE SET role = EXCLUDED.role, vault_key = EXCLUDED.vault_key;
+`
+
+const deleteOrgMemberQuery = `
+	DELETE FROM gk_org_members
+	WHERE org_id = (SELECT id FROM gk_orgs WHERE name=$1)
+	AND user_id = (SELECT id FROM gk_users WHERE username=$2);
+`
+
+const rotateOrgMemberKeyQuery = `
+	UPDATE gk_org_members SET vault_key = $3
+	WHERE org_id = (SELECT id FROM gk_orgs WHERE name=$1)
+	AND user_id = (SELECT id FROM gk_users WHERE username=$2);
+`
+
+const updateOrgItemQuery = `
+	UPDATE gk_org_items SET data = $4, encname = $5
+	WHERE org_id = (SELECT id FROM gk_orgs WHERE name=$1)
+	AND kind = $2 AND name = $3;
+`
+
+const rotateOrgItemQuery = `
+	UPDATE gk_org_items SET name = $4, encname = $5, data = $6
+	WHERE org_id = (SELECT id FROM gk_orgs WHERE name=$1)
+	AND kind = $2 AND name = $3;
+`
+
+const deleteOrgItemQuery = `
+	DELETE FROM gk_org_items
+	WHERE org_id = (SELECT id FROM gk_orgs WHERE name=$1)
+	AND kind = $2 AND name = $3;
+`
+
+const countOrgRoleQuery = `
+	SELECT COUNT(*) FROM gk_org_members
+	WHERE org_id = (SELECT id FROM gk_orgs WHERE name=$1)
+	AND role = $2;
+`
+
+const listOrgMembersQuery = `
+	SELECT gk_users.username, gk_org_members.role
+	FROM gk_org_members
+	JOIN gk_orgs ON gk_org_members.org_id = gk_orgs.id
+	JOIN gk_users ON gk_org_members.user_id = gk_users.id
+	WHERE gk_orgs.name = $1;
+`
+
+const setOrgItemQuery = `
+	INSERT INTO gk_org_items(org_id, kind, name, data, encname)
+	VALUES ((SELECT id FROM gk_orgs WHERE name=$1),$2,$3,$4,$5);
+`
+
+const getOrgItemQuery = `
+	SELECT gk_org_items.kind, gk_org_items.name, gk_org_items.encname, gk_org_items.data
+	FROM gk_org_items
+	JOIN gk_orgs ON gk_org_items.org_id = gk_orgs.id
+	WHERE gk_orgs.name = $1 AND gk_org_items.kind = $2 AND gk_org_items.name = $3;
+`
+
+const listOrgItemsQuery = `
+	SELECT gk_org_items.kind, gk_org_items.name, gk_org_items.encname
+	FROM gk_org_items
+	JOIN gk_orgs ON gk_org_items.org_id = gk_orgs.id
+	WHERE gk_orgs.name = $1;
+`
+
+const listOrgItemKeysQuery = `
+	SELECT gk_org_items.kind, gk_org_items.name
+	FROM gk_org_items
+	JOIN gk_orgs ON gk_org_items.org_id = gk_orgs.id
+	WHERE gk_orgs.name = $1;
+`
+
+const setItemTagQuery = `
+	INSERT INTO gk_item_tags(user_id, kind, name, tag)
+	VALUES ((SELECT id FROM gk_users WHERE username=$1),$2,$3,$4)
+	ON CONFLICT DO NOTHING;
+`
+
+const deleteItemTagsQuery = `
+	DELETE FROM gk_item_tags
+	WHERE user_id = (SELECT id FROM gk_users WHERE username=$1) AND kind = $2 AND name = $3;
+`
+
+// change feed queries
+
+const nextRevisionQuery = `
+	UPDATE gk_users
+	SET revision = revision + 1
+	WHERE username = $1
+	RETURNING revision;
+`
+
+const getRevisionQuery = `
+	SELECT revision
+	FROM gk_users
+	WHERE username = $1;
+`
+
+const setChangeQuery = `
+	INSERT INTO gk_changes(user_id, kind, name, revision, deleted, hash, device)
+	VALUES ((SELECT id FROM gk_users WHERE username=$1),$2,$3,$4,$5,$6,$7)
+	ON CONFLICT (user_id, kind, name)
+	DO UPDATE SET revision = EXCLUDED.revision, deleted = EXCLUDED.deleted, hash = EXCLUDED.hash, device = EXCLUDED.device;
+`
+
+const getChangeQuery = `
+	SELECT gk_changes.revision, gk_changes.hash, gk_changes.device
+	FROM gk_changes
+	JOIN gk_users ON gk_changes.user_id = gk_users.id
+	WHERE gk_users.username = $1 AND gk_changes.kind = $2 AND gk_changes.name = $3;
+`
+
+const listChangesQuery = `
+	SELECT gk_changes.kind, gk_changes.name, gk_changes.revision, gk_changes.deleted, gk_changes.hash, gk_changes.device
+	FROM gk_changes
+	JOIN gk_users ON gk_changes.user_id = gk_users.id
+	WHERE gk_users.username = $1 AND gk_changes.revision > $2 AND gk_changes.revision <= $3
+	ORDER BY gk_changes.revision
+	LIMIT $4;
+`
+
+// a failed statement aborts the whole transaction in Postgres,
+// so every item of a batch is written within its own savepoint
+
+const itemSavepointQuery = `SAVEPOINT item;`
+
+const rollbackItemQuery = `ROLLBACK TO SAVEPOINT item;`
+
+const releaseItemQuery = `RELEASE SAVEPOINT item;`
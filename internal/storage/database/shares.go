@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// SetKeyPair saves user's public key and wrapped private key.
+// Returns storage.ErrMetanameIsTaken if the user has them already
+func (s *SQLdb) SetKeyPair(ctx context.Context, username string, keys storage.KeyPair) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, setKeyPairQuery, username, keys.PublicKey, keys.PrivateKey)
+	if err != nil {
+		if IsUniqueConstraintViolation(err) {
+			return storage.ErrMetanameIsTaken
+		}
+		return fmt.Errorf("error setting key pair in SetKeyPair:%w", err)
+	}
+	return nil
+}
+
+// GetKeyPair returns user's public key and wrapped private key
+func (s *SQLdb) GetKeyPair(ctx context.Context, username string) (keys storage.KeyPair, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err = s.DB.QueryRowContext(ctx, getKeyPairQuery, username).Scan(&keys.PublicKey, &keys.PrivateKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.KeyPair{}, storage.ErrDataNotFound
+		}
+		return storage.KeyPair{}, fmt.Errorf("error in GetKeyPair:%w", err)
+	}
+	return keys, nil
+}
+
+// SetShare saves an item shared by the user with share.Recipient.
+// Sharing the same item again replaces the previous share
+func (s *SQLdb) SetShare(ctx context.Context, username string, share storage.Share) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, setShareQuery, username, share.Recipient, share.Kind, share.Name, share.Data, share.Key, share.EncName)
+	if err != nil {
+		return fmt.Errorf("error setting share in SetShare:%w", err)
+	}
+	return nil
+}
+
+// ListSharesReceived returns all items shared with the user, including encrypted data
+func (s *SQLdb) ListSharesReceived(ctx context.Context, username string) (shares []storage.Share, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, listSharesReceivedQuery, username)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't ask database in ListSharesReceived:%w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var share storage.Share
+		err := rows.Scan(&share.Owner, &share.Recipient, &share.Kind, &share.Name, &share.EncName, &share.Data, &share.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning in ListSharesReceived:%w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning with rows.Next() in ListSharesReceived:%w", err)
+	}
+
+	return shares, nil
+}
+
+// ListSharesOwned returns items the user has shared with others, without encrypted data
+func (s *SQLdb) ListSharesOwned(ctx context.Context, username string) (shares []storage.Share, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, listSharesOwnedQuery, username)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't ask database in ListSharesOwned:%w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var share storage.Share
+		err := rows.Scan(&share.Owner, &share.Recipient, &share.Kind, &share.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning in ListSharesOwned:%w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning with rows.Next() in ListSharesOwned:%w", err)
+	}
+
+	return shares, nil
+}
+
+// DeleteShare revokes a share. Returns storage.ErrDataNotFound if there was no such share
+func (s *SQLdb) DeleteShare(ctx context.Context, username string, share storage.Share) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, deleteShareQuery, username, share.Recipient, share.Kind, share.Name)
+	if err != nil {
+		return fmt.Errorf("error deleting share in DeleteShare:%w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error in DeleteShare:%w", err)
+	}
+	if n == 0 {
+		return storage.ErrDataNotFound
+	}
+	return nil
+}
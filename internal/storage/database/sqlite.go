@@ -0,0 +1,39 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Dialect is the SQL database the storage runs on
+type Dialect string
+
+// Supported dialects
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// sqlitePragmas are set on every connection: foreign keys for ON DELETE CASCADE,
+// WAL with busy timeout so readers don't fail while a write is in progress,
+// immediate transactions so a transaction holds the write lock from its first read,
+// sortable time format for ORDER BY on timestamps
+const sqlitePragmas = "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)" +
+	"&_txlock=immediate&_time_format=sqlite"
+
+// Open opens the database of the storage. Storage is either empty or a postgres:// URI for Postgres,
+// with postgresStr used if empty, or sqlite:///path/to/file.db for the embedded SQLite database
+func Open(storage string, postgresStr string) (*sql.DB, Dialect, error) {
+	if strings.HasPrefix(storage, "sqlite://") {
+		path := strings.TrimPrefix(storage, "sqlite://")
+		db, err := sql.Open("sqlite", "file:"+path+sqlitePragmas)
+		return db, SQLite, err
+	}
+	if storage != "" {
+		postgresStr = storage
+	}
+	db, err := sql.Open("pgx", postgresStr)
+	return db, Postgres, err
+}
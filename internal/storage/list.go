@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sort orders of item lists, prefixed with "-" for descending order.
+// Names of items are blind indexes the server can't read, so sorting by name only gives
+// a stable order for paging. It is alphabetical for legacy plaintext names alone
+const (
+	SortName     = "name"
+	SortModified = "modified"
+)
+
+// page sizes of item lists
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// NextCursorHeader carries Page.Next in responses of the list endpoints
+const NextCursorHeader = "X-Next-Cursor"
+
+// ListOptions select a page of item names. The zero value selects the first page sorted by name
+type ListOptions struct {
+	// Sort is SortName or SortModified, either prefixed with "-" for descending order
+	Sort string
+	// Tag leaves the items tagged with it
+	Tag string
+	// Cursor is Page.Next of the previous page, empty for the first one
+	Cursor string
+	// Limit is the most names of the page, DefaultPageSize if 0 and MaxPageSize at most
+	Limit int
+}
+
+// Page is a page of item names. Next is the cursor of the next page, empty if this page is the last one
+type Page struct {
+	Names []string
+	Next  string
+}
+
+// ListedItem is an item as it is ordered in lists
+type ListedItem struct {
+	Name     string
+	Modified time.Time
+}
+
+// cursor is the position after the last item of a page
+type cursor struct {
+	Sort     string    `json:"s"`
+	Name     string    `json:"n"`
+	Modified time.Time `json:"m,omitempty"`
+}
+
+// Check validates the sort order and the cursor and returns the position the page starts after,
+// nil for the first page. Limit is set within the page sizes
+func (o *ListOptions) Check() (after *ListedItem, err error) {
+	if o.Sort == "" {
+		o.Sort = SortName
+	}
+	switch strings.TrimPrefix(o.Sort, "-") {
+	case SortName, SortModified:
+	default:
+		return nil, ErrWrongCursor
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultPageSize
+	}
+	if o.Limit > MaxPageSize {
+		o.Limit = MaxPageSize
+	}
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, ErrWrongCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != o.Sort {
+		return nil, ErrWrongCursor
+	}
+	return &ListedItem{Name: c.Name, Modified: c.Modified}, nil
+}
+
+// ByModified tells if the items are sorted by modification time
+func (o ListOptions) ByModified() bool {
+	return strings.TrimPrefix(o.Sort, "-") == SortModified
+}
+
+// Descending tells if the items are sorted in descending order
+func (o ListOptions) Descending() bool {
+	return strings.HasPrefix(o.Sort, "-")
+}
+
+// NewPage returns the page of the items, which are sorted and filtered already.
+// Storages ask for one item more than the limit to know if there is the next page
+func NewPage(opts ListOptions, items []ListedItem) Page {
+	var page Page
+	if len(items) > opts.Limit {
+		items = items[:opts.Limit]
+		last := items[len(items)-1]
+		c := cursor{Sort: opts.Sort, Name: last.Name}
+		if opts.ByModified() {
+			c.Modified = last.Modified
+		}
+		data, _ := json.Marshal(c)
+		page.Next = base64.RawURLEncoding.EncodeToString(data)
+	}
+	for _, item := range items {
+		page.Names = append(page.Names, item.Name)
+	}
+	return page
+}
+
+// SortListed sorts the items in the order of the options and leaves the ones after the position,
+// for storages which can't do it themselves
+func SortListed(opts ListOptions, items []ListedItem, after *ListedItem) []ListedItem {
+	less := func(a, b ListedItem) bool {
+		if opts.ByModified() && !a.Modified.Equal(b.Modified) {
+			return a.Modified.Before(b.Modified)
+		}
+		return a.Name < b.Name
+	}
+	if opts.Descending() {
+		ascending := less
+		less = func(a, b ListedItem) bool { return ascending(b, a) }
+	}
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+	if after == nil {
+		return items
+	}
+	start := sort.Search(len(items), func(i int) bool { return less(*after, items[i]) })
+	return items[start:]
+}
@@ -9,11 +9,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 
 	"github.com/gambruh/simplevault/internal/config"
 	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
 	"github.com/gambruh/simplevault/internal/storage"
 )
 
@@ -23,6 +23,9 @@ type LocalStorage struct {
 	Notes      []string
 	Binaries   []string
 	Mu         sync.Mutex
+
+	// Folder to keep files in. If empty, config.ClientCfg.LocalStorage is used
+	Folder string
 }
 
 const (
@@ -30,6 +33,7 @@ const (
 	notesFile      = "/notes"
 	loginCredsFile = "/logincred"
 	binariesFolder = "/binaries"
+	orgsFolder     = "/orgs"
 )
 
 var (
@@ -50,11 +54,29 @@ func NewStorage() *LocalStorage {
 
 }
 
+// NewOrgStorage returns local storage for items of the organization vault.
+// Its files are kept in a subfolder of the client's local storage
+func NewOrgStorage(orgname string) *LocalStorage {
+	ls := NewStorage()
+	ls.Folder = filepath.Join(config.ClientCfg.LocalStorage, orgsFolder, filepath.Base(orgname))
+	return ls
+}
+
+func (s *LocalStorage) folder() string {
+	if s.Folder != "" {
+		return s.Folder
+	}
+	return config.ClientCfg.LocalStorage
+}
+
 // InitStorage creates required directories if they doesn't exist yet
 // If files and directories exists, it checks for it's contents and get the data loaded into struct fields
 func (s *LocalStorage) InitStorage(key []byte) error {
 	//create local folders if needed
 	os.Mkdir(config.ClientCfg.LocalStorage, 0600)
+	if s.Folder != "" {
+		os.MkdirAll(s.Folder, 0700)
+	}
 	os.Mkdir(config.ClientCfg.BinInputFolder, 0600)
 	os.Mkdir(config.ClientCfg.BinOutputFolder, 0600)
 
@@ -108,11 +130,22 @@ func (s *LocalStorage) DeleteLocalStorage() error {
 		return err
 	}
 
+	if err := os.Remove(s.folder() + syncStateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("can't delete local cache:%w", err)
+	}
+
+	// organizations vaults are kept inside of the personal storage
+	if s.Folder == "" {
+		if err := os.RemoveAll(s.folder() + orgsFolder); err != nil {
+			return fmt.Errorf("can't delete local cache:%w", err)
+		}
+	}
+
 	return nil
 }
 
 func (s *LocalStorage) deleteCardsFile() error {
-	err := os.Remove(config.ClientCfg.LocalStorage + cardsFile)
+	err := os.Remove(s.folder() + cardsFile)
 	if err != nil {
 		return fmt.Errorf("can't delete local cache:%w", err)
 	}
@@ -120,7 +153,7 @@ func (s *LocalStorage) deleteCardsFile() error {
 }
 
 func (s *LocalStorage) deleteLoginCredsFile() error {
-	err := os.Remove(config.ClientCfg.LocalStorage + loginCredsFile)
+	err := os.Remove(s.folder() + loginCredsFile)
 	if err != nil {
 		return fmt.Errorf("can't delete local cache:%w", err)
 	}
@@ -128,7 +161,7 @@ func (s *LocalStorage) deleteLoginCredsFile() error {
 }
 
 func (s *LocalStorage) deleteNotesFile() error {
-	err := os.Remove(config.ClientCfg.LocalStorage + notesFile)
+	err := os.Remove(s.folder() + notesFile)
 	if err != nil {
 		return fmt.Errorf("can't delete local cache:%w", err)
 	}
@@ -136,7 +169,7 @@ func (s *LocalStorage) deleteNotesFile() error {
 }
 
 func (s *LocalStorage) deleteBinaryFiles() error {
-	err := os.RemoveAll(config.ClientCfg.LocalStorage + binariesFolder)
+	err := os.RemoveAll(s.folder() + binariesFolder)
 	if err != nil {
 		return fmt.Errorf("can't delete local cache:%w", err)
 	}
@@ -147,87 +180,33 @@ func (s *LocalStorage) deleteBinaryFiles() error {
 func (s *LocalStorage) SaveCard(card storage.Card, key []byte) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	// check if the card with this name is in storage. Return error if yes
-	if check := s.lookupCard(card.Cardname); check {
-		return ErrMetanameIsTaken
-	}
-
-	// add cardname to check array
-	s.Cards = append(s.Cards, card.Cardname)
-
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+cardsFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
-	if err != nil {
-		return fmt.Errorf("error in SaveCard when opening file:%w", err)
-	}
-	defer file.Close()
-
-	// concatenating card to string
-	cardStr := card.Cardname + "," + card.Number + "," + card.Name + "," + card.Surname + "," + card.ValidTill + "," + card.Code
-
-	// encrypting the card data
-	encrypted, err := encrypt.EncryptData([]byte(cardStr), key)
-	if err != nil {
-		return err
-	}
-	// Encode the encrypted password in base64 for storage
-	encodedData := base64.StdEncoding.EncodeToString(encrypted)
-
-	_, err = fmt.Fprintf(file, "%s\n", encodedData)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return fmt.Errorf("error in SaveCard when writing in file:%w", err)
-	}
+	// the name is the first field to find the card by
+	return s.appendItem(cardsFile, &s.Cards, card.Cardname, func() (string, error) {
+		return helpers.SealFields(key, card.Cardname, card.Number, card.Name, card.Surname, card.ValidTill, card.Code)
+	})
+}
 
-	return nil
+// SaveOpenedCard saves the card opened out of data received from the database under the name
+func (s *LocalStorage) SaveOpenedCard(cardname string, card *helpers.OpenedItem, key []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return s.appendItem(cardsFile, &s.Cards, cardname, func() (string, error) {
+		return card.Seal(cardname, key)
+	})
 }
 
-// GetCard gets the card data by its name, decrypts it and returns as a Card struct
-func (s *LocalStorage) GetCard(cardname string, key []byte) (card storage.Card, err error) {
+// OpenCard finds the card by its name and decrypts it into a secure buffer, the caller must destroy it
+func (s *LocalStorage) OpenCard(cardname string, key []byte) (*helpers.OpenedItem, error) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	// check if the card with this name is in storage. Return error if yes
 	if check := s.lookupCard(cardname); !check {
-		return storage.Card{}, ErrNoData
+		return nil, ErrNoData
 	}
-
-	// opening the localstorage file
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+cardsFile, os.O_RDONLY|os.O_CREATE, 0600)
-	if err != nil {
-		return storage.Card{}, fmt.Errorf("error in GetCard when opening file:%w", err)
+	card, err := s.openItem(cardsFile, cardname, 6, key)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("error in OpenCard:%w", err)
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	// reading with Scanner each line, until encounter needed one
-	for scanner.Scan() {
-		line := scanner.Text()
-		dst, err := base64.StdEncoding.DecodeString(line)
-		if err != nil {
-			return storage.Card{}, err
-		}
-
-		decryptedData, err := encrypt.DecryptData(dst, key)
-		if err != nil {
-			return storage.Card{}, err
-		}
-
-		//Getting the card string, splitting it by comma to get values
-		cardStr := string(decryptedData)
-		cardArr := strings.Split(cardStr, ",")
-
-		// cardArr[0] is the cardname. If it is the one we are looking for,
-		// we fill in fields of storage.Card struct and return it
-		if cardArr[0] == cardname {
-			card.Cardname = cardArr[0]
-			card.Number = cardArr[1]
-			card.Name = cardArr[2]
-			card.Surname = cardArr[3]
-			card.ValidTill = cardArr[4]
-			card.Code = cardArr[5]
-			return card, nil
-		}
-	}
-	return storage.Card{}, storage.ErrDataNotFound
+	return card, err
 }
 
 // ListCards returns a list of names of cards saved in Storage.
@@ -247,7 +226,7 @@ func (s *LocalStorage) ListCardsFromFile(key []byte) (cards []string, err error)
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 	// opening the localstorage file
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+cardsFile, os.O_RDONLY|os.O_CREATE, 0600)
+	file, err := os.OpenFile(s.folder()+cardsFile, os.O_RDONLY|os.O_CREATE, 0600)
 	if err != nil {
 		return nil, fmt.Errorf("error in ListCards when opening file:%w", err)
 	}
@@ -258,21 +237,15 @@ func (s *LocalStorage) ListCardsFromFile(key []byte) (cards []string, err error)
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		dst, err := base64.StdEncoding.DecodeString(line)
+		//Decrypting into a secure buffer, splitting it by comma to get values
+		plain, cardArr, err := helpers.OpenFields(line, key)
 		if err != nil {
 			return nil, err
 		}
-		decryptedData, err := encrypt.DecryptData(dst, key)
-		if err != nil {
-			return nil, err
-		}
-
-		//Getting the card string, splitting it by comma to get values
-		cardStr := string(decryptedData)
-		cardArr := strings.Split(cardStr, ",")
 
-		// cardArr[0] is the cardname
-		cards = append(cards, cardArr[0])
+		// cardArr[0] is the name
+		cards = append(cards, string(cardArr[0]))
+		plain.Destroy()
 	}
 
 	if len(cards) == 0 {
@@ -296,39 +269,19 @@ func (s *LocalStorage) lookupCard(cardname string) bool {
 func (s *LocalStorage) SaveLoginCreds(logincreds storage.LoginCreds, key []byte) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	// check if the card with this name is in storage. Return error if yes
-	if check := s.lookupLoginCreds(logincreds.Name); check {
-		return ErrMetanameIsTaken
-	}
-
-	// add name to check array
-	s.Logincreds = append(s.Logincreds, logincreds.Name)
-
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+loginCredsFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
-	if err != nil {
-		return fmt.Errorf("error in SaveLoginCreds when opening file:%w", err)
-	}
-	defer file.Close()
-
-	// concatenating string
-	logincredsStr := logincreds.Name + "," + logincreds.Site + "," + logincreds.Login + "," + logincreds.Password
-
-	// encrypting the data
-	encrypted, err := encrypt.EncryptData([]byte(logincredsStr), key)
-	if err != nil {
-		return err
-	}
-	// encoding the encrypted data in base64 for storage
-	encodedData := base64.StdEncoding.EncodeToString(encrypted)
-
-	// saving data to the filestorage
-	_, err = fmt.Fprintf(file, "%s\n", encodedData)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return fmt.Errorf("error in SaveLoginCreds when writing in file:%w", err)
-	}
+	// the name is the first field to find the item by
+	return s.appendItem(loginCredsFile, &s.Logincreds, logincreds.Name, func() (string, error) {
+		return helpers.SealFields(key, logincreds.Name, logincreds.Site, logincreds.Login, logincreds.Password)
+	})
+}
 
-	return nil
+// SaveOpenedLoginCreds saves login credentials opened out of data received from the database under the name
+func (s *LocalStorage) SaveOpenedLoginCreds(logincredsname string, logincreds *helpers.OpenedItem, key []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return s.appendItem(loginCredsFile, &s.Logincreds, logincredsname, func() (string, error) {
+		return logincreds.Seal(logincredsname, key)
+	})
 }
 
 func (s *LocalStorage) lookupLoginCreds(logincreds string) bool {
@@ -341,50 +294,19 @@ func (s *LocalStorage) lookupLoginCreds(logincreds string) bool {
 	return false
 }
 
-// GetLoginCreds gets login credentials from local storage by the logincreds name
-func (s *LocalStorage) GetLoginCreds(logincredsname string, key []byte) (logincreds storage.LoginCreds, err error) {
+// OpenLoginCreds finds login credentials by the name and decrypts them into a secure buffer,
+// the caller must destroy them
+func (s *LocalStorage) OpenLoginCreds(logincredsname string, key []byte) (*helpers.OpenedItem, error) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	// check if the card with this name is in storage. Return error if yes
 	if check := s.lookupLoginCreds(logincredsname); !check {
-		return storage.LoginCreds{}, ErrNoData
-	}
-
-	// opening the localstorage file
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+loginCredsFile, os.O_RDONLY|os.O_CREATE, 0600)
-	if err != nil {
-		return storage.LoginCreds{}, fmt.Errorf("error in GetLoginCreds when opening file:%w", err)
+		return nil, ErrNoData
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	// reading with Scanner each line, until encounter needed one
-	for scanner.Scan() {
-		line := scanner.Text()
-		dst, err := base64.StdEncoding.DecodeString(line)
-		if err != nil {
-			return storage.LoginCreds{}, err
-		}
-
-		decryptedData, err := encrypt.DecryptData(dst, key)
-		if err != nil {
-			return storage.LoginCreds{}, err
-		}
-
-		//Getting the string, splitting it by comma to get values
-		loginCredStr := string(decryptedData)
-		loginCredArr := strings.Split(loginCredStr, ",")
-
-		if loginCredArr[0] == logincredsname {
-			logincreds.Name = loginCredArr[0]
-			logincreds.Site = loginCredArr[1]
-			logincreds.Login = loginCredArr[2]
-			logincreds.Password = loginCredArr[3]
-
-			return logincreds, nil
-		}
+	logincreds, err := s.openItem(loginCredsFile, logincredsname, 4, key)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("error in OpenLoginCreds:%w", err)
 	}
-	return storage.LoginCreds{}, storage.ErrDataNotFound
+	return logincreds, err
 }
 
 // ListLoginCreds returns a list of login credential names saves in a structure
@@ -402,7 +324,7 @@ func (s *LocalStorage) ListLoginCredsFromFile(key []byte) (logincreds []string,
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 	// opening the localstorage file
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+loginCredsFile, os.O_RDONLY|os.O_CREATE, 0600)
+	file, err := os.OpenFile(s.folder()+loginCredsFile, os.O_RDONLY|os.O_CREATE, 0600)
 	if err != nil {
 		return nil, fmt.Errorf("error in ListLoginCredsFromFile when opening file:%w", err)
 	}
@@ -413,21 +335,15 @@ func (s *LocalStorage) ListLoginCredsFromFile(key []byte) (logincreds []string,
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		dst, err := base64.StdEncoding.DecodeString(line)
+		//Decrypting into a secure buffer, splitting it by comma to get values
+		plain, loginCredArr, err := helpers.OpenFields(line, key)
 		if err != nil {
 			return nil, err
 		}
-		decryptedData, err := encrypt.DecryptData(dst, key)
-		if err != nil {
-			return nil, err
-		}
-
-		//Getting the card string, splitting it by comma to get values
-		loginCredStr := string(decryptedData)
-		loginCredArr := strings.Split(loginCredStr, ",")
 
-		// cardArr[0] is the cardname
-		logincreds = append(logincreds, loginCredArr[0])
+		// loginCredArr[0] is the name
+		logincreds = append(logincreds, string(loginCredArr[0]))
+		plain.Destroy()
 	}
 
 	if len(logincreds) == 0 {
@@ -451,81 +367,33 @@ func (s *LocalStorage) lookupNote(note string) bool {
 func (s *LocalStorage) SaveNote(note storage.Note, key []byte) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	// check if the card with this name is in storage. Return error if yes
-	if check := s.lookupNote(note.Name); check {
-		return ErrMetanameIsTaken
-	}
-
-	// add name to check array
-	s.Notes = append(s.Notes, note.Name)
-
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+notesFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
-	if err != nil {
-		return fmt.Errorf("error in SaveNote when opening file:%w", err)
-	}
-	defer file.Close()
-
-	// concatenating string
-	noteStr := note.Name + "," + note.Text
-
-	// encrypting the data
-	encrypted, err := encrypt.EncryptData([]byte(noteStr), key)
-	if err != nil {
-		return err
-	}
-	// encoding the encrypted data in base64 for storage
-	encodedData := base64.StdEncoding.EncodeToString(encrypted)
-
-	// saving data to the filestorage
-	_, err = fmt.Fprintf(file, "%s\n", encodedData)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return fmt.Errorf("error in SaveNote when writing in file:%w", err)
-	}
+	// the name is the first field to find the note by
+	return s.appendItem(notesFile, &s.Notes, note.Name, func() (string, error) {
+		return helpers.SealFields(key, note.Name, note.Text)
+	})
+}
 
-	return nil
+// SaveOpenedNote saves the note opened out of data received from the database under the name
+func (s *LocalStorage) SaveOpenedNote(notename string, note *helpers.OpenedItem, key []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return s.appendItem(notesFile, &s.Notes, notename, func() (string, error) {
+		return note.Seal(notename, key)
+	})
 }
 
-func (s *LocalStorage) GetNote(notename string, key []byte) (note storage.Note, err error) {
+// OpenNote finds the note by its name and decrypts it into a secure buffer, the caller must destroy it
+func (s *LocalStorage) OpenNote(notename string, key []byte) (*helpers.OpenedItem, error) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	// check if the card with this name is in storage. Return error if yes
 	if check := s.lookupNote(notename); !check {
-		return storage.Note{}, ErrNoData
+		return nil, ErrNoData
 	}
-
-	// opening the localstorage file
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+notesFile, os.O_RDONLY|os.O_CREATE, 0600)
-	if err != nil {
-		return storage.Note{}, fmt.Errorf("error in GetNote when opening file:%w", err)
+	note, err := s.openItem(notesFile, notename, 2, key)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("error in OpenNote:%w", err)
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	// reading with Scanner each line, until encounter needed one
-	for scanner.Scan() {
-		line := scanner.Text()
-		dst, err := base64.StdEncoding.DecodeString(line)
-		if err != nil {
-			return storage.Note{}, err
-		}
-
-		decryptedData, err := encrypt.DecryptData(dst, key)
-		if err != nil {
-			return storage.Note{}, err
-		}
-
-		//Getting the string, splitting it by comma to get values
-		noteStr := string(decryptedData)
-		noteArr := strings.Split(noteStr, ",")
-
-		if noteArr[0] == notename {
-			note.Name = noteArr[0]
-			note.Text = noteArr[1]
-			return note, nil
-		}
-	}
-	return storage.Note{}, storage.ErrDataNotFound
+	return note, err
 }
 
 func (s *LocalStorage) ListNotes() (notes []string, err error) {
@@ -541,7 +409,7 @@ func (s *LocalStorage) ListNotesFromFile(key []byte) (notes []string, err error)
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 	// opening the localstorage file
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+notesFile, os.O_RDONLY|os.O_CREATE, 0600)
+	file, err := os.OpenFile(s.folder()+notesFile, os.O_RDONLY|os.O_CREATE, 0600)
 	if err != nil {
 		return nil, fmt.Errorf("error in ListNotesFromFile when opening file:%w", err)
 	}
@@ -552,21 +420,15 @@ func (s *LocalStorage) ListNotesFromFile(key []byte) (notes []string, err error)
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		dst, err := base64.StdEncoding.DecodeString(line)
+		//Decrypting into a secure buffer, splitting it by comma to get values
+		plain, noteArr, err := helpers.OpenFields(line, key)
 		if err != nil {
 			return nil, err
 		}
-		decryptedData, err := encrypt.DecryptData(dst, key)
-		if err != nil {
-			return nil, err
-		}
-
-		//Getting the card string, splitting it by comma to get values
-		noteStr := string(decryptedData)
-		noteArr := strings.Split(noteStr, ",")
 
-		// cardArr[0] is the cardname
-		notes = append(notes, noteArr[0])
+		// noteArr[0] is the name
+		notes = append(notes, string(noteArr[0]))
+		plain.Destroy()
 	}
 
 	if len(notes) == 0 {
@@ -576,6 +438,56 @@ func (s *LocalStorage) ListNotesFromFile(key []byte) (notes []string, err error)
 	return notes, nil
 }
 
+// appendItem seals the item and appends it to the file. Names are the names of the items kept in the file
+func (s *LocalStorage) appendItem(filename string, names *[]string, name string, seal func() (string, error)) error {
+	for _, taken := range *names {
+		if taken == name {
+			return ErrMetanameIsTaken
+		}
+	}
+
+	encodedData, err := seal()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.folder()+filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("can't open %s:%w", filename, err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(file, "%s\n", encodedData); err != nil {
+		return fmt.Errorf("can't write to %s:%w", filename, err)
+	}
+	*names = append(*names, name)
+	return nil
+}
+
+// openItem reads the file line by line until it finds the item with the name
+// and at least the number of fields. Each item is decrypted into its own secure buffer
+func (s *LocalStorage) openItem(filename, name string, fields int, key []byte) (*helpers.OpenedItem, error) {
+	file, err := os.OpenFile(s.folder()+filename, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("can't open %s:%w", filename, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		item, err := helpers.OpenItem(scanner.Text(), key)
+		if err != nil {
+			return nil, err
+		}
+		// the first field is the name
+		if string(item.Field(0)) == name && item.Len() >= fields {
+			return item, nil
+		}
+		item.Destroy()
+	}
+	return nil, storage.ErrDataNotFound
+}
+
 // Binaries processing methods
 func (s *LocalStorage) lookupBinary(binaryname string) bool {
 	for _, b := range s.Binaries {
@@ -587,38 +499,42 @@ func (s *LocalStorage) lookupBinary(binaryname string) bool {
 }
 
 func (s *LocalStorage) SaveBinary(binary storage.Binary, key []byte) error {
+	// encrypting the data
+	encrypted, err := encrypt.EncryptData(binary.Data, key)
+	if err != nil {
+		return err
+	}
+	return s.SaveEncryptedBinary(binary.Name, encrypted)
+}
+
+// SaveEncryptedBinary saves the binary already encrypted with the vault key, so it isn't decrypted on the way
+func (s *LocalStorage) SaveEncryptedBinary(binaryname string, encrypted []byte) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 	// check if the card with this name is in storage. Return error if yes
-	if check := s.lookupBinary(binary.Name); check {
+	if check := s.lookupBinary(binaryname); check {
 		return ErrMetanameIsTaken
 	}
 
 	// add name to check array
-	s.Binaries = append(s.Binaries, binary.Name)
+	s.Binaries = append(s.Binaries, binaryname)
 
 	// just in case create binaries folder
-	os.Mkdir(config.ClientCfg.LocalStorage+binariesFolder, 0600)
+	os.Mkdir(s.folder()+binariesFolder, 0600)
 
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+binariesFolder+"/"+binary.Name, os.O_RDWR|os.O_CREATE, 0600)
+	file, err := os.OpenFile(s.folder()+binariesFolder+"/"+binaryname, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
-		return fmt.Errorf("error in SaveBinary when opening file:%w", err)
+		return fmt.Errorf("error in SaveEncryptedBinary when opening file:%w", err)
 	}
 	defer file.Close()
 
-	// encrypting the data
-	encrypted, err := encrypt.EncryptData(binary.Data, key)
-	if err != nil {
-		return err
-	}
-
 	encodedData := base64.StdEncoding.EncodeToString(encrypted)
 
 	// saving data to the filestorage
 	_, err = fmt.Fprint(file, encodedData)
 	if err != nil {
 		fmt.Println("Error writing to file:", err)
-		return fmt.Errorf("error in SaveBinary when writing in file:%w", err)
+		return fmt.Errorf("error in SaveEncryptedBinary when writing in file:%w", err)
 	}
 
 	return nil
@@ -632,7 +548,7 @@ func (s *LocalStorage) GetBinary(binaryname string, key []byte) (binary storage.
 		return storage.Binary{}, ErrNoData
 	}
 
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+binariesFolder+"/"+binaryname, os.O_RDONLY, 0600)
+	file, err := os.OpenFile(s.folder()+binariesFolder+"/"+binaryname, os.O_RDONLY, 0600)
 	if err != nil {
 		return storage.Binary{}, fmt.Errorf("error in GetBinary when opening file:%w", err)
 	}
@@ -685,7 +601,7 @@ func (s *LocalStorage) GetEncryptedBinary(binaryname string) (binary storage.Bin
 		return storage.Binary{}, ErrNoData
 	}
 
-	file, err := os.OpenFile(config.ClientCfg.LocalStorage+binariesFolder+"/"+binaryname, os.O_RDONLY, 0600)
+	file, err := os.OpenFile(s.folder()+binariesFolder+"/"+binaryname, os.O_RDONLY, 0600)
 	if err != nil {
 		return storage.Binary{}, fmt.Errorf("error in GetEncryptedBinary when opening file:%w", err)
 	}
@@ -718,10 +634,10 @@ func (s *LocalStorage) ListBinariesFromFolder() (binaries []string, err error) {
 	defer s.Mu.Unlock()
 
 	// Make a folder if its a first time
-	os.Mkdir(config.ClientCfg.LocalStorage+binariesFolder, 0600)
+	os.Mkdir(s.folder()+binariesFolder, 0600)
 
 	// Open the folder
-	err = filepath.Walk(config.ClientCfg.LocalStorage+binariesFolder, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(s.folder()+binariesFolder, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			fmt.Println("Error accessing path:", err)
 			return nil
@@ -0,0 +1,194 @@
+package localstorage
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gambruh/simplevault/internal/encrypt"
+	"github.com/gambruh/simplevault/internal/helpers"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+const syncStateFile = "/syncstate"
+
+// SyncState is the position of the client in the change feed of the server
+type SyncState struct {
+	// Revision is the revision of the user on the server the items are synchronized up to
+	Revision int64 `json:"revision"`
+	// Items are local names of the items known to be on the server by kind, with the items
+	// as the client has last seen them there
+	Items map[string]map[string]SyncedItem `json:"items"`
+	// Conflicts are items changed both locally and on the server, waiting to be resolved by the user
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+}
+
+// SyncedItem is the revision of the last change of an item seen by the client and the hash of its content.
+// Revision 0 means the item was synchronized by names. Pending marks items modified locally after that,
+// only they and items the server hasn't got are read for upload
+type SyncedItem struct {
+	Revision int64  `json:"revision"`
+	Hash     string `json:"hash"`
+	Pending  bool   `json:"pending,omitempty"`
+}
+
+// Conflict is a local item with its change on the server it conflicts with
+type Conflict struct {
+	Name   string         `json:"name"`
+	Change storage.Change `json:"change"`
+}
+
+// LoadSyncState reads and decrypts the sync state. Returns ErrNoData if the storage was never synchronized
+func (s *LocalStorage) LoadSyncState(key []byte) (SyncState, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	data, err := os.ReadFile(s.folder() + syncStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return SyncState{}, ErrNoData
+	}
+	if err != nil {
+		return SyncState{}, fmt.Errorf("error in LoadSyncState when reading file:%w", err)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return SyncState{}, err
+	}
+	plain, err := encrypt.DecryptData(encrypted, key)
+	if err != nil {
+		return SyncState{}, err
+	}
+
+	var state SyncState
+	if err := json.Unmarshal(plain, &state); err != nil {
+		return SyncState{}, fmt.Errorf("error in LoadSyncState when decoding state:%w", err)
+	}
+	return state, nil
+}
+
+// SaveSyncState encrypts and saves the sync state, replacing the previous one at once
+func (s *LocalStorage) SaveSyncState(state SyncState, key []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error in SaveSyncState when encoding state:%w", err)
+	}
+	encrypted, err := encrypt.EncryptData(data, key)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.folder()+syncStateFile, base64.StdEncoding.EncodeToString(encrypted))
+}
+
+// writeFile replaces the file with the data through a temporary file,
+// so the file is never left half written
+func writeFile(filename string, data string) error {
+	if err := os.WriteFile(filename+".tmp", []byte(data), 0600); err != nil {
+		return fmt.Errorf("error writing %s:%w", filename, err)
+	}
+	if err := os.Rename(filename+".tmp", filename); err != nil {
+		return fmt.Errorf("error replacing %s:%w", filename, err)
+	}
+	return nil
+}
+
+// removeLine rewrites the file of items without the line of the item with the name
+func (s *LocalStorage) removeLine(filename string, name string, key []byte) error {
+	file, err := os.OpenFile(s.folder()+filename, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening file:%w", err)
+	}
+	defer file.Close()
+
+	var kept strings.Builder
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		plain, fields, err := helpers.OpenFields(line, key)
+		if err != nil {
+			return err
+		}
+		found := string(fields[0]) == name
+		plain.Destroy()
+		if !found {
+			fmt.Fprintf(&kept, "%s\n", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading file:%w", err)
+	}
+	return writeFile(s.folder()+filename, kept.String())
+}
+
+// without returns the names except the one
+func without(names []string, name string) []string {
+	kept := make([]string, 0, len(names))
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+// DeleteCard deletes the card by its name. Returns ErrNoData if there is no such card
+func (s *LocalStorage) DeleteCard(cardname string, key []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if check := s.lookupCard(cardname); !check {
+		return ErrNoData
+	}
+	if err := s.removeLine(cardsFile, cardname, key); err != nil {
+		return fmt.Errorf("error in DeleteCard:%w", err)
+	}
+	s.Cards = without(s.Cards, cardname)
+	return nil
+}
+
+// DeleteLoginCreds deletes the login credentials by name. Returns ErrNoData if there are no such credentials
+func (s *LocalStorage) DeleteLoginCreds(logincredsname string, key []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if check := s.lookupLoginCreds(logincredsname); !check {
+		return ErrNoData
+	}
+	if err := s.removeLine(loginCredsFile, logincredsname, key); err != nil {
+		return fmt.Errorf("error in DeleteLoginCreds:%w", err)
+	}
+	s.Logincreds = without(s.Logincreds, logincredsname)
+	return nil
+}
+
+// DeleteNote deletes the note by its name. Returns ErrNoData if there is no such note
+func (s *LocalStorage) DeleteNote(notename string, key []byte) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if check := s.lookupNote(notename); !check {
+		return ErrNoData
+	}
+	if err := s.removeLine(notesFile, notename, key); err != nil {
+		return fmt.Errorf("error in DeleteNote:%w", err)
+	}
+	s.Notes = without(s.Notes, notename)
+	return nil
+}
+
+// DeleteBinary deletes the binary by its name. Returns ErrNoData if there is no such binary
+func (s *LocalStorage) DeleteBinary(binaryname string) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if check := s.lookupBinary(binaryname); !check {
+		return ErrNoData
+	}
+	if err := os.Remove(s.folder() + binariesFolder + "/" + binaryname); err != nil {
+		return fmt.Errorf("error in DeleteBinary:%w", err)
+	}
+	s.Binaries = without(s.Binaries, binaryname)
+	return nil
+}
@@ -0,0 +1,46 @@
+package localstorage
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// The sync state is rewritten after every synchronization, every write must be encrypted with a fresh nonce
+func TestSaveSyncStateReencrypts(t *testing.T) {
+	s := NewStorage()
+	s.Folder = t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	state := SyncState{Revision: 7, Items: map[string]map[string]SyncedItem{"note": {"todo": {Revision: 7, Hash: "h"}}}}
+
+	if _, err := s.LoadSyncState(key); err != ErrNoData {
+		t.Fatalf("LoadSyncState() of new storage error = %v, want %v", err, ErrNoData)
+	}
+
+	var written []string
+	for i := 0; i < 2; i++ {
+		if err := s.SaveSyncState(state, key); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(s.Folder + syncStateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, string(data))
+	}
+	if written[0] == written[1] {
+		t.Error("the same sync state is encrypted to the same data twice")
+	}
+
+	got, err := s.LoadSyncState(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("LoadSyncState() = %+v, want %+v", got, state)
+	}
+	if _, err := s.LoadSyncState(bytes.Repeat([]byte{2}, 32)); err == nil {
+		t.Error("sync state is decrypted with a wrong key")
+	}
+}
@@ -1,140 +1,935 @@
 // Package memstorage provides inmemory implementation of Storage interface
-// Purpose of this package is to provide struct and methods to use in unit-tests mainly
+// It behaves the same way as the database, so it can back the server in tests and small setups
 package memstorage
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gambruh/simplevault/internal/storage"
 )
 
-// MemStorage struct is supposed to be used in unit-tests only
+// MemStorage keeps everything in maps. Users are not checked, the caller passes logins of existing accounts
 type MemStorage struct {
-	// login-pass pairs stored for each user.
-	Logins map[string][]storage.LoginCreds
+	// login credentials by user and name
+	Logins map[string]map[string]storage.EncryptedData
 
-	// notes stored for each user
-	Notes map[string][]storage.Note
+	// notes by user and name
+	Notes map[string]map[string]storage.EncryptedData
 
-	//cards stored for each user
-	Cards map[string][]storage.Card
+	// cards by user and name
+	Cards map[string]map[string]storage.EncryptedData
 
-	//Binary data stored for each user
-	Binaries map[string][]storage.Binary
+	// binary data by user and name
+	Binaries map[string]map[string]storage.Binary
+
+	// modification times of items by user and "kind/name"
+	Modified map[string]map[string]time.Time
+
+	// revisions by user, each change of the user's items takes the next one
+	Revisions map[string]int64
+
+	// the last change of each item by user and "kind/name", deleted items are kept
+	Changes map[string]map[string]storage.Change
+
+	// key pairs by user
+	Keys map[string]storage.KeyPair
+
+	// shares of all users, the owner of a share is in share.Owner
+	Shares []storage.Share
+
+	// organizations by name
+	Orgs map[string]*Org
 
 	// to ensure possible concurrent usage
 	Mu *sync.Mutex
 }
 
+// Org is an organization with its members and vault items
+type Org struct {
+	// members by login
+	Members map[string]storage.OrgMember
+	// items by "kind/name"
+	Items map[string]storage.OrgItem
+}
+
 // NewStorage is a constructor of a new MemStorage struct
 func NewStorage() *MemStorage {
 	return &MemStorage{
-		Logins:   make(map[string][]storage.LoginCreds),
-		Notes:    make(map[string][]storage.Note),
-		Cards:    make(map[string][]storage.Card),
-		Binaries: make(map[string][]storage.Binary),
-		Mu:       &sync.Mutex{},
+		Logins:    make(map[string]map[string]storage.EncryptedData),
+		Notes:     make(map[string]map[string]storage.EncryptedData),
+		Cards:     make(map[string]map[string]storage.EncryptedData),
+		Binaries:  make(map[string]map[string]storage.Binary),
+		Modified:  make(map[string]map[string]time.Time),
+		Revisions: make(map[string]int64),
+		Changes:   make(map[string]map[string]storage.Change),
+		Keys:      make(map[string]storage.KeyPair),
+		Orgs:      make(map[string]*Org),
+		Mu:        &sync.Mutex{},
 	}
 }
 
-// ListLoginCreds returns a list of names of login credentials saved in Storage
-func (s *MemStorage) ListLoginCreds(username string) ([]string, error) {
-	var list []string
-
-	for _, item := range s.Logins[username] {
-		list = append(list, item.Name)
+func setItem(items map[string]map[string]storage.EncryptedData, username string, item storage.EncryptedData) error {
+	if _, ok := items[username]; !ok {
+		items[username] = make(map[string]storage.EncryptedData)
 	}
+	if _, ok := items[username][item.Name]; ok {
+		return storage.ErrMetanameIsTaken
+	}
+	items[username][item.Name] = item
+	return nil
+}
 
-	return list, nil
+func getItem(items map[string]map[string]storage.EncryptedData, username string, name string) (storage.EncryptedData, error) {
+	item, ok := items[username][name]
+	if !ok {
+		return storage.EncryptedData{}, storage.ErrDataNotFound
+	}
+	// tags only filter lists, the database doesn't return them either
+	item.Tags = nil
+	return item, nil
 }
 
-// ListCards returns a list of names of cards saved in Storage
-func (s *MemStorage) ListCards(username string) ([]string, error) {
+func listItems[T any](items map[string]map[string]T, username string) []string {
 	var list []string
-
-	for _, item := range s.Cards[username] {
-		list = append(list, item.Name)
+	for name := range items[username] {
+		list = append(list, name)
 	}
+	sort.Strings(list)
+	return list
+}
+
+// SetLoginCred saves a login credentials in the Storage
+func (s *MemStorage) SetLoginCred(ctx context.Context, username string, logindata storage.EncryptedData) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	_, err := s.saveItem(username, storage.Item{
+		Kind: storage.KindLoginCreds, Name: logindata.Name, Data: logindata.Data, EncName: logindata.EncName, Tags: logindata.Tags,
+	})
+	return err
+}
 
-	return list, nil
+// GetLoginCred returns a login credentials by it's name
+func (s *MemStorage) GetLoginCred(ctx context.Context, username string, loginname string) (storage.EncryptedData, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return getItem(s.Logins, username, loginname)
+}
+
+// ListLoginCreds returns a list of names of login credentials saved in Storage
+func (s *MemStorage) ListLoginCreds(ctx context.Context, username string) ([]string, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return listItems(s.Logins, username), nil
+}
+
+// SetNote saves a note in the Storage
+func (s *MemStorage) SetNote(ctx context.Context, username string, note storage.EncryptedData) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	_, err := s.saveItem(username, storage.Item{
+		Kind: storage.KindNote, Name: note.Name, Data: note.Data, EncName: note.EncName, Tags: note.Tags,
+	})
+	return err
+}
+
+// GetNote returns a note by it's name
+func (s *MemStorage) GetNote(ctx context.Context, username string, notename string) (storage.EncryptedData, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return getItem(s.Notes, username, notename)
 }
 
 // ListNotes returns a list of names of notes saved in Storage
-func (s *MemStorage) ListNotes(username string) ([]string, error) {
-	var list []string
+func (s *MemStorage) ListNotes(ctx context.Context, username string) ([]string, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return listItems(s.Notes, username), nil
+}
+
+// SetCard saves a card in the Storage
+func (s *MemStorage) SetCard(ctx context.Context, username string, card storage.EncryptedData) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	_, err := s.saveItem(username, storage.Item{
+		Kind: storage.KindCard, Name: card.Name, Data: card.Data, EncName: card.EncName, Tags: card.Tags,
+	})
+	return err
+}
+
+// GetCard returns a card by it's name
+func (s *MemStorage) GetCard(ctx context.Context, username string, cardname string) (storage.EncryptedData, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return getItem(s.Cards, username, cardname)
+}
 
-	for _, item := range s.Notes[username] {
-		list = append(list, item.Name)
+// ListCards returns a list of names of cards saved in Storage
+func (s *MemStorage) ListCards(ctx context.Context, username string) ([]string, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return listItems(s.Cards, username), nil
+}
+
+// SetBinary saves a new binary in the Storage
+func (s *MemStorage) SetBinary(ctx context.Context, username string, newbinary storage.Binary) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	_, err := s.saveItem(username, storage.Item{
+		Kind: storage.KindBinary, Name: newbinary.Name, Binary: newbinary.Data, EncName: newbinary.EncName, Tags: newbinary.Tags,
+	})
+	return err
+}
+
+func (s *MemStorage) setBinary(username string, newbinary storage.Binary) error {
+	if _, ok := s.Binaries[username]; !ok {
+		s.Binaries[username] = make(map[string]storage.Binary)
 	}
+	if _, ok := s.Binaries[username][newbinary.Name]; ok {
+		return storage.ErrMetanameIsTaken
+	}
+	newbinary.Data = append([]byte(nil), newbinary.Data...)
+	s.Binaries[username][newbinary.Name] = newbinary
+	return nil
+}
 
-	return list, nil
+// GetBinary returns a binary by it's name
+func (s *MemStorage) GetBinary(ctx context.Context, username string, binaryname string) (storage.Binary, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return s.getBinary(username, binaryname)
+}
+
+func (s *MemStorage) getBinary(username string, binaryname string) (storage.Binary, error) {
+	binary, ok := s.Binaries[username][binaryname]
+	if !ok {
+		return storage.Binary{}, storage.ErrDataNotFound
+	}
+	binary.Data = append([]byte(nil), binary.Data...)
+	binary.Tags = nil
+	return binary, nil
 }
 
 // ListBinaries returns a list of names of binaries saved in Storage
-func (s *MemStorage) ListBinaries(username string) ([]string, error) {
-	var list []string
+func (s *MemStorage) ListBinaries(ctx context.Context, username string) ([]string, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return listItems(s.Binaries, username), nil
+}
+
+// SetKeyPair saves user's public key and wrapped private key.
+// Returns storage.ErrMetanameIsTaken if the user has them already
+func (s *MemStorage) SetKeyPair(ctx context.Context, username string, keys storage.KeyPair) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
 
-	for _, item := range s.Binaries[username] {
-		list = append(list, item.Name)
+	if _, ok := s.Keys[username]; ok {
+		return storage.ErrMetanameIsTaken
 	}
+	s.Keys[username] = keys
+	return nil
+}
+
+// GetKeyPair returns user's public key and wrapped private key
+func (s *MemStorage) GetKeyPair(ctx context.Context, username string) (storage.KeyPair, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
 
-	return list, nil
+	keys, ok := s.Keys[username]
+	if !ok {
+		return storage.KeyPair{}, storage.ErrDataNotFound
+	}
+	return keys, nil
 }
 
-// SetBinary saves a new binary in the Storage
-func (s *MemStorage) SetBinary(username string, newbinary storage.Binary) error {
-	if _, ok := s.Binaries[username]; !ok {
-		s.Binaries[username] = make([]storage.Binary, 1)
+func sameShare(a storage.Share, b storage.Share) bool {
+	return a.Owner == b.Owner && a.Recipient == b.Recipient && a.Kind == b.Kind && a.Name == b.Name
+}
+
+// SetShare saves an item shared by the user with share.Recipient.
+// Sharing the same item again replaces the previous share
+func (s *MemStorage) SetShare(ctx context.Context, username string, share storage.Share) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	share.Owner = username
+	for i, old := range s.Shares {
+		if sameShare(old, share) {
+			s.Shares[i] = share
+			return nil
+		}
 	}
-	s.Binaries[username] = append(s.Binaries[username], newbinary)
+	s.Shares = append(s.Shares, share)
 	return nil
 }
 
-// GetBinary returns a binary by it's name
-func (s *MemStorage) GetBinary(username string, binaryname string) (storage.Binary, error) {
+// ListSharesReceived returns all items shared with the user, including encrypted data
+func (s *MemStorage) ListSharesReceived(ctx context.Context, username string) ([]storage.Share, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
 
-	for _, bindata := range s.Binaries[username] {
-		fmt.Println(bindata)
+	var shares []storage.Share
+	for _, share := range s.Shares {
+		if share.Recipient == username {
+			shares = append(shares, share)
+		}
 	}
+	return shares, nil
+}
 
-	return storage.Binary{}, storage.ErrDataNotFound
+// ListSharesOwned returns items the user has shared with others, without encrypted data
+func (s *MemStorage) ListSharesOwned(ctx context.Context, username string) ([]storage.Share, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	var shares []storage.Share
+	for _, share := range s.Shares {
+		if share.Owner == username {
+			share.EncName, share.Data, share.Key = "", "", ""
+			shares = append(shares, share)
+		}
+	}
+	return shares, nil
 }
 
-// SetCard saves a card in the Storage
-func (s *MemStorage) SetCard(username string, card storage.Card) error {
-	if _, ok := s.Cards[username]; !ok {
-		s.Cards[username] = make([]storage.Card, 1)
+// DeleteShare revokes a share. Returns storage.ErrDataNotFound if there was no such share
+func (s *MemStorage) DeleteShare(ctx context.Context, username string, share storage.Share) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	share.Owner = username
+	for i, old := range s.Shares {
+		if sameShare(old, share) {
+			s.Shares = append(s.Shares[:i], s.Shares[i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrDataNotFound
+}
+
+// CreateOrg creates new organization with the user as its owner.
+// Returns storage.ErrMetanameIsTaken if the name is taken
+func (s *MemStorage) CreateOrg(ctx context.Context, username string, org storage.Org) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if _, ok := s.Orgs[org.Name]; ok {
+		return storage.ErrMetanameIsTaken
+	}
+	s.Orgs[org.Name] = &Org{
+		Members: map[string]storage.OrgMember{
+			username: {Org: org.Name, Login: username, Role: storage.RoleOwner, VaultKey: org.VaultKey},
+		},
+		Items: make(map[string]storage.OrgItem),
 	}
-	s.Cards[username] = append(s.Cards[username], card)
 	return nil
 }
 
-// SetLoginCred saves a login credentials in the Storage
-func (s *MemStorage) SetLoginCred(username string, logindata storage.LoginCreds) error {
-	if _, ok := s.Logins[username]; !ok {
-		s.Logins[username] = make([]storage.LoginCreds, 1)
+// ListOrgs returns organizations the user is a member of, with user's role and sealed vault key
+func (s *MemStorage) ListOrgs(ctx context.Context, username string) ([]storage.Org, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	var orgs []storage.Org
+	for name, org := range s.Orgs {
+		if member, ok := org.Members[username]; ok {
+			orgs = append(orgs, storage.Org{Name: name, Role: member.Role, VaultKey: member.VaultKey})
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Name < orgs[j].Name })
+	return orgs, nil
+}
+
+// GetOrgRole returns user's role in the organization.
+// Returns storage.ErrDataNotFound if user is not a member
+func (s *MemStorage) GetOrgRole(ctx context.Context, username string, orgname string) (string, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[orgname]
+	if !ok {
+		return "", storage.ErrDataNotFound
+	}
+	member, ok := org.Members[username]
+	if !ok {
+		return "", storage.ErrDataNotFound
+	}
+	return member.Role, nil
+}
+
+// SetOrgMember adds a member to the organization or updates role and vault key of existing one.
+// Returns storage.ErrDataNotFound if there is no such organization
+// and storage.ErrLastOwner if it demotes the only owner
+func (s *MemStorage) SetOrgMember(ctx context.Context, member storage.OrgMember) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[member.Org]
+	if !ok {
+		return storage.ErrDataNotFound
 	}
-	s.Logins[username] = append(s.Logins[username], logindata)
+	if member.Role != storage.RoleOwner && org.lastOwner(member.Login) {
+		return storage.ErrLastOwner
+	}
+	org.Members[member.Login] = member
 	return nil
 }
 
-// GetLoginCred returns a login credentials by it's name
-func (s *MemStorage) GetLoginCred(username string, loginname string) (storage.LoginCreds, error) {
-	for _, logindata := range s.Logins[username] {
+// DeleteOrgMember removes a member from the organization.
+// Returns storage.ErrLastOwner if the member is the only owner
+func (s *MemStorage) DeleteOrgMember(ctx context.Context, orgname string, login string) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
 
-		fmt.Println(logindata)
+	org, ok := s.Orgs[orgname]
+	if !ok {
+		return storage.ErrDataNotFound
+	}
+	if _, ok := org.Members[login]; !ok {
+		return storage.ErrDataNotFound
+	}
+	if org.lastOwner(login) {
+		return storage.ErrLastOwner
+	}
+	delete(org.Members, login)
+	return nil
+}
 
+// lastOwner reports whether the user is the only owner of the organization
+func (org *Org) lastOwner(login string) bool {
+	if org.Members[login].Role != storage.RoleOwner {
+		return false
 	}
-	return storage.LoginCreds{}, storage.ErrDataNotFound
+	owners := 0
+	for _, member := range org.Members {
+		if member.Role == storage.RoleOwner {
+			owners++
+		}
+	}
+	return owners == 1
 }
 
-// GetCard returns a card by it's name
-func (s *MemStorage) GetCard(username string, cardname string) (storage.Card, error) {
-	for _, carddata := range s.Cards[username] {
+// RotateOrgKey removes the member and replaces the vault keys of the remaining members
+// and the data of the items, renaming them to their new blind indexes. Returns storage.ErrOrgChanged
+// if the rotation doesn't cover exactly the remaining members and the items,
+// storage.ErrLastOwner if the member is the only owner
+func (s *MemStorage) RotateOrgKey(ctx context.Context, rotation storage.OrgRotation) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[rotation.Org]
+	if !ok {
+		return storage.ErrDataNotFound
+	}
+	if _, ok := org.Members[rotation.Login]; !ok {
+		return storage.ErrDataNotFound
+	}
+	if org.lastOwner(rotation.Login) {
+		return storage.ErrLastOwner
+	}
 
-		fmt.Print(carddata)
+	members := make(map[string]string, len(rotation.Members))
+	for _, member := range rotation.Members {
+		if _, ok := org.Members[member.Login]; !ok || member.Login == rotation.Login {
+			return storage.ErrOrgChanged
+		}
+		members[member.Login] = member.VaultKey
+	}
+	items := make(map[string]storage.OrgItem, len(rotation.Items))
+	for _, item := range rotation.Items {
+		if _, ok := org.Items[itemKey(item.Kind, item.Name)]; !ok {
+			return storage.ErrOrgChanged
+		}
+		items[itemKey(item.Kind, item.Name)] = item
+	}
+	if len(members) != len(org.Members)-1 || len(items) != len(org.Items) {
+		return storage.ErrOrgChanged
+	}
 
+	delete(org.Members, rotation.Login)
+	for login, key := range members {
+		member := org.Members[login]
+		member.VaultKey = key
+		org.Members[login] = member
+	}
+	for key := range items {
+		delete(org.Items, key)
 	}
-	return storage.Card{}, storage.ErrDataNotFound
+	for _, item := range items {
+		if item.Rename != "" {
+			item.Name, item.Rename = item.Rename, ""
+		}
+		item.Org = rotation.Org
+		org.Items[itemKey(item.Kind, item.Name)] = item
+	}
+	return nil
+}
+
+// ListOrgMembers returns members of the organization and their roles
+func (s *MemStorage) ListOrgMembers(ctx context.Context, orgname string) ([]storage.OrgMember, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[orgname]
+	if !ok {
+		return nil, nil
+	}
+	var members []storage.OrgMember
+	for _, member := range org.Members {
+		members = append(members, storage.OrgMember{Org: orgname, Login: member.Login, Role: member.Role})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Login < members[j].Login })
+	return members, nil
+}
+
+// itemKey is the key of items of organizations and modification times of personal items
+func itemKey(kind string, name string) string {
+	return kind + "/" + name
+}
+
+// SetOrgItem saves new item in the organization vault.
+// Returns storage.ErrMetanameIsTaken if there is an item of the kind with the name already
+func (s *MemStorage) SetOrgItem(ctx context.Context, item storage.OrgItem) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[item.Org]
+	if !ok {
+		return storage.ErrDataNotFound
+	}
+	key := itemKey(item.Kind, item.Name)
+	if _, ok := org.Items[key]; ok {
+		return storage.ErrMetanameIsTaken
+	}
+	org.Items[key] = item
+	return nil
+}
+
+// UpdateOrgItem replaces the data of an item in the organization vault.
+// Returns storage.ErrDataNotFound if there is no such item
+func (s *MemStorage) UpdateOrgItem(ctx context.Context, item storage.OrgItem) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[item.Org]
+	if !ok {
+		return storage.ErrDataNotFound
+	}
+	key := itemKey(item.Kind, item.Name)
+	if _, ok := org.Items[key]; !ok {
+		return storage.ErrDataNotFound
+	}
+	org.Items[key] = item
+	return nil
+}
+
+// DeleteOrgItem removes an item from the organization vault.
+// Returns storage.ErrDataNotFound if there is no such item
+func (s *MemStorage) DeleteOrgItem(ctx context.Context, orgname string, kind string, name string) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[orgname]
+	if !ok {
+		return storage.ErrDataNotFound
+	}
+	key := itemKey(kind, name)
+	if _, ok := org.Items[key]; !ok {
+		return storage.ErrDataNotFound
+	}
+	delete(org.Items, key)
+	return nil
+}
+
+// GetOrgItem returns an item of the organization vault
+func (s *MemStorage) GetOrgItem(ctx context.Context, orgname string, kind string, name string) (storage.OrgItem, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[orgname]
+	if !ok {
+		return storage.OrgItem{}, storage.ErrDataNotFound
+	}
+	item, ok := org.Items[itemKey(kind, name)]
+	if !ok {
+		return storage.OrgItem{}, storage.ErrDataNotFound
+	}
+	return item, nil
+}
+
+// ListOrgItems returns kinds, names and encrypted names of all items in the organization vault
+func (s *MemStorage) ListOrgItems(ctx context.Context, orgname string) ([]storage.OrgItem, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	org, ok := s.Orgs[orgname]
+	if !ok {
+		return nil, nil
+	}
+	var items []storage.OrgItem
+	for _, item := range org.Items {
+		items = append(items, storage.OrgItem{Org: orgname, Kind: item.Kind, Name: item.Name, EncName: item.EncName})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return itemKey(items[i].Kind, items[i].Name) < itemKey(items[j].Kind, items[j].Name)
+	})
+	return items, nil
+}
+
+// items returns the items of the kind, nil for binaries and unknown kinds
+func (s *MemStorage) items(kind string) map[string]map[string]storage.EncryptedData {
+	switch kind {
+	case storage.KindCard:
+		return s.Cards
+	case storage.KindLoginCreds:
+		return s.Logins
+	case storage.KindNote:
+		return s.Notes
+	}
+	return nil
+}
+
+var errWrongKind = errors.New("wrong kind of item")
+
+// storeItem saves the item of any kind along with its modification time.
+// Returns storage.ErrMetanameIsTaken if there is an item of the kind with the name already
+func (s *MemStorage) storeItem(username string, item storage.Item) error {
+	var err error
+	if kindItems := s.items(item.Kind); kindItems != nil {
+		err = setItem(kindItems, username, storage.EncryptedData{Name: item.Name, Data: item.Data, EncName: item.EncName, Tags: item.Tags})
+	} else if item.Kind == storage.KindBinary {
+		err = s.setBinary(username, storage.Binary{Name: item.Name, Data: item.Binary, EncName: item.EncName, Tags: item.Tags})
+	} else {
+		err = errWrongKind
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.Modified[username]; !ok {
+		s.Modified[username] = make(map[string]time.Time)
+	}
+	s.Modified[username][itemKey(item.Kind, item.Name)] = time.Now().UTC()
+	return nil
+}
+
+// findItem returns storage.ErrDataNotFound if there is no such item
+func (s *MemStorage) findItem(username string, kind string, name string) error {
+	var ok bool
+	if kindItems := s.items(kind); kindItems != nil {
+		_, ok = kindItems[username][name]
+	} else if kind == storage.KindBinary {
+		_, ok = s.Binaries[username][name]
+	} else {
+		return errWrongKind
+	}
+	if !ok {
+		return storage.ErrDataNotFound
+	}
+	return nil
+}
+
+// removeItem deletes the item of any kind along with its modification time.
+// Returns storage.ErrDataNotFound if there is no such item
+func (s *MemStorage) removeItem(username string, kind string, name string) error {
+	if err := s.findItem(username, kind, name); err != nil {
+		return err
+	}
+	if kindItems := s.items(kind); kindItems != nil {
+		delete(kindItems[username], name)
+	} else {
+		delete(s.Binaries[username], name)
+	}
+	delete(s.Modified[username], itemKey(kind, name))
+	return nil
+}
+
+// itemTags returns the tags of the item of any kind
+func (s *MemStorage) itemTags(username string, kind string, name string) []string {
+	if kindItems := s.items(kind); kindItems != nil {
+		return kindItems[username][name].Tags
+	}
+	return s.Binaries[username][name].Tags
+}
+
+var errConflict = errors.New("item has changed after the base revision")
+
+// checkBase returns errConflict if the existing item has changed after the base revision of the write
+func (s *MemStorage) checkBase(username string, item storage.Item) error {
+	if err := s.findItem(username, item.Kind, item.Name); err != nil {
+		return err
+	}
+	if item.BaseRevision != 0 && s.Changes[username][itemKey(item.Kind, item.Name)].Revision != item.BaseRevision {
+		return errConflict
+	}
+	return nil
+}
+
+// recordChange takes the next revision of the user and marks the item changed with it
+func (s *MemStorage) recordChange(username string, item storage.Item, deleted bool) int64 {
+	s.Revisions[username]++
+	if _, ok := s.Changes[username]; !ok {
+		s.Changes[username] = make(map[string]storage.Change)
+	}
+	change := storage.Change{
+		Kind: item.Kind, Name: item.Name, Revision: s.Revisions[username], Deleted: deleted, Hash: item.Hash, Device: item.Device,
+	}
+	if deleted {
+		change.Hash = ""
+	}
+	s.Changes[username][itemKey(item.Kind, item.Name)] = change
+	return change.Revision
+}
+
+// saveItem saves the item of any kind and records the change.
+// Returns storage.ErrMetanameIsTaken if there is an item of the kind with the name already
+func (s *MemStorage) saveItem(username string, item storage.Item) (int64, error) {
+	if err := s.storeItem(username, item); err != nil {
+		return 0, err
+	}
+	return s.recordChange(username, item, false), nil
+}
+
+// itemError returns the error of a failed item of a batch
+func itemError(err error) string {
+	switch err {
+	case nil:
+		return ""
+	case storage.ErrMetanameIsTaken:
+		return storage.ItemErrNameTaken
+	case storage.ErrDataNotFound:
+		return storage.ItemErrNotFound
+	case errWrongKind:
+		return storage.ItemErrWrongKind
+	case errConflict:
+		return storage.ItemErrConflict
+	}
+	return err.Error()
+}
+
+// ListItems returns a page of names of the user's items of the kind.
+// Returns storage.ErrWrongCursor if the options are malformed
+func (s *MemStorage) ListItems(ctx context.Context, username string, kind string, opts storage.ListOptions) (storage.Page, error) {
+	after, err := opts.Check()
+	if err != nil {
+		return storage.Page{}, err
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	var items []storage.ListedItem
+	add := func(name string, tags []string) {
+		if opts.Tag != "" && !hasTag(tags, opts.Tag) {
+			return
+		}
+		items = append(items, storage.ListedItem{Name: name, Modified: s.Modified[username][itemKey(kind, name)]})
+	}
+	if kindItems := s.items(kind); kindItems != nil {
+		for name, item := range kindItems[username] {
+			add(name, item.Tags)
+		}
+	} else if kind == storage.KindBinary {
+		for name, binary := range s.Binaries[username] {
+			add(name, binary.Tags)
+		}
+	} else {
+		return storage.Page{}, storage.ErrDataNotFound
+	}
+
+	items = storage.SortListed(opts, items, after)
+	if len(items) > opts.Limit+1 {
+		items = items[:opts.Limit+1]
+	}
+	return storage.NewPage(opts, items), nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SetItems saves the items of any kinds at once.
+// Items with taken names or unknown kinds fail alone
+func (s *MemStorage) SetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	results := make([]storage.ItemResult, len(items))
+	for i, item := range items {
+		results[i].Kind, results[i].Name = item.Kind, item.Name
+		revision, err := s.saveItem(username, item)
+		results[i].Revision, results[i].Error = revision, itemError(err)
+	}
+	return results, nil
+}
+
+// UpdateItems replaces the content of the existing items at once, and their tags
+// unless the items come without them. Missing items, items changed after their base revisions and unknown kinds fail alone
+func (s *MemStorage) UpdateItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	results := make([]storage.ItemResult, len(items))
+	for i, item := range items {
+		results[i].Kind, results[i].Name = item.Kind, item.Name
+		err := s.checkBase(username, item)
+		if err == nil {
+			if item.Tags == nil {
+				item.Tags = s.itemTags(username, item.Kind, item.Name)
+			}
+			err = s.removeItem(username, item.Kind, item.Name)
+		}
+		if err == nil {
+			err = s.storeItem(username, item)
+		}
+		if err != nil {
+			results[i].Error = itemError(err)
+			continue
+		}
+		results[i].Revision = s.recordChange(username, item, false)
+	}
+	return results, nil
+}
+
+// DeleteItems deletes the items by kind and name at once.
+// Missing items, items changed after their base revisions and unknown kinds fail alone
+func (s *MemStorage) DeleteItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	results := make([]storage.ItemResult, len(items))
+	for i, item := range items {
+		results[i].Kind, results[i].Name = item.Kind, item.Name
+		err := s.checkBase(username, item)
+		if err == nil {
+			err = s.removeItem(username, item.Kind, item.Name)
+		}
+		if err != nil {
+			results[i].Error = itemError(err)
+			continue
+		}
+		results[i].Revision = s.recordChange(username, item, true)
+	}
+	return results, nil
+}
+
+// ListChanges returns a page of the user's change feed after the revision since, at most limit changes.
+// With limit 0 only the revision is returned
+func (s *MemStorage) ListChanges(ctx context.Context, username string, since int64, limit int) (storage.Changes, error) {
+	if limit < 0 || limit > storage.MaxPageSize {
+		limit = storage.MaxPageSize
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	var changes []storage.Change
+	for _, change := range s.Changes[username] {
+		if change.Revision > since {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Revision < changes[j].Revision })
+	if len(changes) > limit+1 {
+		changes = changes[:limit+1]
+	}
+	return storage.ChangesPage(s.Revisions[username], changes, limit), nil
+}
+
+// GetItems returns the items of any kinds by kind and name along with their last changes at once.
+// Missing items and unknown kinds fail alone
+func (s *MemStorage) GetItems(ctx context.Context, username string, items []storage.Item) ([]storage.ItemResult, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	results := make([]storage.ItemResult, len(items))
+	for i, item := range items {
+		results[i].Kind, results[i].Name = item.Kind, item.Name
+		if kindItems := s.items(item.Kind); kindItems != nil {
+			data, err := getItem(kindItems, username, item.Name)
+			if err != nil {
+				results[i].Error = storage.ItemErrNotFound
+				continue
+			}
+			results[i].Data, results[i].EncName = data.Data, data.EncName
+		} else if item.Kind == storage.KindBinary {
+			binary, err := s.getBinary(username, item.Name)
+			if err != nil {
+				results[i].Error = storage.ItemErrNotFound
+				continue
+			}
+			results[i].Binary, results[i].EncName = binary.Data, binary.EncName
+		} else {
+			results[i].Error = storage.ItemErrWrongKind
+			continue
+		}
+		change := s.Changes[username][itemKey(item.Kind, item.Name)]
+		results[i].Revision, results[i].Hash, results[i].Device = change.Revision, change.Hash, change.Device
+	}
+	return results, nil
+}
+
+func moveItems[T any](items map[string]map[string]T, login string, newLogin string) {
+	if newLogin != "" && items[login] != nil {
+		items[newLogin] = items[login]
+	}
+	delete(items, login)
+}
+
+// MoveAccount moves all the data of the user to the new login, as the database does by user id.
+// Deletes the data if newLogin is empty
+func (s *MemStorage) MoveAccount(ctx context.Context, login string, newLogin string) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	moveItems(s.Logins, login, newLogin)
+	moveItems(s.Notes, login, newLogin)
+	moveItems(s.Cards, login, newLogin)
+	moveItems(s.Binaries, login, newLogin)
+	moveItems(s.Modified, login, newLogin)
+	moveItems(s.Changes, login, newLogin)
+	if revision, ok := s.Revisions[login]; ok && newLogin != "" {
+		s.Revisions[newLogin] = revision
+	}
+	delete(s.Revisions, login)
+	if keys, ok := s.Keys[login]; ok && newLogin != "" {
+		s.Keys[newLogin] = keys
+	}
+	delete(s.Keys, login)
+
+	shares := s.Shares[:0]
+	for _, share := range s.Shares {
+		if newLogin == "" && (share.Owner == login || share.Recipient == login) {
+			continue
+		}
+		if share.Owner == login {
+			share.Owner = newLogin
+		}
+		if share.Recipient == login {
+			share.Recipient = newLogin
+		}
+		shares = append(shares, share)
+	}
+	s.Shares = shares
+
+	for _, org := range s.Orgs {
+		member, ok := org.Members[login]
+		if !ok {
+			continue
+		}
+		delete(org.Members, login)
+		if newLogin != "" {
+			member.Login = newLogin
+			org.Members[newLogin] = member
+		}
+	}
+	return nil
 }
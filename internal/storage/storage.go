@@ -1,21 +1,55 @@
 // Package storage declares Storage interface, as well as types and errors for it
 package storage
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 type Storage interface {
-	SetLoginCred(username string, logincreds EncryptedData) error
-	SetNote(username string, note EncryptedData) error
-	SetBinary(username string, binary Binary) error
-	SetCard(username string, card EncryptedData) error
-	GetLoginCred(username string, name string) (EncryptedData, error)
-	GetNote(username string, name string) (EncryptedData, error)
-	GetBinary(username string, name string) (Binary, error)
-	GetCard(username string, name string) (EncryptedData, error)
-	ListLoginCreds(username string) ([]string, error)
-	ListNotes(username string) ([]string, error)
-	ListBinaries(username string) ([]string, error)
-	ListCards(username string) ([]string, error)
+	SetLoginCred(ctx context.Context, username string, logincreds EncryptedData) error
+	SetNote(ctx context.Context, username string, note EncryptedData) error
+	SetBinary(ctx context.Context, username string, binary Binary) error
+	SetCard(ctx context.Context, username string, card EncryptedData) error
+	GetLoginCred(ctx context.Context, username string, name string) (EncryptedData, error)
+	GetNote(ctx context.Context, username string, name string) (EncryptedData, error)
+	GetBinary(ctx context.Context, username string, name string) (Binary, error)
+	GetCard(ctx context.Context, username string, name string) (EncryptedData, error)
+	ListLoginCreds(ctx context.Context, username string) ([]string, error)
+	ListNotes(ctx context.Context, username string) ([]string, error)
+	ListBinaries(ctx context.Context, username string) ([]string, error)
+	ListCards(ctx context.Context, username string) ([]string, error)
+	SetKeyPair(ctx context.Context, username string, keys KeyPair) error
+	GetKeyPair(ctx context.Context, username string) (KeyPair, error)
+	SetShare(ctx context.Context, username string, share Share) error
+	ListSharesReceived(ctx context.Context, username string) ([]Share, error)
+	ListSharesOwned(ctx context.Context, username string) ([]Share, error)
+	DeleteShare(ctx context.Context, username string, share Share) error
+	CreateOrg(ctx context.Context, username string, org Org) error
+	ListOrgs(ctx context.Context, username string) ([]Org, error)
+	GetOrgRole(ctx context.Context, username string, orgname string) (string, error)
+	SetOrgMember(ctx context.Context, member OrgMember) error
+	DeleteOrgMember(ctx context.Context, orgname string, login string) error
+	RotateOrgKey(ctx context.Context, rotation OrgRotation) error
+	ListOrgMembers(ctx context.Context, orgname string) ([]OrgMember, error)
+	SetOrgItem(ctx context.Context, item OrgItem) error
+	UpdateOrgItem(ctx context.Context, item OrgItem) error
+	DeleteOrgItem(ctx context.Context, orgname string, kind string, name string) error
+	GetOrgItem(ctx context.Context, orgname string, kind string, name string) (OrgItem, error)
+	ListOrgItems(ctx context.Context, orgname string) ([]OrgItem, error)
+	ListItems(ctx context.Context, username string, kind string, opts ListOptions) (Page, error)
+	SetItems(ctx context.Context, username string, items []Item) ([]ItemResult, error)
+	GetItems(ctx context.Context, username string, items []Item) ([]ItemResult, error)
+	UpdateItems(ctx context.Context, username string, items []Item) ([]ItemResult, error)
+	DeleteItems(ctx context.Context, username string, items []Item) ([]ItemResult, error)
+	ListChanges(ctx context.Context, username string, since int64, limit int) (Changes, error)
+}
+
+// AccountMover is implemented by storages which keep data by login rather than by account.
+// Databases move and delete the data along with the account, others are told by the handlers.
+// An empty newLogin means the account is deleted
+type AccountMover interface {
+	MoveAccount(ctx context.Context, login string, newLogin string) error
 }
 
 type LoginCreds struct {
@@ -33,6 +67,9 @@ type Note struct {
 type Binary struct {
 	Name string `json:"name"`
 	Data []byte `json:"data"`
+	// EncName is the name encrypted on the client, Name then keeps its blind index
+	EncName string   `json:"encname,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
 }
 
 type Card struct {
@@ -47,12 +84,131 @@ type Card struct {
 type EncryptedData struct {
 	Name string `json:"name"`
 	Data string `json:"data"`
+	// EncName is the name encrypted on the client, Name then keeps its blind index
+	EncName string   `json:"encname,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// Item is an encrypted item of any kind in batch requests.
+// Binaries keep their content in Binary, the other kinds in Data
+type Item struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Data    string `json:"data,omitempty"`
+	Binary  []byte `json:"binary,omitempty"`
+	EncName string `json:"encname,omitempty"`
+	// Tags filter lists of the items. Updates without tags keep the tags of the item
+	// and an empty list removes them, so empty lists aren't omitted
+	Tags []string `json:"tags"`
+	// Hash is a keyed hash of the content computed by the client, so clients compare contents
+	// without downloading them. Device names the client install which wrote the item
+	Hash   string `json:"hash,omitempty"`
+	Device string `json:"device,omitempty"`
+	// BaseRevision is the revision of the item an update or deletion is based on.
+	// If the item has changed after it, the write fails with ItemErrConflict. Zero writes anyway
+	BaseRevision int64 `json:"baserevision,omitempty"`
+}
+
+// ItemResult is the outcome of one item of a batch, Error is empty if the item succeeded.
+// Results of reads carry the item with the revision, hash and device of its last change,
+// results of writes only its kind, name and the revision of the change
+type ItemResult struct {
+	Item
+	Revision int64  `json:"revision,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
+// errors of batch items, one failed item doesn't fail the others
+const (
+	ItemErrNotFound  = "not found"
+	ItemErrNameTaken = "name is taken"
+	ItemErrWrongKind = "wrong kind"
+	ItemErrForbidden = "forbidden"
+	ItemErrConflict  = "conflict"
+)
+
+// KeyPair is a user's X25519 key pair. Private key is wrapped by user's vault key on the client
+// so the server only sees the public part in clear
+type KeyPair struct {
+	PublicKey  string `json:"publickey"`
+	PrivateKey string `json:"privatekey,omitempty"`
+}
+
+// Share is an item shared by its owner with another user.
+// Data is the item encrypted with a one-time item key, Key is that item key sealed for the recipient.
+// Name is a blind index keyed by the owner, EncName is the name encrypted with the item key
+type Share struct {
+	Owner     string `json:"owner"`
+	Recipient string `json:"recipient"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	EncName   string `json:"encname,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// kinds of items which can be shared
+const (
+	KindCard       = "card"
+	KindLoginCreds = "logincreds"
+	KindNote       = "note"
+)
+
+// KindBinary is the kind of binary files, they can't be shared
+const KindBinary = "binary"
+
+// Org is an organization owning a shared vault.
+// VaultKey is the organization vault key sealed for the current user's public key
+type Org struct {
+	Name     string `json:"name"`
+	Role     string `json:"role,omitempty"`
+	VaultKey string `json:"vaultkey,omitempty"`
+}
+
+// OrgMember is a user's membership in an organization.
+// VaultKey is the organization vault key sealed for the member's public key
+type OrgMember struct {
+	Org      string `json:"org"`
+	Login    string `json:"login"`
+	Role     string `json:"role,omitempty"`
+	VaultKey string `json:"vaultkey,omitempty"`
+}
+
+// OrgItem is an item of organization vault, encrypted with organization vault key.
+// Name is a blind index keyed by the vault key, Rename is the new one when the key is rotated
+type OrgItem struct {
+	Org     string `json:"org"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	EncName string `json:"encname,omitempty"`
+	Rename  string `json:"rename,omitempty"`
+	Data    string `json:"data,omitempty"`
+}
+
+// OrgRotation removes a member from the organization and replaces the organization vault key,
+// so the removed member can't read what is written afterwards. Members are the remaining members
+// with the new key sealed for each of them, Items are all items of the vault encrypted with the new key
+type OrgRotation struct {
+	Org     string      `json:"org"`
+	Login   string      `json:"login"`
+	Members []OrgMember `json:"members"`
+	Items   []OrgItem   `json:"items"`
+}
+
+// organization member roles, from the most to the least privileged
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
 // errors
 var (
-	ErrTableDoesntExist = errors.New("table doesn't exist")
-	ErrWrongPassword    = errors.New("wrong password")
-	ErrDataNotFound     = errors.New("requested data not found in storage")
-	ErrMetanameIsTaken  = errors.New("metaname is already in use")
+	ErrWrongPassword   = errors.New("wrong password")
+	ErrDataNotFound    = errors.New("requested data not found in storage")
+	ErrMetanameIsTaken = errors.New("metaname is already in use")
+	ErrWrongCursor     = errors.New("list sort order or cursor is malformed")
+	ErrOrgChanged      = errors.New("organization members or items have changed")
+	ErrLastOwner       = errors.New("organization can't be left without an owner")
 )
@@ -0,0 +1,49 @@
+package storagetest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/storage/database"
+	"github.com/gambruh/simplevault/internal/storage/memstorage"
+)
+
+func TestMemStorage(t *testing.T) {
+	Run(t, func(t *testing.T) Backend {
+		return Backend{Storage: memstorage.NewStorage(), Auth: auth.NewMemStorage()}
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	Run(t, func(t *testing.T) Backend {
+		return open(t, "sqlite://"+filepath.Join(t.TempDir(), "vault.db"), "")
+	})
+}
+
+// TestPostgresStorage runs on the database from GK_TEST_DATABASE, the tables are created if needed
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv("GK_TEST_DATABASE")
+	if dsn == "" {
+		t.Skip("GK_TEST_DATABASE is not set")
+	}
+	Run(t, func(t *testing.T) Backend {
+		return open(t, "", dsn)
+	})
+}
+
+// open opens auth storage first, data tables refer to its users table
+func open(t *testing.T, storage string, postgresStr string) Backend {
+	t.Helper()
+	authdb, err := auth.OpenAuthDB(storage, postgresStr)
+	if err != nil {
+		t.Fatalf("OpenAuthDB: %v", err)
+	}
+	db, err := database.OpenDB(storage, postgresStr)
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+	return Backend{Storage: db, Auth: authdb}
+}
@@ -0,0 +1,1304 @@
+// Package storagetest is the conformance suite of storage backends.
+// Every backend runs it, so the server behaves the same whichever storage it is started with
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gambruh/simplevault/internal/auth"
+	"github.com/gambruh/simplevault/internal/handlers"
+	"github.com/gambruh/simplevault/internal/storage"
+)
+
+// Backend is a pair of data and auth storages the server is started with
+type Backend struct {
+	Storage handlers.Storage
+	Auth    handlers.AuthStorage
+}
+
+// Run runs the suite. newBackend is called once per test and may return storages
+// with data of previous tests, all names are unique within the run
+func Run(t *testing.T, newBackend func(t *testing.T) Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, b Backend)
+	}{
+		{"Items", testItems},
+		{"Binaries", testBinaries},
+		{"Batch", testBatch},
+		{"Listing", testListing},
+		{"ListingBlindIndexes", testListingBlindIndexes},
+		{"Changes", testChanges},
+		{"Conflicts", testConflicts},
+		{"KeyPairs", testKeyPairs},
+		{"Shares", testShares},
+		{"Orgs", testOrgs},
+		{"OrgRotation", testOrgRotation},
+		{"Accounts", testAccounts},
+		{"VaultKeys", testVaultKeys},
+		{"Recovery", testRecovery},
+		{"TOTP", testTOTP},
+		{"Sessions", testSessions},
+		{"LoginFailures", testLoginFailures},
+		{"Certificates", testCertificates},
+		{"APIKeys", testAPIKeys},
+		{"Devices", testDevices},
+		{"LoginKeys", testLoginKeys},
+		{"ChangeUsername", testChangeUsername},
+		{"DeleteAccount", testDeleteAccount},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newBackend(t))
+		})
+	}
+}
+
+var (
+	runID   = strconv.FormatInt(time.Now().UnixNano(), 36)
+	counter int64
+)
+
+// unique returns a name not used before, so the suite can run again on the same database
+func unique(name string) string {
+	return fmt.Sprintf("%s-%s-%d", name, runID, atomic.AddInt64(&counter, 1))
+}
+
+// now is the current time at the precision every backend keeps
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func register(t *testing.T, b Backend, name string) string {
+	t.Helper()
+	ctx := context.Background()
+	login := unique(name)
+	if err := b.Auth.Register(ctx, login, auth.SRPVerifier{Salt: "salt", Verifier: "verifier"}); err != nil {
+		t.Fatalf("Register(%s): %v", login, err)
+	}
+	return login
+}
+
+// changeUsername renames the account as the handler does
+func changeUsername(b Backend, login string, newLogin string, vaultKey string) error {
+	ctx := context.Background()
+	if err := b.Auth.ChangeUsername(ctx, login, newLogin, vaultKey); err != nil {
+		return err
+	}
+	if mover, ok := b.Storage.(storage.AccountMover); ok {
+		return mover.MoveAccount(ctx, login, newLogin)
+	}
+	return nil
+}
+
+// deleteAccount deletes the account as the handler does
+func deleteAccount(b Backend, login string) error {
+	ctx := context.Background()
+	if err := b.Auth.DeleteAccount(ctx, login); err != nil {
+		return err
+	}
+	if mover, ok := b.Storage.(storage.AccountMover); ok {
+		return mover.MoveAccount(ctx, login, "")
+	}
+	return nil
+}
+
+func wantErr(t *testing.T, what string, err error, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+func noErr(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+}
+
+func sameTime(t *testing.T, what string, got time.Time, want time.Time) {
+	t.Helper()
+	if !got.Equal(want) {
+		t.Fatalf("%s: got time %v, want %v", what, got, want)
+	}
+}
+
+func sameStrings(t *testing.T, what string, got []string, want []string) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func testItems(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	kinds := []struct {
+		name string
+		set  func(context.Context, string, storage.EncryptedData) error
+		get  func(context.Context, string, string) (storage.EncryptedData, error)
+		list func(context.Context, string) ([]string, error)
+	}{
+		{"logincreds", s.SetLoginCred, s.GetLoginCred, s.ListLoginCreds},
+		{"notes", s.SetNote, s.GetNote, s.ListNotes},
+		{"cards", s.SetCard, s.GetCard, s.ListCards},
+	}
+	for _, kind := range kinds {
+		kind := kind
+		t.Run(kind.name, func(t *testing.T) {
+			user, other := register(t, b, "user"), register(t, b, "other")
+			item := storage.EncryptedData{Name: "b", Data: "data", EncName: "encname"}
+
+			_, err := kind.get(ctx, user, "b")
+			wantErr(t, "get missing", err, storage.ErrDataNotFound)
+			list, err := kind.list(ctx, user)
+			noErr(t, "list empty", err)
+			sameStrings(t, "list empty", list, nil)
+
+			noErr(t, "set", kind.set(ctx, user, item))
+			noErr(t, "set second", kind.set(ctx, user, storage.EncryptedData{Name: "a", Data: "data a"}))
+			got, err := kind.get(ctx, user, "b")
+			noErr(t, "get", err)
+			if !reflect.DeepEqual(got, item) {
+				t.Fatalf("get: got %+v, want %+v", got, item)
+			}
+			wantErr(t, "set duplicate", kind.set(ctx, user, storage.EncryptedData{Name: "b", Data: "new"}), storage.ErrMetanameIsTaken)
+
+			_, err = kind.get(ctx, other, "b")
+			wantErr(t, "get of other user", err, storage.ErrDataNotFound)
+			noErr(t, "set same name by other user", kind.set(ctx, other, storage.EncryptedData{Name: "b", Data: "other"}))
+			got, err = kind.get(ctx, user, "b")
+			noErr(t, "get after other user", err)
+			if got.Data != "data" {
+				t.Fatalf("get after other user: got %q", got.Data)
+			}
+
+			list, err = kind.list(ctx, user)
+			noErr(t, "list", err)
+			sameStrings(t, "list", list, []string{"a", "b"})
+		})
+	}
+}
+
+func testBinaries(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	user, other := register(t, b, "user"), register(t, b, "other")
+	bin := storage.Binary{Name: "file", Data: []byte{0, 1, 2, 255}, EncName: "encname"}
+
+	_, err := s.GetBinary(ctx, user, "file")
+	wantErr(t, "get missing", err, storage.ErrDataNotFound)
+	noErr(t, "set", s.SetBinary(ctx, user, bin))
+	got, err := s.GetBinary(ctx, user, "file")
+	noErr(t, "get", err)
+	if got.Name != bin.Name || got.EncName != bin.EncName || !bytes.Equal(got.Data, bin.Data) {
+		t.Fatalf("get: got %+v, want %+v", got, bin)
+	}
+	wantErr(t, "set duplicate", s.SetBinary(ctx, user, bin), storage.ErrMetanameIsTaken)
+	noErr(t, "set same name by other user", s.SetBinary(ctx, other, bin))
+
+	list, err := s.ListBinaries(ctx, user)
+	noErr(t, "list", err)
+	sameStrings(t, "list", list, []string{"file"})
+}
+
+func testBatch(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	user := register(t, b, "user")
+	items := []storage.Item{
+		{Kind: storage.KindCard, Name: "card", Data: "card data", EncName: "encname"},
+		{Kind: storage.KindLoginCreds, Name: "login", Data: "login data"},
+		{Kind: storage.KindNote, Name: "note", Data: "note data"},
+		{Kind: storage.KindBinary, Name: "file", Binary: []byte{0, 1, 255}},
+		{Kind: "unknown", Name: "item"},
+	}
+	errs := func(results []storage.ItemResult) []string {
+		var errs []string
+		for _, result := range results {
+			errs = append(errs, result.Error)
+		}
+		return errs
+	}
+
+	results, err := s.SetItems(ctx, user, items)
+	noErr(t, "set", err)
+	if got, want := errs(results), []string{"", "", "", "", storage.ItemErrWrongKind}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("set: got errors %q, want %q", got, want)
+	}
+	note, err := s.GetNote(ctx, user, "note")
+	noErr(t, "get note", err)
+	if note.Data != "note data" {
+		t.Fatalf("get note: got %+v", note)
+	}
+
+	// one taken name doesn't fail the rest of the batch
+	results, err = s.SetItems(ctx, user, []storage.Item{
+		{Kind: storage.KindNote, Name: "note", Data: "new data"},
+		{Kind: storage.KindNote, Name: "second", Data: "second data"},
+	})
+	noErr(t, "set again", err)
+	if got, want := errs(results), []string{storage.ItemErrNameTaken, ""}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("set again: got errors %q, want %q", got, want)
+	}
+	list, err := s.ListNotes(ctx, user)
+	noErr(t, "list notes", err)
+	sameStrings(t, "list notes", list, []string{"note", "second"})
+
+	results, err = s.GetItems(ctx, user, append(items, storage.Item{Kind: storage.KindCard, Name: "missing"}))
+	noErr(t, "get", err)
+	if got, want := errs(results), []string{"", "", "", "", storage.ItemErrWrongKind, storage.ItemErrNotFound}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("get: got errors %q, want %q", got, want)
+	}
+	for i, item := range items[:4] {
+		got := results[i].Item
+		if got.Kind != item.Kind || got.Name != item.Name || got.Data != item.Data ||
+			got.EncName != item.EncName || !bytes.Equal(got.Binary, item.Binary) {
+			t.Fatalf("get: got %+v, want %+v", got, item)
+		}
+	}
+}
+
+func testListing(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	user := register(t, b, "user")
+	// in order of modification, the times differ at the precision of every backend
+	for _, note := range []storage.EncryptedData{
+		{Name: "c", Data: "data"},
+		{Name: "b2", Data: "data", Tags: []string{"work"}},
+		{Name: "a1", Data: "data", Tags: []string{"work", "home"}},
+		{Name: "b1", Data: "data"},
+		{Name: "a2", Data: "data", Tags: []string{"home"}},
+	} {
+		noErr(t, "set "+note.Name, s.SetNote(ctx, user, note))
+		time.Sleep(2 * time.Millisecond)
+	}
+	noErr(t, "set binary", s.SetBinary(ctx, user, storage.Binary{Name: "file", Data: []byte{1}, Tags: []string{"work"}}))
+
+	// listAll pages through the list two names at a time
+	listAll := func(kind string, opts storage.ListOptions) []string {
+		t.Helper()
+		var names []string
+		opts.Limit = 2
+		for i := 0; i < 10; i++ {
+			page, err := s.ListItems(ctx, user, kind, opts)
+			noErr(t, "list "+opts.Sort, err)
+			if len(page.Names) > 2 {
+				t.Fatalf("list %s: page of %d names", opts.Sort, len(page.Names))
+			}
+			names = append(names, page.Names...)
+			if page.Next == "" {
+				return names
+			}
+			opts.Cursor = page.Next
+		}
+		t.Fatalf("list %s: too many pages", opts.Sort)
+		return nil
+	}
+	for _, tt := range []struct {
+		opts storage.ListOptions
+		want []string
+	}{
+		{storage.ListOptions{}, []string{"a1", "a2", "b1", "b2", "c"}},
+		{storage.ListOptions{Sort: "-" + storage.SortName}, []string{"c", "b2", "b1", "a2", "a1"}},
+		{storage.ListOptions{Sort: storage.SortModified}, []string{"c", "b2", "a1", "b1", "a2"}},
+		{storage.ListOptions{Sort: "-" + storage.SortModified}, []string{"a2", "b1", "a1", "b2", "c"}},
+		{storage.ListOptions{Tag: "work"}, []string{"a1", "b2"}},
+		{storage.ListOptions{Sort: storage.SortModified, Tag: "home"}, []string{"a1", "a2"}},
+		{storage.ListOptions{Tag: "travel"}, nil},
+	} {
+		if got := listAll(storage.KindNote, tt.opts); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("list %+v: got %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+	if got := listAll(storage.KindBinary, storage.ListOptions{Tag: "work"}); !reflect.DeepEqual(got, []string{"file"}) {
+		t.Fatalf("list binaries: got %v", got)
+	}
+
+	page, err := s.ListItems(ctx, user, storage.KindNote, storage.ListOptions{Limit: 2})
+	noErr(t, "list first page", err)
+	_, err = s.ListItems(ctx, user, storage.KindNote, storage.ListOptions{Sort: storage.SortModified, Cursor: page.Next})
+	wantErr(t, "list with cursor of another order", err, storage.ErrWrongCursor)
+	_, err = s.ListItems(ctx, user, storage.KindNote, storage.ListOptions{Cursor: "malformed"})
+	wantErr(t, "list with malformed cursor", err, storage.ErrWrongCursor)
+	_, err = s.ListItems(ctx, user, storage.KindNote, storage.ListOptions{Sort: "size"})
+	wantErr(t, "list by unknown order", err, storage.ErrWrongCursor)
+	_, err = s.ListItems(ctx, user, "unknown", storage.ListOptions{})
+	wantErr(t, "list unknown kind", err, storage.ErrDataNotFound)
+
+	// updates with tags replace them, an empty list removes them
+	retag := func(name string, tags []string, tag string, want []string) {
+		t.Helper()
+		results, err := s.UpdateItems(ctx, user, []storage.Item{{Kind: storage.KindNote, Name: "a1", Data: "data", Tags: tags}})
+		noErr(t, name, err)
+		if results[0].Error != "" {
+			t.Fatalf("%s: got %+v", name, results[0])
+		}
+		if got := listAll(storage.KindNote, storage.ListOptions{Tag: tag}); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	retag("update without tags", nil, "home", []string{"a1", "a2"})
+	retag("retag", []string{"travel"}, "home", []string{"a2"})
+	retag("untag", []string{}, "travel", nil)
+}
+
+// Names of items hidden by clients are blind indexes, the storage orders them by the index
+// and not by the names they hide. Legacy plaintext names are ordered among them as they are
+func testListingBlindIndexes(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	user := register(t, b, "user")
+	for _, note := range []storage.EncryptedData{
+		{Name: "bi1-9c0e", EncName: "sealed apple", Data: "data", Tags: []string{"work"}},
+		{Name: "bi1-1f7a", EncName: "sealed banana", Data: "data"},
+		{Name: "bi1-e45b", EncName: "sealed cherry", Data: "data", Tags: []string{"work"}},
+		{Name: "legacy", Data: "data"},
+	} {
+		noErr(t, "set "+note.Name, s.SetNote(ctx, user, note))
+	}
+
+	var names []string
+	opts := storage.ListOptions{Limit: 1}
+	for {
+		page, err := s.ListItems(ctx, user, storage.KindNote, opts)
+		noErr(t, "list page", err)
+		names = append(names, page.Names...)
+		if page.Next == "" {
+			break
+		}
+		opts.Cursor = page.Next
+	}
+	if want := []string{"bi1-1f7a", "bi1-9c0e", "bi1-e45b", "legacy"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("list by name: got %v, want %v", names, want)
+	}
+
+	page, err := s.ListItems(ctx, user, storage.KindNote, storage.ListOptions{Tag: "work", Sort: "-" + storage.SortName})
+	noErr(t, "list tagged", err)
+	if want := []string{"bi1-e45b", "bi1-9c0e"}; !reflect.DeepEqual(page.Names, want) {
+		t.Fatalf("list tagged: got %v, want %v", page.Names, want)
+	}
+}
+
+func testChanges(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	user := register(t, b, "user")
+	feed := func(what string, since int64, limit int, want storage.Changes) {
+		t.Helper()
+		got, err := s.ListChanges(ctx, user, since, limit)
+		noErr(t, what, err)
+		if len(got.Changes) == 0 && len(want.Changes) == 0 {
+			got.Changes, want.Changes = nil, nil
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %+v, want %+v", what, got, want)
+		}
+	}
+	revisions := func(what string, results []storage.ItemResult, err error, want ...int64) {
+		t.Helper()
+		noErr(t, what, err)
+		var got []int64
+		for _, result := range results {
+			got = append(got, result.Revision)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got revisions %v, want %v (results %+v)", what, got, want, results)
+		}
+	}
+
+	feed("empty feed", 0, 10, storage.Changes{})
+
+	// every written item takes the next revision, failed ones take none
+	noErr(t, "set note", s.SetNote(ctx, user, storage.EncryptedData{Name: "single", Data: "data"}))
+	results, err := s.SetItems(ctx, user, []storage.Item{
+		{Kind: storage.KindCard, Name: "card", Data: "card data"},
+		{Kind: storage.KindNote, Name: "note", Data: "note data", Tags: []string{"work"}},
+		{Kind: storage.KindNote, Name: "single", Data: "taken"},
+	})
+	revisions("set", results, err, 2, 3, 0)
+
+	results, err = s.UpdateItems(ctx, user, []storage.Item{
+		{Kind: storage.KindNote, Name: "note", Data: "new data", EncName: "encname"},
+		{Kind: storage.KindCard, Name: "missing", Data: "data"},
+		{Kind: "unknown", Name: "note"},
+	})
+	revisions("update", results, err, 4, 0, 0)
+	if results[1].Error != storage.ItemErrNotFound || results[2].Error != storage.ItemErrWrongKind {
+		t.Fatalf("update: got %+v", results)
+	}
+	note, err := s.GetNote(ctx, user, "note")
+	noErr(t, "get updated note", err)
+	if note.Data != "new data" || note.EncName != "encname" {
+		t.Fatalf("get updated note: got %+v", note)
+	}
+	// updates without tags keep them
+	page, err := s.ListItems(ctx, user, storage.KindNote, storage.ListOptions{Tag: "work"})
+	noErr(t, "list by kept tag", err)
+	sameStrings(t, "list by kept tag", page.Names, []string{"note"})
+
+	results, err = s.DeleteItems(ctx, user, []storage.Item{
+		{Kind: storage.KindCard, Name: "card"},
+		{Kind: storage.KindCard, Name: "card"},
+	})
+	revisions("delete", results, err, 5, 0)
+	if results[1].Error != storage.ItemErrNotFound {
+		t.Fatalf("delete again: got %+v", results[1])
+	}
+	_, err = s.GetCard(ctx, user, "card")
+	wantErr(t, "get deleted card", err, storage.ErrDataNotFound)
+
+	// the feed has the last change of each item only
+	single := storage.Change{Kind: storage.KindNote, Name: "single", Revision: 1}
+	updated := storage.Change{Kind: storage.KindNote, Name: "note", Revision: 4}
+	deleted := storage.Change{Kind: storage.KindCard, Name: "card", Revision: 5, Deleted: true}
+	feed("whole feed", 0, 10, storage.Changes{Changes: []storage.Change{single, updated, deleted}, Revision: 5})
+	feed("first page", 0, 2, storage.Changes{Changes: []storage.Change{single, updated}, Revision: 5, More: true})
+	feed("last page", 4, 2, storage.Changes{Changes: []storage.Change{deleted}, Revision: 5})
+	feed("revision only", 0, 0, storage.Changes{Revision: 5, More: true})
+	feed("up to date", 5, 10, storage.Changes{Revision: 5})
+
+	// recreated items are not deleted anymore
+	results, err = s.SetItems(ctx, user, []storage.Item{{Kind: storage.KindCard, Name: "card", Data: "again"}})
+	revisions("set deleted", results, err, 6)
+	feed("recreated", 5, 10, storage.Changes{Changes: []storage.Change{{Kind: storage.KindCard, Name: "card", Revision: 6}}, Revision: 6})
+
+	// feeds are per user
+	other, err := s.ListChanges(ctx, register(t, b, "other"), 0, 10)
+	noErr(t, "feed of other user", err)
+	if other.Revision != 0 || len(other.Changes) != 0 {
+		t.Fatalf("feed of other user: got %+v", other)
+	}
+}
+
+func testConflicts(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	user := register(t, b, "user")
+	write := func(what string, run func(context.Context, string, []storage.Item) ([]storage.ItemResult, error),
+		item storage.Item, wantErr string) int64 {
+		t.Helper()
+		results, err := run(ctx, user, []storage.Item{item})
+		noErr(t, what, err)
+		if results[0].Error != wantErr {
+			t.Fatalf("%s: got %+v, want error %q", what, results[0], wantErr)
+		}
+		return results[0].Revision
+	}
+	note := func(data string, hash string, device string, base int64) storage.Item {
+		return storage.Item{Kind: storage.KindNote, Name: "n", Data: data, Hash: hash, Device: device, BaseRevision: base}
+	}
+
+	created := write("set", s.SetItems, note("first", "h1", "laptop", 0), "")
+	results, err := s.GetItems(ctx, user, []storage.Item{{Kind: storage.KindNote, Name: "n"}})
+	noErr(t, "get", err)
+	if got := results[0]; got.Revision != created || got.Hash != "h1" || got.Device != "laptop" {
+		t.Fatalf("get: got %+v", got)
+	}
+
+	updated := write("update on base", s.UpdateItems, note("second", "h2", "phone", created), "")
+	write("update on stale base", s.UpdateItems, note("third", "h3", "laptop", created), storage.ItemErrConflict)
+	write("delete on stale base", s.DeleteItems, note("", "", "laptop", created), storage.ItemErrConflict)
+	got, err := s.GetNote(ctx, user, "n")
+	noErr(t, "get after conflicts", err)
+	if got.Data != "second" {
+		t.Fatalf("get after conflicts: got %+v", got)
+	}
+	changes, err := s.ListChanges(ctx, user, created, 10)
+	noErr(t, "list changes", err)
+	if want := []storage.Change{{Kind: storage.KindNote, Name: "n", Revision: updated, Hash: "h2", Device: "phone"}}; !reflect.DeepEqual(changes.Changes, want) {
+		t.Fatalf("list changes: got %+v, want %+v", changes.Changes, want)
+	}
+
+	// writes without base revision don't check it
+	updated = write("update without base", s.UpdateItems, note("fourth", "h4", "tablet", 0), "")
+	write("update missing", s.UpdateItems, storage.Item{Kind: storage.KindNote, Name: "missing", BaseRevision: updated}, storage.ItemErrNotFound)
+
+	deleted := write("delete on base", s.DeleteItems, note("", "", "laptop", updated), "")
+	changes, err = s.ListChanges(ctx, user, updated, 10)
+	noErr(t, "list deletion", err)
+	if want := []storage.Change{{Kind: storage.KindNote, Name: "n", Revision: deleted, Deleted: true, Device: "laptop"}}; !reflect.DeepEqual(changes.Changes, want) {
+		t.Fatalf("list deletion: got %+v, want %+v", changes.Changes, want)
+	}
+}
+
+func testKeyPairs(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	user := register(t, b, "user")
+	keys := storage.KeyPair{PublicKey: "public", PrivateKey: "private"}
+
+	_, err := s.GetKeyPair(ctx, user)
+	wantErr(t, "get missing", err, storage.ErrDataNotFound)
+	noErr(t, "set", s.SetKeyPair(ctx, user, keys))
+	got, err := s.GetKeyPair(ctx, user)
+	noErr(t, "get", err)
+	if got != keys {
+		t.Fatalf("get: got %+v, want %+v", got, keys)
+	}
+	wantErr(t, "set again", s.SetKeyPair(ctx, user, keys), storage.ErrMetanameIsTaken)
+}
+
+func testShares(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	owner, recipient := register(t, b, "owner"), register(t, b, "recipient")
+	share := storage.Share{Recipient: recipient, Kind: "note", Name: "n", EncName: "name", Data: "data", Key: "key"}
+
+	noErr(t, "set", s.SetShare(ctx, owner, share))
+	share.EncName, share.Data, share.Key = "new name", "new data", "new key"
+	noErr(t, "set again", s.SetShare(ctx, owner, share))
+
+	share.Owner = owner
+	received, err := s.ListSharesReceived(ctx, recipient)
+	noErr(t, "list received", err)
+	if len(received) != 1 || received[0] != share {
+		t.Fatalf("list received: got %+v, want %+v", received, share)
+	}
+	owned, err := s.ListSharesOwned(ctx, owner)
+	noErr(t, "list owned", err)
+	want := storage.Share{Owner: owner, Recipient: recipient, Kind: "note", Name: "n"}
+	if len(owned) != 1 || owned[0] != want {
+		t.Fatalf("list owned: got %+v, want %+v", owned, want)
+	}
+	received, err = s.ListSharesReceived(ctx, owner)
+	noErr(t, "list received by owner", err)
+	if len(received) != 0 {
+		t.Fatalf("list received by owner: got %+v", received)
+	}
+
+	noErr(t, "delete", s.DeleteShare(ctx, owner, share))
+	wantErr(t, "delete again", s.DeleteShare(ctx, owner, share), storage.ErrDataNotFound)
+	received, err = s.ListSharesReceived(ctx, recipient)
+	noErr(t, "list received after delete", err)
+	if len(received) != 0 {
+		t.Fatalf("list received after delete: got %+v", received)
+	}
+}
+
+func testOrgs(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	owner, member := register(t, b, "owner"), register(t, b, "member")
+	org := unique("org")
+
+	_, err := s.GetOrgRole(ctx, owner, org)
+	wantErr(t, "role before create", err, storage.ErrDataNotFound)
+	noErr(t, "create", s.CreateOrg(ctx, owner, storage.Org{Name: org, VaultKey: "sealed"}))
+	wantErr(t, "create duplicate", s.CreateOrg(ctx, member, storage.Org{Name: org, VaultKey: "sealed"}), storage.ErrMetanameIsTaken)
+
+	orgs, err := s.ListOrgs(ctx, owner)
+	noErr(t, "list", err)
+	if want := (storage.Org{Name: org, Role: storage.RoleOwner, VaultKey: "sealed"}); len(orgs) != 1 || orgs[0] != want {
+		t.Fatalf("list: got %+v, want %+v", orgs, want)
+	}
+
+	noErr(t, "add member", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: member, Role: storage.RoleViewer, VaultKey: "sealed for member"}))
+	noErr(t, "change role", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: member, Role: storage.RoleEditor, VaultKey: "sealed for member"}))
+	role, err := s.GetOrgRole(ctx, member, org)
+	noErr(t, "role", err)
+	if role != storage.RoleEditor {
+		t.Fatalf("role: got %q", role)
+	}
+	members, err := s.ListOrgMembers(ctx, org)
+	noErr(t, "list members", err)
+	sort.Slice(members, func(i, j int) bool { return members[i].Login < members[j].Login })
+	wantMembers := []storage.OrgMember{
+		{Org: org, Login: member, Role: storage.RoleEditor},
+		{Org: org, Login: owner, Role: storage.RoleOwner},
+	}
+	sort.Slice(wantMembers, func(i, j int) bool { return wantMembers[i].Login < wantMembers[j].Login })
+	if !reflect.DeepEqual(members, wantMembers) {
+		t.Fatalf("list members: got %+v, want %+v", members, wantMembers)
+	}
+	wantErr(t, "add member to missing org", s.SetOrgMember(ctx, storage.OrgMember{Org: unique("org"), Login: member, Role: storage.RoleViewer}), storage.ErrDataNotFound)
+
+	item := storage.OrgItem{Org: org, Kind: "note", Name: "n", EncName: "name", Data: "data"}
+	noErr(t, "set item", s.SetOrgItem(ctx, item))
+	wantErr(t, "set item duplicate", s.SetOrgItem(ctx, item), storage.ErrMetanameIsTaken)
+	noErr(t, "set item of another kind", s.SetOrgItem(ctx, storage.OrgItem{Org: org, Kind: "card", Name: "n", Data: "card"}))
+	wantErr(t, "set item to missing org", s.SetOrgItem(ctx, storage.OrgItem{Org: unique("org"), Kind: "note", Name: "n"}), storage.ErrDataNotFound)
+	got, err := s.GetOrgItem(ctx, org, "note", "n")
+	noErr(t, "get item", err)
+	if got != item {
+		t.Fatalf("get item: got %+v, want %+v", got, item)
+	}
+	_, err = s.GetOrgItem(ctx, org, "note", "missing")
+	wantErr(t, "get missing item", err, storage.ErrDataNotFound)
+	items, err := s.ListOrgItems(ctx, org)
+	noErr(t, "list items", err)
+	sort.Slice(items, func(i, j int) bool { return items[i].Kind < items[j].Kind })
+	wantItems := []storage.OrgItem{{Org: org, Kind: "card", Name: "n"}, {Org: org, Kind: "note", Name: "n", EncName: "name"}}
+	if !reflect.DeepEqual(items, wantItems) {
+		t.Fatalf("list items: got %+v, want %+v", items, wantItems)
+	}
+
+	item.EncName, item.Data = "new name", "new data"
+	noErr(t, "update item", s.UpdateOrgItem(ctx, item))
+	got, err = s.GetOrgItem(ctx, org, "note", "n")
+	noErr(t, "get updated item", err)
+	if got != item {
+		t.Fatalf("get updated item: got %+v, want %+v", got, item)
+	}
+	wantErr(t, "update missing item", s.UpdateOrgItem(ctx, storage.OrgItem{Org: org, Kind: "note", Name: "missing", Data: "data"}), storage.ErrDataNotFound)
+	noErr(t, "delete item", s.DeleteOrgItem(ctx, org, "card", "n"))
+	wantErr(t, "delete item again", s.DeleteOrgItem(ctx, org, "card", "n"), storage.ErrDataNotFound)
+	wantErr(t, "delete item of missing org", s.DeleteOrgItem(ctx, unique("org"), "note", "n"), storage.ErrDataNotFound)
+	_, err = s.GetOrgItem(ctx, org, "card", "n")
+	wantErr(t, "get deleted item", err, storage.ErrDataNotFound)
+
+	wantErr(t, "demote the last owner", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: owner, Role: storage.RoleAdmin, VaultKey: "sealed"}), storage.ErrLastOwner)
+	wantErr(t, "delete the last owner", s.DeleteOrgMember(ctx, org, owner), storage.ErrLastOwner)
+	noErr(t, "promote member", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: member, Role: storage.RoleOwner, VaultKey: "sealed for member"}))
+	noErr(t, "demote an owner of two", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: owner, Role: storage.RoleAdmin, VaultKey: "sealed"}))
+	wantErr(t, "delete the new last owner", s.DeleteOrgMember(ctx, org, member), storage.ErrLastOwner)
+	role, err = s.GetOrgRole(ctx, member, org)
+	noErr(t, "role of the last owner", err)
+	if role != storage.RoleOwner {
+		t.Fatalf("role of the last owner: got %q", role)
+	}
+
+	noErr(t, "delete member", s.DeleteOrgMember(ctx, org, owner))
+	wantErr(t, "delete member again", s.DeleteOrgMember(ctx, org, owner), storage.ErrDataNotFound)
+	_, err = s.GetOrgRole(ctx, owner, org)
+	wantErr(t, "role after delete", err, storage.ErrDataNotFound)
+}
+
+func testOrgRotation(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.Storage
+	owner, admin, member := register(t, b, "owner"), register(t, b, "admin"), register(t, b, "member")
+	org := unique("org")
+
+	noErr(t, "create", s.CreateOrg(ctx, owner, storage.Org{Name: org, VaultKey: "old for owner"}))
+	noErr(t, "add admin", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: admin, Role: storage.RoleAdmin, VaultKey: "old for admin"}))
+	noErr(t, "add member", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: member, Role: storage.RoleViewer, VaultKey: "old for member"}))
+	noErr(t, "set item", s.SetOrgItem(ctx, storage.OrgItem{Org: org, Kind: "note", Name: "n", Data: "old data"}))
+	noErr(t, "set item to rename", s.SetOrgItem(ctx, storage.OrgItem{Org: org, Kind: "card", Name: "old index", EncName: "old name", Data: "old data"}))
+
+	rotation := storage.OrgRotation{
+		Org:   org,
+		Login: member,
+		Members: []storage.OrgMember{
+			{Org: org, Login: owner, VaultKey: "new for owner"},
+			{Org: org, Login: admin, VaultKey: "new for admin"},
+		},
+		Items: []storage.OrgItem{
+			{Org: org, Kind: "note", Name: "n", Data: "new data"},
+			{Org: org, Kind: "card", Name: "old index", Rename: "new index", EncName: "new name", Data: "new data"},
+		},
+	}
+
+	stale := rotation
+	stale.Members = rotation.Members[:1]
+	wantErr(t, "rotate without a member", s.RotateOrgKey(ctx, stale), storage.ErrOrgChanged)
+	stale = rotation
+	stale.Items = nil
+	wantErr(t, "rotate without an item", s.RotateOrgKey(ctx, stale), storage.ErrOrgChanged)
+	stale = rotation
+	stale.Members = append(rotation.Members[:2:2], storage.OrgMember{Org: org, Login: member, VaultKey: "new for member"})
+	wantErr(t, "rotate keeping the removed member", s.RotateOrgKey(ctx, stale), storage.ErrOrgChanged)
+	_, err := s.GetOrgRole(ctx, member, org)
+	noErr(t, "member kept after failed rotation", err)
+	got, err := s.GetOrgItem(ctx, org, "note", "n")
+	noErr(t, "get item after failed rotation", err)
+	if got.Data != "old data" {
+		t.Fatalf("item after failed rotation: got %q", got.Data)
+	}
+
+	noErr(t, "rotate", s.RotateOrgKey(ctx, rotation))
+	_, err = s.GetOrgRole(ctx, member, org)
+	wantErr(t, "role of removed member", err, storage.ErrDataNotFound)
+	orgs, err := s.ListOrgs(ctx, admin)
+	noErr(t, "list orgs of admin", err)
+	if len(orgs) != 1 || orgs[0].VaultKey != "new for admin" {
+		t.Fatalf("orgs of admin: got %+v", orgs)
+	}
+	got, err = s.GetOrgItem(ctx, org, "note", "n")
+	noErr(t, "get item", err)
+	if got.Data != "new data" {
+		t.Fatalf("item after rotation: got %q", got.Data)
+	}
+	got, err = s.GetOrgItem(ctx, org, "card", "new index")
+	noErr(t, "get renamed item", err)
+	if want := (storage.OrgItem{Org: org, Kind: "card", Name: "new index", EncName: "new name", Data: "new data"}); got != want {
+		t.Fatalf("renamed item: got %+v, want %+v", got, want)
+	}
+	_, err = s.GetOrgItem(ctx, org, "card", "old index")
+	wantErr(t, "get item by the old name", err, storage.ErrDataNotFound)
+
+	wantErr(t, "rotate removed member", s.RotateOrgKey(ctx, rotation), storage.ErrDataNotFound)
+	last := storage.OrgRotation{Org: org, Login: owner, Members: rotation.Members[1:], Items: rotation.Items}
+	wantErr(t, "rotate out the last owner", s.RotateOrgKey(ctx, last), storage.ErrLastOwner)
+	missing := rotation
+	missing.Org = unique("org")
+	wantErr(t, "rotate missing org", s.RotateOrgKey(ctx, missing), storage.ErrDataNotFound)
+}
+
+func testAccounts(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	login := register(t, b, "user")
+	missing := unique("missing")
+
+	wantErr(t, "register duplicate", a.Register(ctx, login, auth.SRPVerifier{Salt: "s", Verifier: "v"}), auth.ErrUsernameIsTaken)
+	v, err := a.GetVerifier(ctx, login)
+	noErr(t, "get verifier", err)
+	if v != (auth.SRPVerifier{Salt: "salt", Verifier: "verifier"}) {
+		t.Fatalf("get verifier: got %+v", v)
+	}
+	_, err = a.GetVerifier(ctx, missing)
+	wantErr(t, "get verifier of missing user", err, auth.ErrUserNotFound)
+
+	newV := auth.SRPVerifier{Salt: "new salt", Verifier: "new verifier"}
+	noErr(t, "set verifier", a.SetVerifier(ctx, login, newV))
+	v, err = a.GetVerifier(ctx, login)
+	noErr(t, "get new verifier", err)
+	if v != newV {
+		t.Fatalf("get new verifier: got %+v", v)
+	}
+	wantErr(t, "set verifier of missing user", a.SetVerifier(ctx, missing, newV), auth.ErrUserNotFound)
+
+	wantErr(t, "password of SRP account", a.VerifyCredentials(ctx, login, "password"), auth.ErrWrongPassword)
+	wantErr(t, "password of missing user", a.VerifyCredentials(ctx, missing, "password"), auth.ErrUserNotFound)
+}
+
+func testVaultKeys(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	login := register(t, b, "user")
+
+	_, err := a.GetVaultKey(ctx, login, auth.VaultKeyPassword)
+	wantErr(t, "get missing", err, auth.ErrVaultKeyNotFound)
+	noErr(t, "set", a.SetVaultKey(ctx, login, auth.VaultKeyPassword, "wrapped"))
+	noErr(t, "set again", a.SetVaultKey(ctx, login, auth.VaultKeyPassword, "rewrapped"))
+	key, err := a.GetVaultKey(ctx, login, auth.VaultKeyPassword)
+	noErr(t, "get", err)
+	if key != "rewrapped" {
+		t.Fatalf("get: got %q", key)
+	}
+	_, err = a.GetVaultKey(ctx, login, auth.VaultKeyRecovery)
+	wantErr(t, "get of another kind", err, auth.ErrVaultKeyNotFound)
+	wantErr(t, "set for missing user", a.SetVaultKey(ctx, unique("missing"), auth.VaultKeyPassword, "wrapped"), auth.ErrUserNotFound)
+}
+
+func testRecovery(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	login := register(t, b, "user")
+	reset := auth.ResetData{
+		Login:    login,
+		Token:    "token",
+		Verifier: auth.SRPVerifier{Salt: "new salt", Verifier: "new verifier"},
+		VaultKey: "wrapped by new password",
+	}
+
+	wantErr(t, "reset without recovery", a.ResetPassword(ctx, reset), auth.ErrWrongRecoveryToken)
+	noErr(t, "set recovery verifier", a.SetRecoveryVerifier(ctx, login, "token"))
+	wantErr(t, "set recovery verifier of missing user", a.SetRecoveryVerifier(ctx, unique("missing"), "token"), auth.ErrUserNotFound)
+
+	wrong := reset
+	wrong.Token = "wrong"
+	wantErr(t, "reset with wrong token", a.ResetPassword(ctx, wrong), auth.ErrWrongRecoveryToken)
+	missing := reset
+	missing.Login = unique("missing")
+	wantErr(t, "reset of missing user", a.ResetPassword(ctx, missing), auth.ErrUserNotFound)
+
+	noErr(t, "reset", a.ResetPassword(ctx, reset))
+	v, err := a.GetVerifier(ctx, login)
+	noErr(t, "get verifier", err)
+	if v != reset.Verifier {
+		t.Fatalf("get verifier: got %+v", v)
+	}
+	key, err := a.GetVaultKey(ctx, login, auth.VaultKeyPassword)
+	noErr(t, "get vault key", err)
+	if key != reset.VaultKey {
+		t.Fatalf("get vault key: got %q", key)
+	}
+}
+
+func testTOTP(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	login := register(t, b, "user")
+
+	_, _, err := a.GetTOTP(ctx, login)
+	wantErr(t, "get before set", err, auth.ErrTOTPNotEnabled)
+	wantErr(t, "enable before set", a.EnableTOTP(ctx, login, nil), auth.ErrTOTPNotEnabled)
+	wantErr(t, "set for missing user", a.SetTOTP(ctx, unique("missing"), "secret"), auth.ErrUserNotFound)
+
+	noErr(t, "set", a.SetTOTP(ctx, login, "secret"))
+	secret, enabled, err := a.GetTOTP(ctx, login)
+	noErr(t, "get", err)
+	if secret != "secret" || enabled {
+		t.Fatalf("get: got %q, %v", secret, enabled)
+	}
+
+	noErr(t, "enable", a.EnableTOTP(ctx, login, []string{"code1", "code2"}))
+	_, enabled, err = a.GetTOTP(ctx, login)
+	noErr(t, "get enabled", err)
+	if !enabled {
+		t.Fatal("get enabled: not enabled")
+	}
+	noErr(t, "use backup code", a.UseBackupCode(ctx, login, "code1"))
+	wantErr(t, "use backup code again", a.UseBackupCode(ctx, login, "code1"), auth.ErrWrongSecondFactor)
+	wantErr(t, "use wrong backup code", a.UseBackupCode(ctx, login, "wrong"), auth.ErrWrongSecondFactor)
+
+	noErr(t, "set new secret", a.SetTOTP(ctx, login, "new secret"))
+	secret, enabled, err = a.GetTOTP(ctx, login)
+	noErr(t, "get new secret", err)
+	if secret != "new secret" || enabled {
+		t.Fatalf("get new secret: got %q, %v", secret, enabled)
+	}
+
+	noErr(t, "disable", a.DisableTOTP(ctx, login))
+	_, _, err = a.GetTOTP(ctx, login)
+	wantErr(t, "get after disable", err, auth.ErrTOTPNotEnabled)
+	wantErr(t, "use backup code after disable", a.UseBackupCode(ctx, login, "code2"), auth.ErrWrongSecondFactor)
+}
+
+func testSessions(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	login := register(t, b, "user")
+	session := auth.Session{ID: unique("session"), Login: login, RefreshHash: "hash", ExpiresAt: now().Add(time.Hour), DeviceID: "device"}
+
+	wantErr(t, "create for missing user", a.CreateSession(ctx, auth.Session{ID: unique("session"), Login: unique("missing"), ExpiresAt: now()}), auth.ErrUserNotFound)
+	_, err := a.GetSession(ctx, session.ID)
+	wantErr(t, "get missing", err, auth.ErrSessionNotFound)
+
+	noErr(t, "create", a.CreateSession(ctx, session))
+	got, err := a.GetSession(ctx, session.ID)
+	noErr(t, "get", err)
+	sameTime(t, "get", got.ExpiresAt, session.ExpiresAt)
+	got.ExpiresAt = session.ExpiresAt
+	if got != session {
+		t.Fatalf("get: got %+v, want %+v", got, session)
+	}
+
+	expires := now().Add(2 * time.Hour)
+	wantErr(t, "rotate with wrong hash", a.RotateRefreshToken(ctx, session.ID, "wrong", "new hash", expires), auth.ErrWrongRefreshToken)
+	noErr(t, "rotate", a.RotateRefreshToken(ctx, session.ID, "hash", "new hash", expires))
+	got, err = a.GetSession(ctx, session.ID)
+	noErr(t, "get rotated", err)
+	if got.RefreshHash != "new hash" {
+		t.Fatalf("get rotated: got hash %q", got.RefreshHash)
+	}
+	sameTime(t, "get rotated", got.ExpiresAt, expires)
+
+	noErr(t, "revoke", a.RevokeSession(ctx, session.ID))
+	noErr(t, "revoke missing", a.RevokeSession(ctx, unique("session")))
+	got, err = a.GetSession(ctx, session.ID)
+	noErr(t, "get revoked", err)
+	if !got.Revoked {
+		t.Fatal("get revoked: not revoked")
+	}
+	wantErr(t, "rotate revoked", a.RotateRefreshToken(ctx, session.ID, "new hash", "newer hash", expires), auth.ErrWrongRefreshToken)
+
+	other := auth.Session{ID: unique("session"), Login: login, RefreshHash: "hash", ExpiresAt: expires}
+	noErr(t, "create without device", a.CreateSession(ctx, other))
+	noErr(t, "revoke all", a.RevokeAllSessions(ctx, login))
+	got, err = a.GetSession(ctx, other.ID)
+	noErr(t, "get after revoke all", err)
+	if !got.Revoked || got.DeviceID != "" {
+		t.Fatalf("get after revoke all: got %+v", got)
+	}
+}
+
+func testLoginFailures(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	login := unique("user")
+	start := now()
+
+	f, err := a.GetLoginFailures(ctx, login)
+	noErr(t, "get none", err)
+	if f.Count != 0 || !f.LastFailure.IsZero() || !f.LockedUntil.IsZero() {
+		t.Fatalf("get none: got %+v", f)
+	}
+
+	var added auth.LoginFailures
+	for i := 0; i < 2; i++ {
+		added, err = a.AddLoginFailure(ctx, login, start.Add(time.Duration(i)*time.Second))
+		noErr(t, "add", err)
+	}
+	if added.Count != 2 || !added.LockedUntil.IsZero() {
+		t.Fatalf("add: got %+v", added)
+	}
+	f, err = a.GetLoginFailures(ctx, login)
+	noErr(t, "get", err)
+	if f.Count != 2 {
+		t.Fatalf("get: got %+v", f)
+	}
+	sameTime(t, "get last failure", f.LastFailure, added.LastFailure)
+
+	for i := 2; i < auth.MaxLoginFailures; i++ {
+		added, err = a.AddLoginFailure(ctx, login, start.Add(time.Duration(i)*time.Second))
+		noErr(t, "add until locked", err)
+	}
+	if added.LockedUntil.IsZero() {
+		t.Fatalf("add until locked: got %+v", added)
+	}
+	f, err = a.GetLoginFailures(ctx, login)
+	noErr(t, "get locked", err)
+	if f.Count != added.Count {
+		t.Fatalf("get locked: got %+v, want %+v", f, added)
+	}
+	sameTime(t, "get locked until", f.LockedUntil, added.LockedUntil)
+
+	noErr(t, "reset", a.ResetLoginFailures(ctx, login))
+	f, err = a.GetLoginFailures(ctx, login)
+	noErr(t, "get after reset", err)
+	if f.Count != 0 {
+		t.Fatalf("get after reset: got %+v", f)
+	}
+}
+
+func testCertificates(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	user, other := register(t, b, "user"), register(t, b, "other")
+	cert1, cert2 := unique("cert1"), unique("cert2")
+
+	wantErr(t, "bind to missing user", a.BindCertificate(ctx, unique("missing"), cert1), auth.ErrUserNotFound)
+	noErr(t, "bind", a.BindCertificate(ctx, user, cert1))
+	noErr(t, "bind again", a.BindCertificate(ctx, user, cert1))
+	noErr(t, "bind second", a.BindCertificate(ctx, user, cert2))
+	wantErr(t, "bind to other user", a.BindCertificate(ctx, other, cert1), auth.ErrCertificateIsTaken)
+
+	login, err := a.GetCertificateLogin(ctx, cert1)
+	noErr(t, "get login", err)
+	if login != user {
+		t.Fatalf("get login: got %q", login)
+	}
+	_, err = a.GetCertificateLogin(ctx, unique("cert"))
+	wantErr(t, "get login of missing", err, auth.ErrCertificateNotFound)
+
+	certs, err := a.ListCertificates(ctx, user)
+	noErr(t, "list", err)
+	sameStrings(t, "list", certs, []string{cert1, cert2})
+	certs, err = a.ListCertificates(ctx, other)
+	noErr(t, "list of other user", err)
+	sameStrings(t, "list of other user", certs, nil)
+}
+
+func testAPIKeys(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	user, other := register(t, b, "user"), register(t, b, "other")
+	created := now()
+	key := auth.APIKey{
+		ID:        unique("key"),
+		Login:     user,
+		Name:      "backup",
+		Hash:      "hash",
+		Scope:     auth.APIKeyScope{ReadOnly: true, Kinds: []string{"note"}},
+		CreatedAt: created,
+		ExpiresAt: created.Add(time.Hour),
+	}
+	older := auth.APIKey{ID: unique("key"), Login: user, Name: "older", Hash: "hash", CreatedAt: created.Add(-time.Hour)}
+
+	missing := key
+	missing.ID, missing.Login = unique("key"), unique("missing")
+	wantErr(t, "create for missing user", a.CreateAPIKey(ctx, missing), auth.ErrUserNotFound)
+	noErr(t, "create", a.CreateAPIKey(ctx, key))
+	noErr(t, "create older", a.CreateAPIKey(ctx, older))
+
+	got, err := a.GetAPIKey(ctx, key.ID)
+	noErr(t, "get", err)
+	sameTime(t, "get created", got.CreatedAt, key.CreatedAt)
+	sameTime(t, "get expires", got.ExpiresAt, key.ExpiresAt)
+	if got.ID != key.ID || got.Login != key.Login || got.Name != key.Name || got.Hash != key.Hash ||
+		!reflect.DeepEqual(got.Scope, key.Scope) || !got.LastUsedAt.IsZero() {
+		t.Fatalf("get: got %+v, want %+v", got, key)
+	}
+	_, err = a.GetAPIKey(ctx, unique("key"))
+	wantErr(t, "get missing", err, auth.ErrAPIKeyNotFound)
+
+	keys, err := a.ListAPIKeys(ctx, user)
+	noErr(t, "list", err)
+	if len(keys) != 2 || keys[0].ID != older.ID || keys[1].ID != key.ID {
+		t.Fatalf("list: got %+v", keys)
+	}
+
+	used := now()
+	noErr(t, "touch", a.TouchAPIKey(ctx, key.ID, used))
+	noErr(t, "touch missing", a.TouchAPIKey(ctx, unique("key"), used))
+	got, err = a.GetAPIKey(ctx, key.ID)
+	noErr(t, "get touched", err)
+	sameTime(t, "get touched", got.LastUsedAt, used)
+
+	wantErr(t, "revoke by other user", a.RevokeAPIKey(ctx, other, key.ID), auth.ErrAPIKeyNotFound)
+	noErr(t, "revoke", a.RevokeAPIKey(ctx, user, key.ID))
+	wantErr(t, "revoke again", a.RevokeAPIKey(ctx, user, key.ID), auth.ErrAPIKeyNotFound)
+	_, err = a.GetAPIKey(ctx, key.ID)
+	wantErr(t, "get revoked", err, auth.ErrAPIKeyNotFound)
+}
+
+func testDevices(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	login := register(t, b, "user")
+	first := now()
+	laptop := auth.Device{ID: "laptop", Name: "Laptop", Version: "1.0", IP: "10.0.0.1", LastSeen: first}
+	phone := auth.Device{ID: "phone", Name: "Phone", Version: "1.0", IP: "10.0.0.2", LastSeen: first.Add(time.Minute)}
+
+	wantErr(t, "save for missing user", a.SaveDevice(ctx, unique("missing"), laptop), auth.ErrUserNotFound)
+	noErr(t, "save", a.SaveDevice(ctx, login, laptop))
+	noErr(t, "save second", a.SaveDevice(ctx, login, phone))
+	devices, err := a.ListDevices(ctx, login)
+	noErr(t, "list", err)
+	if len(devices) != 2 || devices[0].ID != "phone" || devices[1].ID != "laptop" {
+		t.Fatalf("list: got %+v", devices)
+	}
+	sameTime(t, "list first seen", devices[1].FirstSeen, first)
+
+	again := laptop
+	again.Version, again.LastSeen = "1.1", first.Add(2*time.Minute)
+	noErr(t, "save again", a.SaveDevice(ctx, login, again))
+	devices, err = a.ListDevices(ctx, login)
+	noErr(t, "list after save again", err)
+	if len(devices) != 2 || devices[0].ID != "laptop" || devices[0].Version != "1.1" {
+		t.Fatalf("list after save again: got %+v", devices)
+	}
+	sameTime(t, "first seen after save again", devices[0].FirstSeen, first)
+	sameTime(t, "last seen after save again", devices[0].LastSeen, again.LastSeen)
+
+	seen := first.Add(3 * time.Minute)
+	noErr(t, "touch", a.TouchDevice(ctx, login, "phone", "10.0.0.3", seen))
+	noErr(t, "touch missing", a.TouchDevice(ctx, login, "missing", "10.0.0.3", seen))
+	devices, err = a.ListDevices(ctx, login)
+	noErr(t, "list after touch", err)
+	if devices[0].ID != "phone" || devices[0].IP != "10.0.0.3" {
+		t.Fatalf("list after touch: got %+v", devices)
+	}
+	sameTime(t, "last seen after touch", devices[0].LastSeen, seen)
+
+	session := auth.Session{ID: unique("session"), Login: login, RefreshHash: "hash", ExpiresAt: first.Add(time.Hour), DeviceID: "laptop"}
+	noErr(t, "create session", a.CreateSession(ctx, session))
+	wantErr(t, "revoke missing", a.RevokeDevice(ctx, login, "missing"), auth.ErrDeviceNotFound)
+	noErr(t, "revoke", a.RevokeDevice(ctx, login, "laptop"))
+	got, err := a.GetSession(ctx, session.ID)
+	noErr(t, "get session of revoked device", err)
+	if !got.Revoked {
+		t.Fatal("session of revoked device is not revoked")
+	}
+	devices, err = a.ListDevices(ctx, login)
+	noErr(t, "list after revoke", err)
+	for _, d := range devices {
+		if d.Revoked != (d.ID == "laptop") {
+			t.Fatalf("list after revoke: got %+v", devices)
+		}
+	}
+
+	wantErr(t, "save revoked", a.SaveDevice(ctx, login, laptop), auth.ErrDeviceRevoked)
+	devices, err = a.ListDevices(ctx, login)
+	noErr(t, "list after save revoked", err)
+	for _, d := range devices {
+		if d.Revoked != (d.ID == "laptop") {
+			t.Fatalf("list after save revoked: got %+v", devices)
+		}
+	}
+}
+
+func newLoginKey(t *testing.T, login string) auth.LoginKey {
+	t.Helper()
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	noErr(t, "generate key", err)
+	key, err := auth.NewLoginKey(login, "laptop", base64.StdEncoding.EncodeToString(public), "laptop")
+	if err != nil {
+		t.Fatalf("NewLoginKey: %v", err)
+	}
+	key.CreatedAt = now()
+	return key
+}
+
+func testLoginKeys(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a := b.Auth
+	user, other := register(t, b, "user"), register(t, b, "other")
+	key := newLoginKey(t, user)
+	older := newLoginKey(t, user)
+	older.CreatedAt = key.CreatedAt.Add(-time.Hour)
+
+	wantErr(t, "add for missing user", a.AddLoginKey(ctx, unique("missing"), newLoginKey(t, user)), auth.ErrUserNotFound)
+	noErr(t, "add", a.AddLoginKey(ctx, user, key))
+	noErr(t, "add older", a.AddLoginKey(ctx, user, older))
+	wantErr(t, "add again", a.AddLoginKey(ctx, user, key), auth.ErrLoginKeyIsTaken)
+	wantErr(t, "add to other user", a.AddLoginKey(ctx, other, key), auth.ErrLoginKeyIsTaken)
+
+	got, err := a.GetLoginKey(ctx, user, key.ID)
+	noErr(t, "get", err)
+	sameTime(t, "get created", got.CreatedAt, key.CreatedAt)
+	if got.ID != key.ID || got.Login != user || got.Name != key.Name || got.PublicKey != key.PublicKey || got.DeviceID != "laptop" || !got.LastUsedAt.IsZero() {
+		t.Fatalf("get: got %+v, want %+v", got, key)
+	}
+	_, err = a.GetLoginKey(ctx, other, key.ID)
+	wantErr(t, "get by other user", err, auth.ErrLoginKeyNotFound)
+
+	keys, err := a.ListLoginKeys(ctx, user)
+	noErr(t, "list", err)
+	if len(keys) != 2 || keys[0].ID != older.ID || keys[1].ID != key.ID {
+		t.Fatalf("list: got %+v", keys)
+	}
+
+	used := now()
+	noErr(t, "touch", a.TouchLoginKey(ctx, key.ID, used))
+	noErr(t, "touch missing", a.TouchLoginKey(ctx, unique("key"), used))
+	got, err = a.GetLoginKey(ctx, user, key.ID)
+	noErr(t, "get touched", err)
+	sameTime(t, "get touched", got.LastUsedAt, used)
+
+	wantErr(t, "delete by other user", a.DeleteLoginKey(ctx, other, key.ID), auth.ErrLoginKeyNotFound)
+	noErr(t, "delete", a.DeleteLoginKey(ctx, user, key.ID))
+	wantErr(t, "delete again", a.DeleteLoginKey(ctx, user, key.ID), auth.ErrLoginKeyNotFound)
+
+	phoneKey := newLoginKey(t, user)
+	phoneKey.DeviceID = "phone"
+	otherKey := newLoginKey(t, other)
+	noErr(t, "add key of phone", a.AddLoginKey(ctx, user, phoneKey))
+	noErr(t, "add key of other user", a.AddLoginKey(ctx, other, otherKey))
+	noErr(t, "save device", a.SaveDevice(ctx, user, auth.Device{ID: "laptop", LastSeen: now()}))
+	noErr(t, "save device of other user", a.SaveDevice(ctx, other, auth.Device{ID: "laptop", LastSeen: now()}))
+	noErr(t, "revoke device", a.RevokeDevice(ctx, user, "laptop"))
+	_, err = a.GetLoginKey(ctx, user, older.ID)
+	wantErr(t, "get key of revoked device", err, auth.ErrLoginKeyNotFound)
+	_, err = a.GetLoginKey(ctx, user, phoneKey.ID)
+	noErr(t, "get key of another device", err)
+	_, err = a.GetLoginKey(ctx, other, otherKey.ID)
+	noErr(t, "get key of other user", err)
+}
+
+func testChangeUsername(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a, s := b.Auth, b.Storage
+	login, taken, recipient := register(t, b, "user"), register(t, b, "taken"), register(t, b, "recipient")
+	newLogin := unique("renamed")
+	org := unique("org")
+
+	noErr(t, "set vault key", a.SetVaultKey(ctx, login, auth.VaultKeyRecovery, "recovery"))
+	session := auth.Session{ID: unique("session"), Login: login, RefreshHash: "hash", ExpiresAt: now().Add(time.Hour)}
+	noErr(t, "create session", a.CreateSession(ctx, session))
+	noErr(t, "set note", s.SetNote(ctx, login, storage.EncryptedData{Name: "n", Data: "data"}))
+	noErr(t, "set share", s.SetShare(ctx, login, storage.Share{Recipient: recipient, Kind: "note", Name: "n", Data: "data", Key: "key"}))
+	noErr(t, "create org", s.CreateOrg(ctx, login, storage.Org{Name: org, VaultKey: "sealed"}))
+
+	// failures counted against the unused name don't lock the renamed account
+	for i := 0; i < auth.MaxLoginFailures; i++ {
+		_, err := a.AddLoginFailure(ctx, newLogin, now())
+		noErr(t, "add login failure of new login", err)
+	}
+
+	wantErr(t, "rename to taken", changeUsername(b, login, taken, "wrapped"), auth.ErrUsernameIsTaken)
+	wantErr(t, "rename missing", changeUsername(b, unique("missing"), unique("renamed"), "wrapped"), auth.ErrUserNotFound)
+	noErr(t, "rename", changeUsername(b, login, newLogin, "wrapped"))
+
+	failures, err := a.GetLoginFailures(ctx, newLogin)
+	noErr(t, "get login failures of new login", err)
+	if failures.Count != 0 || !failures.LockedUntil.IsZero() {
+		t.Fatalf("get login failures of new login: got %+v", failures)
+	}
+
+	_, err = a.GetVerifier(ctx, login)
+	wantErr(t, "get verifier of old login", err, auth.ErrUserNotFound)
+	_, err = a.GetVerifier(ctx, newLogin)
+	noErr(t, "get verifier of new login", err)
+	key, err := a.GetVaultKey(ctx, newLogin, auth.VaultKeyPassword)
+	noErr(t, "get password vault key", err)
+	if key != "wrapped" {
+		t.Fatalf("get password vault key: got %q", key)
+	}
+	key, err = a.GetVaultKey(ctx, newLogin, auth.VaultKeyRecovery)
+	noErr(t, "get recovery vault key", err)
+	if key != "recovery" {
+		t.Fatalf("get recovery vault key: got %q", key)
+	}
+	got, err := a.GetSession(ctx, session.ID)
+	noErr(t, "get session", err)
+	if got.Login != newLogin {
+		t.Fatalf("get session: got login %q", got.Login)
+	}
+
+	_, err = s.GetNote(ctx, newLogin, "n")
+	noErr(t, "get note of new login", err)
+	changes, err := s.ListChanges(ctx, newLogin, 0, 10)
+	noErr(t, "list changes of new login", err)
+	if changes.Revision != 1 || len(changes.Changes) != 1 {
+		t.Fatalf("list changes of new login: got %+v", changes)
+	}
+	_, err = s.GetNote(ctx, login, "n")
+	wantErr(t, "get note of old login", err, storage.ErrDataNotFound)
+	received, err := s.ListSharesReceived(ctx, recipient)
+	noErr(t, "list received", err)
+	if len(received) != 1 || received[0].Owner != newLogin {
+		t.Fatalf("list received: got %+v", received)
+	}
+	role, err := s.GetOrgRole(ctx, newLogin, org)
+	noErr(t, "get org role", err)
+	if role != storage.RoleOwner {
+		t.Fatalf("get org role: got %q", role)
+	}
+
+	// the old name is free for new accounts
+	noErr(t, "register old login", a.Register(ctx, login, auth.SRPVerifier{Salt: "salt", Verifier: "verifier"}))
+	_, err = s.GetNote(ctx, login, "n")
+	wantErr(t, "get note of new account with old login", err, storage.ErrDataNotFound)
+	changes, err = s.ListChanges(ctx, login, 0, 10)
+	noErr(t, "list changes of new account with old login", err)
+	if changes.Revision != 0 || len(changes.Changes) != 0 {
+		t.Fatalf("list changes of new account with old login: got %+v", changes)
+	}
+}
+
+func testDeleteAccount(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a, s := b.Auth, b.Storage
+	login, recipient := register(t, b, "user"), register(t, b, "recipient")
+	org := unique("org")
+
+	noErr(t, "set note", s.SetNote(ctx, login, storage.EncryptedData{Name: "n", Data: "data"}))
+	noErr(t, "set share", s.SetShare(ctx, login, storage.Share{Recipient: recipient, Kind: "note", Name: "n", Data: "data", Key: "key"}))
+	noErr(t, "create org", s.CreateOrg(ctx, recipient, storage.Org{Name: org, VaultKey: "sealed"}))
+	noErr(t, "add member", s.SetOrgMember(ctx, storage.OrgMember{Org: org, Login: login, Role: storage.RoleViewer, VaultKey: "sealed"}))
+	session := auth.Session{ID: unique("session"), Login: login, RefreshHash: "hash", ExpiresAt: now().Add(time.Hour)}
+	noErr(t, "create session", a.CreateSession(ctx, session))
+
+	noErr(t, "delete", deleteAccount(b, login))
+	_, err := a.GetVerifier(ctx, login)
+	wantErr(t, "get verifier", err, auth.ErrUserNotFound)
+	_, err = a.GetSession(ctx, session.ID)
+	wantErr(t, "get session", err, auth.ErrSessionNotFound)
+	received, err := s.ListSharesReceived(ctx, recipient)
+	noErr(t, "list received", err)
+	if len(received) != 0 {
+		t.Fatalf("list received: got %+v", received)
+	}
+	members, err := s.ListOrgMembers(ctx, org)
+	noErr(t, "list members", err)
+	if len(members) != 1 || members[0].Login != recipient {
+		t.Fatalf("list members: got %+v", members)
+	}
+
+	noErr(t, "register again", a.Register(ctx, login, auth.SRPVerifier{Salt: "salt", Verifier: "verifier"}))
+	_, err = s.GetNote(ctx, login, "n")
+	wantErr(t, "get note of new account", err, storage.ErrDataNotFound)
+}
@@ -98,3 +98,25 @@ func CreateConfigTLS(certFile string, privatekeyFile string) (*tls.Config, error
 	}
 	return tlsconfig, nil
 }
+
+// ClientAuthConfig creates TLS config of a server verifying client certificates with the CA from the file.
+// With require set, connections without a valid client certificate are refused
+func ClientAuthConfig(caFile string, require bool) (*tls.Config, error) {
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", caFile)
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if require {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: clientAuth,
+	}, nil
+}